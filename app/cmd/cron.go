@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"payment-gateway/pkg/constants"
+	"payment-gateway/internal/health"
+	"payment-gateway/pkg/utils"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
@@ -12,19 +15,64 @@ func InitCron() *cron.Cron {
 	c := cron.New()
 	ctx := context.Background()
 
-	// Schedule a job to check gateway health status every 30 seconds
-	_, err := c.AddFunc("@every 30s", func() {
-		// log.Println("Cron Job: Checking gateway health status...")
+	// Probe the health endpoint of every gateway
+	probeInterval := health.ProbeSettingsFromEnv().Interval
+	_, err := c.AddFunc(fmt.Sprintf("@every %s", probeInterval), func() {
+		if err := HealthProber.RunOnce(ctx); err != nil {
+			log.Printf("Cron Job: failed to probe gateway health: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to schedule cron job: %v", err)
+	}
 
-		// 1. fetch all active gatewayID
-		gatewayIDs := []int{1, 2, 3}
+	// Score every gateway by the outcomes of its live transactions
+	scoreInterval := health.ScoreSettingsFromEnv().Interval
+	_, err = c.AddFunc(fmt.Sprintf("@every %s", scoreInterval), func() {
+		if err := HealthScorer.RunOnce(ctx); err != nil {
+			log.Printf("Cron Job: failed to score gateway traffic: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to schedule cron job: %v", err)
+	}
 
-		// 2. check if external gateway is reachable and ready to accept traffic (e.g via API)
+	// Remove idempotency keys whose retention period has passed
+	_, err = c.AddFunc("@every 1h", func() {
+		deleted, err := TransactionService.DeleteExpiredIdempotencyKeys(ctx)
+		if err != nil {
+			log.Printf("Cron Job: failed to delete expired idempotency keys: %v", err)
+			return
+		}
+		log.Printf("Cron Job: deleted %d expired idempotency keys", deleted)
+	})
+	if err != nil {
+		log.Fatalf("Failed to schedule cron job: %v", err)
+	}
+
+	// Remove outbox messages that were published longer ago than the retention period
+	outboxRetention := utils.GetEnvDuration("OUTBOX_SENT_RETENTION", 7*24*time.Hour)
+	_, err = c.AddFunc("@every 1h", func() {
+		deleted, err := OutboxRepo.DeleteSentMessages(ctx, time.Now().Add(-outboxRetention))
+		if err != nil {
+			log.Printf("Cron Job: failed to delete sent outbox messages: %v", err)
+			return
+		}
+		log.Printf("Cron Job: deleted %d sent outbox messages", deleted)
+	})
+	if err != nil {
+		log.Fatalf("Failed to schedule cron job: %v", err)
+	}
 
-		// 3. update the status accordingly (HEALTHY/UNHEALTHY)
-		for _, v := range gatewayIDs {
-			GatewayService.UpdateGatewayHealthStatusByID(ctx, v, constants.HEALTHY)
+	// Remove health probe results older than the retention period. Status changes are kept for the uptime.
+	probeEventRetention := utils.GetEnvDuration("HEALTH_PROBE_EVENT_RETENTION", 7*24*time.Hour)
+	_, err = c.AddFunc("@every 1h", func() {
+		deleted, err := GatewayRepo.DeleteProbeEvents(ctx, time.Now().Add(-probeEventRetention))
+		if err != nil {
+			log.Printf("Cron Job: failed to delete old health probe events: %v", err)
+			return
 		}
+		log.Printf("Cron Job: deleted %d old health probe events", deleted)
 	})
 	if err != nil {
 		log.Fatalf("Failed to schedule cron job: %v", err)
@@ -32,7 +80,7 @@ func InitCron() *cron.Cron {
 
 	c.Start()
 
-	log.Println("Cron scheduler initialized successfully (every 30 seconds)")
+	log.Printf("Cron scheduler initialized successfully (probing gateways every %s, scoring their traffic every %s)", probeInterval, scoreInterval)
 
 	return c
 }
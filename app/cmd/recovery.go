@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"payment-gateway/internal/kafka"
+	"payment-gateway/internal/recovery"
+	"payment-gateway/models"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// replayTimeout bounds a replay, at the default rate it is enough for hundreds of thousands of transactions
+const replayTimeout = 24 * time.Hour
+
+var (
+	dlqLimit           int
+	replaySettings     recovery.Settings
+	replayPositions    []string
+	replayReferenceIDs []string
+	replayAll          bool
+	replayStatus       string
+	replayCreatedFrom  string
+	replayCreatedTo    string
+)
+
+var dlqCommand = &cobra.Command{
+	Use:   "dlq",
+	Short: "Inspect the dead-letter topic",
+}
+
+var dlqListCommand = &cobra.Command{
+	Use:    "list",
+	Short:  "List the messages on the dead-letter topic",
+	PreRun: loadTopics,
+	Run:    listDeadLetters,
+}
+
+var dlqInspectCommand = &cobra.Command{
+	Use:    "inspect <partition:offset>",
+	Short:  "Show a dead-letter message with its headers",
+	Args:   cobra.ExactArgs(1),
+	PreRun: loadTopics,
+	Run:    inspectDeadLetter,
+}
+
+var replayCommand = &cobra.Command{
+	Use:   "replay",
+	Short: "Publish transactions to the transaction topic again",
+}
+
+var replayDLQCommand = &cobra.Command{
+	Use:    "dlq",
+	Short:  "Replay the transactions of dead-letter messages",
+	PreRun: initReplay,
+	Run:    replayDeadLetters,
+}
+
+var replayDBCommand = &cobra.Command{
+	Use:    "transactions",
+	Short:  "Replay transactions selected by status, creation time or reference ID",
+	PreRun: initReplay,
+	Run:    replayTransactions,
+}
+
+func init() {
+	dlqCommand.PersistentFlags().IntVar(&dlqLimit, "limit", 1000, "maximum number of dead-letter messages read")
+	dlqCommand.AddCommand(dlqListCommand, dlqInspectCommand)
+
+	replayFlags := replayCommand.PersistentFlags()
+	replayFlags.BoolVar(&replaySettings.DryRun, "dry-run", false, "only report what would be replayed")
+	replayFlags.Float64Var(&replaySettings.Rate, "rate", 10, "transactions replayed per second, 0 for no limit")
+	replayFlags.StringSliceVar(&replayReferenceIDs, "reference-id", nil, "reference IDs of the transactions to replay")
+
+	replayDLQCommand.Flags().StringSliceVar(&replayPositions, "message", nil, "dead-letter messages to replay, as partition:offset")
+	replayDLQCommand.Flags().BoolVar(&replayAll, "all", false, "replay every dead-letter message")
+	replayDLQCommand.Flags().IntVar(&dlqLimit, "limit", 1000, "maximum number of dead-letter messages read")
+
+	replayDBCommand.Flags().StringVar(&replayStatus, "status", "", "status of the transactions to replay (pending or retry)")
+	replayDBCommand.Flags().StringVar(&replayCreatedFrom, "from", "", "replay transactions created at or after this time (RFC 3339)")
+	replayDBCommand.Flags().StringVar(&replayCreatedTo, "to", "", "replay transactions created before this time (RFC 3339)")
+
+	replayCommand.AddCommand(replayDLQCommand, replayDBCommand)
+	rootCmd.AddCommand(dlqCommand, replayCommand)
+}
+
+func loadTopics(cmd *cobra.Command, args []string) {
+	kafka.LoadTopics()
+}
+
+func initReplay(cmd *cobra.Command, args []string) {
+	initApp()
+}
+
+func listDeadLetters(cmd *cobra.Command, args []string) {
+	reader := kafka.NewDeadLetterReader()
+	defer reader.Close()
+
+	messages, err := reader.ReadDeadLetters(dlqLimit)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", kafka.DeadLetterKafkaTopic, err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POSITION\tFAILED AT\tORIGINAL TOPIC\tATTEMPT\tREFERENCE ID\tERROR")
+	for _, message := range messages {
+		fmt.Fprintf(w, "%d:%d\t%s\t%s\t%s\t%s\t%s\n",
+			message.Partition,
+			message.Offset,
+			message.Headers[kafka.HeaderFailedAt],
+			message.Headers[kafka.HeaderOriginalTopic],
+			message.Headers[kafka.HeaderAttempt],
+			recovery.DeadLetterReferenceID(message),
+			message.Headers[kafka.HeaderError],
+		)
+	}
+	w.Flush()
+
+	log.Printf("%d message(s) on %s", len(messages), kafka.DeadLetterKafkaTopic)
+}
+
+func inspectDeadLetter(cmd *cobra.Command, args []string) {
+	position, err := recovery.ParseDeadLetterPosition(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	reader := kafka.NewDeadLetterReader()
+	defer reader.Close()
+
+	message, err := reader.ReadDeadLetter(position.Partition, position.Offset)
+	if err != nil {
+		log.Fatalf("Failed to read %s at %s: %v", kafka.DeadLetterKafkaTopic, args[0], err)
+	}
+
+	output, err := json.MarshalIndent(message, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to format message: %v", err)
+	}
+	fmt.Println(string(output))
+}
+
+func replayDeadLetters(cmd *cobra.Command, args []string) {
+	if !replayAll && len(replayPositions) == 0 && len(replayReferenceIDs) == 0 {
+		log.Fatal("select the messages to replay with --message, --reference-id or --all")
+	}
+
+	var positions []recovery.DeadLetterPosition
+	for _, value := range replayPositions {
+		position, err := recovery.ParseDeadLetterPosition(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		positions = append(positions, position)
+	}
+
+	reader := kafka.NewDeadLetterReader()
+	defer reader.Close()
+
+	messages, err := reader.ReadDeadLetters(dlqLimit)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", kafka.DeadLetterKafkaTopic, err)
+	}
+	if !replayAll {
+		messages = recovery.SelectDeadLetters(messages, positions, replayReferenceIDs)
+	}
+
+	ctx, cancel := replayContext()
+	defer cancel()
+
+	result, err := newReplayer().ReplayDeadLetters(ctx, messages)
+	reportReplay(result, err)
+}
+
+func replayTransactions(cmd *cobra.Command, args []string) {
+	selection := recovery.TransactionSelection{
+		Status:       replayStatus,
+		CreatedFrom:  parseReplayTime("from", replayCreatedFrom),
+		CreatedTo:    parseReplayTime("to", replayCreatedTo),
+		ReferenceIDs: replayReferenceIDs,
+	}
+
+	ctx, cancel := replayContext()
+	defer cancel()
+
+	result, err := newReplayer().ReplayTransactions(ctx, selection)
+	reportReplay(result, err)
+}
+
+func newReplayer() *recovery.Replayer {
+	return recovery.NewReplayer(TransactionRepository, ProcessedMessageRepo, KafkaProducer, replaySettings)
+}
+
+// replayContext stops a replay on SIGINT or SIGTERM, transactions already replayed stay replayed
+func replayContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func parseReplayTime(flag, value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("--%s must be an RFC 3339 time: %v", flag, err)
+	}
+	return &parsed
+}
+
+func reportReplay(result models.ReplayResult, err error) {
+	mode := "replayed"
+	if replaySettings.DryRun {
+		mode = "would be replayed"
+	}
+	log.Printf("Selected %d, %s %d, skipped %d", result.Selected, mode, result.Replayed, result.Skipped)
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Fatal("Replay interrupted")
+		}
+		log.Fatalf("Replay failed: %v", err)
+	}
+}
@@ -24,7 +24,11 @@ const (
 var restCommand = &cobra.Command{
 	Use:   "rest",
 	Short: "Start REST server",
-	Run:   restServer,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		initApp()
+		initConsumer()
+	},
+	Run: restServer,
 }
 
 func init() {
@@ -48,11 +52,20 @@ func restServer(cmd *cobra.Command, args []string) {
 	//Run cron in the same process as web server
 	InitCron()
 
+	// Publish stored transactions to Kafka, requeue retries, poll gateways and expire stale transactions
+	// from the same process as well
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go OutboxRelay.Run(workersCtx)
+	go RetryScheduler.Run(workersCtx)
+	go StatusPoller.Run(workersCtx)
+	go ExpirySweeper.Run(workersCtx)
+
 	registerControllers(e, timeoutCtx)
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, rest.HeaderIdempotencyKey},
 	}))
 
 	srvAddress := os.Getenv("SERVER_ADDRESS")
@@ -72,6 +85,7 @@ func restServer(cmd *cobra.Command, args []string) {
 
 	<-stop
 	log.Printf("Shutting down server...\n")
+	stopWorkers()
 
 	// Create a shutdown context with timeout
 	gracefulCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
@@ -87,4 +101,6 @@ func restServer(cmd *cobra.Command, args []string) {
 
 func registerControllers(e *echo.Echo, timeoutCtx time.Duration) {
 	rest.InstallTransactionController(e, TransactionService, timeoutCtx)
+	rest.InstallOutboxController(e, OutboxRelay, timeoutCtx)
+	rest.InstallGatewayController(e, GatewayService, timeoutCtx)
 }
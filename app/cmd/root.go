@@ -4,22 +4,41 @@ import (
 	"log"
 	"payment-gateway/database"
 	"payment-gateway/internal/client"
+	"payment-gateway/internal/health"
 	"payment-gateway/internal/kafka"
+	"payment-gateway/internal/outbox"
 	"payment-gateway/internal/repositories"
+	"payment-gateway/internal/scheduler"
 	"payment-gateway/internal/services"
+	"payment-gateway/pkg/utils"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 // Declare services and repositories here
 var (
-	TransactionRepository *repositories.TransactionRepository
-	KafkaProducer         kafka.KafkaProducer
-	TransactionService    *services.TransactionService
-	SendTransactionClient *client.TransactionClient
-	GatewayCountryRepo    *repositories.GatewayCountryRepository
-	GatewayRepo           *repositories.GatewayRepository
-	GatewayService        *services.GatewayService
+	TransactionRepository  *repositories.TransactionRepository
+	TransactionAttemptRepo *repositories.TransactionAttemptRepository
+	IdempotencyKeyRepo     *repositories.IdempotencyKeyRepository
+	ProcessedMessageRepo   *repositories.ProcessedMessageRepository
+	OutboxRepo             *repositories.OutboxRepository
+	OutboxRelay            *outbox.Relay
+	TransactionRetryRepo   *repositories.TransactionRetryRepository
+	RetryScheduler         *scheduler.RetryScheduler
+	TransactionExpiryRepo  *repositories.TransactionExpiryRepository
+	ExpirySweeper          *scheduler.ExpirySweeper
+	TransactionPollRepo    *repositories.TransactionPollRepository
+	StatusPoller           *scheduler.StatusPoller
+	KafkaProducer          kafka.KafkaProducer
+	TransactionService     *services.TransactionService
+	SendTransactionClient  *client.TransactionClient
+	GatewayCountryRepo     *repositories.GatewayCountryRepository
+	GatewayRepo            *repositories.GatewayRepository
+	GatewayMaintenanceRepo *repositories.GatewayMaintenanceRepository
+	GatewayService         *services.GatewayService
+	HealthProber           *health.Prober
+	HealthScorer           *health.Scorer
 )
 
 var (
@@ -37,23 +56,42 @@ func Execute() {
 	}
 }
 
-func init() {
-	cobra.OnInitialize(initApp, initConsumer)
-}
-
+// initApp connects to the database and wires services and repositories,
+// commands that need them call it from their PreRun
 func initApp() {
+	database.InitDB()
 	db := database.GetDB()
 
+	kafka.LoadTopics()
 	KafkaProducer = kafka.NewKafkaProducer()
 
 	SendTransactionClient = client.NewTransactionClient()
 
 	GatewayCountryRepo = repositories.NewGatewayCountryRepository(db)
 	TransactionRepository = repositories.NewTransactionRepository(db)
+	TransactionAttemptRepo = repositories.NewTransactionAttemptRepository(db)
+	IdempotencyKeyRepo = repositories.NewIdempotencyKeyRepository(db)
+	ProcessedMessageRepo = repositories.NewProcessedMessageRepository(db)
+	OutboxRepo = repositories.NewOutboxRepository(db)
+	TransactionRetryRepo = repositories.NewTransactionRetryRepository(db)
+	TransactionExpiryRepo = repositories.NewTransactionExpiryRepository(db)
+	TransactionPollRepo = repositories.NewTransactionPollRepository(db)
 	GatewayRepo = repositories.NewGatewayRepository(db)
+	GatewayMaintenanceRepo = repositories.NewGatewayMaintenanceRepository(db)
 
-	GatewayService = services.NewGatewayService(GatewayRepo)
-	TransactionService = services.NewTransactionService(TransactionRepository, KafkaProducer)
+	GatewayService = services.NewGatewayService(GatewayRepo, GatewayMaintenanceRepo, SendTransactionClient)
+	TransactionService = services.NewTransactionService(
+		TransactionRepository,
+		TransactionAttemptRepo,
+		IdempotencyKeyRepo,
+		utils.GetEnvDuration("IDEMPOTENCY_KEY_RETENTION", 24*time.Hour),
+	)
+	OutboxRelay = outbox.NewRelay(OutboxRepo, KafkaProducer, outbox.SettingsFromEnv())
+	RetryScheduler = scheduler.NewRetryScheduler(TransactionRetryRepo, scheduler.RetrySettingsFromEnv())
+	ExpirySweeper = scheduler.NewExpirySweeper(TransactionExpiryRepo, TransactionRepository, GatewayService, scheduler.ExpirySettingsFromEnv())
+	HealthProber = health.NewProber(GatewayRepo, SendTransactionClient, health.ProbeSettingsFromEnv())
+	HealthScorer = health.NewScorer(GatewayRepo, TransactionAttemptRepo, health.ScoreSettingsFromEnv())
+	StatusPoller = scheduler.NewStatusPoller(TransactionPollRepo, TransactionRepository, GatewayService, TransactionService, scheduler.PollSettingsFromEnv())
 }
 
 func initConsumer() {
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/simulator"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var simulatorSettings simulator.Settings
+
+var simulateCommand = &cobra.Command{
+	Use:   "simulate",
+	Short: "Run fake gateway providers on the ports of the configured gateway URLs",
+	Run:   simulate,
+}
+
+func init() {
+	flags := simulateCommand.Flags()
+	flags.Float64Var(&simulatorSettings.ApproveRate, "approve-rate", 0.7, "share of transactions that are approved")
+	flags.Float64Var(&simulatorSettings.DeclineRate, "decline-rate", 0.1, "share of transactions that are declined")
+	flags.Float64Var(&simulatorSettings.TimeoutRate, "timeout-rate", 0.1, "share of transactions that time out")
+	flags.Float64Var(&simulatorSettings.ErrorRate, "error-rate", 0.1, "share of transactions answered with a 5xx")
+	flags.DurationVar(&simulatorSettings.MinLatency, "min-latency", 50*time.Millisecond, "minimum response latency")
+	flags.DurationVar(&simulatorSettings.MaxLatency, "max-latency", 500*time.Millisecond, "maximum response latency")
+	flags.DurationVar(&simulatorSettings.TimeoutDuration, "timeout-duration", 35*time.Second, "how long a timed out request hangs")
+	flags.DurationVar(&simulatorSettings.CallbackDelay, "callback-delay", 2*time.Second, "delay before the callback is sent")
+	flags.StringVar(&simulatorSettings.CallbackURL, "callback-url", "http://localhost:8080/transaction/callback", "base callback URL, the gateway name is appended")
+
+	rootCmd.AddCommand(simulateCommand)
+}
+
+func simulate(cmd *cobra.Command, args []string) {
+	var servers []*http.Server
+
+	for _, adapter := range gateways.All() {
+		gatewaySimulator := simulator.NewGatewaySimulator(adapter, simulatorSettings)
+
+		address, err := gatewaySimulator.Address()
+		if err != nil {
+			log.Fatalf("Failed to start simulator: %v", err)
+		}
+
+		server := &http.Server{Addr: address, Handler: gatewaySimulator.Handler()}
+		servers = append(servers, server)
+
+		go func(name string) {
+			log.Printf("Simulating gateway %s on %s", name, server.Addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Simulator for gateway %s stopped: %v", name, err)
+			}
+		}(adapter.Name())
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("Shutting down simulator...\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shutdown simulator on %s: %v", server.Addr, err)
+		}
+	}
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"log"
 	"payment-gateway/app/cmd"
-	"payment-gateway/database"
-	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateways/gatewaya"
+	"payment-gateway/internal/gateways/gatewayb"
+	"payment-gateway/internal/gateways/gatewayc"
 
 	"github.com/joho/godotenv"
 )
@@ -14,11 +15,10 @@ func main() {
 	if err != nil {
 		log.Fatal(".env is not available")
 	}
-	database.InitDB()
 
-	config.InitGatewayA()
-	config.InitGatewayB()
-	config.InitGatewayC()
+	gatewaya.Init()
+	gatewayb.Init()
+	gatewayc.Init()
 
 	cmd.Execute()
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"log"
 	"os"
 	"payment-gateway/pkg/utils"
@@ -18,19 +19,26 @@ func InitDB() {
 	}
 
 	var err error
-
-	err = utils.RetryOperation(func() error {
-		db, err = sqlx.Open("postgres", uri)
-		if err != nil {
-			return err
-		}
-		db.SetConnMaxLifetime(300 * time.Second)
-		db.SetMaxOpenConns(50)
-		db.SetMaxIdleConns(100)
-
-		return db.Ping()
-	}, 5)
-
+	db, err = sqlx.Open("postgres", uri)
+	if err != nil {
+		log.Fatalf("Invalid POSTGRES_URI: %v", err)
+	}
+	db.SetConnMaxLifetime(300 * time.Second)
+	db.SetMaxOpenConns(50)
+	db.SetMaxIdleConns(100)
+
+	// the database may still be starting up next to the app
+	connectPolicy := utils.RetryPolicy{
+		Name:           "Postgres connection",
+		MaxAttempts:    10,
+		MaxElapsedTime: time.Minute,
+		InitialDelay:   500 * time.Millisecond,
+		MaxDelay:       10 * time.Second,
+		Backoff:        utils.BackoffDecorrelated,
+	}
+	err = connectPolicy.Do(context.Background(), func() error {
+		return db.PingContext(context.Background())
+	})
 	if err != nil {
 		log.Fatalf("Could not connect to the database: %v", err)
 	}
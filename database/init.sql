@@ -16,14 +16,28 @@ END $$;
 DO $$ 
 BEGIN
     IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'gateways') THEN
-        CREATE TYPE health_status_enum AS ENUM ('healthy', 'unhealthy');
+        CREATE TYPE health_status_enum AS ENUM ('healthy', 'degraded', 'unhealthy', 'maintenance');
 
         CREATE TABLE gateways (
             id SERIAL PRIMARY KEY,
             name VARCHAR(255) NOT NULL UNIQUE,
             data_format_supported VARCHAR(50) NOT NULL,
-            health_status health_status_enum DEFAULT 'healthy', -- Track gateway health: ENUM type
+            health_status health_status_enum DEFAULT 'healthy', -- Track gateway health: ENUM type, the worse of probe_status and traffic_status unless in maintenance
+            health_status_reason TEXT NOT NULL DEFAULT '', -- why the gateway got its health status
+            health_status_changed_at TIMESTAMP, -- when the health status last changed
+            probe_status VARCHAR(20) NOT NULL DEFAULT 'healthy', -- verdict of the health checks
             last_checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Timestamp of the last health check
+            consecutive_failures INT NOT NULL DEFAULT 0, -- health checks failed in a row
+            consecutive_successes INT NOT NULL DEFAULT 0, -- health checks passed in a row
+            last_check_latency_ms BIGINT NOT NULL DEFAULT 0, -- how long the last health check took
+            last_check_error TEXT NOT NULL DEFAULT '', -- why the last health check failed, empty when it passed
+            traffic_status VARCHAR(20) NOT NULL DEFAULT 'healthy', -- verdict of the live transaction outcomes: healthy, degraded, unhealthy
+            traffic_status_reason TEXT NOT NULL DEFAULT '', -- why the live transaction outcomes got their verdict
+            traffic_requests INT NOT NULL DEFAULT 0, -- requests in the scoring window
+            traffic_success_rate DOUBLE PRECISION NOT NULL DEFAULT 1, -- share of requests the gateway answered
+            traffic_timeout_rate DOUBLE PRECISION NOT NULL DEFAULT 0, -- share of requests that timed out
+            traffic_p95_latency_ms BIGINT NOT NULL DEFAULT 0, -- 95th percentile latency in the scoring window
+            traffic_scored_at TIMESTAMP, -- when the live transaction outcomes were last scored
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, 
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
         );
@@ -67,12 +81,18 @@ BEGIN
             amount DECIMAL(10, 2) NOT NULL,
             currency CHAR(3) NOT NULL,
             type VARCHAR(50) NOT NULL, -- deposit/withdrawal
-            status VARCHAR(50) NOT NULL, -- pending, retry, completed, failed
+            status VARCHAR(50) NOT NULL, -- pending, processing, submitted, in_doubt, completed, failed, reversed, retry, expired
+            failure_reason VARCHAR(100), -- reason code of a failed transaction, e.g. insufficient_funds
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  
             gateway_id INT,
             country_id INT NOT NULL,
             user_id INT NOT NULL,
+            retry_count INT NOT NULL DEFAULT 0, -- times the retry scheduler enqueued the transaction again
+            next_retry_at TIMESTAMP, -- the retry scheduler does not enqueue the transaction before this
+            poll_count INT NOT NULL DEFAULT 0, -- times the gateway was asked for the status of the transaction
+            next_poll_at TIMESTAMP, -- the status poller does not ask the gateway before this
+            processing_attempt INT, -- attempt of the message that moved the transaction to processing
             FOREIGN KEY (gateway_id) REFERENCES gateways(id) ON DELETE SET NULL,
             FOREIGN KEY (country_id) REFERENCES countries(id) ON DELETE CASCADE,
             FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
@@ -80,6 +100,159 @@ BEGIN
     END IF;
 END $$;
 
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'gateway_circuit_breakers') THEN
+        CREATE TABLE gateway_circuit_breakers (
+            gateway_id INT PRIMARY KEY,
+            state VARCHAR(20) NOT NULL DEFAULT 'closed', -- closed, open, half_open
+            window_started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Start of the current failure-rate window
+            request_count INT NOT NULL DEFAULT 0, -- Requests recorded in the current window
+            failure_count INT NOT NULL DEFAULT 0, -- Failures recorded in the current window
+            opened_at TIMESTAMP, -- When the breaker last opened
+            half_open_probes INT NOT NULL DEFAULT 0, -- Probe requests admitted while half-open
+            half_open_successes INT NOT NULL DEFAULT 0, -- Successful probes while half-open
+            probe_admitted_at TIMESTAMP, -- When the last probe was admitted while half-open
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (gateway_id) REFERENCES gateways(id) ON DELETE CASCADE
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'gateway_health_events') THEN
+        CREATE TABLE gateway_health_events (
+            id SERIAL PRIMARY KEY,
+            gateway_id INT NOT NULL,
+            event_type VARCHAR(20) NOT NULL, -- probe, status_change
+            health_status health_status_enum NOT NULL, -- Health status of the gateway after the event
+            previous_status health_status_enum, -- Health status before a status change
+            probe_passed BOOLEAN, -- Outcome of a probe
+            latency_ms BIGINT, -- Latency of a probe
+            reason TEXT NOT NULL DEFAULT '', -- Why the probe failed or the status changed
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (gateway_id) REFERENCES gateways(id) ON DELETE CASCADE
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'gateway_maintenance_windows') THEN
+        CREATE TABLE gateway_maintenance_windows (
+            id SERIAL PRIMARY KEY,
+            gateway_id INT NOT NULL,
+            country_id INT, -- NULL applies to every country of the gateway
+            starts_at TIMESTAMP NOT NULL,
+            ends_at TIMESTAMP NOT NULL,
+            reason TEXT NOT NULL DEFAULT '', -- Usually the announcement of the provider
+            cancelled_at TIMESTAMP, -- Set when the window is called off, routing ignores it from then on
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            CHECK (ends_at > starts_at),
+            FOREIGN KEY (gateway_id) REFERENCES gateways(id) ON DELETE CASCADE,
+            FOREIGN KEY (country_id) REFERENCES countries(id) ON DELETE CASCADE
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'transaction_attempts') THEN
+        CREATE TABLE transaction_attempts (
+            id SERIAL PRIMARY KEY,
+            transaction_id INT NOT NULL,
+            gateway_id INT NOT NULL,
+            attempt_number INT NOT NULL, -- 1 for the first request of the transaction, counting across gateways
+            request TEXT NOT NULL, -- Encrypted request body sent to the gateway
+            response TEXT NOT NULL DEFAULT '', -- Raw response body returned by the gateway
+            http_status INT NOT NULL DEFAULT 0, -- 0 when no response was received
+            latency_ms INT NOT NULL DEFAULT 0,
+            status VARCHAR(50) NOT NULL, -- accepted, declined, error
+            error_class VARCHAR(50) NOT NULL DEFAULT '', -- retryable, unavailable, declined, internal
+            error_message TEXT NOT NULL DEFAULT '',
+            timed_out BOOLEAN NOT NULL DEFAULT FALSE, -- No answer in time, or a 504 from the gateway
+            started_at TIMESTAMP NOT NULL,
+            completed_at TIMESTAMP NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (transaction_id, attempt_number),
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE,
+            FOREIGN KEY (gateway_id) REFERENCES gateways(id) ON DELETE CASCADE
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'transaction_status_history') THEN
+        CREATE TABLE transaction_status_history (
+            id SERIAL PRIMARY KEY,
+            transaction_id INT NOT NULL,
+            from_status VARCHAR(50) NOT NULL,
+            to_status VARCHAR(50) NOT NULL,
+            reason VARCHAR(255) NOT NULL DEFAULT '', -- What caused the transition, e.g. a callback or a reason code
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'idempotency_keys') THEN
+        CREATE TABLE idempotency_keys (
+            key VARCHAR(255) PRIMARY KEY, -- Idempotency-Key header sent by the client
+            request_hash CHAR(64) NOT NULL, -- sha256 of the operation and request body
+            response TEXT NOT NULL DEFAULT '', -- Response returned for the request, empty while it is being processed
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            expires_at TIMESTAMP NOT NULL -- The key can be reused with another request after this
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'outbox_messages') THEN
+        CREATE TABLE outbox_messages (
+            id SERIAL PRIMARY KEY,
+            topic VARCHAR(255) NOT NULL, -- Kafka topic the message is published to
+            payload TEXT NOT NULL,
+            attempts INT NOT NULL DEFAULT 0, -- Failed publish attempts
+            last_error TEXT NOT NULL DEFAULT '',
+            next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- The relay skips the message until then
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            sent_at TIMESTAMP -- Set once the broker acknowledged the message
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'processed_messages') THEN
+        CREATE TABLE processed_messages (
+            reference_id UUID NOT NULL, -- Transaction the message was about
+            attempt INT NOT NULL, -- Attempt of the message, increased every time the transaction is republished
+            processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (reference_id, attempt)
+        );
+    END IF;
+END $$;
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'transaction_expiry_policies') THEN
+        CREATE TABLE transaction_expiry_policies (
+            id SERIAL PRIMARY KEY,
+            transaction_type VARCHAR(50) NOT NULL, -- deposit/withdrawal
+            gateway_id INT, -- NULL applies to every gateway without a policy of its own
+            status VARCHAR(50) NOT NULL, -- pending, processing, submitted or in_doubt
+            ttl_seconds INT NOT NULL, -- Time in the status after which the sweeper ends the transaction
+            expire_to VARCHAR(50) NOT NULL DEFAULT 'expired' CHECK (expire_to IN ('expired', 'failed')),
+            FOREIGN KEY (gateway_id) REFERENCES gateways(id) ON DELETE CASCADE
+        );
+    END IF;
+END $$;
+
 -- Add indexes to optimize queries for priority, health status, and status updates
 CREATE INDEX IF NOT EXISTS idx_gateway_health_status ON gateways(health_status);
 CREATE INDEX IF NOT EXISTS idx_gateway_last_checked ON gateways(last_checked_at);
@@ -89,6 +262,17 @@ CREATE INDEX IF NOT EXISTS idx_countries_code ON countries(code);
 CREATE INDEX IF NOT EXISTS idx_gateway_countries_country_id ON gateway_countries(country_id);
 CREATE INDEX IF NOT EXISTS idx_gateway_countries_composite ON gateway_countries(country_id, priority, gateway_id);
 CREATE INDEX IF NOT EXISTS idx_transactions_reference_id ON transactions(reference_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions(created_at);
+CREATE INDEX IF NOT EXISTS idx_transaction_status_history_transaction_id ON transaction_status_history(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_attempts_gateway_started ON transaction_attempts(gateway_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_gateway_health_events_gateway_created ON gateway_health_events(gateway_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_gateway_maintenance_windows_active ON gateway_maintenance_windows(gateway_id, ends_at) WHERE cancelled_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_pending ON outbox_messages(next_attempt_at) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_retry ON transactions(id) WHERE status = 'retry';
+CREATE INDEX IF NOT EXISTS idx_transactions_open ON transactions(id) WHERE status IN ('pending', 'processing', 'submitted', 'in_doubt');
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transaction_expiry_policies_unique ON transaction_expiry_policies(transaction_type, status, COALESCE(gateway_id, 0));
 
 -- Populate countries, gateways, and a user
 INSERT INTO countries (name, code, currency, created_at, updated_at)
@@ -116,3 +300,16 @@ INSERT INTO users (username, email, password, country_id, created_at, updated_at
 VALUES 
     ('test_user', 'test_user@example.com', 'hashed_password', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 ON CONFLICT DO NOTHING;
+
+-- Expire transactions nobody picked up after an hour, and give gateways a day to call back or resolve a transaction in doubt
+INSERT INTO transaction_expiry_policies (transaction_type, gateway_id, status, ttl_seconds, expire_to)
+VALUES
+    ('deposit', NULL, 'pending', 3600, 'expired'),
+    ('deposit', NULL, 'processing', 3600, 'expired'),
+    ('deposit', NULL, 'submitted', 86400, 'expired'),
+    ('deposit', NULL, 'in_doubt', 86400, 'expired'),
+    ('withdrawal', NULL, 'pending', 3600, 'expired'),
+    ('withdrawal', NULL, 'processing', 3600, 'expired'),
+    ('withdrawal', NULL, 'submitted', 86400, 'expired'),
+    ('withdrawal', NULL, 'in_doubt', 86400, 'expired')
+ON CONFLICT DO NOTHING;
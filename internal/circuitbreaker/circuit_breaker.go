@@ -0,0 +1,187 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type ICircuitBreaker interface {
+	Allow(ctx context.Context, gatewayID int) error
+	RecordSuccess(ctx context.Context, gatewayID int) error
+	RecordFailure(ctx context.Context, gatewayID int) error
+	Release(ctx context.Context, gatewayID int) error
+}
+
+type Settings struct {
+	Window               time.Duration // length of the failure-rate window while closed
+	FailureRateThreshold float64       // failure rate in the window that opens the breaker
+	MinimumRequests      int           // requests needed in the window before the rate is evaluated
+	OpenDuration         time.Duration // how long the breaker stays open before probing
+	HalfOpenProbes       int           // probe requests allowed while half-open
+}
+
+// SettingsFromEnv reads the breaker settings from CIRCUIT_BREAKER_* environment variables
+func SettingsFromEnv() Settings {
+	return Settings{
+		Window:               utils.GetEnvDuration("CIRCUIT_BREAKER_WINDOW", time.Minute),
+		FailureRateThreshold: utils.GetEnvFloat("CIRCUIT_BREAKER_FAILURE_RATE", 0.5),
+		MinimumRequests:      utils.GetEnvInt("CIRCUIT_BREAKER_MINIMUM_REQUESTS", 5),
+		OpenDuration:         utils.GetEnvDuration("CIRCUIT_BREAKER_OPEN_DURATION", 30*time.Second),
+		HalfOpenProbes:       utils.GetEnvInt("CIRCUIT_BREAKER_HALF_OPEN_PROBES", 3),
+	}
+}
+
+// CircuitBreaker is a closed/open/half-open breaker per gateway whose state is kept in Postgres
+type CircuitBreaker struct {
+	repo     repositories.ICircuitBreakerRepository
+	settings Settings
+	now      func() time.Time
+}
+
+func NewCircuitBreaker(repo repositories.ICircuitBreakerRepository, settings Settings) *CircuitBreaker {
+	return &CircuitBreaker{
+		repo:     repo,
+		settings: settings,
+		now:      time.Now,
+	}
+}
+
+// Allow returns ErrCircuitOpen when the gateway should not receive the request.
+// Once the open duration has passed the breaker turns half-open and admits a limited
+// number of probe requests. Every admitted request must be followed by RecordSuccess,
+// RecordFailure or Release.
+func (b *CircuitBreaker) Allow(ctx context.Context, gatewayID int) error {
+	return b.repo.UpdateState(ctx, gatewayID, func(state *models.CircuitBreakerState) error {
+		now := b.now()
+		err := b.allow(state, now)
+		state.UpdatedAt = now
+		return err
+	})
+}
+
+func (b *CircuitBreaker) RecordSuccess(ctx context.Context, gatewayID int) error {
+	return b.repo.UpdateState(ctx, gatewayID, func(state *models.CircuitBreakerState) error {
+		now := b.now()
+		b.record(state, true, now)
+		state.UpdatedAt = now
+		return nil
+	})
+}
+
+func (b *CircuitBreaker) RecordFailure(ctx context.Context, gatewayID int) error {
+	return b.repo.UpdateState(ctx, gatewayID, func(state *models.CircuitBreakerState) error {
+		now := b.now()
+		b.record(state, false, now)
+		state.UpdatedAt = now
+		return nil
+	})
+}
+
+// Release gives back a request admitted by Allow that was never sent, so a half-open
+// probe slot is not held by a request that cannot report back.
+func (b *CircuitBreaker) Release(ctx context.Context, gatewayID int) error {
+	return b.repo.UpdateState(ctx, gatewayID, func(state *models.CircuitBreakerState) error {
+		if state.State == constants.CIRCUIT_HALF_OPEN && state.HalfOpenProbes > state.HalfOpenSuccesses {
+			state.HalfOpenProbes--
+		}
+		state.UpdatedAt = b.now()
+		return nil
+	})
+}
+
+func (b *CircuitBreaker) allow(state *models.CircuitBreakerState, now time.Time) error {
+	switch state.State {
+	case constants.CIRCUIT_OPEN:
+		if state.OpenedAt != nil && now.Before(state.OpenedAt.Add(b.settings.OpenDuration)) {
+			return ErrCircuitOpen
+		}
+		b.halfOpen(state)
+		fallthrough
+
+	case constants.CIRCUIT_HALF_OPEN:
+		// probes that never reported back must not keep the breaker half-open forever. Rejected requests
+		// leave probe_admitted_at alone, so a steady stream of them cannot postpone this.
+		if state.HalfOpenProbes >= b.settings.HalfOpenProbes &&
+			(state.ProbeAdmittedAt == nil || now.Sub(*state.ProbeAdmittedAt) >= b.settings.OpenDuration) {
+			b.halfOpen(state)
+		}
+		if state.HalfOpenProbes >= b.settings.HalfOpenProbes {
+			return ErrCircuitOpen
+		}
+		state.HalfOpenProbes++
+		state.ProbeAdmittedAt = &now
+		return nil
+
+	default:
+		b.rollWindow(state, now)
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) record(state *models.CircuitBreakerState, success bool, now time.Time) {
+	switch state.State {
+	case constants.CIRCUIT_OPEN:
+		// a late result from before the breaker opened, nothing to learn from it
+
+	case constants.CIRCUIT_HALF_OPEN:
+		if !success {
+			b.open(state, now)
+			return
+		}
+		state.HalfOpenSuccesses++
+		if state.HalfOpenSuccesses >= b.settings.HalfOpenProbes {
+			b.close(state, now)
+		}
+
+	default:
+		b.rollWindow(state, now)
+		state.RequestCount++
+		if !success {
+			state.FailureCount++
+		}
+
+		if state.RequestCount >= b.settings.MinimumRequests &&
+			float64(state.FailureCount)/float64(state.RequestCount) >= b.settings.FailureRateThreshold {
+			b.open(state, now)
+		}
+	}
+}
+
+func (b *CircuitBreaker) rollWindow(state *models.CircuitBreakerState, now time.Time) {
+	if now.Sub(state.WindowStartedAt) < b.settings.Window {
+		return
+	}
+	state.WindowStartedAt = now
+	state.RequestCount = 0
+	state.FailureCount = 0
+}
+
+func (b *CircuitBreaker) open(state *models.CircuitBreakerState, now time.Time) {
+	state.State = constants.CIRCUIT_OPEN
+	state.OpenedAt = &now
+	state.HalfOpenProbes = 0
+	state.HalfOpenSuccesses = 0
+}
+
+func (b *CircuitBreaker) halfOpen(state *models.CircuitBreakerState) {
+	state.State = constants.CIRCUIT_HALF_OPEN
+	state.HalfOpenProbes = 0
+	state.HalfOpenSuccesses = 0
+}
+
+func (b *CircuitBreaker) close(state *models.CircuitBreakerState, now time.Time) {
+	state.State = constants.CIRCUIT_CLOSED
+	state.WindowStartedAt = now
+	state.RequestCount = 0
+	state.FailureCount = 0
+	state.HalfOpenProbes = 0
+	state.HalfOpenSuccesses = 0
+}
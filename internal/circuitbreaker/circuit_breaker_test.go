@@ -0,0 +1,182 @@
+package circuitbreaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mocksRepository "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "CircuitBreaker Suite")
+}
+
+var _ = ginkgo.Describe("CircuitBreaker", func() {
+	var (
+		mockRepo       *mocksRepository.MockCircuitBreakerRepository
+		circuitBreaker *CircuitBreaker
+		state          *models.CircuitBreakerState
+		ctx            context.Context
+		now            time.Time
+		gatewayID      int
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		gatewayID = 1
+
+		mockRepo = new(mocksRepository.MockCircuitBreakerRepository)
+		circuitBreaker = NewCircuitBreaker(mockRepo, Settings{
+			Window:               time.Minute,
+			FailureRateThreshold: 0.5,
+			MinimumRequests:      4,
+			OpenDuration:         30 * time.Second,
+			HalfOpenProbes:       2,
+		})
+		circuitBreaker.now = func() time.Time { return now }
+
+		state = &models.CircuitBreakerState{
+			GatewayID:       gatewayID,
+			State:           constants.CIRCUIT_CLOSED,
+			WindowStartedAt: now,
+			UpdatedAt:       now,
+		}
+		mockRepo.On("UpdateState", ctx, gatewayID).Return(state, nil)
+	})
+
+	ginkgo.Describe("closed", func() {
+		ginkgo.It("should allow requests", func() {
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should stay closed below the minimum number of requests", func() {
+			for i := 0; i < 3; i++ {
+				gomega.Expect(circuitBreaker.RecordFailure(ctx, gatewayID)).To(gomega.Succeed())
+			}
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_CLOSED))
+		})
+
+		ginkgo.It("should open when the failure rate reaches the threshold", func() {
+			circuitBreaker.RecordSuccess(ctx, gatewayID)
+			circuitBreaker.RecordSuccess(ctx, gatewayID)
+			circuitBreaker.RecordFailure(ctx, gatewayID)
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_CLOSED))
+
+			circuitBreaker.RecordFailure(ctx, gatewayID)
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_OPEN))
+			gomega.Expect(*state.OpenedAt).To(gomega.Equal(now))
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.MatchError(ErrCircuitOpen))
+		})
+
+		ginkgo.It("should forget failures from an expired window", func() {
+			for i := 0; i < 3; i++ {
+				circuitBreaker.RecordFailure(ctx, gatewayID)
+			}
+
+			now = now.Add(time.Minute)
+			circuitBreaker.RecordFailure(ctx, gatewayID)
+
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_CLOSED))
+			gomega.Expect(state.RequestCount).To(gomega.Equal(1))
+			gomega.Expect(state.FailureCount).To(gomega.Equal(1))
+		})
+	})
+
+	ginkgo.Describe("open", func() {
+		ginkgo.BeforeEach(func() {
+			openedAt := now
+			state.State = constants.CIRCUIT_OPEN
+			state.OpenedAt = &openedAt
+		})
+
+		ginkgo.It("should reject requests until the open duration has passed", func() {
+			now = now.Add(29 * time.Second)
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.MatchError(ErrCircuitOpen))
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_OPEN))
+		})
+
+		ginkgo.It("should turn half-open and admit a limited number of probes", func() {
+			now = now.Add(30 * time.Second)
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.Succeed())
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_HALF_OPEN))
+
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.Succeed())
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.MatchError(ErrCircuitOpen))
+		})
+
+		ginkgo.It("should ignore results recorded while open", func() {
+			circuitBreaker.RecordSuccess(ctx, gatewayID)
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_OPEN))
+		})
+	})
+
+	ginkgo.Describe("half-open", func() {
+		ginkgo.BeforeEach(func() {
+			admittedAt := now
+			state.State = constants.CIRCUIT_HALF_OPEN
+			state.HalfOpenProbes = 2
+			state.ProbeAdmittedAt = &admittedAt
+		})
+
+		ginkgo.It("should close after enough successful probes", func() {
+			circuitBreaker.RecordSuccess(ctx, gatewayID)
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_HALF_OPEN))
+
+			circuitBreaker.RecordSuccess(ctx, gatewayID)
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_CLOSED))
+			gomega.Expect(state.RequestCount).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should reopen on a failed probe", func() {
+			now = now.Add(time.Second)
+			circuitBreaker.RecordFailure(ctx, gatewayID)
+
+			gomega.Expect(state.State).To(gomega.Equal(constants.CIRCUIT_OPEN))
+			gomega.Expect(*state.OpenedAt).To(gomega.Equal(now))
+		})
+
+		ginkgo.It("should admit new probes when the previous ones never reported back", func() {
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.MatchError(ErrCircuitOpen))
+
+			now = now.Add(30 * time.Second)
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.Succeed())
+			gomega.Expect(state.HalfOpenProbes).To(gomega.Equal(1))
+			gomega.Expect(state.ProbeAdmittedAt).To(gomega.HaveValue(gomega.Equal(now)))
+		})
+
+		ginkgo.It("should not let rejected requests postpone admitting new probes", func() {
+			for i := 0; i < 2; i++ {
+				now = now.Add(10 * time.Second)
+				gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.MatchError(ErrCircuitOpen))
+			}
+
+			now = now.Add(10 * time.Second)
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should admit another probe once an admitted one is released", func() {
+			gomega.Expect(circuitBreaker.Release(ctx, gatewayID)).To(gomega.Succeed())
+			gomega.Expect(state.HalfOpenProbes).To(gomega.Equal(1))
+
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.Succeed())
+			gomega.Expect(circuitBreaker.Allow(ctx, gatewayID)).To(gomega.MatchError(ErrCircuitOpen))
+		})
+
+		ginkgo.It("should not release probes that already reported back", func() {
+			circuitBreaker.RecordSuccess(ctx, gatewayID)
+			gomega.Expect(circuitBreaker.Release(ctx, gatewayID)).To(gomega.Succeed())
+			gomega.Expect(circuitBreaker.Release(ctx, gatewayID)).To(gomega.Succeed())
+
+			gomega.Expect(state.HalfOpenProbes).To(gomega.Equal(1))
+			gomega.Expect(state.HalfOpenSuccesses).To(gomega.Equal(1))
+		})
+	})
+})
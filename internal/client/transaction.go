@@ -2,44 +2,195 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"payment-gateway/internal/gateways"
 	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"strings"
 	"time"
+)
 
-	"golang.org/x/exp/rand"
+const (
+	sendTransactionPath = "/transactions"
+	apiKeyHeader        = "X-API-Key"
+	defaultHTTPTimeout  = 30 * time.Second
+	maxResponseBytes    = 1 << 20
 )
 
 type ITransactionClient interface {
-	SendTransaction(ctx context.Context, transactionRequest models.BuildExternalTransaction, gatewayName string, gatewayConfig models.GatewayConfig) error
+	SendTransaction(ctx context.Context, transactionRequest models.BuildExternalTransaction, adapter gateways.GatewayAdapter) (models.GatewayTransactionResult, error)
+	QueryTransactionStatus(ctx context.Context, referenceID string, adapter gateways.GatewayAdapter) (string, error)
+	CheckHealth(ctx context.Context, adapter gateways.GatewayAdapter) error
 }
 
-type TransactionClient struct{}
+type TransactionClient struct {
+	httpClient *http.Client
+}
 
 func NewTransactionClient() *TransactionClient {
-	return &TransactionClient{}
+	return &TransactionClient{
+		httpClient: &http.Client{Timeout: defaultHTTPTimeout},
+	}
 }
 
+// SendTransaction posts the built transaction to the gateway and lets the adapter parse its response.
+// Only an accepted transaction is returned without error. Anything else is returned as a
+// *gateways.Error alongside whatever the gateway reported, classified as:
+//   - declined: the gateway refused the transaction (a 4xx with a declined status)
+//   - retryable: the request never reached the gateway
+//   - unknown: the request reached the gateway but its outcome is unclear, because the answer got lost,
+//     timed out (504), was a 500 or was a success we cannot read, so the gateway may have executed the
+//     transaction
+//   - unavailable: the gateway answered with 408, 429 or another 5xx
+//   - internal: the gateway rejected the request itself (other 4xx), which is on our side
 func (c *TransactionClient) SendTransaction(
 	ctx context.Context,
 	transactionRequest models.BuildExternalTransaction,
-	gatewayName string,
-	gatewayConfig models.GatewayConfig,
-) error {
-	randGen := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
-	isSuccess := randGen.Intn(2) == 0
+	adapter gateways.GatewayAdapter,
+) (models.GatewayTransactionResult, error) {
+	gatewayName := adapter.Name()
+	gatewayConfig := adapter.Config()
+	url := strings.TrimRight(gatewayConfig.GatewayUrl, "/") + sendTransactionPath
 
-	/* ====to test the fault-tolerance==== */
-	// isSuccess = false
-	// if gatewayName == constants.GATEWAY_B {
-	// 	isSuccess = true
-	// }
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(transactionRequest.Request))
+	if err != nil {
+		return models.GatewayTransactionResult{}, gateways.NewInternalError(gatewayName, fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set("Content-Type", transactionRequest.ContentType)
+	req.Header.Set("Accept", transactionRequest.ContentType)
+	req.Header.Set(apiKeyHeader, gatewayConfig.GatewayApiKey)
+	for header, value := range transactionRequest.Headers {
+		req.Header.Set(header, value)
+	}
 
-	if !isSuccess {
-		return fmt.Errorf("gateway failed to process transaction")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to send transaction: %w", err)
+		if requestNotSent(err) {
+			return models.GatewayTransactionResult{}, gateways.NewRetryableError(gatewayName, err)
+		}
+		return models.GatewayTransactionResult{}, gateways.NewUnknownError(gatewayName, err)
 	}
+	defer resp.Body.Close()
 
-	log.Printf("Transaction is processed by gateway=[%s]", gatewayName)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return models.GatewayTransactionResult{HTTPStatus: resp.StatusCode}, gateways.NewUnknownError(gatewayName, fmt.Errorf("failed to read response: %w", err))
+	}
+
+	result := adapter.ParseResponse(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	result.RawResponse = string(body)
+
+	switch {
+	case result.Status == constants.ACCEPTED && resp.StatusCode < http.StatusMultipleChoices:
+		log.Printf("Transaction is accepted by gateway=[%s], reference=[%s]", gatewayName, result.GatewayReference)
+		return result, nil
+	case result.Status == constants.DECLINED && resp.StatusCode < http.StatusInternalServerError:
+		log.Printf("Transaction is declined by gateway=[%s], reference=[%s]: %s", gatewayName, result.GatewayReference, result.Message)
+		return result, gateways.NewDeclinedError(gatewayName, result.ReasonCode, result.GatewayReference, errors.New(result.Message))
+	}
 
+	result.Status = constants.ERROR
+	err = fmt.Errorf("failed to process transaction (http_status=%d, reference=%s): %s",
+		resp.StatusCode, result.GatewayReference, result.Message)
+
+	switch {
+	case resp.StatusCode == http.StatusGatewayTimeout,
+		resp.StatusCode == http.StatusInternalServerError,
+		resp.StatusCode < http.StatusBadRequest:
+		return result, gateways.NewUnknownError(gatewayName, err)
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode > http.StatusInternalServerError:
+		return result, gateways.NewUnavailableError(gatewayName, err)
+	default:
+		return result, gateways.NewInternalError(gatewayName, err)
+	}
+}
+
+// QueryTransactionStatus asks the gateway for the status of a transaction and returns it as an internal
+// transaction status. gateways.ErrStatusQueryUnsupported is returned for gateways that cannot be asked,
+// gateways.ErrTransactionNotFound when the gateway answers 404, and any other failure as a *gateways.Error
+// classified like the failures of SendTransaction.
+func (c *TransactionClient) QueryTransactionStatus(ctx context.Context, referenceID string, adapter gateways.GatewayAdapter) (string, error) {
+	if !adapter.SupportsStatusQuery() {
+		return "", gateways.ErrStatusQueryUnsupported
+	}
+
+	gatewayName := adapter.Name()
+	gatewayConfig := adapter.Config()
+	statusURL := strings.TrimRight(gatewayConfig.GatewayUrl, "/") + sendTransactionPath + "/" + url.PathEscape(referenceID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL, nil)
+	if err != nil {
+		return "", gateways.NewInternalError(gatewayName, fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set(apiKeyHeader, gatewayConfig.GatewayApiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", gateways.NewRetryableError(gatewayName, fmt.Errorf("failed to query transaction status: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return "", gateways.NewRetryableError(gatewayName, fmt.Errorf("failed to read response: %w", err))
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		status, err := adapter.ParseStatusResponse(resp.Header.Get("Content-Type"), body)
+		if err != nil {
+			return "", gateways.NewUnavailableError(gatewayName, fmt.Errorf("failed to parse status of transaction %s: %w", referenceID, err))
+		}
+		return status, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("gateway %s, transaction %s: %w", gatewayName, referenceID, gateways.ErrTransactionNotFound)
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= http.StatusInternalServerError:
+		return "", gateways.NewUnavailableError(gatewayName, fmt.Errorf("failed to query status of transaction %s (http_status=%d)", referenceID, resp.StatusCode))
+	default:
+		return "", gateways.NewInternalError(gatewayName, fmt.Errorf("failed to query status of transaction %s (http_status=%d)", referenceID, resp.StatusCode))
+	}
+}
+
+// CheckHealth calls the health endpoint of the gateway. Any answer but a 2xx is returned as an unavailable
+// *gateways.Error, a gateway that cannot be reached as a retryable one.
+func (c *TransactionClient) CheckHealth(ctx context.Context, adapter gateways.GatewayAdapter) error {
+	gatewayName := adapter.Name()
+	gatewayConfig := adapter.Config()
+	healthURL := strings.TrimRight(gatewayConfig.GatewayUrl, "/") + adapter.HealthPath()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return gateways.NewInternalError(gatewayName, fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set(apiKeyHeader, gatewayConfig.GatewayApiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return gateways.NewRetryableError(gatewayName, fmt.Errorf("failed to check health: %w", err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return gateways.NewUnavailableError(gatewayName, fmt.Errorf("health check failed (http_status=%d)", resp.StatusCode))
+	}
 	return nil
 }
+
+// requestNotSent reports whether the request failed before any of it reached the gateway,
+// in which case resending it cannot execute the transaction twice
+func requestNotSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
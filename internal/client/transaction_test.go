@@ -0,0 +1,325 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/gateways/gatewaya"
+	"payment-gateway/internal/gateways/gatewayb"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestTransactionClient(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "TransactionClient Suite")
+}
+
+var _ = ginkgo.Describe("TransactionClient", func() {
+	var (
+		server        *httptest.Server
+		handler       http.HandlerFunc
+		client        *TransactionClient
+		gatewayConfig models.GatewayConfig
+		request       models.BuildExternalTransaction
+	)
+
+	ginkgo.BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+		}))
+
+		client = NewTransactionClient()
+		gatewayConfig = models.GatewayConfig{
+			GatewayUrl:        server.URL,
+			GatewayApiKey:     "api-key",
+			GatewayPrivateKey: "12345678901234567890123456789012",
+		}
+		request = models.BuildExternalTransaction{
+			Request:     `{"encrypted_data":"payload"}`,
+			ContentType: "application/json",
+			Headers:     map[string]string{"Idempotency-Key": "ref-123-0"},
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.Describe("SendTransaction", func() {
+		ginkgo.It("should post the request with its content type and api key", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				defer ginkgo.GinkgoRecover()
+				body, _ := io.ReadAll(r.Body)
+
+				gomega.Expect(r.Method).To(gomega.Equal(http.MethodPost))
+				gomega.Expect(r.URL.Path).To(gomega.Equal(sendTransactionPath))
+				gomega.Expect(r.Header.Get("Content-Type")).To(gomega.Equal("application/json"))
+				gomega.Expect(r.Header.Get(apiKeyHeader)).To(gomega.Equal("api-key"))
+				gomega.Expect(r.Header.Get("Idempotency-Key")).To(gomega.Equal("ref-123-0"))
+				gomega.Expect(string(body)).To(gomega.Equal(request.Request))
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"status":"accepted","reference":"gw-123","message":"ok"}`))
+			}
+
+			result, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.GatewayTransactionResult{
+				Status:           constants.ACCEPTED,
+				GatewayReference: "gw-123",
+				Message:          "ok",
+				HTTPStatus:       http.StatusOK,
+				RawResponse:      `{"status":"accepted","reference":"gw-123","message":"ok"}`,
+			}))
+		})
+
+		ginkgo.It("should parse a SOAP response", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+				w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<TransactionResponse>
+			<status>accepted</status>
+			<reference>gw-456</reference>
+		</TransactionResponse>
+	</soap:Body>
+</soap:Envelope>`))
+			}
+
+			result, err := client.SendTransaction(context.Background(), request, gatewayb.New(gatewayConfig))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result.Status).To(gomega.Equal(constants.ACCEPTED))
+			gomega.Expect(result.GatewayReference).To(gomega.Equal("gw-456"))
+		})
+
+		ginkgo.It("should return a declined error with the reason code", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusPaymentRequired)
+				w.Write([]byte(`{"status":"declined","reference":"gw-789","message":"insufficient funds","reason_code":"insufficient_funds"}`))
+			}
+
+			result, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorDeclined))
+
+			var gatewayErr *gateways.Error
+			gomega.Expect(errors.As(err, &gatewayErr)).To(gomega.BeTrue())
+			gomega.Expect(gatewayErr.Reason).To(gomega.Equal(constants.REASON_INSUFFICIENT_FUNDS))
+			gomega.Expect(result.Status).To(gomega.Equal(constants.DECLINED))
+			gomega.Expect(result.GatewayReference).To(gomega.Equal("gw-789"))
+			gomega.Expect(result.HTTPStatus).To(gomega.Equal(http.StatusPaymentRequired))
+		})
+
+		ginkgo.It("should return an unknown error result when the gateway fails", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"status":"error","reference":"gw-500","message":"internal error"}`))
+			}
+
+			result, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("gw-500"))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnknown))
+			gomega.Expect(result.Status).To(gomega.Equal(constants.ERROR))
+			gomega.Expect(result.HTTPStatus).To(gomega.Equal(http.StatusInternalServerError))
+		})
+
+		ginkgo.It("should return an unavailable error when the gateway is overloaded", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+
+			_, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnavailable))
+		})
+
+		ginkgo.It("should return an unknown error when a success response cannot be decoded", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("ok"))
+			}
+
+			result, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnknown))
+			gomega.Expect(result.Status).To(gomega.Equal(constants.ERROR))
+		})
+
+		ginkgo.It("should return an unknown error when a 200 carries a body that is not valid JSON", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"status":"accepted","reference":`))
+			}
+
+			result, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnknown))
+			gomega.Expect(result.Status).To(gomega.Equal(constants.ERROR))
+			gomega.Expect(result.HTTPStatus).To(gomega.Equal(http.StatusOK))
+		})
+
+		ginkgo.It("should return an internal error when the gateway rejects the request", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"status":"error","message":"invalid api key"}`))
+			}
+
+			_, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorInternal))
+		})
+
+		ginkgo.It("should return an unknown error when the gateway times out", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusGatewayTimeout)
+			}
+
+			result, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnknown))
+			gomega.Expect(result.Status).To(gomega.Equal(constants.ERROR))
+		})
+
+		ginkgo.It("should return a retryable error when the gateway cannot be reached", func() {
+			server.Close()
+
+			_, err := client.SendTransaction(context.Background(), request, gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.IsRetryable(err)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should return an unknown error when the context deadline passes after the request was sent", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := client.SendTransaction(ctx, request, gatewaya.New(gatewayConfig))
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err).Should(gomega.MatchError(context.DeadlineExceeded))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnknown))
+		})
+	})
+
+	ginkgo.Describe("QueryTransactionStatus", func() {
+		ginkgo.It("should get the status of the transaction with the api key and map it", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				defer ginkgo.GinkgoRecover()
+
+				gomega.Expect(r.Method).To(gomega.Equal(http.MethodGet))
+				gomega.Expect(r.URL.Path).To(gomega.Equal(sendTransactionPath + "/ref-123"))
+				gomega.Expect(r.Header.Get(apiKeyHeader)).To(gomega.Equal("api-key"))
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"status":"completed","reference":"gw-123"}`))
+			}
+
+			status, err := client.QueryTransactionStatus(context.Background(), "ref-123", gatewaya.New(gatewayConfig))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(status).To(gomega.Equal(constants.COMPLETED))
+		})
+
+		ginkgo.It("should map a transaction still in progress to submitted", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"status":"pending"}`))
+			}
+
+			status, err := client.QueryTransactionStatus(context.Background(), "ref-123", gatewaya.New(gatewayConfig))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(status).To(gomega.Equal(constants.SUBMITTED))
+		})
+
+		ginkgo.It("should not ask a gateway that does not support status queries", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				defer ginkgo.GinkgoRecover()
+				ginkgo.Fail("the gateway must not be asked")
+			}
+
+			_, err := client.QueryTransactionStatus(context.Background(), "ref-123", gatewayb.New(gatewayConfig))
+			gomega.Expect(err).To(gomega.Equal(gateways.ErrStatusQueryUnsupported))
+		})
+
+		ginkgo.It("should return an unavailable error for an unknown status", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"status":"on_hold"}`))
+			}
+
+			_, err := client.QueryTransactionStatus(context.Background(), "ref-123", gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnavailable))
+		})
+
+		ginkgo.It("should return ErrTransactionNotFound when the gateway has no record of the transaction", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			}
+
+			_, err := client.QueryTransactionStatus(context.Background(), "ref-123", gatewaya.New(gatewayConfig))
+			gomega.Expect(err).To(gomega.MatchError(gateways.ErrTransactionNotFound))
+		})
+
+		ginkgo.It("should return an unavailable error when the gateway fails", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+
+			_, err := client.QueryTransactionStatus(context.Background(), "ref-123", gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnavailable))
+		})
+
+		ginkgo.It("should return a retryable error when the gateway cannot be reached", func() {
+			server.Close()
+
+			_, err := client.QueryTransactionStatus(context.Background(), "ref-123", gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.IsRetryable(err)).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Describe("CheckHealth", func() {
+		ginkgo.It("should get the health endpoint of the gateway with the api key", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				defer ginkgo.GinkgoRecover()
+
+				gomega.Expect(r.Method).To(gomega.Equal(http.MethodGet))
+				gomega.Expect(r.URL.Path).To(gomega.Equal("/health"))
+				gomega.Expect(r.Header.Get(apiKeyHeader)).To(gomega.Equal("api-key"))
+
+				w.Write([]byte(`{"status":"ok"}`))
+			}
+
+			err := client.CheckHealth(context.Background(), gatewaya.New(gatewayConfig))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should return an unavailable error when the gateway reports it is unhealthy", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+
+			err := client.CheckHealth(context.Background(), gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnavailable))
+		})
+
+		ginkgo.It("should return a retryable error when the gateway cannot be reached", func() {
+			server.Close()
+
+			err := client.CheckHealth(context.Background(), gatewaya.New(gatewayConfig))
+			gomega.Expect(gateways.IsRetryable(err)).To(gomega.BeTrue())
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package gateways
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"payment-gateway/models"
+)
+
+// GatewayAdapter describes everything that differs between payment providers.
+// Each provider lives in its own package and registers its adapter under the
+// name stored in gateways.name.
+type GatewayAdapter interface {
+	// Name returns the gateway name as stored in gateways.name
+	Name() string
+	// Config returns the connection settings of the gateway
+	Config() models.GatewayConfig
+	// BuildRequest builds the encrypted outbound request for a transaction, carrying the idempotency key
+	// in the header named by IdempotencyHeader or, when there is none, in the payload
+	BuildRequest(transaction *models.Transaction, idempotencyKey string) (models.BuildExternalTransaction, error)
+	// IdempotencyHeader returns the header the gateway reads the idempotency key from, empty when
+	// the key is part of the payload
+	IdempotencyHeader() string
+	// ParseResponse parses the gateway response to a submitted transaction
+	ParseResponse(statusCode int, contentType string, body []byte) models.GatewayTransactionResult
+	// ParseCallback parses an asynchronous callback sent by the gateway
+	ParseCallback(contentType string, body []byte) (*models.TransactionCallbackRequest, error)
+	// MapStatus maps a gateway transaction status to an internal transaction status
+	MapStatus(gatewayStatus string) (string, error)
+	// SupportsStatusQuery reports whether the gateway can be asked for the status of a transaction
+	SupportsStatusQuery() bool
+	// ParseStatusResponse parses the gateway response to a status query into an internal transaction status
+	ParseStatusResponse(contentType string, body []byte) (string, error)
+	// HealthPath returns the path of the endpoint that tells whether the gateway accepts traffic
+	HealthPath() string
+}
+
+// IdempotencyKey returns the idempotency key of an attempt to send a transaction. Resending the same
+// attempt yields the same key, so the gateway executes the transaction at most once per attempt.
+func IdempotencyKey(referenceID string, attempt int) string {
+	return fmt.Sprintf("%s-%d", referenceID, attempt)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]GatewayAdapter{}
+)
+
+// Register adds an adapter to the registry, replacing any adapter with the same name
+func Register(adapter GatewayAdapter) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[adapter.Name()] = adapter
+}
+
+// Get returns the adapter registered for the given gateway name
+func Get(name string) (GatewayAdapter, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	adapter, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported gateway name: %s", name)
+	}
+
+	return adapter, nil
+}
+
+// All returns every registered adapter ordered by name
+func All() []GatewayAdapter {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	adapters := make([]GatewayAdapter, 0, len(registry))
+	for _, adapter := range registry {
+		adapters = append(adapters, adapter)
+	}
+	sort.Slice(adapters, func(i, j int) bool {
+		return adapters[i].Name() < adapters[j].Name()
+	})
+
+	return adapters
+}
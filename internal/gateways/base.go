@@ -0,0 +1,153 @@
+package gateways
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+)
+
+// BaseAdapter implements the encrypted JSON/SOAP exchange shared by the providers
+// we integrate with. Provider packages embed it and only describe their differences.
+type BaseAdapter struct {
+	GatewayName   string
+	DataFormat    string
+	GatewayConfig models.GatewayConfig
+	StatusMapping map[string]string // gateway transaction status -> internal transaction status
+	StatusQuery   bool              // the gateway answers GET /transactions/{reference_id}
+
+	IdempotencyHeaderName string // header carrying the idempotency key, the key goes in the payload when empty
+	HealthCheckPath       string // path of the health endpoint, /health when empty
+}
+
+const defaultHealthPath = "/health"
+
+// LoadConfig reads <prefix>_URL, <prefix>_API_KEY and <prefix>_PRIVATE_KEY from the environment
+func LoadConfig(prefix string) models.GatewayConfig {
+	return models.GatewayConfig{
+		GatewayUrl:        mustGetenv(prefix + "_URL"),
+		GatewayApiKey:     mustGetenv(prefix + "_API_KEY"),
+		GatewayPrivateKey: mustGetenv(prefix + "_PRIVATE_KEY"),
+	}
+}
+
+func mustGetenv(key string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Fatalf("%s environment variable is not set", key)
+	}
+	return value
+}
+
+func (a *BaseAdapter) Name() string {
+	return a.GatewayName
+}
+
+func (a *BaseAdapter) Config() models.GatewayConfig {
+	return a.GatewayConfig
+}
+
+func (a *BaseAdapter) BuildRequest(transaction *models.Transaction, idempotencyKey string) (models.BuildExternalTransaction, error) {
+	transactionRequest := models.SendTransactionRequest{
+		ReferenceID: transaction.ReferenceID.String(),
+		Amount:      transaction.Amount,
+		UserID:      transaction.UserID,
+		Currency:    transaction.Currency,
+	}
+	if a.IdempotencyHeaderName == "" {
+		transactionRequest.IdempotencyKey = idempotencyKey
+	}
+	jsonData, err := json.Marshal(transactionRequest)
+	if err != nil {
+		return models.BuildExternalTransaction{}, fmt.Errorf("failed to serialize request to JSON: %w", err)
+	}
+
+	encryptedPayload, err := utils.EncryptAES(string(jsonData), a.GatewayConfig.GatewayPrivateKey)
+	if err != nil {
+		return models.BuildExternalTransaction{}, fmt.Errorf("failed to encrypt request for gateway %s: %w", a.GatewayName, err)
+	}
+
+	request, err := utils.BuildExternalTransactionRequest(a.DataFormat, encryptedPayload)
+	if err != nil {
+		return models.BuildExternalTransaction{}, err
+	}
+	if a.IdempotencyHeaderName != "" {
+		request.Headers = map[string]string{a.IdempotencyHeaderName: idempotencyKey}
+	}
+
+	return request, nil
+}
+
+func (a *BaseAdapter) IdempotencyHeader() string {
+	return a.IdempotencyHeaderName
+}
+
+// ParseResponse decodes the response body, an undecodable body yields an error result
+func (a *BaseAdapter) ParseResponse(statusCode int, contentType string, body []byte) models.GatewayTransactionResult {
+	result := models.GatewayTransactionResult{HTTPStatus: statusCode}
+
+	var response models.GatewayTransactionResponse
+	if err := utils.DecodeResponse(contentType, body, &response); err != nil {
+		result.Status = constants.ERROR
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Status = strings.ToLower(strings.TrimSpace(response.Status))
+	result.GatewayReference = response.Reference
+	result.Message = response.Message
+	result.ReasonCode = strings.ToLower(strings.TrimSpace(response.ReasonCode))
+	if result.Status == constants.DECLINED && result.ReasonCode == "" {
+		result.ReasonCode = constants.REASON_DECLINED
+	}
+
+	return result
+}
+
+func (a *BaseAdapter) ParseCallback(contentType string, body []byte) (*models.TransactionCallbackRequest, error) {
+	var request models.TransactionCallbackRequest
+	if err := utils.DecodeResponse(contentType, body, &request); err != nil {
+		return nil, err
+	}
+
+	status, err := a.MapStatus(request.Status)
+	if err != nil {
+		return nil, err
+	}
+	request.Status = status
+
+	return &request, nil
+}
+
+func (a *BaseAdapter) MapStatus(gatewayStatus string) (string, error) {
+	status, ok := a.StatusMapping[strings.ToLower(strings.TrimSpace(gatewayStatus))]
+	if !ok {
+		return "", fmt.Errorf("unknown status %q from gateway %s", gatewayStatus, a.GatewayName)
+	}
+	return status, nil
+}
+
+func (a *BaseAdapter) SupportsStatusQuery() bool {
+	return a.StatusQuery
+}
+
+func (a *BaseAdapter) ParseStatusResponse(contentType string, body []byte) (string, error) {
+	var response models.GatewayTransactionResponse
+	if err := utils.DecodeResponse(contentType, body, &response); err != nil {
+		return "", err
+	}
+
+	return a.MapStatus(response.Status)
+}
+
+func (a *BaseAdapter) HealthPath() string {
+	if a.HealthCheckPath == "" {
+		return defaultHealthPath
+	}
+	return a.HealthCheckPath
+}
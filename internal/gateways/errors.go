@@ -0,0 +1,88 @@
+package gateways
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrorClass tells the caller what to do with a failed gateway request
+type ErrorClass string
+
+const (
+	ErrorRetryable   ErrorClass = "retryable"   // transport failure, the same gateway may be tried again
+	ErrorUnavailable ErrorClass = "unavailable" // the gateway cannot process requests, fall back to another one
+	ErrorDeclined    ErrorClass = "declined"    // the gateway refused the transaction, the outcome is final
+	ErrorInternal    ErrorClass = "internal"    // a bug or misconfiguration on our side
+	ErrorUnknown     ErrorClass = "unknown"     // the request may have reached the gateway, its outcome must be queried before any resend
+)
+
+// ErrStatusQueryUnsupported is returned when a gateway cannot be asked for the status of a transaction
+var ErrStatusQueryUnsupported = errors.New("gateway does not support status queries")
+
+// ErrTransactionNotFound is returned when a gateway confirms it never received a transaction
+var ErrTransactionNotFound = errors.New("gateway has no record of the transaction")
+
+// Error is a classified error returned when talking to a gateway
+type Error struct {
+	Class            ErrorClass
+	Gateway          string
+	Reason           string // reason code of a declined transaction
+	GatewayReference string
+	Err              error
+}
+
+func (e *Error) Error() string {
+	if e.Class == ErrorDeclined {
+		return fmt.Sprintf("gateway %s declined the transaction (reason=%s): %v", e.Gateway, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("gateway %s %s error: %v", e.Gateway, e.Class, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewRetryableError(gateway string, err error) *Error {
+	return &Error{Class: ErrorRetryable, Gateway: gateway, Err: err}
+}
+
+func NewUnavailableError(gateway string, err error) *Error {
+	return &Error{Class: ErrorUnavailable, Gateway: gateway, Err: err}
+}
+
+func NewDeclinedError(gateway, reason, gatewayReference string, err error) *Error {
+	return &Error{Class: ErrorDeclined, Gateway: gateway, Reason: reason, GatewayReference: gatewayReference, Err: err}
+}
+
+func NewInternalError(gateway string, err error) *Error {
+	return &Error{Class: ErrorInternal, Gateway: gateway, Err: err}
+}
+
+func NewUnknownError(gateway string, err error) *Error {
+	return &Error{Class: ErrorUnknown, Gateway: gateway, Err: err}
+}
+
+// Classify returns the class of a gateway error, unclassified errors are internal
+func Classify(err error) ErrorClass {
+	var gatewayErr *Error
+	if errors.As(err, &gatewayErr) {
+		return gatewayErr.Class
+	}
+	return ErrorInternal
+}
+
+// IsRetryable reports whether the request may be sent to the same gateway again
+func IsRetryable(err error) bool {
+	return Classify(err) == ErrorRetryable
+}
+
+// IsTimeout reports whether a request to the gateway ran out of time before an answer arrived
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,37 @@
+package gatewaya
+
+import (
+	"payment-gateway/internal/gateways"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+)
+
+const Name = "A"
+
+// Adapter talks JSON to gateway A
+type Adapter struct {
+	gateways.BaseAdapter
+}
+
+// Init loads the gateway A configuration and registers its adapter
+func Init() {
+	gateways.Register(New(gateways.LoadConfig("GATEWAY_A")))
+}
+
+func New(config models.GatewayConfig) *Adapter {
+	return &Adapter{
+		BaseAdapter: gateways.BaseAdapter{
+			GatewayName:   Name,
+			DataFormat:    constants.JSON,
+			GatewayConfig: config,
+			StatusMapping: map[string]string{
+				"pending":   constants.SUBMITTED,
+				"completed": constants.COMPLETED,
+				"failed":    constants.FAILED,
+				"reversed":  constants.REVERSED,
+			},
+			StatusQuery:           true,
+			IdempotencyHeaderName: "Idempotency-Key",
+		},
+	}
+}
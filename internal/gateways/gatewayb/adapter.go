@@ -0,0 +1,37 @@
+package gatewayb
+
+import (
+	"payment-gateway/internal/gateways"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+)
+
+const Name = "B"
+
+// Adapter talks SOAP to gateway B, which cannot be asked for the status of a transaction
+// and reads the idempotency key from the encrypted payload
+type Adapter struct {
+	gateways.BaseAdapter
+}
+
+// Init loads the gateway B configuration and registers its adapter
+func Init() {
+	gateways.Register(New(gateways.LoadConfig("GATEWAY_B")))
+}
+
+func New(config models.GatewayConfig) *Adapter {
+	return &Adapter{
+		BaseAdapter: gateways.BaseAdapter{
+			GatewayName:   Name,
+			DataFormat:    constants.SOAP,
+			GatewayConfig: config,
+			StatusMapping: map[string]string{
+				"success":   constants.COMPLETED,
+				"completed": constants.COMPLETED,
+				"failed":    constants.FAILED,
+				"rejected":  constants.FAILED,
+				"refunded":  constants.REVERSED,
+			},
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package gatewayc
+
+import (
+	"payment-gateway/internal/gateways"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+)
+
+const Name = "C"
+
+// Adapter talks JSON to gateway C
+type Adapter struct {
+	gateways.BaseAdapter
+}
+
+// Init loads the gateway C configuration and registers its adapter
+func Init() {
+	gateways.Register(New(gateways.LoadConfig("GATEWAY_C")))
+}
+
+func New(config models.GatewayConfig) *Adapter {
+	return &Adapter{
+		BaseAdapter: gateways.BaseAdapter{
+			GatewayName:   Name,
+			DataFormat:    constants.JSON,
+			GatewayConfig: config,
+			StatusMapping: map[string]string{
+				"pending":   constants.SUBMITTED,
+				"completed": constants.COMPLETED,
+				"settled":   constants.COMPLETED,
+				"failed":    constants.FAILED,
+				"declined":  constants.FAILED,
+				"reversed":  constants.REVERSED,
+			},
+			StatusQuery:           true,
+			IdempotencyHeaderName: "X-Idempotency-Key",
+		},
+	}
+}
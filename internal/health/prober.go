@@ -0,0 +1,154 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+)
+
+// Checker calls the health endpoint of a gateway
+type Checker interface {
+	CheckHealth(ctx context.Context, adapter gateways.GatewayAdapter) error
+}
+
+type ProbeSettings struct {
+	Interval         time.Duration // pause between probes of every gateway
+	Timeout          time.Duration // how long a single probe may take
+	FailureThreshold int           // failed probes in a row that mark a healthy gateway unhealthy
+	SuccessThreshold int           // passed probes in a row that mark an unhealthy gateway healthy
+}
+
+// ProbeSettingsFromEnv reads the probe settings from HEALTH_PROBE_* environment variables
+func ProbeSettingsFromEnv() ProbeSettings {
+	return ProbeSettings{
+		Interval:         utils.GetEnvDuration("HEALTH_PROBE_INTERVAL", 30*time.Second),
+		Timeout:          utils.GetEnvDuration("HEALTH_PROBE_TIMEOUT", 5*time.Second),
+		FailureThreshold: utils.GetEnvInt("HEALTH_PROBE_FAILURE_THRESHOLD", 3),
+		SuccessThreshold: utils.GetEnvInt("HEALTH_PROBE_SUCCESS_THRESHOLD", 2),
+	}
+}
+
+// Prober calls the health endpoint of every gateway and turns its probe verdict between healthy and
+// unhealthy once enough probes in a row agree, so a single slow answer does not pull a gateway out of routing
+type Prober struct {
+	repo     repositories.IGatewayRepository
+	checker  Checker
+	settings ProbeSettings
+	now      func() time.Time
+}
+
+func NewProber(repo repositories.IGatewayRepository, checker Checker, settings ProbeSettings) *Prober {
+	return &Prober{
+		repo:     repo,
+		checker:  checker,
+		settings: settings,
+		now:      time.Now,
+	}
+}
+
+// RunOnce probes every gateway in the gateways table once. A gateway without a registered
+// adapter cannot be probed and keeps its status.
+func (p *Prober) RunOnce(ctx context.Context) error {
+	gatewayDetails, err := p.repo.GetGateways(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, gatewayDetail := range gatewayDetails {
+		adapter, err := gateways.Get(gatewayDetail.Name)
+		if err != nil {
+			log.Printf("Skipping health probe of gateway=[%s]: %v", gatewayDetail.Name, err)
+			continue
+		}
+
+		if err := p.probe(ctx, gatewayDetail, adapter); err != nil {
+			log.Printf("Failed to record health probe of gateway=[%s]: %v", gatewayDetail.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Prober) probe(ctx context.Context, gatewayDetail models.GatewayDetail, adapter gateways.GatewayAdapter) error {
+	probeCtx, cancel := context.WithTimeout(ctx, p.settings.Timeout)
+	startedAt := p.now()
+	checkErr := p.checker.CheckHealth(probeCtx, adapter)
+	completedAt := p.now()
+	cancel()
+
+	var healthStatus string
+	err := p.repo.UpdateHealth(ctx, gatewayDetail.ID, func(health *models.GatewayHealth) error {
+		defer func() { healthStatus = health.HealthStatus }()
+
+		previous := health.ProbeStatus
+		p.record(health, checkErr, startedAt, completedAt)
+		if health.ProbeStatus == previous {
+			return nil
+		}
+
+		var reason string
+		if checkErr != nil {
+			reason = fmt.Sprintf("%d health probe(s) failed in a row: %v", health.ConsecutiveFailures, checkErr)
+		} else {
+			reason = fmt.Sprintf("%d health probe(s) passed in a row", health.ConsecutiveSuccesses)
+		}
+		log.Printf("Health probes of gateway=[%s] turned %s: %s", gatewayDetail.Name, health.ProbeStatus, reason)
+		if settleHealthStatus(health, reason, completedAt) {
+			log.Printf("Gateway=[%s] marked %s: %s", gatewayDetail.Name, health.HealthStatus, reason)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The probe history is only there for operators, losing an entry must not fail the probe
+	passed := checkErr == nil
+	latencyMs := completedAt.Sub(startedAt).Milliseconds()
+	event := &models.GatewayHealthEvent{
+		GatewayID:    gatewayDetail.ID,
+		EventType:    constants.HEALTH_EVENT_PROBE,
+		HealthStatus: healthStatus,
+		ProbePassed:  &passed,
+		LatencyMs:    &latencyMs,
+		CreatedAt:    completedAt,
+	}
+	if checkErr != nil {
+		event.Reason = checkErr.Error()
+	}
+	if err := p.repo.InsertHealthEvent(ctx, event); err != nil {
+		log.Printf("Failed to record health probe event of gateway=[%s]: %v", gatewayDetail.Name, err)
+	}
+
+	return nil
+}
+
+// record adds the outcome of a probe to the health of a gateway
+func (p *Prober) record(health *models.GatewayHealth, checkErr error, startedAt, completedAt time.Time) {
+	health.LastCheckedAt = completedAt
+	health.LastCheckLatencyMs = completedAt.Sub(startedAt).Milliseconds()
+
+	if checkErr != nil {
+		health.LastCheckError = checkErr.Error()
+		health.ConsecutiveFailures++
+		health.ConsecutiveSuccesses = 0
+		if health.ProbeStatus != constants.UNHEALTHY && health.ConsecutiveFailures >= p.settings.FailureThreshold {
+			health.ProbeStatus = constants.UNHEALTHY
+		}
+		return
+	}
+
+	health.LastCheckError = ""
+	health.ConsecutiveSuccesses++
+	health.ConsecutiveFailures = 0
+	if health.ProbeStatus != constants.HEALTHY && health.ConsecutiveSuccesses >= p.settings.SuccessThreshold {
+		health.ProbeStatus = constants.HEALTHY
+	}
+}
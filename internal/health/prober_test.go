@@ -0,0 +1,223 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/gateways/gatewaya"
+	mocksClient "payment-gateway/mocks/client"
+	mocksRepository "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHealth(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Health Suite")
+}
+
+var _ = ginkgo.Describe("Prober", func() {
+	var (
+		mockRepo   *mocksRepository.MockGatewayRepository
+		mockClient *mocksClient.MockTransactionClient
+		prober     *Prober
+		health     *models.GatewayHealth
+		ctx        context.Context
+		now        time.Time
+	)
+
+	gateway := models.GatewayDetail{ID: 1, Name: gatewaya.Name}
+
+	ginkgo.BeforeEach(func() {
+		os.Setenv("GATEWAY_A_URL", "http://localhost:8081")
+		os.Setenv("GATEWAY_A_API_KEY", "api-key")
+		os.Setenv("GATEWAY_A_PRIVATE_KEY", "12345678901234567890123456789012")
+		gatewaya.Init()
+
+		ctx = context.Background()
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		mockRepo = new(mocksRepository.MockGatewayRepository)
+		mockClient = new(mocksClient.MockTransactionClient)
+		prober = NewProber(mockRepo, mockClient, ProbeSettings{
+			Interval:         30 * time.Second,
+			Timeout:          time.Second,
+			FailureThreshold: 2,
+			SuccessThreshold: 2,
+		})
+		prober.now = func() time.Time { return now }
+
+		health = &models.GatewayHealth{
+			GatewayID:     gateway.ID,
+			HealthStatus:  constants.HEALTHY,
+			ProbeStatus:   constants.HEALTHY,
+			TrafficStatus: constants.HEALTHY,
+		}
+		mockRepo.On("GetGateways", ctx).Return([]models.GatewayDetail{gateway}, nil)
+		mockRepo.On("UpdateHealth", ctx, gateway.ID).Return(health, nil)
+		mockRepo.On("InsertHealthEvent", ctx, mock.Anything).Return(nil)
+	})
+
+	ginkgo.AfterEach(func() {
+		os.Unsetenv("GATEWAY_A_URL")
+		os.Unsetenv("GATEWAY_A_API_KEY")
+		os.Unsetenv("GATEWAY_A_PRIVATE_KEY")
+	})
+
+	probeFails := func(err error) {
+		mockClient.On("CheckHealth", mock.Anything, mock.Anything).Return(err).Once()
+	}
+
+	ginkgo.Describe("RunOnce", func() {
+		ginkgo.It("should record the latency and outcome of the probe", func() {
+			mockClient.On("CheckHealth", mock.Anything, mock.Anything).
+				Run(func(mock.Arguments) { now = now.Add(120 * time.Millisecond) }).
+				Return(errors.New("connection refused")).
+				Once()
+
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.LastCheckedAt).To(gomega.Equal(now))
+			gomega.Expect(health.LastCheckLatencyMs).To(gomega.Equal(int64(120)))
+			gomega.Expect(health.LastCheckError).To(gomega.Equal("connection refused"))
+			gomega.Expect(health.ConsecutiveFailures).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should record the probe in the health history", func() {
+			health.HealthStatus = constants.DEGRADED
+			mockClient.On("CheckHealth", mock.Anything, mock.Anything).
+				Run(func(mock.Arguments) { now = now.Add(80 * time.Millisecond) }).
+				Return(errors.New("connection refused")).
+				Once()
+
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertHealthEvent", ctx, mock.MatchedBy(func(event *models.GatewayHealthEvent) bool {
+				return event.GatewayID == gateway.ID &&
+					event.EventType == constants.HEALTH_EVENT_PROBE &&
+					event.HealthStatus == constants.DEGRADED &&
+					*event.ProbePassed == false &&
+					*event.LatencyMs == 80 &&
+					event.Reason == "connection refused" &&
+					event.CreatedAt.Equal(now)
+			}))
+		})
+
+		ginkgo.It("should not fail the probe when its history cannot be recorded", func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.On("GetGateways", ctx).Return([]models.GatewayDetail{gateway}, nil)
+			mockRepo.On("UpdateHealth", ctx, gateway.ID).Return(health, nil)
+			mockRepo.On("InsertHealthEvent", ctx, mock.Anything).Return(errors.New("database error"))
+			probeFails(nil)
+
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(health.ConsecutiveSuccesses).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should probe with a timeout", func() {
+			mockClient.On("CheckHealth", mock.MatchedBy(func(probeCtx context.Context) bool {
+				deadline, ok := probeCtx.Deadline()
+				return ok && time.Until(deadline) <= time.Second
+			}), mock.Anything).Return(nil).Once()
+
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			mockClient.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should mark a gateway unhealthy only after consecutive failures", func() {
+			probeFails(errors.New("connection refused"))
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.HEALTHY))
+
+			probeFails(gateways.NewUnavailableError(gateway.Name, errors.New("health check failed (http_status=503)")))
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(health.ProbeStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.ConsecutiveFailures).To(gomega.Equal(2))
+			gomega.Expect(health.HealthStatusReason).To(gomega.HavePrefix("2 health probe(s) failed in a row: "))
+			gomega.Expect(health.HealthStatusChangedAt).To(gomega.HaveValue(gomega.Equal(now)))
+		})
+
+		ginkgo.It("should start counting failures again after a passed probe", func() {
+			probeFails(errors.New("connection refused"))
+			probeFails(nil)
+			probeFails(errors.New("connection refused"))
+
+			for i := 0; i < 3; i++ {
+				gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			}
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.HEALTHY))
+			gomega.Expect(health.ConsecutiveFailures).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should mark an unhealthy gateway healthy only after consecutive successes", func() {
+			health.HealthStatus = constants.UNHEALTHY
+			health.ProbeStatus = constants.UNHEALTHY
+			health.ConsecutiveFailures = 5
+			health.LastCheckError = "connection refused"
+
+			probeFails(nil)
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.ConsecutiveFailures).To(gomega.Equal(0))
+			gomega.Expect(health.LastCheckError).To(gomega.BeEmpty())
+
+			probeFails(nil)
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.HEALTHY))
+			gomega.Expect(health.HealthStatusReason).To(gomega.Equal("2 health probe(s) passed in a row"))
+		})
+
+		ginkgo.It("should keep a gateway unhealthy while its live traffic is unhealthy", func() {
+			health.HealthStatus = constants.UNHEALTHY
+			health.HealthStatusReason = "success rate 40.0% below 75.0% over the last 5m0s (50 requests)"
+			health.ProbeStatus = constants.UNHEALTHY
+			health.TrafficStatus = constants.UNHEALTHY
+
+			probeFails(nil)
+			probeFails(nil)
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.ProbeStatus).To(gomega.Equal(constants.HEALTHY))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.HealthStatusReason).To(gomega.HavePrefix("success rate"))
+		})
+
+		ginkgo.It("should keep probing a gateway in maintenance without changing its status", func() {
+			health.HealthStatus = constants.MAINTENANCE
+
+			probeFails(errors.New("connection refused"))
+			probeFails(errors.New("connection refused"))
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.ProbeStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.MAINTENANCE))
+		})
+
+		ginkgo.It("should skip gateways without an adapter", func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.On("GetGateways", ctx).Return([]models.GatewayDetail{{ID: 9, Name: "Z"}}, nil).Once()
+
+			gomega.Expect(prober.RunOnce(ctx)).To(gomega.Succeed())
+			mockClient.AssertNotCalled(ginkgo.GinkgoT(), "CheckHealth", mock.Anything, mock.Anything)
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateHealth", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return error when the gateways cannot be fetched", func() {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.On("GetGateways", ctx).Return(nil, errors.New("database error")).Once()
+
+			gomega.Expect(prober.RunOnce(ctx)).Should(gomega.HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,171 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+)
+
+// ScoreThresholds are the limits live traffic has to stay within. A zero limit is not checked.
+type ScoreThresholds struct {
+	SuccessRate float64       // lowest share of requests the gateway has to answer
+	TimeoutRate float64       // highest share of requests that may time out
+	P95Latency  time.Duration // highest 95th percentile latency
+}
+
+type ScoreSettings struct {
+	Interval        time.Duration // pause between scorings of every gateway
+	Window          time.Duration // how far back requests are scored
+	MinimumRequests int           // requests needed in the window before a gateway is judged
+	Degraded        ScoreThresholds
+	Unhealthy       ScoreThresholds
+}
+
+// ScoreSettingsFromEnv reads the scorer settings from HEALTH_SCORE_* environment variables
+func ScoreSettingsFromEnv() ScoreSettings {
+	return ScoreSettings{
+		Interval:        utils.GetEnvDuration("HEALTH_SCORE_INTERVAL", time.Minute),
+		Window:          utils.GetEnvDuration("HEALTH_SCORE_WINDOW", 5*time.Minute),
+		MinimumRequests: utils.GetEnvInt("HEALTH_SCORE_MINIMUM_REQUESTS", 20),
+		Degraded: ScoreThresholds{
+			SuccessRate: utils.GetEnvFloat("HEALTH_SCORE_DEGRADED_SUCCESS_RATE", 0.95),
+			TimeoutRate: utils.GetEnvFloat("HEALTH_SCORE_DEGRADED_TIMEOUT_RATE", 0.05),
+			P95Latency:  utils.GetEnvDuration("HEALTH_SCORE_DEGRADED_P95_LATENCY", 2*time.Second),
+		},
+		Unhealthy: ScoreThresholds{
+			SuccessRate: utils.GetEnvFloat("HEALTH_SCORE_UNHEALTHY_SUCCESS_RATE", 0.75),
+			TimeoutRate: utils.GetEnvFloat("HEALTH_SCORE_UNHEALTHY_TIMEOUT_RATE", 0.2),
+			P95Latency:  utils.GetEnvDuration("HEALTH_SCORE_UNHEALTHY_P95_LATENCY", 5*time.Second),
+		},
+	}
+}
+
+// Scorer judges every gateway by the requests TransactionProcessor sent it within a sliding window:
+// the share it answered, the share that timed out and the 95th percentile latency. A gateway that
+// crosses the degraded or unhealthy thresholds is demoted, and promoted again once its traffic is
+// back within them.
+type Scorer struct {
+	gatewayRepo repositories.IGatewayRepository
+	attemptRepo repositories.ITransactionAttemptRepository
+	settings    ScoreSettings
+	now         func() time.Time
+}
+
+func NewScorer(gatewayRepo repositories.IGatewayRepository, attemptRepo repositories.ITransactionAttemptRepository, settings ScoreSettings) *Scorer {
+	return &Scorer{
+		gatewayRepo: gatewayRepo,
+		attemptRepo: attemptRepo,
+		settings:    settings,
+		now:         time.Now,
+	}
+}
+
+// RunOnce scores the traffic of every gateway in the gateways table once
+func (s *Scorer) RunOnce(ctx context.Context) error {
+	now := s.now()
+
+	stats, err := s.attemptRepo.GetGatewayTrafficStats(ctx, now.Add(-s.settings.Window))
+	if err != nil {
+		return err
+	}
+	statsByGateway := make(map[int]models.GatewayTrafficStats, len(stats))
+	for _, gatewayStats := range stats {
+		statsByGateway[gatewayStats.GatewayID] = gatewayStats
+	}
+
+	gatewayDetails, err := s.gatewayRepo.GetGateways(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, gatewayDetail := range gatewayDetails {
+		if err := s.score(ctx, gatewayDetail, statsByGateway[gatewayDetail.ID], now); err != nil {
+			log.Printf("Failed to record traffic score of gateway=[%s]: %v", gatewayDetail.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scorer) score(ctx context.Context, gatewayDetail models.GatewayDetail, stats models.GatewayTrafficStats, now time.Time) error {
+	status, reason := s.evaluate(stats)
+
+	return s.gatewayRepo.UpdateHealth(ctx, gatewayDetail.ID, func(health *models.GatewayHealth) error {
+		health.TrafficRequests = stats.Requests
+		health.TrafficSuccessRate = 1
+		health.TrafficTimeoutRate = 0
+		if stats.Requests > 0 {
+			health.TrafficSuccessRate = float64(stats.Successes) / float64(stats.Requests)
+			health.TrafficTimeoutRate = float64(stats.Timeouts) / float64(stats.Requests)
+		}
+		health.TrafficP95LatencyMs = int64(math.Round(stats.P95LatencyMs))
+		health.TrafficScoredAt = &now
+
+		if status == "" {
+			// an unhealthy gateway gets no traffic to be judged on, once its probes pass it gets the capped
+			// share of a degraded one so it can earn its way back
+			if health.TrafficStatus != constants.UNHEALTHY || health.ProbeStatus != constants.HEALTHY {
+				return nil
+			}
+			status = constants.DEGRADED
+			reason += ", health probes pass so it gets a share of the traffic again"
+		}
+		if status == health.TrafficStatus {
+			return nil
+		}
+
+		log.Printf("Live traffic of gateway=[%s] turned %s: %s", gatewayDetail.Name, status, reason)
+		health.TrafficStatus = status
+		health.TrafficStatusReason = reason
+		if settleHealthStatus(health, reason, now) {
+			log.Printf("Gateway=[%s] marked %s: %s", gatewayDetail.Name, health.HealthStatus, reason)
+		}
+		return nil
+	})
+}
+
+// evaluate returns the verdict on the traffic of a gateway and why. The worst thresholds crossed decide.
+// No verdict is returned for a gateway with too few requests to judge, score keeps its previous one.
+func (s *Scorer) evaluate(stats models.GatewayTrafficStats) (string, string) {
+	if stats.Requests == 0 || stats.Requests < s.settings.MinimumRequests {
+		return "", fmt.Sprintf("%d request(s) in the last %s, too few to judge", stats.Requests, s.settings.Window)
+	}
+
+	successRate := float64(stats.Successes) / float64(stats.Requests)
+	timeoutRate := float64(stats.Timeouts) / float64(stats.Requests)
+	p95Latency := time.Duration(math.Round(stats.P95LatencyMs)) * time.Millisecond
+
+	levels := []struct {
+		status     string
+		thresholds ScoreThresholds
+	}{
+		{constants.UNHEALTHY, s.settings.Unhealthy},
+		{constants.DEGRADED, s.settings.Degraded},
+	}
+	for _, level := range levels {
+		var crossed []string
+		if successRate < level.thresholds.SuccessRate {
+			crossed = append(crossed, fmt.Sprintf("success rate %.1f%% below %.1f%%", 100*successRate, 100*level.thresholds.SuccessRate))
+		}
+		if level.thresholds.TimeoutRate > 0 && timeoutRate > level.thresholds.TimeoutRate {
+			crossed = append(crossed, fmt.Sprintf("timeout rate %.1f%% above %.1f%%", 100*timeoutRate, 100*level.thresholds.TimeoutRate))
+		}
+		if level.thresholds.P95Latency > 0 && p95Latency > level.thresholds.P95Latency {
+			crossed = append(crossed, fmt.Sprintf("p95 latency %s above %s", p95Latency, level.thresholds.P95Latency))
+		}
+		if len(crossed) > 0 {
+			return level.status, fmt.Sprintf("%s over the last %s (%d requests)", strings.Join(crossed, ", "), s.settings.Window, stats.Requests)
+		}
+	}
+
+	return constants.HEALTHY, fmt.Sprintf("success rate %.1f%%, timeout rate %.1f%% and p95 latency %s over the last %s (%d requests)",
+		100*successRate, 100*timeoutRate, p95Latency, s.settings.Window, stats.Requests)
+}
@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mocksRepository "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Scorer", func() {
+	var (
+		mockGatewayRepo *mocksRepository.MockGatewayRepository
+		mockAttemptRepo *mocksRepository.MockTransactionAttemptRepository
+		scorer          *Scorer
+		health          *models.GatewayHealth
+		ctx             context.Context
+		now             time.Time
+	)
+
+	gateway := models.GatewayDetail{ID: 1, Name: "A"}
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		mockGatewayRepo = new(mocksRepository.MockGatewayRepository)
+		mockAttemptRepo = new(mocksRepository.MockTransactionAttemptRepository)
+		scorer = NewScorer(mockGatewayRepo, mockAttemptRepo, ScoreSettings{
+			Window:          5 * time.Minute,
+			MinimumRequests: 10,
+			Degraded:        ScoreThresholds{SuccessRate: 0.95, TimeoutRate: 0.05, P95Latency: 2 * time.Second},
+			Unhealthy:       ScoreThresholds{SuccessRate: 0.75, TimeoutRate: 0.2, P95Latency: 5 * time.Second},
+		})
+		scorer.now = func() time.Time { return now }
+
+		health = &models.GatewayHealth{
+			GatewayID:     gateway.ID,
+			HealthStatus:  constants.HEALTHY,
+			ProbeStatus:   constants.HEALTHY,
+			TrafficStatus: constants.HEALTHY,
+		}
+		mockGatewayRepo.On("GetGateways", ctx).Return([]models.GatewayDetail{gateway}, nil)
+		mockGatewayRepo.On("UpdateHealth", ctx, gateway.ID).Return(health, nil)
+	})
+
+	trafficIs := func(stats ...models.GatewayTrafficStats) {
+		mockAttemptRepo.On("GetGatewayTrafficStats", ctx, now.Add(-5*time.Minute)).Return(stats, nil).Once()
+	}
+
+	ginkgo.Describe("RunOnce", func() {
+		ginkgo.It("should store the traffic stats of the window", func() {
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 50, Successes: 49, Timeouts: 1, P95LatencyMs: 420.4})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficRequests).To(gomega.Equal(50))
+			gomega.Expect(health.TrafficSuccessRate).To(gomega.BeNumerically("~", 0.98))
+			gomega.Expect(health.TrafficTimeoutRate).To(gomega.BeNumerically("~", 0.02))
+			gomega.Expect(health.TrafficP95LatencyMs).To(gomega.Equal(int64(420)))
+			gomega.Expect(health.TrafficScoredAt).To(gomega.HaveValue(gomega.Equal(now)))
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.HEALTHY))
+		})
+
+		ginkgo.It("should demote a gateway whose success rate drops below the unhealthy threshold", func() {
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 20, Successes: 10, P95LatencyMs: 300})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.TrafficStatusReason).To(gomega.Equal("success rate 50.0% below 75.0% over the last 5m0s (20 requests)"))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.HealthStatusReason).To(gomega.Equal(health.TrafficStatusReason))
+			gomega.Expect(health.HealthStatusChangedAt).To(gomega.HaveValue(gomega.Equal(now)))
+		})
+
+		ginkgo.It("should name every threshold crossed", func() {
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 10, Successes: 10, Timeouts: 3, P95LatencyMs: 6000})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.TrafficStatusReason).To(gomega.Equal("timeout rate 30.0% above 20.0%, p95 latency 6s above 5s over the last 5m0s (10 requests)"))
+		})
+
+		ginkgo.It("should mark a slow gateway degraded", func() {
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 40, Successes: 40, P95LatencyMs: 2500})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.DEGRADED))
+			gomega.Expect(health.TrafficStatusReason).To(gomega.Equal("p95 latency 2.5s above 2s over the last 5m0s (40 requests)"))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.DEGRADED))
+			gomega.Expect(health.HealthStatusReason).To(gomega.Equal(health.TrafficStatusReason))
+		})
+
+		ginkgo.It("should keep a degraded gateway unhealthy while its health probes fail", func() {
+			health.HealthStatus = constants.UNHEALTHY
+			health.ProbeStatus = constants.UNHEALTHY
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 40, Successes: 40, P95LatencyMs: 2500})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.DEGRADED))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.UNHEALTHY))
+		})
+
+		ginkgo.It("should leave a gateway in maintenance alone", func() {
+			health.HealthStatus = constants.MAINTENANCE
+			health.HealthStatusReason = "set by an operator"
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 20, Successes: 10})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.MAINTENANCE))
+			gomega.Expect(health.HealthStatusReason).To(gomega.Equal("set by an operator"))
+		})
+
+		ginkgo.It("should promote a gateway again once its traffic recovers", func() {
+			health.HealthStatus = constants.UNHEALTHY
+			health.TrafficStatus = constants.UNHEALTHY
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 30, Successes: 30, P95LatencyMs: 250})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.HEALTHY))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.HEALTHY))
+			gomega.Expect(health.HealthStatusReason).To(gomega.Equal("success rate 100.0%, timeout rate 0.0% and p95 latency 250ms over the last 5m0s (30 requests)"))
+		})
+
+		ginkgo.It("should promote an unhealthy gateway without enough traffic to judge once its probes pass", func() {
+			health.HealthStatus = constants.UNHEALTHY
+			health.TrafficStatus = constants.UNHEALTHY
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 3, Successes: 0})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.DEGRADED))
+			gomega.Expect(health.TrafficStatusReason).To(gomega.Equal("3 request(s) in the last 5m0s, too few to judge, health probes pass so it gets a share of the traffic again"))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.DEGRADED))
+		})
+
+		ginkgo.It("should keep the traffic verdict of a degraded gateway without enough traffic to judge", func() {
+			health.HealthStatus = constants.DEGRADED
+			health.TrafficStatus = constants.DEGRADED
+			health.TrafficStatusReason = "p95 latency 2.5s above 2s over the last 5m0s (40 requests)"
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 3, Successes: 3})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficRequests).To(gomega.Equal(3))
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.DEGRADED))
+			gomega.Expect(health.TrafficStatusReason).To(gomega.HavePrefix("p95 latency 2.5s"))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.DEGRADED))
+		})
+
+		ginkgo.It("should not demote a gateway without enough traffic to judge", func() {
+			trafficIs(models.GatewayTrafficStats{GatewayID: gateway.ID, Requests: 3, Successes: 0})
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.HEALTHY))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.HEALTHY))
+		})
+
+		ginkgo.It("should keep a gateway unhealthy while its health probes fail", func() {
+			health.HealthStatus = constants.UNHEALTHY
+			health.HealthStatusReason = "3 health probe(s) failed in a row: connection refused"
+			health.ProbeStatus = constants.UNHEALTHY
+			health.TrafficStatus = constants.UNHEALTHY
+			trafficIs()
+
+			gomega.Expect(scorer.RunOnce(ctx)).To(gomega.Succeed())
+
+			gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.TrafficRequests).To(gomega.Equal(0))
+			gomega.Expect(health.HealthStatus).To(gomega.Equal(constants.UNHEALTHY))
+			gomega.Expect(health.HealthStatusReason).To(gomega.HavePrefix("3 health probe(s) failed"))
+		})
+
+		ginkgo.It("should return error when the traffic stats cannot be fetched", func() {
+			mockAttemptRepo.On("GetGatewayTrafficStats", ctx, mock.Anything).Return(nil, errors.New("database error")).Once()
+
+			gomega.Expect(scorer.RunOnce(ctx)).Should(gomega.HaveOccurred())
+			mockGatewayRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateHealth", mock.Anything, mock.Anything)
+		})
+	})
+})
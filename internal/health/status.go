@@ -0,0 +1,58 @@
+package health
+
+import (
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+)
+
+// severity orders the verdicts of the health probes and the live traffic from best to worst
+var severity = map[string]int{
+	constants.HEALTHY:   0,
+	constants.DEGRADED:  1,
+	constants.UNHEALTHY: 2,
+}
+
+// settleHealthStatus sets the health status of a gateway to the worse verdict of its health probes and its
+// live traffic, and stores reason when the status changes. A gateway in maintenance is put there and taken
+// out by an operator, its status is left alone. It reports whether the health status changed.
+func settleHealthStatus(health *models.GatewayHealth, reason string, now time.Time) bool {
+	if health.HealthStatus == constants.MAINTENANCE {
+		return false
+	}
+
+	status := constants.HEALTHY
+	for _, verdict := range []string{health.ProbeStatus, health.TrafficStatus} {
+		if severity[verdict] > severity[status] {
+			status = verdict
+		}
+	}
+	if status == health.HealthStatus {
+		return false
+	}
+
+	health.HealthStatus = status
+	health.HealthStatusReason = reason
+	health.HealthStatusChangedAt = &now
+	return true
+}
+
+// SetMaintenance puts a gateway in maintenance or takes it out, on behalf of an operator. A gateway taken
+// out of maintenance gets the verdict of its health probes and live traffic again. It reports whether the
+// health status changed.
+func SetMaintenance(health *models.GatewayHealth, inMaintenance bool, reason string, now time.Time) bool {
+	if (health.HealthStatus == constants.MAINTENANCE) == inMaintenance {
+		return false
+	}
+
+	if inMaintenance {
+		health.HealthStatus = constants.MAINTENANCE
+		health.HealthStatusReason = reason
+		health.HealthStatusChangedAt = &now
+		return true
+	}
+
+	health.HealthStatus = ""
+	return settleHealthStatus(health, reason, now)
+}
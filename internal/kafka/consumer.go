@@ -2,14 +2,18 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
 	"payment-gateway/database"
+	"payment-gateway/internal/circuitbreaker"
 	"payment-gateway/internal/client"
 	"payment-gateway/internal/repositories"
+	"payment-gateway/pkg/utils"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
@@ -19,17 +23,13 @@ var (
 	consumerGroup             sarama.ConsumerGroup
 )
 
+// InitializeKafkaConsumer consumes the transaction and retry topics, LoadTopics must have been called
 func InitializeKafkaConsumer() {
 	kafkaBrokerUrl := os.Getenv("KAFKA_BROKER_URL")
 	if kafkaBrokerUrl == "" {
 		log.Fatalf("KAFKA_BROKER_URL environment variable is not set")
 	}
 
-	SendTransactionKafkaTopic = os.Getenv("SEND_TRANSACTION_KAFKA_TOPIC")
-	if SendTransactionKafkaTopic == "" {
-		log.Fatalf("SEND_TRANSACTION_KAFKA_TOPIC environment variable is not set")
-	}
-
 	brokers := strings.Split(kafkaBrokerUrl, ",")
 
 	kafkaGroupId := os.Getenv("KAFKA_GROUP_ID")
@@ -46,8 +46,10 @@ func InitializeKafkaConsumer() {
 	config.Consumer.Return.Errors = true
 	config.Version = sarama.V2_4_1_0
 	config.ClientID = kafkaClientId
+	// only offsets marked after processing are committed, see ConsumeClaim
 	config.Consumer.Offsets.AutoCommit.Enable = true
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	// a new consumer group starts at the oldest message, so transactions published before it joined are not skipped
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
 
 	var err error
 	consumerGroup, err = sarama.NewConsumerGroup(brokers, kafkaGroupId, config)
@@ -56,44 +58,157 @@ func InitializeKafkaConsumer() {
 	}
 
 	topics := []string{SendTransactionKafkaTopic}
+	for _, retryTopic := range RetryTopics {
+		topics = append(topics, retryTopic.Name)
+	}
 	startConsuming(topics)
 
 	log.Printf("Kafka connected to brokers: %s, topic: %s\n", brokers, topics)
 }
 
-type ConsumerHandler struct{}
+// ProcessingSettings controls how often a message is processed before it is given up on
+type ProcessingSettings struct {
+	MaxAttempts  int           // attempts before a failing message is dead-lettered
+	RetryBackoff time.Duration // delay before the second attempt, doubled for every further attempt
+}
+
+// ProcessingSettingsFromEnv reads the processing settings from CONSUMER_* environment variables
+func ProcessingSettingsFromEnv() ProcessingSettings {
+	return ProcessingSettings{
+		MaxAttempts:  utils.GetEnvInt("CONSUMER_MAX_ATTEMPTS", 5),
+		RetryBackoff: utils.GetEnvDuration("CONSUMER_RETRY_BACKOFF", time.Second),
+	}
+}
 
-func (ConsumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+// ConsumerHandler processes the claims of the consumer group. Its producer is shared by every claim and
+// closed by startConsuming once the group is closed.
+type ConsumerHandler struct {
+	settings ProcessingSettings
+	producer KafkaProducer
+}
+
+// ConsumeClaim marks a message only after its outcome is recorded, so a crash while it is processed
+// makes Kafka deliver it again
+func (h ConsumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	db := database.GetDB()
+	producer := h.producer
 
 	transactionHandler := NewTransactionHandler(
 		repositories.NewTransactionRepository(db),
-		NewKafkaProducer(),
+		producer,
 		client.NewTransactionClient(),
 		repositories.NewGatewayCountryRepository(db),
-		repositories.NewGatewayRepository(db),
+		circuitbreaker.NewCircuitBreaker(repositories.NewCircuitBreakerRepository(db), circuitbreaker.SettingsFromEnv()),
+		repositories.NewTransactionAttemptRepository(db),
+		repositories.NewProcessedMessageRepository(db),
 	)
 
 	for message := range claim.Messages() {
 		log.Printf("Message claimed: value = %s, topic = %s, partition = %d, offset = %d", string(message.Value), message.Topic, message.Partition, message.Offset)
-		session.MarkMessage(message, "")
 
-		switch message.Topic {
-		case SendTransactionKafkaTopic:
-			err := transactionHandler.HandleTransaction(context.Background(), message)
-			if err != nil {
-				return err
-			}
+		if message.Topic != SendTransactionKafkaTopic && !isRetryTopic(message.Topic) {
+			session.MarkMessage(message, "")
+			continue
+		}
+
+		// every message of a retry topic has the same delay, so the ones behind it are not due either
+		if !waitUntilDue(session.Context(), message, time.Now()) {
+			return nil
+		}
+
+		deadLetter := func(message *sarama.ConsumerMessage, cause error) error {
+			return producer.ProduceMessageWithHeaders(message.Value, DeadLetterKafkaTopic, deadLetterHeaders(message, cause, time.Now()))
 		}
+		if !processMessage(session.Context(), message, transactionHandler.HandleTransaction, deadLetter, h.settings) {
+			// the partition was revoked, the next owner receives the message again
+			return nil
+		}
+		session.MarkMessage(message, "")
 	}
 	return nil
 }
 
+// processMessage runs handle until it succeeds, retrying failures with a doubling backoff. A poison
+// message, or one that still fails after MaxAttempts, is handed to deadLetter so it does not block the
+// partition. It returns false when ctx ends before the message is done with, the message must not be
+// marked then.
+func processMessage(
+	ctx context.Context,
+	message *sarama.ConsumerMessage,
+	handle func(ctx context.Context, message *sarama.ConsumerMessage) error,
+	deadLetter func(message *sarama.ConsumerMessage, cause error) error,
+	settings ProcessingSettings,
+) bool {
+	backoff := settings.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := handle(ctx, message)
+		if err == nil {
+			return true
+		}
+
+		if errors.Is(err, ErrPoisonMessage) || attempt >= settings.MaxAttempts {
+			return deadLetterMessage(ctx, message, err, attempt, deadLetter, settings)
+		}
+
+		log.Printf("Failed to process message (topic = %s, partition = %d, offset = %d, attempt %d), retrying in %s: %v",
+			message.Topic, message.Partition, message.Offset, attempt, backoff, err)
+
+		if !sleep(ctx, backoff) {
+			return false
+		}
+		backoff *= 2
+	}
+}
+
+// deadLetterMessage moves a message that cannot be processed to the dead-letter topic. Publishing is
+// retried until it succeeds, a message must not be marked before it is safe on the dead-letter topic.
+func deadLetterMessage(
+	ctx context.Context,
+	message *sarama.ConsumerMessage,
+	cause error,
+	attempts int,
+	deadLetter func(message *sarama.ConsumerMessage, cause error) error,
+	settings ProcessingSettings,
+) bool {
+	log.Printf("Dead-lettering message after %d attempt(s) (topic = %s, partition = %d, offset = %d, value = %s): %v",
+		attempts, message.Topic, message.Partition, message.Offset, string(message.Value), cause)
+
+	backoff := settings.RetryBackoff
+	for {
+		err := deadLetter(message, cause)
+		if err == nil {
+			return true
+		}
+
+		log.Printf("Failed to dead-letter message (topic = %s, partition = %d, offset = %d), retrying in %s: %v",
+			message.Topic, message.Partition, message.Offset, backoff, err)
+
+		if !sleep(ctx, backoff) {
+			return false
+		}
+		backoff *= 2
+	}
+}
+
+// sleep waits for d, it returns false when ctx ends first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 func startConsuming(topics []string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	consumer := ConsumerHandler{}
+	producer := NewKafkaProducer()
+	consumer := ConsumerHandler{settings: ProcessingSettingsFromEnv(), producer: producer}
 	go func() {
 		for {
 			if err := consumerGroup.Consume(ctx, topics, consumer); err != nil {
@@ -110,6 +225,9 @@ func startConsuming(topics []string) {
 	if err := consumerGroup.Close(); err != nil {
 		log.Fatalf("Error closing consumer group: %v", err)
 	}
+	if err := producer.Close(); err != nil {
+		log.Printf("Error closing Kafka producer: %v", err)
+	}
 }
 
 func (ConsumerHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("processMessage", func() {
+	var (
+		ctx         context.Context
+		message     *sarama.ConsumerMessage
+		settings    ProcessingSettings
+		calls       int
+		deadLetter  func(message *sarama.ConsumerMessage, cause error) error
+		deadLetters []error
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		message = &sarama.ConsumerMessage{Topic: SendTransactionKafkaTopic, Value: []byte("{}")}
+		settings = ProcessingSettings{MaxAttempts: 3, RetryBackoff: time.Millisecond}
+		calls = 0
+		deadLetters = nil
+		deadLetter = func(message *sarama.ConsumerMessage, cause error) error {
+			deadLetters = append(deadLetters, cause)
+			return nil
+		}
+	})
+
+	ginkgo.It("should be done after the message is processed", func() {
+		done := processMessage(ctx, message, func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			calls++
+			return nil
+		}, deadLetter, settings)
+
+		gomega.Expect(done).To(gomega.BeTrue())
+		gomega.Expect(calls).To(gomega.Equal(1))
+		gomega.Expect(deadLetters).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should retry a failing message until it succeeds", func() {
+		done := processMessage(ctx, message, func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			calls++
+			if calls < 2 {
+				return errors.New("database unavailable")
+			}
+			return nil
+		}, deadLetter, settings)
+
+		gomega.Expect(done).To(gomega.BeTrue())
+		gomega.Expect(calls).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("should dead-letter a message that keeps failing", func() {
+		done := processMessage(ctx, message, func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			calls++
+			return errors.New("database unavailable")
+		}, deadLetter, settings)
+
+		gomega.Expect(done).To(gomega.BeTrue())
+		gomega.Expect(calls).To(gomega.Equal(settings.MaxAttempts))
+		gomega.Expect(deadLetters).To(gomega.HaveLen(1))
+		gomega.Expect(deadLetters[0]).To(gomega.MatchError("database unavailable"))
+	})
+
+	ginkgo.It("should dead-letter a poison message without retrying it", func() {
+		done := processMessage(ctx, message, func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			calls++
+			return fmt.Errorf("%w: invalid json", ErrPoisonMessage)
+		}, deadLetter, settings)
+
+		gomega.Expect(done).To(gomega.BeTrue())
+		gomega.Expect(calls).To(gomega.Equal(1))
+		gomega.Expect(deadLetters).To(gomega.HaveLen(1))
+		gomega.Expect(errors.Is(deadLetters[0], ErrPoisonMessage)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should keep publishing to the dead-letter topic until it succeeds", func() {
+		failures := 0
+		deadLetter = func(message *sarama.ConsumerMessage, cause error) error {
+			if failures < 2 {
+				failures++
+				return errors.New("broker down")
+			}
+			deadLetters = append(deadLetters, cause)
+			return nil
+		}
+
+		done := processMessage(ctx, message, func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			return ErrPoisonMessage
+		}, deadLetter, settings)
+
+		gomega.Expect(done).To(gomega.BeTrue())
+		gomega.Expect(deadLetters).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should not be done when the session ends before the message is dead-lettered", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		settings.RetryBackoff = time.Hour
+		deadLetter = func(message *sarama.ConsumerMessage, cause error) error {
+			cancel()
+			return errors.New("broker down")
+		}
+
+		done := processMessage(ctx, message, func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			return ErrPoisonMessage
+		}, deadLetter, settings)
+
+		gomega.Expect(done).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should not be done when the session ends before the message is processed", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		settings.RetryBackoff = time.Hour
+
+		done := processMessage(ctx, message, func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			calls++
+			cancel()
+			return errors.New("database unavailable")
+		}, deadLetter, settings)
+
+		gomega.Expect(done).To(gomega.BeFalse())
+		gomega.Expect(calls).To(gomega.Equal(1))
+	})
+})
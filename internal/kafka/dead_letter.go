@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/Shopify/sarama"
+)
+
+// deadLetterReadTimeout bounds the wait for a message the broker reported as present
+const deadLetterReadTimeout = 10 * time.Second
+
+// ErrDeadLetterNotFound is returned when there is no dead-letter message at the requested position
+var ErrDeadLetterNotFound = errors.New("dead-letter message not found")
+
+// DeadLetterReader reads DeadLetterKafkaTopic without consuming it, messages stay on the topic
+type DeadLetterReader interface {
+	ReadDeadLetters(limit int) ([]models.DeadLetterMessage, error)
+	ReadDeadLetter(partition int32, offset int64) (models.DeadLetterMessage, error)
+	Close() error
+}
+
+type SaramaDeadLetterReader struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+	topic    string
+}
+
+func NewDeadLetterReader() DeadLetterReader {
+	kafkaBrokers := os.Getenv("KAFKA_BROKER_URL")
+	if kafkaBrokers == "" {
+		kafkaBrokers = "localhost:9092"
+		log.Printf("KAFKA_BROKER_URL is not set. Using default: %s\n", kafkaBrokers)
+	}
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_4_1_0
+
+	client, err := sarama.NewClient(strings.Split(kafkaBrokers, ","), config)
+	if err != nil {
+		log.Fatalf("Failed to connect to Kafka: %v", err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		log.Fatalf("Failed to initialize Kafka consumer: %v", err)
+	}
+
+	return &SaramaDeadLetterReader{client: client, consumer: consumer, topic: DeadLetterKafkaTopic}
+}
+
+// ReadDeadLetters returns up to limit messages, oldest first within each partition
+func (r *SaramaDeadLetterReader) ReadDeadLetters(limit int) ([]models.DeadLetterMessage, error) {
+	partitions, err := r.client.Partitions(r.topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %w", r.topic, err)
+	}
+
+	var messages []models.DeadLetterMessage
+	for _, partition := range partitions {
+		if len(messages) >= limit {
+			break
+		}
+
+		oldest, err := r.client.GetOffset(r.topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get oldest offset of %s/%d: %w", r.topic, partition, err)
+		}
+		newest, err := r.client.GetOffset(r.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get newest offset of %s/%d: %w", r.topic, partition, err)
+		}
+		if oldest >= newest {
+			continue
+		}
+
+		partitionMessages, err := r.readPartition(partition, oldest, newest, limit-len(messages))
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, partitionMessages...)
+	}
+
+	return messages, nil
+}
+
+// ReadDeadLetter returns the message at the given position
+func (r *SaramaDeadLetterReader) ReadDeadLetter(partition int32, offset int64) (models.DeadLetterMessage, error) {
+	newest, err := r.client.GetOffset(r.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return models.DeadLetterMessage{}, fmt.Errorf("failed to get newest offset of %s/%d: %w", r.topic, partition, err)
+	}
+	if offset >= newest {
+		return models.DeadLetterMessage{}, ErrDeadLetterNotFound
+	}
+
+	messages, err := r.readPartition(partition, offset, offset+1, 1)
+	if err != nil {
+		if errors.Is(err, sarama.ErrOffsetOutOfRange) {
+			return models.DeadLetterMessage{}, ErrDeadLetterNotFound
+		}
+		return models.DeadLetterMessage{}, err
+	}
+	if len(messages) == 0 || messages[0].Offset != offset {
+		return models.DeadLetterMessage{}, ErrDeadLetterNotFound
+	}
+
+	return messages[0], nil
+}
+
+// readPartition reads the messages of a partition from offset up to (not including) until
+func (r *SaramaDeadLetterReader) readPartition(partition int32, offset, until int64, limit int) ([]models.DeadLetterMessage, error) {
+	partitionConsumer, err := r.consumer.ConsumePartition(r.topic, partition, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%d from offset %d: %w", r.topic, partition, offset, err)
+	}
+	defer partitionConsumer.Close()
+
+	var messages []models.DeadLetterMessage
+	for len(messages) < limit {
+		select {
+		case message := <-partitionConsumer.Messages():
+			messages = append(messages, toDeadLetterMessage(message))
+			if message.Offset >= until-1 {
+				return messages, nil
+			}
+		case err := <-partitionConsumer.Errors():
+			return nil, fmt.Errorf("failed to read %s/%d: %w", r.topic, partition, err)
+		case <-time.After(deadLetterReadTimeout):
+			// offsets can be skipped, e.g. by compaction, so the last one may never arrive
+			return messages, nil
+		}
+	}
+
+	return messages, nil
+}
+
+func (r *SaramaDeadLetterReader) Close() error {
+	if err := r.consumer.Close(); err != nil {
+		return err
+	}
+	return r.client.Close()
+}
+
+func toDeadLetterMessage(message *sarama.ConsumerMessage) models.DeadLetterMessage {
+	headers := make(map[string]string, len(message.Headers))
+	for _, h := range message.Headers {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
+	}
+
+	return models.DeadLetterMessage{
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Timestamp: message.Timestamp,
+		Headers:   headers,
+		Payload:   string(message.Value),
+	}
+}
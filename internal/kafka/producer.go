@@ -11,6 +11,8 @@ import (
 
 type KafkaProducer interface {
 	ProduceMessage(data []byte, topic string) error
+	ProduceMessageWithHeaders(data []byte, topic string, headers map[string]string) error
+	Close() error
 }
 
 type SaramaProducer struct {
@@ -25,6 +27,8 @@ func NewKafkaProducer() KafkaProducer {
 	}
 
 	config := sarama.NewConfig()
+	// record headers need Kafka 0.11 or later
+	config.Version = sarama.V2_4_1_0
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Retry.Max = 5
 	config.Producer.Return.Successes = true
@@ -41,10 +45,17 @@ func NewKafkaProducer() KafkaProducer {
 }
 
 func (p *SaramaProducer) ProduceMessage(data []byte, topic string) error {
+	return p.ProduceMessageWithHeaders(data, topic, nil)
+}
+
+func (p *SaramaProducer) ProduceMessageWithHeaders(data []byte, topic string, headers map[string]string) error {
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
 		Value: sarama.ByteEncoder(data),
 	}
+	for key, value := range headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
 
 	log.Printf("Sending message to Kafka topic %s...\n", topic)
 	partition, offset, err := p.producer.SendMessage(msg)
@@ -55,3 +66,8 @@ func (p *SaramaProducer) ProduceMessage(data []byte, topic string) error {
 	log.Printf("Message sent successfully to topic %s, partition %d, offset %d\n", topic, partition, offset)
 	return nil
 }
+
+// Close flushes and closes the underlying producer
+func (p *SaramaProducer) Close() error {
+	return p.producer.Close()
+}
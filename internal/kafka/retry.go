@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Headers carried by transaction messages. The attempt counter picks the retry topic of the next
+// attempt, the other headers describe where a dead-lettered message came from and why it failed.
+const (
+	HeaderAttempt           = "x-attempt"
+	HeaderRetryAt           = "x-retry-at"
+	HeaderError             = "x-error"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderOriginalTimestamp = "x-original-timestamp"
+	HeaderFailedAt          = "x-failed-at"
+)
+
+// RetryTopic holds transactions waiting for another attempt. A message is consumed once Delay
+// has passed since it was published.
+type RetryTopic struct {
+	Name  string
+	Delay time.Duration
+}
+
+var (
+	// RetryTopics are used in order, retry n of a transaction goes to RetryTopics[n-1]
+	RetryTopics []RetryTopic
+	// DeadLetterKafkaTopic receives messages that exhausted RetryTopics or can never be processed
+	DeadLetterKafkaTopic string
+)
+
+// LoadTopics reads the transaction, retry and dead-letter topic names from the environment
+func LoadTopics() {
+	SendTransactionKafkaTopic = os.Getenv("SEND_TRANSACTION_KAFKA_TOPIC")
+	if SendTransactionKafkaTopic == "" {
+		log.Fatalf("SEND_TRANSACTION_KAFKA_TOPIC environment variable is not set")
+	}
+
+	delays := os.Getenv("RETRY_TOPIC_DELAYS")
+	if delays == "" {
+		delays = "10s,1m,10m"
+	}
+
+	var err error
+	RetryTopics, err = parseRetryTopics(SendTransactionKafkaTopic, delays)
+	if err != nil {
+		log.Fatalf("RETRY_TOPIC_DELAYS is invalid: %v", err)
+	}
+
+	DeadLetterKafkaTopic = os.Getenv("DEAD_LETTER_KAFKA_TOPIC")
+	if DeadLetterKafkaTopic == "" {
+		DeadLetterKafkaTopic = SendTransactionKafkaTopic + "-dlq"
+	}
+}
+
+// parseRetryTopics builds one retry topic per comma separated delay, named after the transaction topic
+func parseRetryTopics(topic, delays string) ([]RetryTopic, error) {
+	var retryTopics []RetryTopic
+	for i, value := range strings.Split(delays, ",") {
+		delay, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		if delay <= 0 {
+			return nil, fmt.Errorf("delay %s must be positive", value)
+		}
+		retryTopics = append(retryTopics, RetryTopic{
+			Name:  fmt.Sprintf("%s-retry-%d", topic, i+1),
+			Delay: delay,
+		})
+	}
+	return retryTopics, nil
+}
+
+// isRetryTopic reports whether topic is one of RetryTopics
+func isRetryTopic(topic string) bool {
+	for _, retryTopic := range RetryTopics {
+		if retryTopic.Name == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// header returns the value of the message header with the given key
+func header(message *sarama.ConsumerMessage, key string) string {
+	for _, h := range message.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// messageAttempt returns the attempt counter of a message, a message without one is the first attempt
+func messageAttempt(message *sarama.ConsumerMessage) (int, error) {
+	value := header(message, HeaderAttempt)
+	if value == "" {
+		return 0, nil
+	}
+
+	attempt, err := strconv.Atoi(value)
+	if err != nil || attempt < 0 {
+		return 0, fmt.Errorf("invalid %s header %q", HeaderAttempt, value)
+	}
+	return attempt, nil
+}
+
+// retryHeaders returns the headers of the given attempt, due once the retry topic's delay has passed
+func retryHeaders(attempt int, retryTopic RetryTopic, now time.Time) map[string]string {
+	return map[string]string{
+		HeaderAttempt: strconv.Itoa(attempt),
+		HeaderRetryAt: now.Add(retryTopic.Delay).UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// deadLetterHeaders keeps the headers of the failed message and adds the error and where the message came from
+func deadLetterHeaders(message *sarama.ConsumerMessage, cause error, now time.Time) map[string]string {
+	headers := make(map[string]string, len(message.Headers)+6)
+	for _, h := range message.Headers {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	delete(headers, HeaderRetryAt)
+
+	headers[HeaderError] = cause.Error()
+	headers[HeaderOriginalTopic] = message.Topic
+	headers[HeaderOriginalPartition] = strconv.Itoa(int(message.Partition))
+	headers[HeaderOriginalOffset] = strconv.FormatInt(message.Offset, 10)
+	headers[HeaderOriginalTimestamp] = message.Timestamp.UTC().Format(time.RFC3339Nano)
+	headers[HeaderFailedAt] = now.UTC().Format(time.RFC3339Nano)
+	return headers
+}
+
+// waitUntilDue blocks until a message of a retry topic is due. It returns false when ctx ends first.
+func waitUntilDue(ctx context.Context, message *sarama.ConsumerMessage, now time.Time) bool {
+	retryAt, err := time.Parse(time.RFC3339Nano, header(message, HeaderRetryAt))
+	if err != nil || !retryAt.After(now) {
+		return true
+	}
+	return sleep(ctx, retryAt.Sub(now))
+}
@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Retry topics", func() {
+	ginkgo.Describe("parseRetryTopics", func() {
+		ginkgo.It("should create a topic per delay", func() {
+			retryTopics, err := parseRetryTopics("process-transaction", "10s, 1m,10m")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(retryTopics).To(gomega.Equal([]RetryTopic{
+				{Name: "process-transaction-retry-1", Delay: 10 * time.Second},
+				{Name: "process-transaction-retry-2", Delay: time.Minute},
+				{Name: "process-transaction-retry-3", Delay: 10 * time.Minute},
+			}))
+		})
+
+		ginkgo.It("should reject an invalid delay", func() {
+			_, err := parseRetryTopics("process-transaction", "10s,soon")
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should reject a delay that is not positive", func() {
+			_, err := parseRetryTopics("process-transaction", "0s")
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("messageAttempt", func() {
+		ginkgo.It("should treat a message without the header as the first attempt", func() {
+			attempt, err := messageAttempt(&sarama.ConsumerMessage{})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(attempt).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should read the attempt header", func() {
+			attempt, err := messageAttempt(&sarama.ConsumerMessage{
+				Headers: []*sarama.RecordHeader{{Key: []byte(HeaderAttempt), Value: []byte("2")}},
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(attempt).To(gomega.Equal(2))
+		})
+	})
+
+	ginkgo.Describe("waitUntilDue", func() {
+		var now time.Time
+
+		ginkgo.BeforeEach(func() {
+			now = time.Now()
+		})
+
+		ginkgo.It("should not wait for a message that is due", func() {
+			message := &sarama.ConsumerMessage{
+				Headers: []*sarama.RecordHeader{{Key: []byte(HeaderRetryAt), Value: []byte(now.Format(time.RFC3339Nano))}},
+			}
+			gomega.Expect(waitUntilDue(context.Background(), message, now)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should give up when the session ends before the message is due", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			message := &sarama.ConsumerMessage{
+				Headers: []*sarama.RecordHeader{{Key: []byte(HeaderRetryAt), Value: []byte(now.Add(time.Hour).Format(time.RFC3339Nano))}},
+			}
+			gomega.Expect(waitUntilDue(ctx, message, now)).To(gomega.BeFalse())
+		})
+	})
+})
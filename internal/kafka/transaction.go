@@ -1,25 +1,46 @@
 package kafka
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
 
+	"payment-gateway/internal/circuitbreaker"
 	"payment-gateway/internal/client"
-	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateways"
 	"payment-gateway/internal/repositories"
 	"payment-gateway/models"
 	"payment-gateway/pkg/constants"
 	"payment-gateway/pkg/utils"
 
 	"github.com/Shopify/sarama"
+	"github.com/google/uuid"
 )
 
-const (
-	maxRetries = 3
-)
+// sendRetryPolicy resends a request that never reached the gateway to the same gateway. It is kept short,
+// the consumer of the partition waits for it.
+var sendRetryPolicy = utils.RetryPolicy{
+	Name:           "SendTransaction",
+	MaxAttempts:    3,
+	MaxElapsedTime: 3 * time.Second,
+	InitialDelay:   200 * time.Millisecond,
+	MaxDelay:       time.Second,
+	Backoff:        utils.BackoffExponential,
+	Retryable:      gateways.IsRetryable,
+}
+
+// errGatewaysExhausted is returned when every gateway of the transaction's country has been tried
+var errGatewaysExhausted = errors.New("all gateways of the country have been tried")
+
+// ErrPoisonMessage is returned for a message that can never be processed, delivering it again does not help
+var ErrPoisonMessage = errors.New("poison message")
 
 // TransactionConsumer defines the interface for handling Kafka messages
 type TransactionConsumer interface {
@@ -32,7 +53,12 @@ type TransactionHandler struct {
 	kafkaProducer         KafkaProducer
 	sendTransactionClient client.ITransactionClient
 	gatewayCountryRepo    repositories.IGatewayCountryRepository
-	gatewayRepo           repositories.IGatewayRepository
+	circuitBreaker        circuitbreaker.ICircuitBreaker
+	attemptRepo           repositories.ITransactionAttemptRepository
+	processedMessageRepo  repositories.IProcessedMessageRepository
+	sendRetryPolicy       utils.RetryPolicy
+	degradedTrafficShare  float64 // share of transactions that may go to a degraded gateway while a healthy one is left
+	now                   func() time.Time
 }
 
 // NewTransactionHandler initializes a new TransactionHandler
@@ -41,42 +67,137 @@ func NewTransactionHandler(
 	kafkaProducer KafkaProducer,
 	sendTransactionClient client.ITransactionClient,
 	gatewayCountryRepo repositories.IGatewayCountryRepository,
-	gatewayRepo repositories.IGatewayRepository,
+	circuitBreaker circuitbreaker.ICircuitBreaker,
+	attemptRepo repositories.ITransactionAttemptRepository,
+	processedMessageRepo repositories.IProcessedMessageRepository,
 ) *TransactionHandler {
 	return &TransactionHandler{
 		transactionRepo:       transactionRepo,
 		kafkaProducer:         kafkaProducer,
 		sendTransactionClient: sendTransactionClient,
 		gatewayCountryRepo:    gatewayCountryRepo,
-		gatewayRepo:           gatewayRepo,
+		circuitBreaker:        circuitBreaker,
+		attemptRepo:           attemptRepo,
+		processedMessageRepo:  processedMessageRepo,
+		sendRetryPolicy:       sendRetryPolicy,
+		degradedTrafficShare:  utils.GetEnvFloat("ROUTING_DEGRADED_TRAFFIC_SHARE", 0.1),
+		now:                   time.Now,
 	}
 }
 
+// HandleTransaction processes a transaction message. It returns nil once the outcome is recorded,
+// so the message may be committed, and ErrPoisonMessage for a message that cannot be decoded.
+// A message that was already handled is skipped.
 func (h *TransactionHandler) HandleTransaction(ctx context.Context, message *sarama.ConsumerMessage) error {
-	var transaction *models.Transaction
-	if err := json.Unmarshal(message.Value, &transaction); err != nil {
+	var transactionMessage *models.TransactionMessage
+	if err := json.Unmarshal(message.Value, &transactionMessage); err != nil {
 		log.Printf("Failed to unmarshal message: %v", err)
+		return fmt.Errorf("%w: %v", ErrPoisonMessage, err)
+	}
+	if transactionMessage == nil || transactionMessage.ReferenceID == uuid.Nil {
+		return fmt.Errorf("%w: message without a transaction reference ID", ErrPoisonMessage)
+	}
+
+	attempt, err := messageAttempt(message)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPoisonMessage, err)
+	}
+	referenceID := transactionMessage.ReferenceID.String()
+
+	processed, err := h.processedMessageRepo.IsMessageProcessed(ctx, referenceID, attempt)
+	if err != nil {
+		log.Printf("Failed to IsMessageProcessed: %v", err)
+		return err
+	}
+	if processed {
+		log.Printf("Skipping transaction %s attempt %d, the message was already processed", referenceID, attempt)
+		return nil
+	}
+
+	if err := h.handleTransaction(ctx, message, transactionMessage, attempt); err != nil {
+		return err
+	}
+
+	if err := h.processedMessageRepo.MarkMessageProcessed(ctx, referenceID, attempt); err != nil {
+		log.Printf("Failed to MarkMessageProcessed: %v", err)
 		return err
 	}
 
-	log.Printf("Processing transaction: %v", transaction)
+	return nil
+}
+
+// handleTransaction sends the transaction to a gateway and records the outcome. An error means the
+// outcome could not be recorded and the message has to be processed again.
+func (h *TransactionHandler) handleTransaction(ctx context.Context, message *sarama.ConsumerMessage, transactionMessage *models.TransactionMessage, attempt int) error {
+	transaction := &transactionMessage.Transaction
 
-	err := h.TransactionProcessor(ctx, transaction)
+	log.Printf("Processing transaction: %v, attempt: %d, tried gateway IDs: %v", transaction, attempt, transactionMessage.TriedGatewayIDs)
+
+	err := h.transactionRepo.ClaimTransactionByReferenceID(ctx, transaction.ReferenceID.String(), attempt)
 	if err != nil {
-		if err.Error() == "error while SendTransaction" {
-			log.Printf("Republish transactionID=%d to be retried, fallback to another gateway", transaction.ID)
+		var transitionErr *utils.TransitionError
+		if errors.As(err, &transitionErr) || errors.Is(err, repositories.ErrTransactionClaimed) {
+			// a duplicate or stale message for a transaction that already moved on or is being sent by another worker
+			log.Printf("Skipping transaction %s attempt %d: %v", transaction.ReferenceID, attempt, err)
+			return nil
+		}
+		log.Printf("Failed to ClaimTransactionByReferenceID: %v", err)
+		return err
+	}
 
-			go h.kafkaProducer.ProduceMessage(message.Value, SendTransactionKafkaTopic)
-			return err
+	err = h.TransactionProcessor(ctx, transactionMessage, attempt)
+	if err != nil {
+		if errors.Is(err, errGatewaysExhausted) {
+			log.Printf("Transaction %s failed, no gateway left to fall back to", transaction.ReferenceID)
+			if errFail := h.transactionRepo.FailTransactionByReferenceID(ctx, transaction.ReferenceID.String(), constants.REASON_GATEWAYS_EXHAUSTED); errFail != nil {
+				log.Printf("Failed to FailTransactionByReferenceID: %v", errFail)
+				return errFail
+			}
+			return nil
+		}
+
+		switch gateways.Classify(err) {
+		case gateways.ErrorDeclined:
+			// a declined transaction is final, there is no point in trying another gateway
+			reason := constants.REASON_DECLINED
+			var gatewayErr *gateways.Error
+			if errors.As(err, &gatewayErr) && gatewayErr.Reason != "" {
+				reason = gatewayErr.Reason
+			}
+
+			log.Printf("Transaction %s declined, reason=[%s]: %v", transaction.ReferenceID, reason, err)
+			if errFail := h.transactionRepo.FailTransactionByReferenceID(ctx, transaction.ReferenceID.String(), reason); errFail != nil {
+				log.Printf("Failed to FailTransactionByReferenceID: %v", errFail)
+				return errFail
+			}
+			return nil
+
+		case gateways.ErrorRetryable, gateways.ErrorUnavailable:
+			return h.retryTransaction(ctx, message, transactionMessage, attempt, err)
+
+		case gateways.ErrorUnknown:
+			return h.resolveInDoubt(ctx, transaction, err)
 		}
 
-		errUpdateTransactionStatus := h.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, transaction.ReferenceID.String(), constants.RETRY)
+		log.Printf("Transaction %s parked for retry: %v", transaction.ReferenceID, err)
+		errUpdateTransactionStatus := h.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, transaction.ReferenceID.String(), constants.RETRY, "internal error")
 		if errUpdateTransactionStatus != nil {
-			log.Printf("Failed to UpdateTransactionStatusByReferenceID: %v", err)
+			log.Printf("Failed to UpdateTransactionStatusByReferenceID: %v", errUpdateTransactionStatus)
 			return errUpdateTransactionStatus
 		}
 
-		return err
+		return nil
+	}
+
+	err = h.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, transaction.ReferenceID.String(), constants.SUBMITTED, "accepted by gateway")
+	if err != nil {
+		var transitionErr *utils.TransitionError
+		if !errors.As(err, &transitionErr) {
+			log.Printf("Failed to UpdateTransactionStatusByReferenceID: %v", err)
+			return err
+		}
+		// the callback got here first, the transaction is already past submitted
+		log.Printf("Transaction %s not marked as submitted: %v", transaction.ReferenceID, err)
 	}
 
 	log.Printf("Transaction successfully processed: %v", transaction)
@@ -84,54 +205,173 @@ func (h *TransactionHandler) HandleTransaction(ctx context.Context, message *sar
 	return nil
 }
 
-func (h *TransactionHandler) TransactionProcessor(ctx context.Context, transaction *models.Transaction) error {
-	gateway, err := h.gatewayCountryRepo.GetHealthyGatewayByCountryID(ctx, transaction.CountryID)
+// retryTransaction publishes the transaction to the retry topic of its next attempt, so another gateway
+// is tried once the topic's delay has passed. When every retry topic was used the message goes to the
+// dead-letter topic and the transaction is parked in retry. The published message is the outcome of
+// this one, so it must reach the broker before this one is committed.
+func (h *TransactionHandler) retryTransaction(
+	ctx context.Context,
+	message *sarama.ConsumerMessage,
+	transactionMessage *models.TransactionMessage,
+	attempt int,
+	cause error,
+) error {
+	transaction := &transactionMessage.Transaction
+
+	messageBytes, err := json.Marshal(transactionMessage)
 	if err != nil {
-		log.Printf("Failed to GetHealthyGatewayByCountryID: %v", err)
+		log.Printf("Failed to marshal Kafka message: %v", err)
 		return err
 	}
 
-	gatewayConfig, err := config.GatewayConfigSelection(gateway.Name)
-	if err != nil {
-		log.Printf("Failed while GatewayConfigSelection: %v", err)
+	next := attempt + 1
+	if next > len(RetryTopics) {
+		log.Printf("Transaction %s exhausted %d retries, moving it to %s: %v", transaction.ReferenceID, len(RetryTopics), DeadLetterKafkaTopic, cause)
+
+		if err := h.kafkaProducer.ProduceMessageWithHeaders(messageBytes, DeadLetterKafkaTopic, deadLetterHeaders(message, cause, h.now())); err != nil {
+			log.Printf("Failed to dead-letter transaction %s: %v", transaction.ReferenceID, err)
+			return err
+		}
+
+		if err := h.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, transaction.ReferenceID.String(), constants.RETRY, "retries exhausted"); err != nil {
+			log.Printf("Failed to UpdateTransactionStatusByReferenceID: %v", err)
+			return err
+		}
+		return nil
+	}
+
+	retryTopic := RetryTopics[next-1]
+	log.Printf("Retrying transaction %s in %s through %s, fallback to another gateway: %v", transaction.ReferenceID, retryTopic.Delay, retryTopic.Name, cause)
+
+	if err := h.kafkaProducer.ProduceMessageWithHeaders(messageBytes, retryTopic.Name, retryHeaders(next, retryTopic, h.now())); err != nil {
+		log.Printf("Failed to republish transaction %s: %v", transaction.ReferenceID, err)
+		return err
+	}
+	return nil
+}
+
+// resolveInDoubt puts a transaction whose outcome is unknown in doubt and asks the gateway it was sent to
+// what became of it, with the same reference the gateway saw. The transaction is only routed again once
+// the gateway confirmed it has no record of it: it is parked in retry for the RetryScheduler. A transaction
+// the gateway cannot tell about yet stays in doubt for the StatusPoller and the ExpirySweeper.
+func (h *TransactionHandler) resolveInDoubt(ctx context.Context, transaction *models.Transaction, cause error) error {
+	referenceID := transaction.ReferenceID.String()
+
+	log.Printf("Transaction %s is in doubt: %v", referenceID, cause)
+	if err := h.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, referenceID, constants.IN_DOUBT, "gateway outcome unknown"); err != nil {
+		log.Printf("Failed to UpdateTransactionStatusByReferenceID: %v", err)
 		return err
 	}
 
-	transactionRequest := models.SendTransactionRequest{
-		ReferenceID: transaction.ReferenceID.String(),
-		Amount:      transaction.Amount,
-		UserID:      transaction.UserID,
-		Currency:    transaction.Currency,
+	var gatewayErr *gateways.Error
+	if !errors.As(cause, &gatewayErr) {
+		log.Printf("Transaction %s stays in doubt, the error does not tell which gateway to ask, gateway ID=%d", referenceID, transaction.GatewayID)
+		return nil
 	}
-	jsonData, err := json.Marshal(transactionRequest)
+	adapter, err := gateways.Get(gatewayErr.Gateway)
 	if err != nil {
-		return fmt.Errorf("failed to serialize request to JSON: %w", err)
+		log.Printf("Transaction %s stays in doubt, failed while looking up gateway adapter: %v", referenceID, err)
+		return nil
+	}
+
+	status, err := h.sendTransactionClient.QueryTransactionStatus(ctx, referenceID, adapter)
+	switch {
+	case errors.Is(err, gateways.ErrTransactionNotFound):
+		status = constants.RETRY
+		err = h.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, referenceID, status, "gateway confirmed the transaction does not exist")
+	case err != nil:
+		log.Printf("Transaction %s stays in doubt, failed to query its status: %v", referenceID, err)
+		return nil
+	case status == constants.SUBMITTED || utils.IsFinalStatus(status):
+		err = h.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, referenceID, status, "gateway status query")
+	default:
+		log.Printf("Transaction %s stays in doubt, gateway reported it as %s", referenceID, status)
+		return nil
 	}
 
-	encryptedPayload, err := utils.EncryptAES(string(jsonData), gatewayConfig.GatewayPrivateKey)
 	if err != nil {
-		log.Printf("Failed while EncryptAES: %v", err)
-		return err
+		var transitionErr *utils.TransitionError
+		if !errors.As(err, &transitionErr) {
+			log.Printf("Failed to UpdateTransactionStatusByReferenceID: %v", err)
+			return err
+		}
+		// a callback resolved the transaction in the meantime
+		log.Printf("Transaction %s not marked as %s: %v", referenceID, status, err)
+		return nil
 	}
 
-	builtExternalTransaction, err := utils.BuildExternalTransactionRequest(gateway.DataFormatSupported, encryptedPayload)
+	log.Printf("Transaction %s resolved as %s by gateway=[%s]", referenceID, status, gatewayErr.Gateway)
+	return nil
+}
+
+// TransactionProcessor sends the transaction to the best gateway not tried yet. A gateway that
+// fails to process it is added to the message's TriedGatewayIDs. A gateway that may have executed
+// the transaction is recorded as its gateway instead, so it can be asked for the outcome. Every request
+// of an attempt carries the same idempotency key, so a resend cannot execute the transaction twice.
+func (h *TransactionHandler) TransactionProcessor(ctx context.Context, message *models.TransactionMessage, attempt int) error {
+	transaction := &message.Transaction
+
+	gateway, err := h.selectGateway(ctx, message)
 	if err != nil {
-		log.Printf("Failed while BuildExternalTransactionRequest: %v", err)
 		return err
 	}
 
-	// retry until 3 times, if its still failed, fallback to another available gateway
-	err = utils.RetryOperation(func() error {
-		return h.sendTransactionClient.SendTransaction(ctx, builtExternalTransaction, gateway.Name, gatewayConfig)
-	}, maxRetries)
+	adapter, err := gateways.Get(gateway.Name)
+	if err != nil {
+		log.Printf("Failed while looking up gateway adapter: %v", err)
+		h.releaseCircuitBreaker(ctx, gateway.ID)
+		return gateways.NewInternalError(gateway.Name, err)
+	}
+
+	builtExternalTransaction, err := adapter.BuildRequest(transaction, gateways.IdempotencyKey(transaction.ReferenceID.String(), attempt))
 	if err != nil {
-		log.Printf("Failed while SendTransaction: %v", err)
-		updateErr := h.gatewayRepo.UpdateHealthStatus(ctx, gateway.ID, constants.UNHEALTHY)
-		if updateErr != nil {
-			log.Printf("Failed to update health status for gateway ID %d: %v", gateway.ID, updateErr)
-			return updateErr
+		log.Printf("Failed while BuildRequest: %v", err)
+		h.releaseCircuitBreaker(ctx, gateway.ID)
+		return gateways.NewInternalError(gateway.Name, err)
+	}
+
+	// only requests that never reached the gateway are retried on the same gateway, anything else
+	// is decided on right away. A request with an unknown outcome is never resent.
+	sendErr := h.sendRetryPolicy.Do(ctx, func() error {
+		startedAt := time.Now()
+		result, err := h.sendTransactionClient.SendTransaction(ctx, builtExternalTransaction, adapter)
+		h.recordAttempt(ctx, transaction, gateway, builtExternalTransaction, result, err, startedAt)
+		return err
+	})
+
+	switch class := gateways.Classify(sendErr); {
+	case sendErr == nil, class == gateways.ErrorDeclined:
+		// the gateway answered, whether it accepted or declined the transaction
+		if recordErr := h.circuitBreaker.RecordSuccess(ctx, gateway.ID); recordErr != nil {
+			log.Printf("Failed to record success for gateway ID %d: %v", gateway.ID, recordErr)
+		}
+
+	case class == gateways.ErrorRetryable, class == gateways.ErrorUnavailable:
+		log.Printf("Failed while SendTransaction: %v", sendErr)
+		if recordErr := h.circuitBreaker.RecordFailure(ctx, gateway.ID); recordErr != nil {
+			log.Printf("Failed to record failure for gateway ID %d: %v", gateway.ID, recordErr)
 		}
-		return errors.New("error while SendTransaction")
+		message.TriedGatewayIDs = append(message.TriedGatewayIDs, gateway.ID)
+		return sendErr
+
+	case class == gateways.ErrorUnknown:
+		log.Printf("Failed while SendTransaction, the outcome is unknown: %v", sendErr)
+		if recordErr := h.circuitBreaker.RecordFailure(ctx, gateway.ID); recordErr != nil {
+			log.Printf("Failed to record failure for gateway ID %d: %v", gateway.ID, recordErr)
+		}
+		// the outcome has to stay unknown even when the gateway cannot be recorded, any other error
+		// would have the transaction sent again
+		if err := h.transactionRepo.UpdateGatewayIDByTransactionID(ctx, transaction.ID, gateway.ID); err != nil {
+			log.Printf("Failed while UpdateGatewayIDByTransactionID: %v", err)
+		}
+		transaction.GatewayID = gateway.ID
+		return sendErr
+
+	default:
+		// nothing was learned about the gateway, its circuit breaker gets the request back
+		log.Printf("Failed while SendTransaction: %v", sendErr)
+		h.releaseCircuitBreaker(ctx, gateway.ID)
+		return sendErr
 	}
 
 	err = h.transactionRepo.UpdateGatewayIDByTransactionID(ctx, transaction.ID, gateway.ID)
@@ -140,5 +380,109 @@ func (h *TransactionHandler) TransactionProcessor(ctx context.Context, transacti
 		return err
 	}
 
-	return nil
+	return sendErr
+}
+
+// releaseCircuitBreaker gives a request admitted by the circuit breaker of the gateway back when it never
+// produced an outcome to record
+func (h *TransactionHandler) releaseCircuitBreaker(ctx context.Context, gatewayID int) {
+	if err := h.circuitBreaker.Release(ctx, gatewayID); err != nil {
+		log.Printf("Failed to release circuit breaker for gateway ID %d: %v", gatewayID, err)
+	}
+}
+
+// selectGateway returns the highest priority routable gateway that has not been tried for the
+// transaction yet and whose circuit breaker admits the request. Healthy gateways go before degraded ones.
+func (h *TransactionHandler) selectGateway(ctx context.Context, message *models.TransactionMessage) (*models.GatewayDetail, error) {
+	transaction := &message.Transaction
+
+	gatewayDetails, err := h.gatewayCountryRepo.GetRoutableGatewaysByCountryID(ctx, transaction.CountryID)
+	if err != nil {
+		log.Printf("Failed to GetRoutableGatewaysByCountryID: %v", err)
+		return nil, err
+	}
+
+	candidates := make([]models.GatewayDetail, 0, len(gatewayDetails))
+	for _, gatewayDetail := range gatewayDetails {
+		if !slices.Contains(message.TriedGatewayIDs, gatewayDetail.ID) {
+			candidates = append(candidates, gatewayDetail)
+		}
+	}
+	if len(candidates) == 0 && len(message.TriedGatewayIDs) > 0 {
+		return nil, errGatewaysExhausted
+	}
+	h.routingOrder(candidates)
+
+	for i := range candidates {
+		err := h.circuitBreaker.Allow(ctx, candidates[i].ID)
+		if err == nil {
+			if candidates[i].HealthStatus == constants.DEGRADED {
+				log.Printf("Routing transaction %s to degraded gateway=[%s]", transaction.ReferenceID, candidates[i].Name)
+			}
+			return &candidates[i], nil
+		}
+		if !errors.Is(err, circuitbreaker.ErrCircuitOpen) {
+			log.Printf("Failed to check circuit breaker for gateway ID %d: %v", candidates[i].ID, err)
+			return nil, err
+		}
+		log.Printf("Skipping gateway=[%s], circuit breaker is open", candidates[i].Name)
+	}
+
+	return nil, fmt.Errorf("no available gateway for country_id %d", transaction.CountryID)
+}
+
+// routingOrder moves the degraded gateways behind the healthy ones, so a degraded gateway only gets the
+// transaction once no healthy one is left. The share of transactions set by degradedTrafficShare keeps the
+// order of priority, which caps the traffic a degraded gateway gets ahead of healthy ones.
+func (h *TransactionHandler) routingOrder(candidates []models.GatewayDetail) {
+	if rand.Float64() < h.degradedTrafficShare {
+		return
+	}
+	slices.SortStableFunc(candidates, func(a, b models.GatewayDetail) int {
+		return cmp.Compare(routingRank(a), routingRank(b))
+	})
+}
+
+func routingRank(gateway models.GatewayDetail) int {
+	if gateway.HealthStatus == constants.DEGRADED {
+		return 1
+	}
+	return 0
+}
+
+// recordAttempt stores the request and outcome of a single SendTransaction call. The audit trail
+// must not decide the outcome of the transaction, so failing to store it is only logged.
+func (h *TransactionHandler) recordAttempt(
+	ctx context.Context,
+	transaction *models.Transaction,
+	gateway *models.GatewayDetail,
+	request models.BuildExternalTransaction,
+	result models.GatewayTransactionResult,
+	sendErr error,
+	startedAt time.Time,
+) {
+	completedAt := time.Now()
+	attempt := &models.TransactionAttempt{
+		TransactionID: transaction.ID,
+		GatewayID:     gateway.ID,
+		Request:       request.Request,
+		Response:      result.RawResponse,
+		HTTPStatus:    result.HTTPStatus,
+		LatencyMs:     completedAt.Sub(startedAt).Milliseconds(),
+		Status:        result.Status,
+		StartedAt:     startedAt,
+		CompletedAt:   completedAt,
+	}
+	if sendErr != nil {
+		attempt.ErrorClass = string(gateways.Classify(sendErr))
+		attempt.ErrorMessage = sendErr.Error()
+		attempt.TimedOut = gateways.IsTimeout(sendErr) || result.HTTPStatus == http.StatusGatewayTimeout
+		if attempt.Status == "" {
+			attempt.Status = constants.ERROR
+		}
+	}
+
+	if err := h.attemptRepo.InsertAttempt(ctx, attempt); err != nil {
+		log.Printf("Failed to record attempt of transaction %s on gateway=[%s]: %v", transaction.ReferenceID, gateway.Name, err)
+	}
 }
@@ -4,15 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
-	"payment-gateway/internal/config"
+	"payment-gateway/internal/circuitbreaker"
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/gateways/gatewaya"
+	"payment-gateway/internal/repositories"
+	mocksCircuitBreaker "payment-gateway/mocks/circuitbreaker"
 	mocksClient "payment-gateway/mocks/client"
 	mockKafka "payment-gateway/mocks/kafka"
 	mocksRepository "payment-gateway/mocks/repositories"
 	"payment-gateway/models"
 	"payment-gateway/pkg/constants"
-	"sync"
+	"payment-gateway/pkg/utils"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/google/uuid"
@@ -26,34 +32,60 @@ func TestTransactionService(t *testing.T) {
 	ginkgo.RunSpecs(t, "TransactionHandler Suite")
 }
 
+// isAdapter matches the gateway adapter registered under the given name
+func isAdapter(name string) interface{} {
+	return mock.MatchedBy(func(adapter gateways.GatewayAdapter) bool {
+		return adapter.Name() == name
+	})
+}
+
 var _ = ginkgo.Describe("TransactionHandler", func() {
 	var (
 		mockTransactionRepo       *mocksRepository.TransactionRepository
 		mockKafkaProducer         *mockKafka.MockKafkaProducer
 		mockSendTransactionClient *mocksClient.MockTransactionClient
 		mockGatewayCountryRepo    *mocksRepository.MockGatewayCountryRepository
-		mockGatewayRepo           *mocksRepository.MockGatewayRepository
+		mockCircuitBreaker        *mocksCircuitBreaker.MockCircuitBreaker
+		mockAttemptRepo           *mocksRepository.MockTransactionAttemptRepository
+		mockProcessedMessageRepo  *mocksRepository.MockProcessedMessageRepository
 		transactionHandler        *TransactionHandler
+		now                       time.Time
 	)
 
 	ginkgo.BeforeEach(func() {
 		os.Setenv("GATEWAY_A_URL", "A")
 		os.Setenv("GATEWAY_A_API_KEY", "api-key")
 		os.Setenv("GATEWAY_A_PRIVATE_KEY", "12345678901234567890123456789012")
-		config.InitGatewayA()
+		gatewaya.Init()
 
 		mockTransactionRepo = new(mocksRepository.TransactionRepository)
 		mockKafkaProducer = new(mockKafka.MockKafkaProducer)
 		mockSendTransactionClient = new(mocksClient.MockTransactionClient)
 		mockGatewayCountryRepo = new(mocksRepository.MockGatewayCountryRepository)
-		mockGatewayRepo = new(mocksRepository.MockGatewayRepository)
+		mockCircuitBreaker = new(mocksCircuitBreaker.MockCircuitBreaker)
+		mockAttemptRepo = new(mocksRepository.MockTransactionAttemptRepository)
+		mockAttemptRepo.On("InsertAttempt", mock.Anything, mock.Anything).Return(nil)
+		mockProcessedMessageRepo = new(mocksRepository.MockProcessedMessageRepository)
 		transactionHandler = NewTransactionHandler(
 			mockTransactionRepo,
 			mockKafkaProducer,
 			mockSendTransactionClient,
 			mockGatewayCountryRepo,
-			mockGatewayRepo,
+			mockCircuitBreaker,
+			mockAttemptRepo,
+			mockProcessedMessageRepo,
 		)
+
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		transactionHandler.now = func() time.Time { return now }
+		transactionHandler.sendRetryPolicy.InitialDelay = time.Millisecond
+
+		SendTransactionKafkaTopic = "process-transaction"
+		RetryTopics = []RetryTopic{
+			{Name: "process-transaction-retry-1", Delay: 10 * time.Second},
+			{Name: "process-transaction-retry-2", Delay: time.Minute},
+		}
+		DeadLetterKafkaTopic = "process-transaction-dlq"
 	})
 
 	ginkgo.AfterEach(func() {
@@ -79,11 +111,6 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 			CountryID:           1,
 			Currency:            "USD",
 		}
-		gatewayConfig := models.GatewayConfig{
-			GatewayUrl:        "A",
-			GatewayApiKey:     "api-key",
-			GatewayPrivateKey: "12345678901234567890123456789012",
-		}
 
 		ginkgo.BeforeEach(func() {
 			mockCtx = context.Background()
@@ -103,61 +130,427 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 			mockMessage = &sarama.ConsumerMessage{
 				Value: messageBytes,
 			}
+
+			mockTransactionRepo.
+				On("ClaimTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), mock.Anything).
+				Return(nil)
+			mockTransactionRepo.
+				On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.SUBMITTED, mock.Anything).
+				Return(nil)
+
+			mockProcessedMessageRepo.
+				On("IsMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 0).
+				Return(false, nil)
+			mockProcessedMessageRepo.
+				On("MarkMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 0).
+				Return(nil)
 		})
 
-		ginkgo.It("should handle unmarshalling error", func() {
+		ginkgo.It("should report an invalid message as poison", func() {
 			mockMessage.Value = []byte("invalid json")
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(errors.Is(err, ErrPoisonMessage)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should report a message without a reference ID as poison", func() {
+			mockMessage.Value = []byte(`{"id": 12345}`)
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(errors.Is(err, ErrPoisonMessage)).To(gomega.BeTrue())
+			mockProcessedMessageRepo.AssertNotCalled(ginkgo.GinkgoT(), "IsMessageProcessed", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should report a message with an invalid attempt header as poison", func() {
+			mockMessage.Headers = []*sarama.RecordHeader{{Key: []byte(HeaderAttempt), Value: []byte("first")}}
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(errors.Is(err, ErrPoisonMessage)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should skip a message that was already processed", func() {
+			mockProcessedMessageRepo.ExpectedCalls = nil
+			mockProcessedMessageRepo.
+				On("IsMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 0).
+				Return(true, nil).
+				Once()
+
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockTransactionRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			mockProcessedMessageRepo.AssertNotCalled(ginkgo.GinkgoT(), "MarkMessageProcessed", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should handle error when checking whether the message was processed", func() {
+			mockProcessedMessageRepo.ExpectedCalls = nil
+			mockProcessedMessageRepo.
+				On("IsMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 0).
+				Return(false, errors.New("error")).
+				Once()
+
 			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockTransactionRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should skip a transaction that already moved past processing", func() {
+			mockTransactionRepo.ExpectedCalls = nil
+			mockTransactionRepo.
+				On("ClaimTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), 0).
+				Return(&utils.TransitionError{ReferenceID: transaction.ReferenceID.String(), From: constants.COMPLETED, To: constants.PROCESSING}).
+				Once()
+
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockGatewayCountryRepo.AssertNotCalled(ginkgo.GinkgoT(), "GetRoutableGatewaysByCountryID", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should skip a transaction another worker is already sending", func() {
+			mockTransactionRepo.ExpectedCalls = nil
+			mockTransactionRepo.
+				On("ClaimTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), 0).
+				Return(repositories.ErrTransactionClaimed).
+				Once()
+
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockGatewayCountryRepo.AssertNotCalled(ginkgo.GinkgoT(), "GetRoutableGatewaysByCountryID", mock.Anything, mock.Anything)
+			mockSendTransactionClient.AssertNotCalled(ginkgo.GinkgoT(), "SendTransaction", mock.Anything, mock.Anything, mock.Anything)
 		})
 
 		ginkgo.It("should handle error from TransactionProcessor", func() {
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
 				Return(nil, errors.New("error")).
 				Once()
 			mockTransactionRepo.
-				On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.RETRY).
+				On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.RETRY, mock.Anything).
 				Return(nil).
 				Once()
 
 			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
-			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			mockGatewayCountryRepo.AssertCalled(ginkgo.GinkgoT(), "GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID)
+			mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, mock.AnythingOfType("string"), constants.RETRY, mock.Anything)
+			mockProcessedMessageRepo.AssertCalled(ginkgo.GinkgoT(), "MarkMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 0)
+		})
+
+		ginkgo.Describe("when the gateway is unavailable", func() {
+			var republished []byte
+
+			ginkgo.BeforeEach(func() {
+				mockGatewayCountryRepo.
+					On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+					Return([]models.GatewayDetail{*gateway}, nil).
+					Once()
+
+				mockCircuitBreaker.
+					On("Allow", mock.Anything, gateway.ID).
+					Return(nil).
+					Once()
+
+				mockSendTransactionClient.
+					On("SendTransaction", mockCtx, mock.Anything, isAdapter(gateway.Name)).
+					Return(models.GatewayTransactionResult{Status: constants.ERROR}, gateways.NewUnavailableError(gateway.Name, errors.New("service unavailable"))).
+					Once()
 
-			mockGatewayCountryRepo.AssertCalled(ginkgo.GinkgoT(), "GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID)
-			mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, mock.AnythingOfType("string"), constants.RETRY)
+				mockCircuitBreaker.
+					On("RecordFailure", mock.Anything, gateway.ID).
+					Return(nil).
+					Once()
+
+				republished, _ = json.Marshal(models.TransactionMessage{
+					Transaction:     *transaction,
+					TriedGatewayIDs: []int{gateway.ID},
+				})
+			})
+
+			ginkgo.It("should publish the transaction to the first retry topic", func() {
+				headers := map[string]string{
+					HeaderAttempt: "1",
+					HeaderRetryAt: now.Add(10 * time.Second).Format(time.RFC3339Nano),
+				}
+				mockKafkaProducer.On("ProduceMessageWithHeaders", republished, "process-transaction-retry-1", headers).Return(nil).Once()
+
+				err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				mockSendTransactionClient.AssertNumberOfCalls(ginkgo.GinkgoT(), "SendTransaction", 1)
+				mockKafkaProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessageWithHeaders", republished, "process-transaction-retry-1", headers)
+				mockProcessedMessageRepo.AssertCalled(ginkgo.GinkgoT(), "MarkMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 0)
+			})
+
+			ginkgo.It("should publish the next attempt to the next retry topic", func() {
+				mockMessage.Topic = "process-transaction-retry-1"
+				mockMessage.Headers = []*sarama.RecordHeader{{Key: []byte(HeaderAttempt), Value: []byte("1")}}
+				mockProcessedMessageRepo.On("IsMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 1).Return(false, nil)
+				mockProcessedMessageRepo.On("MarkMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 1).Return(nil)
+
+				headers := map[string]string{
+					HeaderAttempt: "2",
+					HeaderRetryAt: now.Add(time.Minute).Format(time.RFC3339Nano),
+				}
+				mockKafkaProducer.On("ProduceMessageWithHeaders", republished, "process-transaction-retry-2", headers).Return(nil).Once()
+
+				err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				mockKafkaProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessageWithHeaders", republished, "process-transaction-retry-2", headers)
+			})
+
+			ginkgo.It("should dead-letter the transaction and park it for retry once every retry topic was used", func() {
+				mockMessage.Topic = "process-transaction-retry-2"
+				mockMessage.Partition = 3
+				mockMessage.Offset = 42
+				mockMessage.Timestamp = now.Add(-time.Minute)
+				mockMessage.Headers = []*sarama.RecordHeader{
+					{Key: []byte(HeaderAttempt), Value: []byte("2")},
+					{Key: []byte(HeaderRetryAt), Value: []byte(now.Format(time.RFC3339Nano))},
+				}
+				mockProcessedMessageRepo.On("IsMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 2).Return(false, nil)
+				mockProcessedMessageRepo.On("MarkMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 2).Return(nil)
+				mockTransactionRepo.
+					On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.RETRY, "retries exhausted").
+					Return(nil).
+					Once()
+
+				mockKafkaProducer.On("ProduceMessageWithHeaders", republished, "process-transaction-dlq", mock.Anything).Return(nil).Once()
+
+				err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				mockKafkaProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessageWithHeaders", republished, "process-transaction-dlq", mock.MatchedBy(func(headers map[string]string) bool {
+					_, hasRetryAt := headers[HeaderRetryAt]
+					return headers[HeaderAttempt] == "2" &&
+						!hasRetryAt &&
+						headers[HeaderOriginalTopic] == "process-transaction-retry-2" &&
+						headers[HeaderOriginalPartition] == "3" &&
+						headers[HeaderOriginalOffset] == "42" &&
+						headers[HeaderFailedAt] == now.Format(time.RFC3339Nano) &&
+						headers[HeaderError] != ""
+				}))
+				mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.RETRY, "retries exhausted")
+			})
+
+			ginkgo.It("should not mark the message as processed when it cannot be republished", func() {
+				mockKafkaProducer.On("ProduceMessageWithHeaders", mock.Anything, "process-transaction-retry-1", mock.Anything).Return(errors.New("broker down")).Once()
+
+				err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+				gomega.Expect(err).Should(gomega.HaveOccurred())
+				mockProcessedMessageRepo.AssertNotCalled(ginkgo.GinkgoT(), "MarkMessageProcessed", mock.Anything, mock.Anything, mock.Anything)
+			})
+		})
+
+		ginkgo.Describe("when the outcome of the request is unknown", func() {
+			ginkgo.BeforeEach(func() {
+				mockGatewayCountryRepo.
+					On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+					Return([]models.GatewayDetail{*gateway}, nil).
+					Once()
+
+				mockCircuitBreaker.
+					On("Allow", mock.Anything, gateway.ID).
+					Return(nil).
+					Once()
+
+				mockSendTransactionClient.
+					On("SendTransaction", mockCtx, mock.Anything, isAdapter(gateway.Name)).
+					Return(models.GatewayTransactionResult{Status: constants.ERROR}, gateways.NewUnknownError(gateway.Name, context.DeadlineExceeded)).
+					Once()
+
+				mockCircuitBreaker.
+					On("RecordFailure", mock.Anything, gateway.ID).
+					Return(nil).
+					Once()
+
+				mockTransactionRepo.
+					On("UpdateGatewayIDByTransactionID", mock.Anything, transaction.ID, gateway.ID).
+					Return(nil).
+					Once()
+
+				mockTransactionRepo.
+					On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.IN_DOUBT, "gateway outcome unknown").
+					Return(nil).
+					Once()
+			})
+
+			ginkgo.It("should park the transaction for retry once the gateway confirms it does not exist", func() {
+				mockSendTransactionClient.
+					On("QueryTransactionStatus", mockCtx, transaction.ReferenceID.String(), isAdapter(gateway.Name)).
+					Return("", gateways.ErrTransactionNotFound).
+					Once()
+
+				mockTransactionRepo.
+					On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.RETRY, "gateway confirmed the transaction does not exist").
+					Return(nil).
+					Once()
+
+				err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				mockSendTransactionClient.AssertNumberOfCalls(ginkgo.GinkgoT(), "SendTransaction", 1)
+				mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.RETRY, "gateway confirmed the transaction does not exist")
+				mockKafkaProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessageWithHeaders", mock.Anything, mock.Anything, mock.Anything)
+			})
+
+			ginkgo.It("should apply the status reported by the gateway", func() {
+				mockSendTransactionClient.
+					On("QueryTransactionStatus", mockCtx, transaction.ReferenceID.String(), isAdapter(gateway.Name)).
+					Return(constants.COMPLETED, nil).
+					Once()
+
+				mockTransactionRepo.
+					On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.COMPLETED, "gateway status query").
+					Return(nil).
+					Once()
+
+				err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.COMPLETED, "gateway status query")
+			})
+
+			ginkgo.It("should leave the transaction in doubt when the gateway cannot be asked", func() {
+				mockSendTransactionClient.
+					On("QueryTransactionStatus", mockCtx, transaction.ReferenceID.String(), isAdapter(gateway.Name)).
+					Return("", gateways.NewRetryableError(gateway.Name, errors.New("connection refused"))).
+					Once()
+
+				err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				mockTransactionRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.RETRY, mock.Anything)
+				mockKafkaProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessageWithHeaders", mock.Anything, mock.Anything, mock.Anything)
+				mockProcessedMessageRepo.AssertCalled(ginkgo.GinkgoT(), "MarkMessageProcessed", mock.Anything, transaction.ReferenceID.String(), 0)
+			})
 		})
 
-		ginkgo.It("should handle error while SendTransaction from TransactionProcessor", func() {
+		ginkgo.It("should fail the transaction with the reason when the gateway declines it", func() {
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(nil, errors.New("error while SendTransaction")).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
 				Once()
 
-			var wg sync.WaitGroup
-			wg.Add(1)
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
 
-			mockKafkaProducer.On("ProduceMessage", mockMessage.Value, SendTransactionKafkaTopic).Run(func(args mock.Arguments) {
-				wg.Done()
-			}).Return(nil)
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.Anything, isAdapter(gateway.Name)).
+				Return(
+					models.GatewayTransactionResult{Status: constants.DECLINED, ReasonCode: constants.REASON_INSUFFICIENT_FUNDS},
+					gateways.NewDeclinedError(gateway.Name, constants.REASON_INSUFFICIENT_FUNDS, "gw-123", errors.New("insufficient funds")),
+				).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mock.Anything, transaction.ID, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("FailTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.REASON_INSUFFICIENT_FUNDS).
+				Return(nil).
+				Once()
 
 			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
-			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 
-			wg.Wait()
+			mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "FailTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.REASON_INSUFFICIENT_FUNDS)
+			mockKafkaProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessageWithHeaders", mock.Anything, mock.Anything, mock.Anything)
+		})
 
-			mockGatewayCountryRepo.AssertCalled(ginkgo.GinkgoT(), "GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID)
-			mockKafkaProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessage", mockMessage.Value, SendTransactionKafkaTopic)
+		ginkgo.It("should fail the transaction as declined when the gateway gives no reason", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.Anything, isAdapter(gateway.Name)).
+				Return(
+					models.GatewayTransactionResult{Status: constants.DECLINED},
+					gateways.NewDeclinedError(gateway.Name, "", "gw-123", errors.New("declined")),
+				).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mock.Anything, transaction.ID, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("FailTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.REASON_DECLINED).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "FailTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.REASON_DECLINED)
+		})
+
+		ginkgo.It("should leave the transaction in doubt when the error does not tell which gateway to ask", func() {
+			mockTransactionRepo.
+				On("UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.IN_DOUBT, "gateway outcome unknown").
+				Return(nil).
+				Once()
+
+			err := transactionHandler.resolveInDoubt(mockCtx, transaction, context.DeadlineExceeded)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockSendTransactionClient.AssertNotCalled(ginkgo.GinkgoT(), "QueryTransactionStatus", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should fail the transaction once every gateway was tried", func() {
+			mockMessage.Value, _ = json.Marshal(models.TransactionMessage{
+				Transaction:     *transaction,
+				TriedGatewayIDs: []int{gateway.ID},
+			})
+
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockTransactionRepo.
+				On("FailTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.REASON_GATEWAYS_EXHAUSTED).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockKafkaProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessageWithHeaders", mock.Anything, mock.Anything, mock.Anything)
 		})
 
 		ginkgo.It("should successfully process the transaction", func() {
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
 				Once()
 
 			mockSendTransactionClient.
-				On("SendTransaction", mockCtx, mock.Anything, gateway.Name, gatewayConfig).
+				On("SendTransaction", mockCtx, mock.Anything, isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ACCEPTED}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
 				Return(nil).
 				Once()
 
@@ -168,6 +561,8 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 
 			err := transactionHandler.HandleTransaction(mockCtx, mockMessage)
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "ClaimTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String(), 0)
+			mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, transaction.ReferenceID.String(), constants.SUBMITTED, mock.Anything)
 		})
 	})
 
@@ -175,6 +570,7 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 		var (
 			mockCtx     context.Context
 			transaction *models.Transaction
+			message     *models.TransactionMessage
 		)
 
 		gateway := &models.GatewayDetail{
@@ -186,11 +582,6 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 			CountryID:           1,
 			Currency:            "USD",
 		}
-		gatewayConfig := models.GatewayConfig{
-			GatewayUrl:        "A",
-			GatewayApiKey:     "api-key",
-			GatewayPrivateKey: "12345678901234567890123456789012",
-		}
 
 		ginkgo.BeforeEach(func() {
 			mockCtx = context.Background()
@@ -205,18 +596,261 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 				Status:      constants.PENDING,
 				UserID:      1,
 			}
+			message = &models.TransactionMessage{Transaction: *transaction}
 		})
 
 		ginkgo.It("should handle when there's no healthy gateway", func() {
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, 1).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, 1).
 				Return(nil, errors.New("error")).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 		})
 
+		ginkgo.It("should fall back to the next gateway when the circuit breaker is open", func() {
+			fallbackGateway := *gateway
+			fallbackGateway.ID = 2
+			fallbackGateway.Priority = 2
+
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway, fallbackGateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(circuitbreaker.ErrCircuitOpen).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, fallbackGateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ACCEPTED}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, fallbackGateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mockCtx, transaction.ID, fallbackGateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockCircuitBreaker.AssertCalled(ginkgo.GinkgoT(), "RecordSuccess", mock.Anything, fallbackGateway.ID)
+		})
+
+		ginkgo.Context("when a gateway is degraded", func() {
+			var degradedGateway, healthyGateway models.GatewayDetail
+
+			ginkgo.BeforeEach(func() {
+				degradedGateway = *gateway
+				degradedGateway.HealthStatus = constants.DEGRADED
+
+				healthyGateway = *gateway
+				healthyGateway.ID = 2
+				healthyGateway.Priority = 2
+			})
+
+			sendsTo := func(gatewayID int) {
+				mockCircuitBreaker.
+					On("Allow", mock.Anything, gatewayID).
+					Return(nil).
+					Once()
+
+				mockSendTransactionClient.
+					On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+					Return(models.GatewayTransactionResult{Status: constants.ACCEPTED}, nil).
+					Once()
+
+				mockCircuitBreaker.
+					On("RecordSuccess", mock.Anything, gatewayID).
+					Return(nil).
+					Once()
+
+				mockTransactionRepo.
+					On("UpdateGatewayIDByTransactionID", mockCtx, transaction.ID, gatewayID).
+					Return(nil).
+					Once()
+			}
+
+			ginkgo.It("should prefer a healthy gateway of lower priority", func() {
+				transactionHandler.degradedTrafficShare = 0
+				mockGatewayCountryRepo.
+					On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+					Return([]models.GatewayDetail{degradedGateway, healthyGateway}, nil).
+					Once()
+				sendsTo(healthyGateway.ID)
+
+				err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				mockCircuitBreaker.AssertNotCalled(ginkgo.GinkgoT(), "Allow", mock.Anything, degradedGateway.ID)
+			})
+
+			ginkgo.It("should keep the order of priority for its share of the traffic", func() {
+				transactionHandler.degradedTrafficShare = 1
+				mockGatewayCountryRepo.
+					On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+					Return([]models.GatewayDetail{degradedGateway, healthyGateway}, nil).
+					Once()
+				sendsTo(degradedGateway.ID)
+
+				err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				mockCircuitBreaker.AssertNotCalled(ginkgo.GinkgoT(), "Allow", mock.Anything, healthyGateway.ID)
+			})
+
+			ginkgo.It("should fall back to the degraded gateway when no healthy one admits the request", func() {
+				transactionHandler.degradedTrafficShare = 0
+				mockGatewayCountryRepo.
+					On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+					Return([]models.GatewayDetail{degradedGateway, healthyGateway}, nil).
+					Once()
+				mockCircuitBreaker.
+					On("Allow", mock.Anything, healthyGateway.ID).
+					Return(circuitbreaker.ErrCircuitOpen).
+					Once()
+				sendsTo(degradedGateway.ID)
+
+				err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				mockTransactionRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateGatewayIDByTransactionID", mockCtx, transaction.ID, degradedGateway.ID)
+			})
+		})
+
+		ginkgo.It("should handle when every circuit breaker is open", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(circuitbreaker.ErrCircuitOpen).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockSendTransactionClient.AssertNotCalled(ginkgo.GinkgoT(), "SendTransaction", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should skip the gateways already tried for the transaction", func() {
+			triedGateway := *gateway
+			triedGateway.ID = 2
+			triedGateway.Priority = 0
+			message.TriedGatewayIDs = []int{triedGateway.ID}
+
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{triedGateway, *gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ACCEPTED}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mockCtx, transaction.ID, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockCircuitBreaker.AssertNotCalled(ginkgo.GinkgoT(), "Allow", mock.Anything, triedGateway.ID)
+		})
+
+		ginkgo.It("should add the gateway to the tried gateways when it is unavailable", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ERROR}, gateways.NewUnavailableError(gateway.Name, errors.New("service unavailable"))).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordFailure", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnavailable))
+			gomega.Expect(message.TriedGatewayIDs).To(gomega.Equal([]int{gateway.ID}))
+		})
+
+		ginkgo.It("should neither resend nor fall back when the outcome is unknown", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ERROR}, gateways.NewUnknownError(gateway.Name, context.DeadlineExceeded)).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordFailure", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mock.Anything, transaction.ID, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnknown))
+			gomega.Expect(message.TriedGatewayIDs).To(gomega.BeEmpty())
+			mockSendTransactionClient.AssertNumberOfCalls(ginkgo.GinkgoT(), "SendTransaction", 1)
+			mockTransactionRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should report the gateways as exhausted once every one of them was tried", func() {
+			message.TriedGatewayIDs = []int{gateway.ID}
+
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(err).To(gomega.MatchError(errGatewaysExhausted))
+			mockSendTransactionClient.AssertNotCalled(ginkgo.GinkgoT(), "SendTransaction", mock.Anything, mock.Anything, mock.Anything)
+		})
+
 		ginkgo.It("should handle when the gateway is not configured", func() {
 			gateway := &models.GatewayDetail{
 				ID:                  1,
@@ -229,18 +863,35 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 			}
 
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Release", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockCircuitBreaker.AssertCalled(ginkgo.GinkgoT(), "Release", mock.Anything, gateway.ID)
 		})
 
 		ginkgo.It("should handle error when ecrypting the request", func() {
+			gateways.Register(gatewaya.New(models.GatewayConfig{
+				GatewayUrl:        "A",
+				GatewayApiKey:     "api-key",
+				GatewayPrivateKey: "short-key",
+			}))
+
 			gateway := &models.GatewayDetail{
 				ID:                  1,
-				Name:                "B",
+				Name:                "A",
 				DataFormatSupported: "json",
 				HealthStatus:        "healthy",
 				Priority:            1,
@@ -249,15 +900,34 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 			}
 
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Release", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockCircuitBreaker.AssertCalled(ginkgo.GinkgoT(), "Release", mock.Anything, gateway.ID)
 		})
 
 		ginkgo.It("should handle error when build external request", func() {
+			gateways.Register(&gatewaya.Adapter{
+				BaseAdapter: gateways.BaseAdapter{
+					GatewayName:   "A",
+					DataFormat:    "unsupported-data-format",
+					GatewayConfig: gateways.LoadConfig("GATEWAY_A"),
+				},
+			})
+
 			gateway := &models.GatewayDetail{
 				ID:                  1,
 				Name:                "A",
@@ -269,67 +939,124 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 			}
 
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Release", mock.Anything, gateway.ID).
+				Return(nil).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockCircuitBreaker.AssertCalled(ginkgo.GinkgoT(), "Release", mock.Anything, gateway.ID)
 		})
 
 		ginkgo.It("should handle error when build external request", func() {
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
 				Once()
 
 			mockSendTransactionClient.
-				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), gateway.Name, gatewayConfig).
-				Return(errors.New("error")).
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{}, gateways.NewRetryableError(gateway.Name, errors.New("connection reset"))).
 				Times(3)
 
-			mockGatewayRepo.
-				On("UpdateHealthStatus", mockCtx, gateway.ID, constants.UNHEALTHY).
+			mockCircuitBreaker.
+				On("RecordFailure", mockCtx, gateway.ID).
 				Return(nil).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 		})
 
-		ginkgo.It("should handle error when update gateway health status", func() {
+		ginkgo.It("should stop resending once the context is done", func() {
+			ctx, cancel := context.WithCancel(mockCtx)
+			transactionHandler.sendRetryPolicy.InitialDelay = time.Hour
+
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
 				Once()
 
 			mockSendTransactionClient.
-				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), gateway.Name, gatewayConfig).
-				Return(errors.New("error")).
+				On("SendTransaction", ctx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Run(func(mock.Arguments) { cancel() }).
+				Return(models.GatewayTransactionResult{}, gateways.NewRetryableError(gateway.Name, errors.New("connection reset"))).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordFailure", ctx, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(ctx, message, 0)
+			gomega.Expect(err).Should(gomega.MatchError(context.Canceled))
+			gomega.Expect(gateways.IsRetryable(err)).To(gomega.BeTrue())
+			mockSendTransactionClient.AssertNumberOfCalls(ginkgo.GinkgoT(), "SendTransaction", 1)
+		})
+
+		ginkgo.It("should handle error when recording the gateway failure", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{}, gateways.NewRetryableError(gateway.Name, errors.New("connection reset"))).
 				Times(3)
 
-			mockGatewayRepo.
-				On("UpdateHealthStatus", mockCtx, gateway.ID, constants.UNHEALTHY).
+			mockCircuitBreaker.
+				On("RecordFailure", mockCtx, gateway.ID).
 				Return(errors.New("error")).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 		})
 
 		ginkgo.It("should handle error when build external request", func() {
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
 				Once()
 
-			mockSendTransactionClient.
-				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), gateway.Name, gatewayConfig).
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
 				Return(nil).
 				Once()
 
-			mockGatewayRepo.
-				On("UpdateHealthStatus", mockCtx, gateway.ID, constants.UNHEALTHY).
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ACCEPTED}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
 				Return(nil).
 				Once()
 
@@ -338,23 +1065,205 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 				Return(errors.New("error")).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 		})
 
-		ginkgo.It("should process the transction successfully", func() {
+		ginkgo.It("should return a declined error without retrying", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(
+					models.GatewayTransactionResult{Status: constants.DECLINED, Message: "insufficient funds"},
+					gateways.NewDeclinedError(gateway.Name, constants.REASON_INSUFFICIENT_FUNDS, "", errors.New("insufficient funds")),
+				).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mockCtx, transaction.ID, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorDeclined))
+			mockSendTransactionClient.AssertNumberOfCalls(ginkgo.GinkgoT(), "SendTransaction", 1)
+		})
+
+		ginkgo.It("should not retry nor trip the circuit breaker when the gateway rejects the request", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Release", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ERROR}, gateways.NewInternalError(gateway.Name, errors.New("invalid api key"))).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorInternal))
+			mockSendTransactionClient.AssertNumberOfCalls(ginkgo.GinkgoT(), "SendTransaction", 1)
+			mockCircuitBreaker.AssertNotCalled(ginkgo.GinkgoT(), "RecordFailure", mock.Anything, mock.Anything)
+			mockCircuitBreaker.AssertCalled(ginkgo.GinkgoT(), "Release", mock.Anything, gateway.ID)
+		})
+
+		ginkgo.It("should record the attempt with the gateway response", func() {
 			mockGatewayCountryRepo.
-				On("GetHealthyGatewayByCountryID", mock.Anything, transaction.CountryID).
-				Return(gateway, nil).
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
 				Once()
 
 			mockSendTransactionClient.
-				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), gateway.Name, gatewayConfig).
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{
+					Status:      constants.ERROR,
+					HTTPStatus:  503,
+					RawResponse: `{"status":"error","message":"service unavailable"}`,
+				}, gateways.NewUnavailableError(gateway.Name, errors.New("service unavailable"))).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordFailure", mock.Anything, gateway.ID).
 				Return(nil).
 				Once()
 
-			mockGatewayRepo.
-				On("UpdateHealthStatus", mockCtx, gateway.ID, constants.UNHEALTHY).
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+
+			mockAttemptRepo.AssertCalled(ginkgo.GinkgoT(), "InsertAttempt", mockCtx, mock.MatchedBy(func(attempt *models.TransactionAttempt) bool {
+				return attempt.TransactionID == transaction.ID &&
+					attempt.GatewayID == gateway.ID &&
+					attempt.Request != "" &&
+					attempt.Response == `{"status":"error","message":"service unavailable"}` &&
+					attempt.HTTPStatus == 503 &&
+					attempt.Status == constants.ERROR &&
+					attempt.ErrorClass == string(gateways.ErrorUnavailable) &&
+					!attempt.TimedOut &&
+					!attempt.CompletedAt.Before(attempt.StartedAt)
+			}))
+		})
+
+		ginkgo.It("should record an attempt that ran out of time as timed out", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{}, gateways.NewUnknownError(gateway.Name, fmt.Errorf("failed to send transaction: %w", context.DeadlineExceeded))).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordFailure", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mockCtx, transaction.ID, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorUnknown))
+
+			mockAttemptRepo.AssertCalled(ginkgo.GinkgoT(), "InsertAttempt", mockCtx, mock.MatchedBy(func(attempt *models.TransactionAttempt) bool {
+				return attempt.ErrorClass == string(gateways.ErrorUnknown) && attempt.TimedOut
+			}))
+		})
+
+		ginkgo.It("should resend the request with the idempotency key of the attempt", func() {
+			idempotencyKey := transaction.ReferenceID.String() + "-2"
+			withKey := mock.MatchedBy(func(request models.BuildExternalTransaction) bool {
+				return request.Headers["Idempotency-Key"] == idempotencyKey
+			})
+
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, withKey, isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{}, gateways.NewRetryableError(gateway.Name, errors.New("connection refused"))).
+				Once()
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, withKey, isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ACCEPTED}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockTransactionRepo.
+				On("UpdateGatewayIDByTransactionID", mockCtx, transaction.ID, gateway.ID).
+				Return(nil).
+				Once()
+
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 2)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockSendTransactionClient.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should process the transction successfully", func() {
+			mockGatewayCountryRepo.
+				On("GetRoutableGatewaysByCountryID", mock.Anything, transaction.CountryID).
+				Return([]models.GatewayDetail{*gateway}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("Allow", mock.Anything, gateway.ID).
+				Return(nil).
+				Once()
+
+			mockSendTransactionClient.
+				On("SendTransaction", mockCtx, mock.AnythingOfType("models.BuildExternalTransaction"), isAdapter(gateway.Name)).
+				Return(models.GatewayTransactionResult{Status: constants.ACCEPTED}, nil).
+				Once()
+
+			mockCircuitBreaker.
+				On("RecordSuccess", mock.Anything, gateway.ID).
 				Return(nil).
 				Once()
 
@@ -363,7 +1272,7 @@ var _ = ginkgo.Describe("TransactionHandler", func() {
 				Return(nil).
 				Once()
 
-			err := transactionHandler.TransactionProcessor(mockCtx, transaction)
+			err := transactionHandler.TransactionProcessor(mockCtx, message, 0)
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 		})
 	})
@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"payment-gateway/internal/kafka"
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/utils"
+)
+
+type IRelay interface {
+	Lag(ctx context.Context) (models.OutboxLag, error)
+}
+
+type Settings struct {
+	PollInterval time.Duration // pause between polls once the outbox is drained
+	BatchSize    int           // messages claimed per poll
+	Lease        time.Duration // how long a claimed message is hidden from other relays
+	MinBackoff   time.Duration // delay before the first retry of a failed publish
+	MaxBackoff   time.Duration // upper bound of the doubling retry delay
+}
+
+// SettingsFromEnv reads the relay settings from OUTBOX_* environment variables
+func SettingsFromEnv() Settings {
+	return Settings{
+		PollInterval: utils.GetEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		BatchSize:    utils.GetEnvInt("OUTBOX_BATCH_SIZE", 100),
+		Lease:        utils.GetEnvDuration("OUTBOX_LEASE", 30*time.Second),
+		MinBackoff:   utils.GetEnvDuration("OUTBOX_MIN_BACKOFF", time.Second),
+		MaxBackoff:   utils.GetEnvDuration("OUTBOX_MAX_BACKOFF", 5*time.Minute),
+	}
+}
+
+// Relay publishes outbox messages to Kafka. A message is marked as sent only after the broker
+// acknowledged it, so every message is delivered at least once.
+type Relay struct {
+	repo     repositories.IOutboxRepository
+	producer kafka.KafkaProducer
+	settings Settings
+	now      func() time.Time
+}
+
+func NewRelay(repo repositories.IOutboxRepository, producer kafka.KafkaProducer, settings Settings) *Relay {
+	return &Relay{
+		repo:     repo,
+		producer: producer,
+		settings: settings,
+		now:      time.Now,
+	}
+}
+
+// Run relays messages until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.settings.PollInterval)
+	defer ticker.Stop()
+
+	log.Printf("Outbox relay started (polling every %s)", r.settings.PollInterval)
+	for {
+		// keep draining while full batches come back
+		for {
+			claimed, err := r.RelayBatch(ctx)
+			if err != nil {
+				log.Printf("Outbox relay failed: %v", err)
+				break
+			}
+			if claimed < r.settings.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes one batch of due messages and returns how many were claimed
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	messages, err := r.repo.ClaimPendingMessages(ctx, r.now(), r.settings.Lease, r.settings.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, message := range messages {
+		if err := r.producer.ProduceMessage([]byte(message.Payload), message.Topic); err != nil {
+			nextAttemptAt := r.now().Add(r.backoff(message.Attempts + 1))
+			log.Printf("Failed to publish outbox message %d to topic %s (attempt %d), retrying at %s: %v",
+				message.ID, message.Topic, message.Attempts+1, nextAttemptAt.Format(time.RFC3339), err)
+
+			if errMark := r.repo.MarkMessageFailed(ctx, message.ID, err.Error(), nextAttemptAt); errMark != nil {
+				log.Printf("Failed to MarkMessageFailed: %v", errMark)
+			}
+			continue
+		}
+
+		// a message that cannot be marked is published again after the lease, consumers handle duplicates
+		if err := r.repo.MarkMessageSent(ctx, message.ID, r.now()); err != nil {
+			log.Printf("Failed to MarkMessageSent: %v", err)
+		}
+	}
+
+	return len(messages), nil
+}
+
+// Lag returns how many messages wait to be published and how long the oldest one has waited
+func (r *Relay) Lag(ctx context.Context) (models.OutboxLag, error) {
+	return r.repo.GetLag(ctx, r.now())
+}
+
+// backoff doubles the retry delay with every failed attempt, up to MaxBackoff
+func (r *Relay) backoff(attempt int) time.Duration {
+	delay := r.settings.MinBackoff
+	for i := 1; i < attempt && delay < r.settings.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.settings.MaxBackoff {
+		delay = r.settings.MaxBackoff
+	}
+	return delay
+}
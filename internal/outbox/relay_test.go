@@ -0,0 +1,111 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mockKafka "payment-gateway/mocks/kafka"
+	mocksRepository "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRelay(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Outbox Relay Suite")
+}
+
+var _ = ginkgo.Describe("Relay", func() {
+	var (
+		mockRepo     *mocksRepository.MockOutboxRepository
+		mockProducer *mockKafka.MockKafkaProducer
+		relay        *Relay
+		ctx          context.Context
+		now          time.Time
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		mockRepo = new(mocksRepository.MockOutboxRepository)
+		mockProducer = new(mockKafka.MockKafkaProducer)
+		relay = NewRelay(mockRepo, mockProducer, Settings{
+			PollInterval: time.Second,
+			BatchSize:    10,
+			Lease:        30 * time.Second,
+			MinBackoff:   time.Second,
+			MaxBackoff:   time.Minute,
+		})
+		relay.now = func() time.Time { return now }
+	})
+
+	ginkgo.Describe("RelayBatch", func() {
+		ginkgo.It("should publish the claimed messages and mark them as sent", func() {
+			messages := []models.OutboxMessage{
+				{ID: 1, Topic: "process-transaction", Payload: `{"id":1}`},
+				{ID: 2, Topic: "process-transaction", Payload: `{"id":2}`},
+			}
+			mockRepo.On("ClaimPendingMessages", ctx, now, 30*time.Second, 10).Return(messages, nil)
+			mockProducer.On("ProduceMessage", mock.Anything, "process-transaction").Return(nil)
+			mockRepo.On("MarkMessageSent", ctx, mock.Anything, now).Return(nil)
+
+			claimed, err := relay.RelayBatch(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(claimed).To(gomega.Equal(2))
+			mockProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessage", []byte(`{"id":1}`), "process-transaction")
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "MarkMessageSent", ctx, 1, now)
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "MarkMessageSent", ctx, 2, now)
+		})
+
+		ginkgo.It("should reschedule a message the broker did not acknowledge", func() {
+			messages := []models.OutboxMessage{{ID: 1, Topic: "process-transaction", Payload: `{"id":1}`, Attempts: 2}}
+			mockRepo.On("ClaimPendingMessages", ctx, now, 30*time.Second, 10).Return(messages, nil)
+			mockProducer.On("ProduceMessage", mock.Anything, "process-transaction").Return(errors.New("broker down"))
+			mockRepo.On("MarkMessageFailed", ctx, 1, "broker down", now.Add(4*time.Second)).Return(nil)
+
+			_, err := relay.RelayBatch(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "MarkMessageFailed", ctx, 1, "broker down", now.Add(4*time.Second))
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "MarkMessageSent", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return error when the messages cannot be claimed", func() {
+			mockRepo.On("ClaimPendingMessages", ctx, now, 30*time.Second, 10).Return(nil, errors.New("db error"))
+
+			_, err := relay.RelayBatch(ctx)
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessage", mock.Anything, mock.Anything)
+		})
+	})
+
+	ginkgo.Describe("backoff", func() {
+		ginkgo.It("should double the delay with every attempt up to the maximum", func() {
+			gomega.Expect(relay.backoff(1)).To(gomega.Equal(time.Second))
+			gomega.Expect(relay.backoff(2)).To(gomega.Equal(2 * time.Second))
+			gomega.Expect(relay.backoff(6)).To(gomega.Equal(32 * time.Second))
+			gomega.Expect(relay.backoff(7)).To(gomega.Equal(time.Minute))
+			gomega.Expect(relay.backoff(100)).To(gomega.Equal(time.Minute))
+		})
+	})
+
+	ginkgo.Describe("Lag", func() {
+		ginkgo.It("should return the lag of the outbox", func() {
+			lag := models.OutboxLag{PendingMessages: 3, OldestPendingAgeSeconds: 42}
+			mockRepo.On("GetLag", ctx, now).Return(lag, nil)
+
+			result, err := relay.Lag(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(lag))
+		})
+	})
+})
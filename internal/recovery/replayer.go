@@ -0,0 +1,314 @@
+package recovery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment-gateway/internal/kafka"
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/google/uuid"
+)
+
+// searchBatchSize is the page size used to collect the transactions of a replay
+const searchBatchSize = 100
+
+// ReplayableStatuses are the statuses a transaction waits in for the consumer to pick it up. A
+// processing transaction may still be in flight, for example in a retry topic, and replaying it
+// could send it twice. A transaction in any other status was already decided. Neither is replayed.
+var ReplayableStatuses = []string{constants.PENDING, constants.RETRY}
+
+var (
+	// ErrEmptySelection is returned when a replay does not say which transactions to replay
+	ErrEmptySelection = errors.New("select the transactions to replay by status or reference ID")
+	// ErrStatusNotReplayable is returned when a replay selects a status the consumer does not pick up
+	ErrStatusNotReplayable = fmt.Errorf("only transactions in %s can be replayed", strings.Join(ReplayableStatuses, ", "))
+)
+
+type Settings struct {
+	DryRun bool    // only report what would be replayed
+	Rate   float64 // replayed transactions per second, no limit when zero
+}
+
+// TransactionSelection selects the transactions in the database to replay
+type TransactionSelection struct {
+	Status       string
+	CreatedFrom  *time.Time // inclusive
+	CreatedTo    *time.Time // exclusive
+	ReferenceIDs []string
+}
+
+// DeadLetterPosition is where a message is stored on the dead-letter topic
+type DeadLetterPosition struct {
+	Partition int32
+	Offset    int64
+}
+
+// ParseDeadLetterPosition parses a position written as partition:offset
+func ParseDeadLetterPosition(value string) (DeadLetterPosition, error) {
+	partition, offset, ok := strings.Cut(value, ":")
+	if !ok {
+		return DeadLetterPosition{}, fmt.Errorf("invalid position %q, expected partition:offset", value)
+	}
+
+	p, err := strconv.ParseInt(partition, 10, 32)
+	if err != nil {
+		return DeadLetterPosition{}, fmt.Errorf("invalid partition in %q: %v", value, err)
+	}
+	o, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil {
+		return DeadLetterPosition{}, fmt.Errorf("invalid offset in %q: %v", value, err)
+	}
+
+	return DeadLetterPosition{Partition: int32(p), Offset: o}, nil
+}
+
+// DeadLetterReferenceID returns the reference ID of the transaction in a dead-letter message,
+// or an empty string when the payload cannot be decoded
+func DeadLetterReferenceID(message models.DeadLetterMessage) string {
+	var transactionMessage *models.TransactionMessage
+	if err := json.Unmarshal([]byte(message.Payload), &transactionMessage); err != nil || transactionMessage == nil {
+		return ""
+	}
+	if transactionMessage.ReferenceID == uuid.Nil {
+		return ""
+	}
+	return transactionMessage.ReferenceID.String()
+}
+
+// SelectDeadLetters keeps the messages at one of the positions or of one of the transactions
+func SelectDeadLetters(messages []models.DeadLetterMessage, positions []DeadLetterPosition, referenceIDs []string) []models.DeadLetterMessage {
+	var selected []models.DeadLetterMessage
+	for _, message := range messages {
+		position := DeadLetterPosition{Partition: message.Partition, Offset: message.Offset}
+		if slices.Contains(positions, position) || slices.Contains(referenceIDs, DeadLetterReferenceID(message)) {
+			selected = append(selected, message)
+		}
+	}
+	return selected
+}
+
+// Replayer publishes transactions to the transaction topic again, so the consumer gives them another
+// round of attempts. A replayed message starts from the first attempt with no gateway tried yet.
+type Replayer struct {
+	transactionRepo      repositories.ITransactionRepository
+	processedMessageRepo repositories.IProcessedMessageRepository
+	producer             kafka.KafkaProducer
+	settings             Settings
+	now                  func() time.Time
+	sleep                func(ctx context.Context, d time.Duration) error
+	nextAt               time.Time
+}
+
+func NewReplayer(
+	transactionRepo repositories.ITransactionRepository,
+	processedMessageRepo repositories.IProcessedMessageRepository,
+	producer kafka.KafkaProducer,
+	settings Settings,
+) *Replayer {
+	return &Replayer{
+		transactionRepo:      transactionRepo,
+		processedMessageRepo: processedMessageRepo,
+		producer:             producer,
+		settings:             settings,
+		now:                  time.Now,
+		sleep:                sleep,
+	}
+}
+
+// ReplayDeadLetters replays the transactions of the given dead-letter messages. Messages that cannot
+// be decoded, and transactions that moved on since they were dead-lettered, are skipped.
+func (r *Replayer) ReplayDeadLetters(ctx context.Context, messages []models.DeadLetterMessage) (models.ReplayResult, error) {
+	result := models.ReplayResult{Selected: len(messages)}
+
+	for _, message := range messages {
+		referenceID := DeadLetterReferenceID(message)
+		if referenceID == "" {
+			log.Printf("Skipping dead-letter message %d:%d, the payload is not a transaction", message.Partition, message.Offset)
+			result.Skipped++
+			continue
+		}
+
+		transaction, err := r.transactionRepo.GetTransactionByReferenceID(ctx, referenceID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Skipping dead-letter message %d:%d, transaction %s does not exist", message.Partition, message.Offset, referenceID)
+				result.Skipped++
+				continue
+			}
+			return result, err
+		}
+
+		if !slices.Contains(ReplayableStatuses, transaction.Status) {
+			log.Printf("Skipping dead-letter message %d:%d, transaction %s is already %s", message.Partition, message.Offset, referenceID, transaction.Status)
+			result.Skipped++
+			continue
+		}
+
+		if err := r.replay(ctx, transaction); err != nil {
+			return result, err
+		}
+		result.Replayed++
+	}
+
+	return result, nil
+}
+
+// ReplayTransactions replays the transactions in the database matching the selection
+func (r *Replayer) ReplayTransactions(ctx context.Context, selection TransactionSelection) (models.ReplayResult, error) {
+	if selection.Status == "" && len(selection.ReferenceIDs) == 0 {
+		return models.ReplayResult{}, ErrEmptySelection
+	}
+	if selection.Status != "" && !slices.Contains(ReplayableStatuses, selection.Status) {
+		return models.ReplayResult{}, ErrStatusNotReplayable
+	}
+
+	transactions, err := r.selectTransactions(ctx, selection)
+	if err != nil {
+		return models.ReplayResult{}, err
+	}
+
+	result := models.ReplayResult{Selected: len(transactions)}
+	for _, transaction := range transactions {
+		if !slices.Contains(ReplayableStatuses, transaction.Status) {
+			log.Printf("Skipping transaction %s, it is already %s", transaction.ReferenceID, transaction.Status)
+			result.Skipped++
+			continue
+		}
+
+		if err := r.replay(ctx, transaction); err != nil {
+			return result, err
+		}
+		result.Replayed++
+	}
+
+	return result, nil
+}
+
+// selectTransactions collects every transaction of the selection before anything is replayed, the
+// replayed transactions change status while the search is still paging
+func (r *Replayer) selectTransactions(ctx context.Context, selection TransactionSelection) ([]models.Transaction, error) {
+	if len(selection.ReferenceIDs) > 0 {
+		var transactions []models.Transaction
+		for _, referenceID := range selection.ReferenceIDs {
+			transaction, err := r.transactionRepo.GetTransactionByReferenceID(ctx, referenceID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					log.Printf("Skipping transaction %s, it does not exist", referenceID)
+					continue
+				}
+				return nil, err
+			}
+			if matches(transaction, selection) {
+				transactions = append(transactions, transaction)
+			}
+		}
+		return transactions, nil
+	}
+
+	filter := models.TransactionFilter{
+		Status:      selection.Status,
+		CreatedFrom: selection.CreatedFrom,
+		CreatedTo:   selection.CreatedTo,
+	}
+
+	var (
+		transactions []models.Transaction
+		afterID      int
+	)
+	for {
+		page, err := r.transactionRepo.SearchTransactions(ctx, filter, afterID, searchBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, page...)
+		if len(page) < searchBatchSize {
+			return transactions, nil
+		}
+		afterID = page[len(page)-1].ID
+	}
+}
+
+// matches reports whether a transaction looked up by reference ID also matches the rest of the selection
+func matches(transaction models.Transaction, selection TransactionSelection) bool {
+	if selection.Status != "" && transaction.Status != selection.Status {
+		return false
+	}
+	if selection.CreatedFrom != nil && transaction.CreatedAt.Before(*selection.CreatedFrom) {
+		return false
+	}
+	if selection.CreatedTo != nil && !transaction.CreatedAt.Before(*selection.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+// replay publishes the transaction to the transaction topic. Its processed messages are forgotten
+// first, otherwise the consumer would skip the new message as a duplicate of the first attempt.
+func (r *Replayer) replay(ctx context.Context, transaction models.Transaction) error {
+	referenceID := transaction.ReferenceID.String()
+
+	if r.settings.DryRun {
+		log.Printf("Dry run: would replay transaction %s (%s)", referenceID, transaction.Status)
+		return nil
+	}
+
+	if err := r.throttle(ctx); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(models.TransactionMessage{Transaction: transaction})
+	if err != nil {
+		return fmt.Errorf("failed to marshal transaction %s: %w", referenceID, err)
+	}
+
+	if _, err := r.processedMessageRepo.DeleteProcessedMessages(ctx, referenceID); err != nil {
+		return err
+	}
+
+	if err := r.producer.ProduceMessage(payload, kafka.SendTransactionKafkaTopic); err != nil {
+		return fmt.Errorf("failed to replay transaction %s: %w", referenceID, err)
+	}
+
+	log.Printf("Replayed transaction %s (%s)", referenceID, transaction.Status)
+	return nil
+}
+
+// throttle spaces the replays out to the configured rate
+func (r *Replayer) throttle(ctx context.Context) error {
+	if r.settings.Rate <= 0 {
+		return nil
+	}
+
+	now := r.now()
+	if wait := r.nextAt.Sub(now); wait > 0 {
+		if err := r.sleep(ctx, wait); err != nil {
+			return err
+		}
+		now = r.nextAt
+	}
+	r.nextAt = now.Add(time.Duration(float64(time.Second) / r.settings.Rate))
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
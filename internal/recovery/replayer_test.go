@@ -0,0 +1,255 @@
+package recovery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"payment-gateway/internal/kafka"
+	mockKafka "payment-gateway/mocks/kafka"
+	mocksRepository "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/google/uuid"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRecovery(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Recovery Suite")
+}
+
+var _ = ginkgo.Describe("Replayer", func() {
+	var (
+		mockTransactionRepo      *mocksRepository.TransactionRepository
+		mockProcessedMessageRepo *mocksRepository.MockProcessedMessageRepository
+		mockProducer             *mockKafka.MockKafkaProducer
+		replayer                 *Replayer
+		ctx                      context.Context
+		transaction              models.Transaction
+		payload                  []byte
+	)
+
+	deadLetter := func(partition int32, offset int64, value string) models.DeadLetterMessage {
+		return models.DeadLetterMessage{Partition: partition, Offset: offset, Payload: value}
+	}
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		kafka.SendTransactionKafkaTopic = "process-transaction"
+
+		mockTransactionRepo = new(mocksRepository.TransactionRepository)
+		mockProcessedMessageRepo = new(mocksRepository.MockProcessedMessageRepository)
+		mockProducer = new(mockKafka.MockKafkaProducer)
+		replayer = NewReplayer(mockTransactionRepo, mockProcessedMessageRepo, mockProducer, Settings{})
+
+		transaction = models.Transaction{
+			ID:          7,
+			ReferenceID: uuid.MustParse("123e4567-e89b-12d3-a456-426614174000"),
+			Amount:      100,
+			Currency:    "USD",
+			Type:        constants.DEPOSIT,
+			Status:      constants.RETRY,
+			CountryID:   1,
+			UserID:      1,
+		}
+		payload, _ = json.Marshal(models.TransactionMessage{Transaction: transaction})
+	})
+
+	ginkgo.Describe("ParseDeadLetterPosition", func() {
+		ginkgo.It("should parse partition:offset", func() {
+			position, err := ParseDeadLetterPosition("2:15")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(position).To(gomega.Equal(DeadLetterPosition{Partition: 2, Offset: 15}))
+		})
+
+		ginkgo.It("should reject a position without an offset", func() {
+			_, err := ParseDeadLetterPosition("2")
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("SelectDeadLetters", func() {
+		ginkgo.It("should select messages by position and by reference ID", func() {
+			messages := []models.DeadLetterMessage{
+				deadLetter(0, 1, `{"reference_id":"123e4567-e89b-12d3-a456-426614174000"}`),
+				deadLetter(0, 2, `{"reference_id":"223e4567-e89b-12d3-a456-426614174000"}`),
+				deadLetter(1, 1, "invalid json"),
+			}
+
+			selected := SelectDeadLetters(messages, []DeadLetterPosition{{Partition: 1, Offset: 1}}, []string{"123e4567-e89b-12d3-a456-426614174000"})
+			gomega.Expect(selected).To(gomega.Equal([]models.DeadLetterMessage{messages[0], messages[2]}))
+		})
+	})
+
+	ginkgo.Describe("ReplayDeadLetters", func() {
+		ginkgo.It("should replay the transaction from the first attempt", func() {
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, transaction.ReferenceID.String()).Return(transaction, nil)
+			mockProcessedMessageRepo.On("DeleteProcessedMessages", ctx, transaction.ReferenceID.String()).Return(int64(3), nil)
+			mockProducer.On("ProduceMessage", payload, "process-transaction").Return(nil)
+
+			message := deadLetter(0, 4, `{"reference_id":"123e4567-e89b-12d3-a456-426614174000","tried_gateway_ids":[1,2]}`)
+			result, err := replayer.ReplayDeadLetters(ctx, []models.DeadLetterMessage{message})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.ReplayResult{Selected: 1, Replayed: 1}))
+			mockProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessage", payload, "process-transaction")
+		})
+
+		ginkgo.It("should skip messages that are not transactions or whose transaction moved on", func() {
+			completed := transaction
+			completed.Status = constants.COMPLETED
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, transaction.ReferenceID.String()).Return(completed, nil)
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, "223e4567-e89b-12d3-a456-426614174000").Return(models.Transaction{}, sql.ErrNoRows)
+
+			result, err := replayer.ReplayDeadLetters(ctx, []models.DeadLetterMessage{
+				deadLetter(0, 1, "invalid json"),
+				deadLetter(0, 2, `{"reference_id":"123e4567-e89b-12d3-a456-426614174000"}`),
+				deadLetter(0, 3, `{"reference_id":"223e4567-e89b-12d3-a456-426614174000"}`),
+			})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.ReplayResult{Selected: 3, Skipped: 3}))
+			mockProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessage", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should stop at the first transaction that cannot be published", func() {
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, transaction.ReferenceID.String()).Return(transaction, nil)
+			mockProcessedMessageRepo.On("DeleteProcessedMessages", ctx, transaction.ReferenceID.String()).Return(int64(0), nil)
+			mockProducer.On("ProduceMessage", payload, "process-transaction").Return(errors.New("broker down"))
+
+			message := deadLetter(0, 4, `{"reference_id":"123e4567-e89b-12d3-a456-426614174000"}`)
+			result, err := replayer.ReplayDeadLetters(ctx, []models.DeadLetterMessage{message, message})
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(result.Replayed).To(gomega.BeZero())
+			mockProducer.AssertNumberOfCalls(ginkgo.GinkgoT(), "ProduceMessage", 1)
+		})
+	})
+
+	ginkgo.Describe("ReplayTransactions", func() {
+		ginkgo.It("should require a status or reference IDs", func() {
+			_, err := replayer.ReplayTransactions(ctx, TransactionSelection{})
+			gomega.Expect(err).To(gomega.MatchError(ErrEmptySelection))
+		})
+
+		ginkgo.It("should reject a status the consumer does not pick up", func() {
+			_, err := replayer.ReplayTransactions(ctx, TransactionSelection{Status: constants.COMPLETED})
+			gomega.Expect(err).To(gomega.MatchError(ErrStatusNotReplayable))
+		})
+
+		ginkgo.It("should reject processing transactions, they may still be in flight", func() {
+			_, err := replayer.ReplayTransactions(ctx, TransactionSelection{Status: constants.PROCESSING})
+			gomega.Expect(err).To(gomega.MatchError(ErrStatusNotReplayable))
+		})
+
+		ginkgo.It("should skip a transaction selected by reference ID that is still processing", func() {
+			processing := transaction
+			processing.Status = constants.PROCESSING
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, transaction.ReferenceID.String()).Return(processing, nil)
+
+			result, err := replayer.ReplayTransactions(ctx, TransactionSelection{ReferenceIDs: []string{transaction.ReferenceID.String()}})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.ReplayResult{Selected: 1, Skipped: 1}))
+			mockProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessage", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should replay every page of transactions matching the status and time range", func() {
+			from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			filter := models.TransactionFilter{Status: constants.RETRY, CreatedFrom: &from}
+
+			firstPage := make([]models.Transaction, searchBatchSize)
+			for i := range firstPage {
+				firstPage[i] = transaction
+				firstPage[i].ID = 1000 - i
+			}
+			lastID := firstPage[searchBatchSize-1].ID
+
+			mockTransactionRepo.On("SearchTransactions", ctx, filter, 0, searchBatchSize).Return(firstPage, nil).Once()
+			mockTransactionRepo.On("SearchTransactions", ctx, filter, lastID, searchBatchSize).Return([]models.Transaction{transaction}, nil).Once()
+			mockProcessedMessageRepo.On("DeleteProcessedMessages", ctx, transaction.ReferenceID.String()).Return(int64(0), nil)
+			mockProducer.On("ProduceMessage", mock.Anything, "process-transaction").Return(nil)
+
+			result, err := replayer.ReplayTransactions(ctx, TransactionSelection{Status: constants.RETRY, CreatedFrom: &from})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.ReplayResult{Selected: searchBatchSize + 1, Replayed: searchBatchSize + 1}))
+		})
+
+		ginkgo.It("should only replay the reference IDs that match the rest of the selection", func() {
+			pending := transaction
+			pending.ReferenceID = uuid.MustParse("223e4567-e89b-12d3-a456-426614174000")
+			pending.Status = constants.PENDING
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, transaction.ReferenceID.String()).Return(transaction, nil)
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, pending.ReferenceID.String()).Return(pending, nil)
+			mockProcessedMessageRepo.On("DeleteProcessedMessages", ctx, transaction.ReferenceID.String()).Return(int64(0), nil)
+			mockProducer.On("ProduceMessage", payload, "process-transaction").Return(nil)
+
+			result, err := replayer.ReplayTransactions(ctx, TransactionSelection{
+				Status:       constants.RETRY,
+				ReferenceIDs: []string{transaction.ReferenceID.String(), pending.ReferenceID.String()},
+			})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.ReplayResult{Selected: 1, Replayed: 1}))
+		})
+
+		ginkgo.It("should skip a transaction selected by reference ID that was already decided", func() {
+			failed := transaction
+			failed.Status = constants.FAILED
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, transaction.ReferenceID.String()).Return(failed, nil)
+
+			result, err := replayer.ReplayTransactions(ctx, TransactionSelection{ReferenceIDs: []string{transaction.ReferenceID.String()}})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.ReplayResult{Selected: 1, Skipped: 1}))
+		})
+
+		ginkgo.It("should not publish anything in a dry run", func() {
+			replayer.settings.DryRun = true
+			mockTransactionRepo.On("GetTransactionByReferenceID", ctx, transaction.ReferenceID.String()).Return(transaction, nil)
+
+			result, err := replayer.ReplayTransactions(ctx, TransactionSelection{ReferenceIDs: []string{transaction.ReferenceID.String()}})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(models.ReplayResult{Selected: 1, Replayed: 1}))
+			mockProcessedMessageRepo.AssertNotCalled(ginkgo.GinkgoT(), "DeleteProcessedMessages", mock.Anything, mock.Anything)
+			mockProducer.AssertNotCalled(ginkgo.GinkgoT(), "ProduceMessage", mock.Anything, mock.Anything)
+		})
+	})
+
+	ginkgo.Describe("rate limit", func() {
+		ginkgo.It("should space the replays out to the rate", func() {
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			var slept []time.Duration
+
+			replayer.settings.Rate = 4
+			replayer.now = func() time.Time { return now }
+			replayer.sleep = func(ctx context.Context, d time.Duration) error {
+				slept = append(slept, d)
+				return nil
+			}
+
+			for i := 0; i < 3; i++ {
+				gomega.Expect(replayer.throttle(ctx)).To(gomega.Succeed())
+			}
+			gomega.Expect(slept).To(gomega.Equal([]time.Duration{250 * time.Millisecond, 500 * time.Millisecond}))
+		})
+
+		ginkgo.It("should stop waiting when the replay is interrupted", func() {
+			replayer.settings.Rate = 0.001
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+
+			gomega.Expect(replayer.throttle(cancelled)).To(gomega.Succeed())
+			gomega.Expect(replayer.throttle(cancelled)).To(gomega.MatchError(context.Canceled))
+		})
+	})
+})
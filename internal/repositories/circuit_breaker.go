@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"payment-gateway/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ICircuitBreakerRepository interface {
+	UpdateState(ctx context.Context, gatewayID int, update func(state *models.CircuitBreakerState) error) error
+}
+
+// CircuitBreakerRepository stores circuit breaker state so every replica shares it
+type CircuitBreakerRepository struct {
+	db *sqlx.DB
+}
+
+func NewCircuitBreakerRepository(db *sqlx.DB) *CircuitBreakerRepository {
+	return &CircuitBreakerRepository{db: db}
+}
+
+// UpdateState locks the breaker row of a gateway, lets update modify it and stores the result.
+// The row is created on first use. The error returned by update is passed through after the
+// state is saved.
+func (r *CircuitBreakerRepository) UpdateState(ctx context.Context, gatewayID int, update func(state *models.CircuitBreakerState) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin circuit breaker transaction for gatewayID %d: %w", gatewayID, err)
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO gateway_circuit_breakers (gateway_id)
+		VALUES ($1)
+		ON CONFLICT (gateway_id) DO NOTHING;
+	`
+	if _, err := tx.ExecContext(ctx, insertQuery, gatewayID); err != nil {
+		return fmt.Errorf("failed to initialize circuit breaker for gatewayID %d: %w", gatewayID, err)
+	}
+
+	selectQuery := `
+		SELECT
+			gateway_id,
+			state,
+			window_started_at,
+			request_count,
+			failure_count,
+			opened_at,
+			half_open_probes,
+			half_open_successes,
+			probe_admitted_at,
+			updated_at
+		FROM
+			gateway_circuit_breakers
+		WHERE
+			gateway_id = $1
+		FOR UPDATE;
+	`
+	var state models.CircuitBreakerState
+	if err := tx.GetContext(ctx, &state, selectQuery, gatewayID); err != nil {
+		return fmt.Errorf("failed to lock circuit breaker for gatewayID %d: %w", gatewayID, err)
+	}
+
+	updateErr := update(&state)
+
+	updateQuery := `
+		UPDATE gateway_circuit_breakers
+		SET state = $1,
+		    window_started_at = $2,
+		    request_count = $3,
+		    failure_count = $4,
+		    opened_at = $5,
+		    half_open_probes = $6,
+		    half_open_successes = $7,
+		    probe_admitted_at = $8,
+		    updated_at = $9
+		WHERE gateway_id = $10;
+	`
+	_, err = tx.ExecContext(ctx, updateQuery,
+		state.State,
+		state.WindowStartedAt,
+		state.RequestCount,
+		state.FailureCount,
+		state.OpenedAt,
+		state.HalfOpenProbes,
+		state.HalfOpenSuccesses,
+		state.ProbeAdmittedAt,
+		state.UpdatedAt,
+		gatewayID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update circuit breaker for gatewayID %d: %w", gatewayID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit circuit breaker for gatewayID %d: %w", gatewayID, err)
+	}
+
+	return updateErr
+}
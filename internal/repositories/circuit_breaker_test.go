@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("CircuitBreakerRepository", func() {
+	var (
+		mockDB    *sqlx.DB
+		sqlMock   sqlmock.Sqlmock
+		repo      *CircuitBreakerRepository
+		ctx       context.Context
+		gatewayID int
+		columns   []string
+		now       time.Time
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewCircuitBreakerRepository(mockDB)
+
+		ctx = context.Background()
+		gatewayID = 1
+		now = time.Now()
+		columns = []string{
+			"gateway_id", "state", "window_started_at", "request_count", "failure_count",
+			"opened_at", "half_open_probes", "half_open_successes", "probe_admitted_at", "updated_at",
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("UpdateState", func() {
+		ginkgo.It("should lock the state, apply the update and store it", func() {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(`INSERT INTO gateway_circuit_breakers`).
+				WithArgs(gatewayID).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+gateway_circuit_breakers .* FOR UPDATE`).
+				WithArgs(gatewayID).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(gatewayID, constants.CIRCUIT_CLOSED, now, 4, 2, nil, 0, 0, nil, now))
+			sqlMock.ExpectExec(`UPDATE gateway_circuit_breakers`).
+				WithArgs(constants.CIRCUIT_OPEN, now, 5, 3, now, 0, 0, nil, now, gatewayID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectCommit()
+
+			err := repo.UpdateState(ctx, gatewayID, func(state *models.CircuitBreakerState) error {
+				gomega.Expect(state.RequestCount).To(gomega.Equal(4))
+				state.State = constants.CIRCUIT_OPEN
+				state.RequestCount++
+				state.FailureCount++
+				state.OpenedAt = &now
+				return nil
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should store the state and return the error of the update", func() {
+			updateErr := errors.New("circuit breaker is open")
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(`INSERT INTO gateway_circuit_breakers`).
+				WithArgs(gatewayID).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+gateway_circuit_breakers .* FOR UPDATE`).
+				WithArgs(gatewayID).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(gatewayID, constants.CIRCUIT_OPEN, now, 0, 0, now, 0, 0, nil, now))
+			sqlMock.ExpectExec(`UPDATE gateway_circuit_breakers`).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectCommit()
+
+			err := repo.UpdateState(ctx, gatewayID, func(state *models.CircuitBreakerState) error {
+				return updateErr
+			})
+			gomega.Expect(err).To(gomega.Equal(updateErr))
+		})
+
+		ginkgo.It("should roll back when the state cannot be locked", func() {
+			dbError := errors.New("database error")
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(`INSERT INTO gateway_circuit_breakers`).
+				WithArgs(gatewayID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+gateway_circuit_breakers .* FOR UPDATE`).
+				WithArgs(gatewayID).
+				WillReturnError(dbError)
+			sqlMock.ExpectRollback()
+
+			err := repo.UpdateState(ctx, gatewayID, func(state *models.CircuitBreakerState) error {
+				ginkgo.Fail("update must not be called")
+				return nil
+			})
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
+		})
+	})
+})
@@ -2,15 +2,62 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
 
 	"github.com/jmoiron/sqlx"
 )
 
 type IGatewayRepository interface {
-	UpdateHealthStatus(ctx context.Context, gatewayID int, healthStatus string) error
+	GetGatewayByID(ctx context.Context, gatewayID int) (models.GatewayDetail, error)
+	GetGateways(ctx context.Context) ([]models.GatewayDetail, error)
+	UpdateHealth(ctx context.Context, gatewayID int, update func(health *models.GatewayHealth) error) error
+	GetHealth(ctx context.Context, gatewayID int) (models.GatewayHealth, error)
+	InsertHealthEvent(ctx context.Context, event *models.GatewayHealthEvent) error
+	GetHealthEvents(ctx context.Context, gatewayID int, limit int) ([]models.GatewayHealthEvent, error)
+	GetHealthStatusChanges(ctx context.Context, gatewayID int, since time.Time) ([]models.GatewayHealthEvent, error)
+	DeleteProbeEvents(ctx context.Context, before time.Time) (int64, error)
 }
 
+// gatewayHealthColumns selects the health of a gateway the way models.GatewayHealth scans it
+const gatewayHealthColumns = `
+	id,
+	health_status,
+	health_status_reason,
+	health_status_changed_at,
+	probe_status,
+	consecutive_failures,
+	consecutive_successes,
+	last_checked_at,
+	last_check_latency_ms,
+	last_check_error,
+	traffic_status,
+	traffic_status_reason,
+	traffic_requests,
+	traffic_success_rate,
+	traffic_timeout_rate,
+	traffic_p95_latency_ms,
+	traffic_scored_at
+`
+
+// gatewayHealthEventColumns selects a health event the way models.GatewayHealthEvent scans it
+const gatewayHealthEventColumns = `
+	id,
+	gateway_id,
+	event_type,
+	health_status,
+	previous_status,
+	probe_passed,
+	latency_ms,
+	reason,
+	created_at
+`
+
 type GatewayRepository struct {
 	db *sqlx.DB
 }
@@ -21,29 +68,216 @@ func NewGatewayRepository(db *sqlx.DB) *GatewayRepository {
 	}
 }
 
-// UpdateHealthStatus updates the health_status of a gateway by its ID
-func (r *GatewayRepository) UpdateHealthStatus(ctx context.Context, gatewayID int, healthStatus string) error {
+// GetGatewayByID returns the gateway, sql.ErrNoRows when it does not exist
+func (r *GatewayRepository) GetGatewayByID(ctx context.Context, gatewayID int) (models.GatewayDetail, error) {
+	query := `
+		SELECT id, name, data_format_supported, health_status, last_checked_at, created_at, updated_at
+		FROM gateways
+		WHERE id = $1;
+	`
+
+	var gateway models.GatewayDetail
+	if err := r.db.GetContext(ctx, &gateway, query, gatewayID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.GatewayDetail{}, sql.ErrNoRows
+		}
+		return models.GatewayDetail{}, fmt.Errorf("failed to fetch gateway with id %d: %w", gatewayID, err)
+	}
+
+	return gateway, nil
+}
+
+// GetGateways returns every gateway ordered by ID
+func (r *GatewayRepository) GetGateways(ctx context.Context) ([]models.GatewayDetail, error) {
 	query := `
+		SELECT id, name, data_format_supported, health_status, last_checked_at, created_at, updated_at
+		FROM gateways
+		ORDER BY id;
+	`
+
+	gateways := []models.GatewayDetail{}
+	if err := r.db.SelectContext(ctx, &gateways, query); err != nil {
+		return nil, fmt.Errorf("failed to fetch gateways: %w", err)
+	}
+
+	return gateways, nil
+}
+
+// UpdateHealth locks the health state of a gateway, lets update modify it and stores the result together
+// with a status_change event when the health status changed. The error returned by update is passed
+// through after the state is saved.
+func (r *GatewayRepository) UpdateHealth(ctx context.Context, gatewayID int, update func(health *models.GatewayHealth) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin health transaction for gatewayID %d: %w", gatewayID, err)
+	}
+	defer tx.Rollback()
+
+	selectQuery := `SELECT ` + gatewayHealthColumns + ` FROM gateways WHERE id = $1 FOR UPDATE;`
+	var health models.GatewayHealth
+	if err := tx.GetContext(ctx, &health, selectQuery, gatewayID); err != nil {
+		return fmt.Errorf("failed to lock health of gatewayID %d: %w", gatewayID, err)
+	}
+
+	previousStatus := health.HealthStatus
+	updateErr := update(&health)
+
+	updateQuery := `
 		UPDATE gateways
 		SET health_status = $1,
-		    last_checked_at = CURRENT_TIMESTAMP,
+		    health_status_reason = $2,
+		    health_status_changed_at = $3,
+		    probe_status = $4,
+		    consecutive_failures = $5,
+		    consecutive_successes = $6,
+		    last_checked_at = $7,
+		    last_check_latency_ms = $8,
+		    last_check_error = $9,
+		    traffic_status = $10,
+		    traffic_status_reason = $11,
+		    traffic_requests = $12,
+		    traffic_success_rate = $13,
+		    traffic_timeout_rate = $14,
+		    traffic_p95_latency_ms = $15,
+		    traffic_scored_at = $16,
 		    updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2;
+		WHERE id = $17;
 	`
-
-	result, err := r.db.ExecContext(ctx, query, healthStatus, gatewayID)
+	_, err = tx.ExecContext(ctx, updateQuery,
+		health.HealthStatus,
+		health.HealthStatusReason,
+		health.HealthStatusChangedAt,
+		health.ProbeStatus,
+		health.ConsecutiveFailures,
+		health.ConsecutiveSuccesses,
+		health.LastCheckedAt,
+		health.LastCheckLatencyMs,
+		health.LastCheckError,
+		health.TrafficStatus,
+		health.TrafficStatusReason,
+		health.TrafficRequests,
+		health.TrafficSuccessRate,
+		health.TrafficTimeoutRate,
+		health.TrafficP95LatencyMs,
+		health.TrafficScoredAt,
+		gatewayID,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to update health_status for gatewayID %d: %w", gatewayID, err)
+		return fmt.Errorf("failed to update health of gatewayID %d: %w", gatewayID, err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to retrieve rows affected for gatewayID %d: %w", gatewayID, err)
+	if health.HealthStatus != previousStatus {
+		changedAt := time.Now()
+		if health.HealthStatusChangedAt != nil {
+			changedAt = *health.HealthStatusChangedAt
+		}
+		event := &models.GatewayHealthEvent{
+			GatewayID:      gatewayID,
+			EventType:      constants.HEALTH_EVENT_STATUS_CHANGE,
+			HealthStatus:   health.HealthStatus,
+			PreviousStatus: &previousStatus,
+			Reason:         health.HealthStatusReason,
+			CreatedAt:      changedAt,
+		}
+		if err := insertHealthEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit health of gatewayID %d: %w", gatewayID, err)
+	}
+
+	return updateErr
+}
+
+// GetHealth returns the health state of a gateway, sql.ErrNoRows when the gateway does not exist
+func (r *GatewayRepository) GetHealth(ctx context.Context, gatewayID int) (models.GatewayHealth, error) {
+	query := `SELECT ` + gatewayHealthColumns + ` FROM gateways WHERE id = $1;`
+
+	var health models.GatewayHealth
+	if err := r.db.GetContext(ctx, &health, query, gatewayID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.GatewayHealth{}, err
+		}
+		return models.GatewayHealth{}, fmt.Errorf("failed to fetch health of gatewayID %d: %w", gatewayID, err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("no gateway found with id %d", gatewayID)
+	return health, nil
+}
+
+// InsertHealthEvent stores an event in the health history of a gateway and sets its ID
+func (r *GatewayRepository) InsertHealthEvent(ctx context.Context, event *models.GatewayHealthEvent) error {
+	return insertHealthEvent(ctx, r.db, event)
+}
+
+func insertHealthEvent(ctx context.Context, db sqlx.QueryerContext, event *models.GatewayHealthEvent) error {
+	query := `
+		INSERT INTO gateway_health_events (
+			gateway_id, event_type, health_status, previous_status, probe_passed, latency_ms, reason, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id;
+	`
+	err := db.QueryRowxContext(ctx, query,
+		event.GatewayID,
+		event.EventType,
+		event.HealthStatus,
+		event.PreviousStatus,
+		event.ProbePassed,
+		event.LatencyMs,
+		event.Reason,
+		event.CreatedAt,
+	).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s health event of gatewayID %d: %w", event.EventType, event.GatewayID, err)
 	}
 
 	return nil
 }
+
+// GetHealthEvents returns the most recent events in the health history of a gateway, newest first
+func (r *GatewayRepository) GetHealthEvents(ctx context.Context, gatewayID int, limit int) ([]models.GatewayHealthEvent, error) {
+	query := `
+		SELECT ` + gatewayHealthEventColumns + `
+		FROM gateway_health_events
+		WHERE gateway_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2;
+	`
+	events := []models.GatewayHealthEvent{}
+	if err := r.db.SelectContext(ctx, &events, query, gatewayID, limit); err != nil {
+		return nil, fmt.Errorf("failed to fetch health events of gatewayID %d: %w", gatewayID, err)
+	}
+
+	return events, nil
+}
+
+// GetHealthStatusChanges returns the changes of the health status of a gateway after since, oldest first
+func (r *GatewayRepository) GetHealthStatusChanges(ctx context.Context, gatewayID int, since time.Time) ([]models.GatewayHealthEvent, error) {
+	query := `
+		SELECT ` + gatewayHealthEventColumns + `
+		FROM gateway_health_events
+		WHERE gateway_id = $1 AND event_type = $2 AND created_at > $3
+		ORDER BY created_at, id;
+	`
+	events := []models.GatewayHealthEvent{}
+	if err := r.db.SelectContext(ctx, &events, query, gatewayID, constants.HEALTH_EVENT_STATUS_CHANGE, since); err != nil {
+		return nil, fmt.Errorf("failed to fetch health status changes of gatewayID %d: %w", gatewayID, err)
+	}
+
+	return events, nil
+}
+
+// DeleteProbeEvents removes the probe events created before the given time and returns how many were
+// removed. Status changes are kept, the uptime of a gateway is worked out from them.
+func (r *GatewayRepository) DeleteProbeEvents(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM gateway_health_events WHERE event_type = $1 AND created_at < $2;`
+
+	result, err := r.db.ExecContext(ctx, query, constants.HEALTH_EVENT_PROBE, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete probe events: %w", err)
+	}
+
+	return result.RowsAffected()
+}
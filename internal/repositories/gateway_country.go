@@ -9,7 +9,7 @@ import (
 )
 
 type IGatewayCountryRepository interface {
-	GetHealthyGatewayByCountryID(ctx context.Context, countryID int) (*models.GatewayDetail, error)
+	GetRoutableGatewaysByCountryID(ctx context.Context, countryID int) ([]models.GatewayDetail, error)
 }
 
 type GatewayCountryRepository struct {
@@ -20,8 +20,11 @@ func NewGatewayCountryRepository(db *sqlx.DB) *GatewayCountryRepository {
 	return &GatewayCountryRepository{db: db}
 }
 
-func (r *GatewayCountryRepository) GetHealthyGatewayByCountryID(ctx context.Context, countryID int) (*models.GatewayDetail, error) {
-	var gatewayDetail models.GatewayDetail
+// GetRoutableGatewaysByCountryID returns the gateways of a country that may receive transactions, the
+// healthy and degraded ones, ordered by priority. Unhealthy gateways, gateways in maintenance and gateways
+// inside a maintenance window for the country are left out; the latter come back once the window is over.
+func (r *GatewayCountryRepository) GetRoutableGatewaysByCountryID(ctx context.Context, countryID int) ([]models.GatewayDetail, error) {
+	var gatewayDetails []models.GatewayDetail
 	query := `
 		SELECT
 			g.id,
@@ -43,17 +46,25 @@ func (r *GatewayCountryRepository) GetHealthyGatewayByCountryID(ctx context.Cont
 		WHERE
 			gc.country_id = $1
 		AND
-			g.health_status = 'healthy'
+			g.health_status IN ('healthy', 'degraded')
+		AND NOT EXISTS (
+			SELECT 1
+			FROM gateway_maintenance_windows mw
+			WHERE mw.gateway_id = g.id
+			AND (mw.country_id IS NULL OR mw.country_id = gc.country_id)
+			AND mw.cancelled_at IS NULL
+			AND mw.starts_at <= (NOW() AT TIME ZONE 'UTC')
+			AND mw.ends_at > (NOW() AT TIME ZONE 'UTC')
+		)
 		ORDER BY 
-			gc.priority ASC
-		LIMIT 1;
+			gc.priority ASC;
 	`
 
-	err := r.db.GetContext(ctx, &gatewayDetail, query, countryID)
+	err := r.db.SelectContext(ctx, &gatewayDetails, query, countryID)
 	if err != nil {
-		log.Printf("Error fetching gateway detail for country_id %d: %v", countryID, err)
+		log.Printf("Error fetching gateway details for country_id %d: %v", countryID, err)
 		return nil, err
 	}
 
-	return &gatewayDetail, nil
+	return gatewayDetails, nil
 }
@@ -49,8 +49,8 @@ var _ = ginkgo.Describe("GatewayCountryRepository", func() {
 		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 	})
 
-	ginkgo.Describe("GetHealthyGatewayByCountryID", func() {
-		ginkgo.It("should successfully fetch healthy gateway detail", func() {
+	ginkgo.Describe("GetRoutableGatewaysByCountryID", func() {
+		ginkgo.It("should successfully fetch routable gateway details", func() {
 			rows := sqlmock.NewRows([]string{
 				"id", "name", "data_format_supported", "health_status", "last_checked_at",
 				"created_at", "updated_at", "priority", "country_id", "currency",
@@ -65,20 +65,28 @@ var _ = ginkgo.Describe("GatewayCountryRepository", func() {
 				WithArgs(countryID).
 				WillReturnRows(rows)
 
-			result, err := repo.GetHealthyGatewayByCountryID(ctx, countryID)
+			result, err := repo.GetRoutableGatewaysByCountryID(ctx, countryID)
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
-			gomega.Expect(result).Should(gomega.Equal(expectedData))
+			gomega.Expect(result).Should(gomega.Equal([]models.GatewayDetail{*expectedData}))
 		})
 
-		ginkgo.It("should return error when no rows match the query", func() {
+		ginkgo.It("should return an empty list when no rows match the query", func() {
 			sqlMock.ExpectQuery(`SELECT g.id, g.name, g.data_format_supported, g.health_status, g.last_checked_at, g.created_at, g.updated_at, gc.priority, gc.country_id, c.currency`).
 				WithArgs(countryID).
 				WillReturnRows(sqlmock.NewRows(nil)) // Empty result
 
-			result, err := repo.GetHealthyGatewayByCountryID(ctx, countryID)
-			gomega.Expect(err).Should(gomega.HaveOccurred())
-			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("sql: no rows in result set"))
-			gomega.Expect(result).Should(gomega.BeNil())
+			result, err := repo.GetRoutableGatewaysByCountryID(ctx, countryID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).Should(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should leave out gateways inside an active maintenance window for the country", func() {
+			sqlMock.ExpectQuery(`NOT EXISTS \( SELECT 1 FROM gateway_maintenance_windows mw WHERE mw.gateway_id = g.id AND \(mw.country_id IS NULL OR mw.country_id = gc.country_id\) AND mw.cancelled_at IS NULL AND mw.starts_at <= \(NOW\(\) AT TIME ZONE 'UTC'\) AND mw.ends_at > \(NOW\(\) AT TIME ZONE 'UTC'\) \)`).
+				WithArgs(countryID).
+				WillReturnRows(sqlmock.NewRows(nil))
+
+			_, err := repo.GetRoutableGatewaysByCountryID(ctx, countryID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 		})
 
 		ginkgo.It("should return error when database query fails", func() {
@@ -88,7 +96,7 @@ var _ = ginkgo.Describe("GatewayCountryRepository", func() {
 				WithArgs(countryID).
 				WillReturnError(dbError)
 
-			result, err := repo.GetHealthyGatewayByCountryID(ctx, countryID)
+			result, err := repo.GetRoutableGatewaysByCountryID(ctx, countryID)
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
 			gomega.Expect(result).Should(gomega.BeNil())
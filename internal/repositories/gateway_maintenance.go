@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IGatewayMaintenanceRepository interface {
+	InsertMaintenanceWindow(ctx context.Context, window *models.GatewayMaintenanceWindow) error
+	GetMaintenanceWindows(ctx context.Context, gatewayID int, endsAfter time.Time) ([]models.GatewayMaintenanceWindow, error)
+	CancelMaintenanceWindow(ctx context.Context, gatewayID int, windowID int, cancelledAt time.Time) (models.GatewayMaintenanceWindow, error)
+}
+
+// gatewayMaintenanceWindowColumns selects a maintenance window the way models.GatewayMaintenanceWindow scans it
+const gatewayMaintenanceWindowColumns = `
+	id,
+	gateway_id,
+	country_id,
+	starts_at,
+	ends_at,
+	reason,
+	cancelled_at,
+	created_at
+`
+
+// GatewayMaintenanceRepository stores the maintenance windows GatewayCountryRepository leaves gateways out of routing for
+type GatewayMaintenanceRepository struct {
+	db *sqlx.DB
+}
+
+func NewGatewayMaintenanceRepository(db *sqlx.DB) *GatewayMaintenanceRepository {
+	return &GatewayMaintenanceRepository{db: db}
+}
+
+// InsertMaintenanceWindow stores a maintenance window and sets its ID and creation time
+func (r *GatewayMaintenanceRepository) InsertMaintenanceWindow(ctx context.Context, window *models.GatewayMaintenanceWindow) error {
+	query := `
+		INSERT INTO gateway_maintenance_windows (gateway_id, country_id, starts_at, ends_at, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at;
+	`
+	err := r.db.QueryRowxContext(ctx, query,
+		window.GatewayID,
+		window.CountryID,
+		window.StartsAt,
+		window.EndsAt,
+		window.Reason,
+	).Scan(&window.ID, &window.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert maintenance window of gatewayID %d: %w", window.GatewayID, err)
+	}
+
+	return nil
+}
+
+// GetMaintenanceWindows returns the windows of a gateway that are not cancelled and end after endsAfter,
+// the running and upcoming ones when endsAfter is now, in the order they start
+func (r *GatewayMaintenanceRepository) GetMaintenanceWindows(ctx context.Context, gatewayID int, endsAfter time.Time) ([]models.GatewayMaintenanceWindow, error) {
+	query := `
+		SELECT ` + gatewayMaintenanceWindowColumns + `
+		FROM gateway_maintenance_windows
+		WHERE gateway_id = $1 AND cancelled_at IS NULL AND ends_at > $2
+		ORDER BY starts_at, id;
+	`
+	windows := []models.GatewayMaintenanceWindow{}
+	if err := r.db.SelectContext(ctx, &windows, query, gatewayID, endsAfter); err != nil {
+		return nil, fmt.Errorf("failed to fetch maintenance windows of gatewayID %d: %w", gatewayID, err)
+	}
+
+	return windows, nil
+}
+
+// CancelMaintenanceWindow calls off a window of a gateway that is neither cancelled nor over, ending it
+// right away when it already started. sql.ErrNoRows is returned when there is no such window.
+func (r *GatewayMaintenanceRepository) CancelMaintenanceWindow(ctx context.Context, gatewayID int, windowID int, cancelledAt time.Time) (models.GatewayMaintenanceWindow, error) {
+	query := `
+		UPDATE gateway_maintenance_windows
+		SET cancelled_at = $1
+		WHERE id = $2 AND gateway_id = $3 AND cancelled_at IS NULL AND ends_at > $1
+		RETURNING ` + gatewayMaintenanceWindowColumns + `;
+	`
+	var window models.GatewayMaintenanceWindow
+	if err := r.db.GetContext(ctx, &window, query, cancelledAt, windowID, gatewayID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.GatewayMaintenanceWindow{}, sql.ErrNoRows
+		}
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("failed to cancel maintenance window %d of gatewayID %d: %w", windowID, gatewayID, err)
+	}
+
+	return window, nil
+}
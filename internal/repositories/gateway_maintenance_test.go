@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("GatewayMaintenanceRepository", func() {
+	var (
+		sqlMock sqlmock.Sqlmock
+		repo    *GatewayMaintenanceRepository
+		ctx     context.Context
+		now     time.Time
+	)
+
+	columns := []string{"id", "gateway_id", "country_id", "starts_at", "ends_at", "reason", "cancelled_at", "created_at"}
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		sqlMock = mock
+		repo = NewGatewayMaintenanceRepository(sqlx.NewDb(sqlDB, "sqlmock"))
+		ctx = context.Background()
+		now = time.Date(2024, 12, 22, 12, 0, 0, 0, time.UTC)
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(sqlMock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.Describe("InsertMaintenanceWindow", func() {
+		ginkgo.It("should insert the window and set its ID", func() {
+			countryID := 2
+			window := &models.GatewayMaintenanceWindow{
+				GatewayID: 1,
+				CountryID: &countryID,
+				StartsAt:  now.Add(time.Hour),
+				EndsAt:    now.Add(3 * time.Hour),
+				Reason:    "database upgrade",
+			}
+
+			sqlMock.ExpectQuery(`INSERT INTO gateway_maintenance_windows`).
+				WithArgs(1, &countryID, window.StartsAt, window.EndsAt, "database upgrade").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, now))
+
+			gomega.Expect(repo.InsertMaintenanceWindow(ctx, window)).To(gomega.Succeed())
+			gomega.Expect(window.ID).To(gomega.Equal(5))
+			gomega.Expect(window.CreatedAt).To(gomega.Equal(now))
+		})
+
+		ginkgo.It("should return error when database query fails", func() {
+			sqlMock.ExpectQuery(`INSERT INTO gateway_maintenance_windows`).
+				WillReturnError(errors.New("database error"))
+
+			err := repo.InsertMaintenanceWindow(ctx, &models.GatewayMaintenanceWindow{GatewayID: 1})
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("failed to insert maintenance window"))
+		})
+	})
+
+	ginkgo.Describe("GetMaintenanceWindows", func() {
+		ginkgo.It("should return the windows that are neither cancelled nor over", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM gateway_maintenance_windows\s+WHERE gateway_id = \$1 AND cancelled_at IS NULL AND ends_at > \$2\s+ORDER BY starts_at, id`).
+				WithArgs(1, now).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(5, 1, nil, now.Add(-time.Hour), now.Add(time.Hour), "database upgrade", nil, now.Add(-24*time.Hour)))
+
+			windows, err := repo.GetMaintenanceWindows(ctx, 1, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(windows).To(gomega.HaveLen(1))
+			gomega.Expect(windows[0].CountryID).To(gomega.BeNil())
+			gomega.Expect(windows[0].Reason).To(gomega.Equal("database upgrade"))
+		})
+	})
+
+	ginkgo.Describe("CancelMaintenanceWindow", func() {
+		ginkgo.It("should cancel the window and return it", func() {
+			sqlMock.ExpectQuery(`UPDATE gateway_maintenance_windows\s+SET cancelled_at = \$1\s+WHERE id = \$2 AND gateway_id = \$3 AND cancelled_at IS NULL AND ends_at > \$1\s+RETURNING`).
+				WithArgs(now, 5, 1).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(5, 1, 2, now.Add(-time.Hour), now.Add(time.Hour), "", now, now.Add(-24*time.Hour)))
+
+			window, err := repo.CancelMaintenanceWindow(ctx, 1, 5, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(window.CancelledAt).To(gomega.HaveValue(gomega.Equal(now)))
+			gomega.Expect(window.CountryID).To(gomega.HaveValue(gomega.Equal(2)))
+		})
+
+		ginkgo.It("should return sql.ErrNoRows when there is no window to cancel", func() {
+			sqlMock.ExpectQuery(`UPDATE gateway_maintenance_windows`).
+				WithArgs(now, 5, 1).
+				WillReturnError(sql.ErrNoRows)
+
+			_, err := repo.CancelMaintenanceWindow(ctx, 1, 5, now)
+			gomega.Expect(err).To(gomega.MatchError(sql.ErrNoRows))
+		})
+	})
+})
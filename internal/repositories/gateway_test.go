@@ -2,9 +2,13 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"fmt"
 	"testing"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -24,7 +28,6 @@ var _ = ginkgo.Describe("GatewayRepository", func() {
 		repo      *GatewayRepository
 		ctx       context.Context
 		gatewayID int
-		status    string
 	)
 
 	ginkgo.BeforeEach(func() {
@@ -38,7 +41,6 @@ var _ = ginkgo.Describe("GatewayRepository", func() {
 
 		ctx = context.Background()
 		gatewayID = 1
-		status = "healthy"
 	})
 
 	ginkgo.AfterEach(func() {
@@ -46,46 +48,215 @@ var _ = ginkgo.Describe("GatewayRepository", func() {
 		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 	})
 
-	ginkgo.Describe("UpdateHealthStatus", func() {
-		ginkgo.It("should successfully update health status", func() {
+	ginkgo.Describe("GetGatewayByID", func() {
+		ginkgo.It("should return the gateway", func() {
+			now := time.Now()
+			sqlMock.ExpectQuery(`SELECT .* FROM gateways\s+WHERE id = \$1`).
+				WithArgs(gatewayID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "data_format_supported", "health_status", "last_checked_at", "created_at", "updated_at"}).
+					AddRow(gatewayID, "A", "json", "healthy", now, now, now))
+
+			gateway, err := repo.GetGatewayByID(ctx, gatewayID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(gateway.Name).To(gomega.Equal("A"))
+		})
+
+		ginkgo.It("should return sql.ErrNoRows when the gateway does not exist", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM gateways`).
+				WithArgs(gatewayID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+			_, err := repo.GetGatewayByID(ctx, gatewayID)
+			gomega.Expect(err).To(gomega.Equal(sql.ErrNoRows))
+		})
+	})
+
+	ginkgo.Describe("GetGateways", func() {
+		ginkgo.It("should return every gateway", func() {
+			now := time.Now()
+			sqlMock.ExpectQuery(`SELECT .* FROM gateways\s+ORDER BY id`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "data_format_supported", "health_status", "last_checked_at", "created_at", "updated_at"}).
+					AddRow(1, "A", "json", "healthy", now, now, now).
+					AddRow(2, "B", "soap", "unhealthy", now, now, now))
+
+			gateways, err := repo.GetGateways(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(gateways).To(gomega.HaveLen(2))
+			gomega.Expect(gateways[1].Name).To(gomega.Equal("B"))
+		})
+
+		ginkgo.It("should return error when database query fails", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM gateways`).
+				WillReturnError(errors.New("database error"))
+
+			_, err := repo.GetGateways(ctx)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("failed to fetch gateways"))
+		})
+	})
+
+	ginkgo.Describe("UpdateHealth", func() {
+		columns := []string{
+			"id", "health_status", "health_status_reason", "health_status_changed_at", "probe_status",
+			"consecutive_failures", "consecutive_successes", "last_checked_at", "last_check_latency_ms", "last_check_error",
+			"traffic_status", "traffic_status_reason", "traffic_requests", "traffic_success_rate", "traffic_timeout_rate",
+			"traffic_p95_latency_ms", "traffic_scored_at",
+		}
+
+		ginkgo.It("should lock the health, apply the update and store it", func() {
+			now := time.Now()
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+gateways\s+WHERE\s+id = \$1\s+FOR UPDATE`).
+				WithArgs(gatewayID).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(gatewayID, constants.HEALTHY, "", nil, constants.HEALTHY, 2, 0, now, 40, "connection refused",
+						constants.DEGRADED, "p95 latency 3s above 2s", 25, 0.96, 0.04, 3000, now))
 			sqlMock.ExpectExec(`UPDATE gateways`).
-				WithArgs(status, gatewayID).
-				WillReturnResult(sqlmock.NewResult(1, 1)) // 1 row affected
+				WithArgs(constants.UNHEALTHY, "3 health probe(s) failed in a row", &now, constants.UNHEALTHY, 3, 0, now, int64(5000), "timeout",
+					constants.DEGRADED, "p95 latency 3s above 2s", 25, 0.96, 0.04, int64(3000), &now, gatewayID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectQuery(`INSERT INTO gateway_health_events`).
+				WithArgs(gatewayID, constants.HEALTH_EVENT_STATUS_CHANGE, constants.UNHEALTHY, sqlmock.AnyArg(), nil, nil, "3 health probe(s) failed in a row", now).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+			sqlMock.ExpectCommit()
 
-			err := repo.UpdateHealthStatus(ctx, gatewayID, status)
+			err := repo.UpdateHealth(ctx, gatewayID, func(health *models.GatewayHealth) error {
+				gomega.Expect(health.ConsecutiveFailures).To(gomega.Equal(2))
+				gomega.Expect(health.TrafficStatus).To(gomega.Equal(constants.DEGRADED))
+				health.HealthStatus = constants.UNHEALTHY
+				health.HealthStatusReason = "3 health probe(s) failed in a row"
+				health.HealthStatusChangedAt = &now
+				health.ProbeStatus = constants.UNHEALTHY
+				health.ConsecutiveFailures++
+				health.LastCheckLatencyMs = 5000
+				health.LastCheckError = "timeout"
+				return nil
+			})
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 		})
 
-		ginkgo.It("should return error when no rows are affected", func() {
+		ginkgo.It("should not record an event when the health status is unchanged", func() {
+			now := time.Now()
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT .* FOR UPDATE`).
+				WithArgs(gatewayID).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(gatewayID, constants.HEALTHY, "", nil, constants.HEALTHY, 0, 4, now, 40, "",
+						constants.HEALTHY, "", 0, 1, 0, 0, nil))
 			sqlMock.ExpectExec(`UPDATE gateways`).
-				WithArgs(status, gatewayID).
-				WillReturnResult(sqlmock.NewResult(1, 0)) // 0 rows affected
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectCommit()
 
-			err := repo.UpdateHealthStatus(ctx, gatewayID, status)
-			gomega.Expect(err).Should(gomega.HaveOccurred())
-			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("no gateway found with id"))
+			err := repo.UpdateHealth(ctx, gatewayID, func(health *models.GatewayHealth) error {
+				health.ConsecutiveSuccesses++
+				return nil
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 		})
 
-		ginkgo.It("should return error when database query fails", func() {
+		ginkgo.It("should roll back when the health cannot be locked", func() {
 			dbError := errors.New("database error")
 
-			sqlMock.ExpectExec(`UPDATE gateways`).
-				WithArgs(status, gatewayID).
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT .* FOR UPDATE`).
+				WithArgs(gatewayID).
 				WillReturnError(dbError)
+			sqlMock.ExpectRollback()
 
-			err := repo.UpdateHealthStatus(ctx, gatewayID, status)
+			err := repo.UpdateHealth(ctx, gatewayID, func(health *models.GatewayHealth) error {
+				ginkgo.Fail("update must not be called")
+				return nil
+			})
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
 		})
+	})
 
-		ginkgo.It("should return error when RowsAffected fails", func() {
-			sqlMock.ExpectExec(`UPDATE gateways`).
-				WithArgs(status, gatewayID).
-				WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("rows affected error")))
+	ginkgo.Describe("GetHealth", func() {
+		ginkgo.It("should return sql.ErrNoRows when the gateway does not exist", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM gateways WHERE id = \$1`).
+				WithArgs(gatewayID).
+				WillReturnError(sql.ErrNoRows)
+
+			_, err := repo.GetHealth(ctx, gatewayID)
+			gomega.Expect(err).To(gomega.MatchError(sql.ErrNoRows))
+		})
+	})
+
+	ginkgo.Describe("InsertHealthEvent", func() {
+		ginkgo.It("should insert the event and set its ID", func() {
+			now := time.Now()
+			passed := true
+			latency := int64(35)
+			event := &models.GatewayHealthEvent{
+				GatewayID:    gatewayID,
+				EventType:    constants.HEALTH_EVENT_PROBE,
+				HealthStatus: constants.HEALTHY,
+				ProbePassed:  &passed,
+				LatencyMs:    &latency,
+				CreatedAt:    now,
+			}
+
+			sqlMock.ExpectQuery(`INSERT INTO gateway_health_events`).
+				WithArgs(gatewayID, constants.HEALTH_EVENT_PROBE, constants.HEALTHY, nil, &passed, &latency, "", now).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
 
-			err := repo.UpdateHealthStatus(ctx, gatewayID, status)
+			gomega.Expect(repo.InsertHealthEvent(ctx, event)).To(gomega.Succeed())
+			gomega.Expect(event.ID).To(gomega.Equal(12))
+		})
+
+		ginkgo.It("should return error when database query fails", func() {
+			sqlMock.ExpectQuery(`INSERT INTO gateway_health_events`).
+				WillReturnError(errors.New("database error"))
+
+			err := repo.InsertHealthEvent(ctx, &models.GatewayHealthEvent{GatewayID: gatewayID, EventType: constants.HEALTH_EVENT_PROBE})
 			gomega.Expect(err).Should(gomega.HaveOccurred())
-			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("failed to retrieve rows affected"))
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("failed to insert probe health event"))
+		})
+	})
+
+	ginkgo.Describe("GetHealthEvents", func() {
+		ginkgo.It("should return the latest events of the gateway", func() {
+			now := time.Now()
+			sqlMock.ExpectQuery(`SELECT .* FROM gateway_health_events\s+WHERE gateway_id = \$1\s+ORDER BY created_at DESC, id DESC\s+LIMIT \$2`).
+				WithArgs(gatewayID, 50).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "gateway_id", "event_type", "health_status", "previous_status", "probe_passed", "latency_ms", "reason", "created_at"}).
+					AddRow(2, gatewayID, constants.HEALTH_EVENT_STATUS_CHANGE, constants.UNHEALTHY, constants.HEALTHY, nil, nil, "2 health probe(s) failed in a row", now).
+					AddRow(1, gatewayID, constants.HEALTH_EVENT_PROBE, constants.HEALTHY, nil, false, 1000, "timeout", now))
+
+			events, err := repo.GetHealthEvents(ctx, gatewayID, 50)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(events).To(gomega.HaveLen(2))
+			gomega.Expect(events[0].PreviousStatus).To(gomega.HaveValue(gomega.Equal(constants.HEALTHY)))
+			gomega.Expect(events[1].ProbePassed).To(gomega.HaveValue(gomega.BeFalse()))
+		})
+	})
+
+	ginkgo.Describe("GetHealthStatusChanges", func() {
+		ginkgo.It("should only fetch status changes after the given time", func() {
+			since := time.Now().Add(-time.Hour)
+			sqlMock.ExpectQuery(`SELECT .* FROM gateway_health_events\s+WHERE gateway_id = \$1 AND event_type = \$2 AND created_at > \$3`).
+				WithArgs(gatewayID, constants.HEALTH_EVENT_STATUS_CHANGE, since).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			events, err := repo.GetHealthStatusChanges(ctx, gatewayID, since)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(events).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Describe("DeleteProbeEvents", func() {
+		ginkgo.It("should delete the probe events older than the given time", func() {
+			before := time.Now().Add(-7 * 24 * time.Hour)
+			sqlMock.ExpectExec(`DELETE FROM gateway_health_events WHERE event_type = \$1 AND created_at < \$2`).
+				WithArgs(constants.HEALTH_EVENT_PROBE, before).
+				WillReturnResult(sqlmock.NewResult(0, 42))
+
+			deleted, err := repo.DeleteProbeEvents(ctx, before)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.Equal(int64(42)))
 		})
 	})
 })
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IIdempotencyKeyRepository interface {
+	ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error)
+	GetIdempotencyKey(ctx context.Context, key string) (models.IdempotencyKey, error)
+	SaveIdempotencyResponse(ctx context.Context, key string, response string) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// IdempotencyKeyRepository handles database operations for the idempotency_keys table
+type IdempotencyKeyRepository struct {
+	db *sqlx.DB
+}
+
+// NewIdempotencyKeyRepository creates a new instance of IdempotencyKeyRepository
+func NewIdempotencyKeyRepository(db *sqlx.DB) *IdempotencyKeyRepository {
+	return &IdempotencyKeyRepository{db: db}
+}
+
+// ReserveIdempotencyKey stores the key without a response and reports whether it was reserved.
+// A key that is still in use is left untouched and false is returned, an expired key is taken over.
+func (r *IdempotencyKeyRepository) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (key, request_hash, response, created_at, expires_at)
+		VALUES ($1, $2, '', $3, $4)
+		ON CONFLICT (key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash,
+		    response = '',
+		    created_at = EXCLUDED.created_at,
+		    expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+		RETURNING key;
+	`
+	var reserved string
+	err := r.db.QueryRowxContext(ctx, query, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt).Scan(&reserved)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Error reserving idempotency key %s: %v", key.Key, err)
+		return false, fmt.Errorf("failed to reserve idempotency key %s: %w", key.Key, err)
+	}
+
+	return true, nil
+}
+
+// GetIdempotencyKey returns the stored key, sql.ErrNoRows when it does not exist
+func (r *IdempotencyKeyRepository) GetIdempotencyKey(ctx context.Context, key string) (models.IdempotencyKey, error) {
+	query := `
+		SELECT key, request_hash, response, created_at, expires_at
+		FROM idempotency_keys
+		WHERE key = $1;
+	`
+	var idempotencyKey models.IdempotencyKey
+	if err := r.db.GetContext(ctx, &idempotencyKey, query, key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.IdempotencyKey{}, sql.ErrNoRows
+		}
+		return models.IdempotencyKey{}, fmt.Errorf("failed to fetch idempotency key %s: %w", key, err)
+	}
+
+	return idempotencyKey, nil
+}
+
+// SaveIdempotencyResponse stores the response returned for the request of a reserved key
+func (r *IdempotencyKeyRepository) SaveIdempotencyResponse(ctx context.Context, key string, response string) error {
+	query := `
+		UPDATE idempotency_keys
+		SET response = $1
+		WHERE key = $2;
+	`
+	result, err := r.db.ExecContext(ctx, query, response, key)
+	if err != nil {
+		log.Printf("Error saving response of idempotency key %s: %v", key, err)
+		return fmt.Errorf("failed to save response of idempotency key %s: %w", key, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save response of idempotency key %s: %w", key, err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteIdempotencyKey releases a key whose request failed, so the client can send it again
+func (r *IdempotencyKeyRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE key = $1;`
+	if _, err := r.db.ExecContext(ctx, query, key); err != nil {
+		log.Printf("Error deleting idempotency key %s: %v", key, err)
+		return fmt.Errorf("failed to delete idempotency key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys that expired before now and returns how many were removed
+func (r *IdempotencyKeyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at <= $1;`
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		log.Printf("Error deleting expired idempotency keys: %v", err)
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+
+	return result.RowsAffected()
+}
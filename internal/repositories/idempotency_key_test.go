@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("IdempotencyKeyRepository", func() {
+	var (
+		mockDB  *sqlx.DB
+		sqlMock sqlmock.Sqlmock
+		repo    *IdempotencyKeyRepository
+		ctx     context.Context
+		now     time.Time
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewIdempotencyKeyRepository(mockDB)
+
+		ctx = context.Background()
+		now = time.Now()
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("ReserveIdempotencyKey", func() {
+		ginkgo.It("should reserve a key that is not in use", func() {
+			key := &models.IdempotencyKey{Key: "key-1", RequestHash: "hash", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+			sqlMock.ExpectQuery(`INSERT INTO idempotency_keys .* ON CONFLICT \(key\) DO UPDATE`).
+				WithArgs("key-1", "hash", now, key.ExpiresAt).
+				WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("key-1"))
+
+			reserved, err := repo.ReserveIdempotencyKey(ctx, key)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(reserved).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should not reserve a key that is still in use", func() {
+			sqlMock.ExpectQuery(`INSERT INTO idempotency_keys`).
+				WillReturnRows(sqlmock.NewRows([]string{"key"}))
+
+			reserved, err := repo.ReserveIdempotencyKey(ctx, &models.IdempotencyKey{Key: "key-1"})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(reserved).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("should return error when the insert fails", func() {
+			dbError := errors.New("database error")
+			sqlMock.ExpectQuery(`INSERT INTO idempotency_keys`).
+				WillReturnError(dbError)
+
+			_, err := repo.ReserveIdempotencyKey(ctx, &models.IdempotencyKey{Key: "key-1"})
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
+		})
+	})
+
+	ginkgo.Describe("GetIdempotencyKey", func() {
+		ginkgo.It("should return the stored key", func() {
+			rows := sqlmock.NewRows([]string{"key", "request_hash", "response", "created_at", "expires_at"}).
+				AddRow("key-1", "hash", `{"id":8}`, now, now.Add(time.Hour))
+
+			sqlMock.ExpectQuery(`SELECT .* FROM idempotency_keys`).
+				WithArgs("key-1").
+				WillReturnRows(rows)
+
+			key, err := repo.GetIdempotencyKey(ctx, "key-1")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(key.RequestHash).To(gomega.Equal("hash"))
+			gomega.Expect(key.Response).To(gomega.Equal(`{"id":8}`))
+		})
+
+		ginkgo.It("should return sql.ErrNoRows when the key does not exist", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM idempotency_keys`).
+				WillReturnError(sql.ErrNoRows)
+
+			_, err := repo.GetIdempotencyKey(ctx, "key-1")
+			gomega.Expect(err).To(gomega.Equal(sql.ErrNoRows))
+		})
+	})
+
+	ginkgo.Describe("SaveIdempotencyResponse", func() {
+		ginkgo.It("should store the response", func() {
+			sqlMock.ExpectExec(`UPDATE idempotency_keys`).
+				WithArgs(`{"id":8}`, "key-1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := repo.SaveIdempotencyResponse(ctx, "key-1", `{"id":8}`)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should return sql.ErrNoRows when the key does not exist", func() {
+			sqlMock.ExpectExec(`UPDATE idempotency_keys`).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := repo.SaveIdempotencyResponse(ctx, "key-1", `{"id":8}`)
+			gomega.Expect(err).To(gomega.Equal(sql.ErrNoRows))
+		})
+	})
+
+	ginkgo.Describe("DeleteExpiredIdempotencyKeys", func() {
+		ginkgo.It("should return the number of deleted keys", func() {
+			sqlMock.ExpectExec(`DELETE FROM idempotency_keys WHERE expires_at <= \$1`).
+				WithArgs(now).
+				WillReturnResult(sqlmock.NewResult(0, 4))
+
+			deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.Equal(int64(4)))
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IOutboxRepository interface {
+	ClaimPendingMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error)
+	MarkMessageSent(ctx context.Context, id int, sentAt time.Time) error
+	MarkMessageFailed(ctx context.Context, id int, errorMessage string, nextAttemptAt time.Time) error
+	GetLag(ctx context.Context, now time.Time) (models.OutboxLag, error)
+	DeleteSentMessages(ctx context.Context, sentBefore time.Time) (int64, error)
+}
+
+// OutboxRepository handles database operations for the outbox_messages table
+type OutboxRepository struct {
+	db *sqlx.DB
+}
+
+// NewOutboxRepository creates a new instance of OutboxRepository
+func NewOutboxRepository(db *sqlx.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// ClaimPendingMessages returns up to limit unsent messages that are due, oldest first. The claimed
+// messages are not handed out again for the lease, so relays on other replicas skip them while
+// they are published. A message whose relay died is claimed again once the lease ran out.
+func (r *OutboxRepository) ClaimPendingMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error) {
+	query := `
+		UPDATE outbox_messages
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id
+			FROM outbox_messages
+			WHERE sent_at IS NULL AND next_attempt_at <= $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, topic, payload, attempts, last_error, next_attempt_at, created_at, sent_at;
+	`
+	messages := []models.OutboxMessage{}
+	if err := r.db.SelectContext(ctx, &messages, query, now.Add(lease), now, limit); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+// MarkMessageSent records that the broker acknowledged the message
+func (r *OutboxRepository) MarkMessageSent(ctx context.Context, id int, sentAt time.Time) error {
+	query := `
+		UPDATE outbox_messages
+		SET sent_at = $1, last_error = ''
+		WHERE id = $2;
+	`
+	if _, err := r.db.ExecContext(ctx, query, sentAt, id); err != nil {
+		log.Printf("Error marking outbox message %d as sent: %v", id, err)
+		return fmt.Errorf("failed to mark outbox message %d as sent: %w", id, err)
+	}
+
+	return nil
+}
+
+// MarkMessageFailed records a failed publish attempt and when the message is due again
+func (r *OutboxRepository) MarkMessageFailed(ctx context.Context, id int, errorMessage string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE outbox_messages
+		SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+		WHERE id = $3;
+	`
+	if _, err := r.db.ExecContext(ctx, query, errorMessage, nextAttemptAt, id); err != nil {
+		log.Printf("Error marking outbox message %d as failed: %v", id, err)
+		return fmt.Errorf("failed to mark outbox message %d as failed: %w", id, err)
+	}
+
+	return nil
+}
+
+// GetLag returns the number of unsent messages and the age of the oldest one
+func (r *OutboxRepository) GetLag(ctx context.Context, now time.Time) (models.OutboxLag, error) {
+	query := `
+		SELECT
+			COUNT(*) AS pending_messages,
+			COALESCE(EXTRACT(EPOCH FROM ($1 - MIN(created_at))), 0) AS oldest_pending_age_seconds
+		FROM outbox_messages
+		WHERE sent_at IS NULL;
+	`
+	var lag models.OutboxLag
+	if err := r.db.GetContext(ctx, &lag, query, now); err != nil {
+		return models.OutboxLag{}, fmt.Errorf("failed to fetch outbox lag: %w", err)
+	}
+
+	return lag, nil
+}
+
+// DeleteSentMessages removes the messages sent before sentBefore and returns how many were removed
+func (r *OutboxRepository) DeleteSentMessages(ctx context.Context, sentBefore time.Time) (int64, error) {
+	query := `DELETE FROM outbox_messages WHERE sent_at < $1;`
+	result, err := r.db.ExecContext(ctx, query, sentBefore)
+	if err != nil {
+		log.Printf("Error deleting sent outbox messages: %v", err)
+		return 0, fmt.Errorf("failed to delete sent outbox messages: %w", err)
+	}
+
+	return result.RowsAffected()
+}
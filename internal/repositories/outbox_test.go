@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("OutboxRepository", func() {
+	var (
+		mockDB  *sqlx.DB
+		sqlMock sqlmock.Sqlmock
+		repo    *OutboxRepository
+		ctx     context.Context
+		now     time.Time
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewOutboxRepository(mockDB)
+
+		ctx = context.Background()
+		now = time.Now()
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("ClaimPendingMessages", func() {
+		ginkgo.It("should lease the due messages and return them oldest first", func() {
+			rows := sqlmock.NewRows([]string{"id", "topic", "payload", "attempts", "last_error", "next_attempt_at", "created_at", "sent_at"}).
+				AddRow(5, "process-transaction", `{"id":5}`, 0, "", now.Add(30*time.Second), now, nil).
+				AddRow(3, "process-transaction", `{"id":3}`, 2, "broker down", now.Add(30*time.Second), now, nil)
+
+			sqlMock.ExpectQuery(`UPDATE outbox_messages\s+SET next_attempt_at = \$1\s+WHERE id IN .* FOR UPDATE SKIP LOCKED`).
+				WithArgs(now.Add(30*time.Second), now, 100).
+				WillReturnRows(rows)
+
+			messages, err := repo.ClaimPendingMessages(ctx, now, 30*time.Second, 100)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(messages).To(gomega.HaveLen(2))
+			gomega.Expect(messages[0].ID).To(gomega.Equal(3))
+			gomega.Expect(messages[0].LastError).To(gomega.Equal("broker down"))
+			gomega.Expect(messages[1].ID).To(gomega.Equal(5))
+		})
+
+		ginkgo.It("should return error when the messages cannot be claimed", func() {
+			dbError := errors.New("database error")
+			sqlMock.ExpectQuery(`UPDATE outbox_messages`).
+				WillReturnError(dbError)
+
+			_, err := repo.ClaimPendingMessages(ctx, now, 30*time.Second, 100)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
+		})
+	})
+
+	ginkgo.Describe("MarkMessageSent", func() {
+		ginkgo.It("should set sent_at", func() {
+			sqlMock.ExpectExec(`UPDATE outbox_messages\s+SET sent_at = \$1`).
+				WithArgs(now, 3).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := repo.MarkMessageSent(ctx, 3, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("MarkMessageFailed", func() {
+		ginkgo.It("should count the attempt and reschedule the message", func() {
+			nextAttemptAt := now.Add(time.Minute)
+			sqlMock.ExpectExec(`UPDATE outbox_messages\s+SET attempts = attempts \+ 1`).
+				WithArgs("broker down", nextAttemptAt, 3).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := repo.MarkMessageFailed(ctx, 3, "broker down", nextAttemptAt)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("GetLag", func() {
+		ginkgo.It("should return the pending count and the age of the oldest message", func() {
+			sqlMock.ExpectQuery(`SELECT\s+COUNT\(\*\) AS pending_messages`).
+				WithArgs(now).
+				WillReturnRows(sqlmock.NewRows([]string{"pending_messages", "oldest_pending_age_seconds"}).AddRow(4, 12.5))
+
+			lag, err := repo.GetLag(ctx, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(lag.PendingMessages).To(gomega.Equal(4))
+			gomega.Expect(lag.OldestPendingAgeSeconds).To(gomega.Equal(12.5))
+		})
+	})
+
+	ginkgo.Describe("DeleteSentMessages", func() {
+		ginkgo.It("should return the number of deleted messages", func() {
+			sqlMock.ExpectExec(`DELETE FROM outbox_messages WHERE sent_at < \$1`).
+				WithArgs(now).
+				WillReturnResult(sqlmock.NewResult(0, 7))
+
+			deleted, err := repo.DeleteSentMessages(ctx, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.Equal(int64(7)))
+		})
+	})
+})
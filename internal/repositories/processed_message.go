@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IProcessedMessageRepository interface {
+	IsMessageProcessed(ctx context.Context, referenceID string, attempt int) (bool, error)
+	MarkMessageProcessed(ctx context.Context, referenceID string, attempt int) error
+	DeleteProcessedMessages(ctx context.Context, referenceID string) (int64, error)
+}
+
+// ProcessedMessageRepository remembers which transaction messages the consumer already handled,
+// so a redelivered message is not processed twice
+type ProcessedMessageRepository struct {
+	db *sqlx.DB
+}
+
+// NewProcessedMessageRepository creates a new instance of ProcessedMessageRepository
+func NewProcessedMessageRepository(db *sqlx.DB) *ProcessedMessageRepository {
+	return &ProcessedMessageRepository{db: db}
+}
+
+// IsMessageProcessed reports whether the given attempt of the transaction was already handled
+func (r *ProcessedMessageRepository) IsMessageProcessed(ctx context.Context, referenceID string, attempt int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM processed_messages WHERE reference_id = $1 AND attempt = $2
+		);
+	`
+	var processed bool
+	if err := r.db.GetContext(ctx, &processed, query, referenceID, attempt); err != nil {
+		return false, fmt.Errorf("failed to check processed message %s/%d: %w", referenceID, attempt, err)
+	}
+
+	return processed, nil
+}
+
+// MarkMessageProcessed records that the given attempt of the transaction was handled. Marking it twice is a no-op.
+func (r *ProcessedMessageRepository) MarkMessageProcessed(ctx context.Context, referenceID string, attempt int) error {
+	query := `
+		INSERT INTO processed_messages (reference_id, attempt)
+		VALUES ($1, $2)
+		ON CONFLICT (reference_id, attempt) DO NOTHING;
+	`
+	if _, err := r.db.ExecContext(ctx, query, referenceID, attempt); err != nil {
+		log.Printf("Error marking message %s/%d as processed: %v", referenceID, attempt, err)
+		return fmt.Errorf("failed to mark message %s/%d as processed: %w", referenceID, attempt, err)
+	}
+
+	return nil
+}
+
+// DeleteProcessedMessages forgets every handled message of the transaction, so a replayed message starting
+// again at the first attempt is not skipped as a duplicate
+func (r *ProcessedMessageRepository) DeleteProcessedMessages(ctx context.Context, referenceID string) (int64, error) {
+	query := `DELETE FROM processed_messages WHERE reference_id = $1;`
+
+	result, err := r.db.ExecContext(ctx, query, referenceID)
+	if err != nil {
+		log.Printf("Error deleting processed messages of %s: %v", referenceID, err)
+		return 0, fmt.Errorf("failed to delete processed messages of %s: %w", referenceID, err)
+	}
+
+	return result.RowsAffected()
+}
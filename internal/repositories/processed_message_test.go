@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("ProcessedMessageRepository", func() {
+	var (
+		mockDB      *sqlx.DB
+		sqlMock     sqlmock.Sqlmock
+		repo        *ProcessedMessageRepository
+		ctx         context.Context
+		referenceID string
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewProcessedMessageRepository(mockDB)
+
+		ctx = context.Background()
+		referenceID = "123e4567-e89b-12d3-a456-426614174000"
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("IsMessageProcessed", func() {
+		ginkgo.It("should report a processed message", func() {
+			sqlMock.ExpectQuery(`SELECT EXISTS .* FROM processed_messages`).
+				WithArgs(referenceID, 2).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+			processed, err := repo.IsMessageProcessed(ctx, referenceID, 2)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(processed).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should return error when the query fails", func() {
+			dbError := errors.New("database error")
+			sqlMock.ExpectQuery(`SELECT EXISTS .* FROM processed_messages`).
+				WillReturnError(dbError)
+
+			_, err := repo.IsMessageProcessed(ctx, referenceID, 0)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
+		})
+	})
+
+	ginkgo.Describe("MarkMessageProcessed", func() {
+		ginkgo.It("should record the message", func() {
+			sqlMock.ExpectExec(`INSERT INTO processed_messages .* ON CONFLICT \(reference_id, attempt\) DO NOTHING`).
+				WithArgs(referenceID, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := repo.MarkMessageProcessed(ctx, referenceID, 1)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should return error when the insert fails", func() {
+			dbError := errors.New("database error")
+			sqlMock.ExpectExec(`INSERT INTO processed_messages`).
+				WillReturnError(dbError)
+
+			err := repo.MarkMessageProcessed(ctx, referenceID, 1)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
+		})
+	})
+
+	ginkgo.Describe("DeleteProcessedMessages", func() {
+		ginkgo.It("should delete the messages of the transaction", func() {
+			sqlMock.ExpectExec(`DELETE FROM processed_messages WHERE reference_id = \$1`).
+				WithArgs(referenceID).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+
+			deleted, err := repo.DeleteProcessedMessages(ctx, referenceID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.Equal(int64(3)))
+		})
+
+		ginkgo.It("should return error when the delete fails", func() {
+			dbError := errors.New("database error")
+			sqlMock.ExpectExec(`DELETE FROM processed_messages`).
+				WillReturnError(dbError)
+
+			_, err := repo.DeleteProcessedMessages(ctx, referenceID)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
+		})
+	})
+})
@@ -3,19 +3,46 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
 
 	"github.com/jmoiron/sqlx"
 )
 
 type ITransactionRepository interface {
-	InsertTransaction(ctx context.Context, transaction *models.Transaction) error
-	UpdateTransactionStatusByReferenceID(ctx context.Context, referenceID string, status string) error
+	InsertTransaction(ctx context.Context, transaction *models.Transaction, topic string) error
+	UpdateTransactionStatusByReferenceID(ctx context.Context, referenceID string, status string, reason string) error
+	ClaimTransactionByReferenceID(ctx context.Context, referenceID string, attempt int) error
 	UpdateGatewayIDByTransactionID(ctx context.Context, transactionID int, gatewayID int) error
+	FailTransactionByReferenceID(ctx context.Context, referenceID string, reason string) error
+	GetTransactionByReferenceID(ctx context.Context, referenceID string) (models.Transaction, error)
+	SearchTransactions(ctx context.Context, filter models.TransactionFilter, afterID int, limit int) ([]models.Transaction, error)
 }
 
+// transactionColumns selects a transaction the way models.Transaction scans it
+const transactionColumns = `
+	id,
+	reference_id,
+	amount,
+	currency,
+	type,
+	status,
+	COALESCE(failure_reason, '') AS failure_reason,
+	created_at,
+	updated_at,
+	COALESCE(gateway_id, 0) AS gateway_id,
+	country_id,
+	user_id
+`
+
 // TransactionRepository handles database operations for the transactions table
 type TransactionRepository struct {
 	db *sqlx.DB
@@ -26,8 +53,16 @@ func NewTransactionRepository(db *sqlx.DB) *TransactionRepository {
 	return &TransactionRepository{db: db}
 }
 
-// InsertTransaction inserts a new transaction into the database
-func (r *TransactionRepository) InsertTransaction(ctx context.Context, transaction *models.Transaction) error {
+// InsertTransaction inserts a new transaction and queues it for publication on topic. The outbox
+// message is written in the same database transaction, so a stored transaction is always published.
+func (r *TransactionRepository) InsertTransaction(ctx context.Context, transaction *models.Transaction, topic string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting insert of transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		INSERT INTO transactions (
 			reference_id, amount, currency, type, status, created_at, updated_at, country_id, user_id
@@ -36,7 +71,7 @@ func (r *TransactionRepository) InsertTransaction(ctx context.Context, transacti
 		) RETURNING id;
 	`
 
-	err := r.db.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		transaction.ReferenceID,
@@ -53,36 +88,41 @@ func (r *TransactionRepository) InsertTransaction(ctx context.Context, transacti
 		log.Printf("Error inserting transaction: %v", err)
 		return err
 	}
-	return nil
-}
 
-// UpdateTransactionStatusByReferenceID updates the status of a transaction by its reference ID
-func (r *TransactionRepository) UpdateTransactionStatusByReferenceID(ctx context.Context, referenceID string, status string) error {
-	query := `
-		UPDATE transactions
-		SET status = $1, updated_at = NOW()
-		WHERE reference_id = $2;
-	`
-	result, err := r.db.ExecContext(ctx, query, status, referenceID)
-	if err != nil {
-		log.Printf("Error updating status for transaction with Reference ID %s: %v", referenceID, err)
+	if err := queueTransaction(ctx, tx, transaction, topic, transaction.CreatedAt); err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return tx.Commit()
+}
+
+// queueTransaction writes the outbox message publishing the transaction on topic as part of tx
+func queueTransaction(ctx context.Context, tx *sqlx.Tx, transaction *models.Transaction, topic string, queuedAt time.Time) error {
+	payload, err := json.Marshal(transaction)
 	if err != nil {
-		log.Printf("Error getting rows affected for transaction with Reference ID %s: %v", referenceID, err)
+		log.Printf("Error marshaling outbox message of transaction %s: %v", transaction.ReferenceID, err)
 		return err
 	}
 
-	if rowsAffected == 0 {
-		log.Printf("No transaction found with Reference ID %s to update", referenceID)
-		return sql.ErrNoRows
+	query := `
+		INSERT INTO outbox_messages (topic, payload, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $3);
+	`
+	if _, err := tx.ExecContext(ctx, query, topic, string(payload), queuedAt); err != nil {
+		log.Printf("Error queuing outbox message of transaction %s: %v", transaction.ReferenceID, err)
+		return err
 	}
 
 	return nil
 }
 
+// UpdateTransactionStatusByReferenceID moves a transaction to the given status and records the
+// transition in transaction_status_history. Transitions the lifecycle does not allow are rejected
+// with a *utils.TransitionError, writing the current status again is a no-op.
+func (r *TransactionRepository) UpdateTransactionStatusByReferenceID(ctx context.Context, referenceID string, status string, reason string) error {
+	return r.transitionStatus(ctx, referenceID, status, reason, nil)
+}
+
 func (r *TransactionRepository) UpdateGatewayIDByTransactionID(ctx context.Context, transactionID int, gatewayID int) error {
 	query := `
 		UPDATE transactions
@@ -108,3 +148,212 @@ func (r *TransactionRepository) UpdateGatewayIDByTransactionID(ctx context.Conte
 
 	return nil
 }
+
+// ErrTransactionClaimed is returned when a transaction is already processing for the same or a later
+// attempt of its message
+var ErrTransactionClaimed = errors.New("transaction is already being processed")
+
+// ClaimTransactionByReferenceID moves a transaction to processing for an attempt of its message. Staying
+// in processing is only allowed for a later attempt, the transaction coming back from a retry topic, so two
+// deliveries of the same message cannot both send the transaction. ErrTransactionClaimed is returned otherwise.
+func (r *TransactionRepository) ClaimTransactionByReferenceID(ctx context.Context, referenceID string, attempt int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting claim for transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		ID                int    `db:"id"`
+		Status            string `db:"status"`
+		ProcessingAttempt int    `db:"processing_attempt"`
+	}
+	selectQuery := `
+		SELECT id, status, COALESCE(processing_attempt, -1) AS processing_attempt
+		FROM transactions
+		WHERE reference_id = $1
+		FOR UPDATE;
+	`
+	if err := tx.GetContext(ctx, &current, selectQuery, referenceID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("No transaction found with Reference ID %s to claim", referenceID)
+			return sql.ErrNoRows
+		}
+		log.Printf("Error locking transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+
+	if current.Status == constants.PROCESSING && current.ProcessingAttempt >= attempt {
+		return ErrTransactionClaimed
+	}
+	if err := utils.ValidateTransition(referenceID, current.Status, constants.PROCESSING); err != nil {
+		log.Printf("Rejected claim for transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+
+	updateQuery := `
+		UPDATE transactions
+		SET status = $1, processing_attempt = $2, updated_at = NOW()
+		WHERE id = $3;
+	`
+	if _, err := tx.ExecContext(ctx, updateQuery, constants.PROCESSING, attempt, current.ID); err != nil {
+		log.Printf("Error claiming transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+
+	if current.Status != constants.PROCESSING {
+		historyQuery := `
+			INSERT INTO transaction_status_history (transaction_id, from_status, to_status, reason)
+			VALUES ($1, $2, $3, $4);
+		`
+		if _, err := tx.ExecContext(ctx, historyQuery, current.ID, current.Status, constants.PROCESSING, "picked up by consumer"); err != nil {
+			log.Printf("Error recording status history for transaction with Reference ID %s: %v", referenceID, err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FailTransactionByReferenceID marks a transaction as failed and stores the reason code
+func (r *TransactionRepository) FailTransactionByReferenceID(ctx context.Context, referenceID string, reason string) error {
+	return r.transitionStatus(ctx, referenceID, constants.FAILED, reason, &reason)
+}
+
+// transitionStatus locks the transaction row so concurrent writers (consumer, callbacks, sweepers)
+// validate the transition against the status they actually replace
+func (r *TransactionRepository) transitionStatus(ctx context.Context, referenceID, status, reason string, failureReason *string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting status update for transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		ID     int    `db:"id"`
+		Status string `db:"status"`
+	}
+	selectQuery := `
+		SELECT id, status
+		FROM transactions
+		WHERE reference_id = $1
+		FOR UPDATE;
+	`
+	if err := tx.GetContext(ctx, &current, selectQuery, referenceID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("No transaction found with Reference ID %s to update", referenceID)
+			return sql.ErrNoRows
+		}
+		log.Printf("Error locking transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+
+	if err := utils.ValidateTransition(referenceID, current.Status, status); err != nil {
+		log.Printf("Rejected status update for transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+	if current.Status == status {
+		return nil
+	}
+
+	updateQuery := `
+		UPDATE transactions
+		SET status = $1, failure_reason = COALESCE($2, failure_reason), updated_at = NOW()
+		WHERE id = $3;
+	`
+	if _, err := tx.ExecContext(ctx, updateQuery, status, failureReason, current.ID); err != nil {
+		log.Printf("Error updating status for transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+
+	historyQuery := `
+		INSERT INTO transaction_status_history (transaction_id, from_status, to_status, reason)
+		VALUES ($1, $2, $3, $4);
+	`
+	if _, err := tx.ExecContext(ctx, historyQuery, current.ID, current.Status, status, reason); err != nil {
+		log.Printf("Error recording status history for transaction with Reference ID %s: %v", referenceID, err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTransactionByReferenceID returns the transaction, sql.ErrNoRows when it does not exist
+func (r *TransactionRepository) GetTransactionByReferenceID(ctx context.Context, referenceID string) (models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE reference_id = $1;`
+
+	var transaction models.Transaction
+	if err := r.db.GetContext(ctx, &transaction, query, referenceID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Transaction{}, sql.ErrNoRows
+		}
+		log.Printf("Error fetching transaction with Reference ID %s: %v", referenceID, err)
+		return models.Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+// SearchTransactions returns up to limit transactions matching the filter, newest first.
+// Only transactions with an ID below afterID are returned when afterID is set.
+func (r *TransactionRepository) SearchTransactions(ctx context.Context, filter models.TransactionFilter, afterID int, limit int) ([]models.Transaction, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != 0 {
+		where("user_id = $%d", filter.UserID)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.Type != "" {
+		where("type = $%d", filter.Type)
+	}
+	if filter.GatewayID != 0 {
+		where("gateway_id = $%d", filter.GatewayID)
+	}
+	if filter.CountryID != 0 {
+		where("country_id = $%d", filter.CountryID)
+	}
+	if filter.Currency != "" {
+		where("currency = $%d", filter.Currency)
+	}
+	if filter.MinAmount != nil {
+		where("amount >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where("amount <= $%d", *filter.MaxAmount)
+	}
+	if filter.CreatedFrom != nil {
+		where("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		where("created_at < $%d", *filter.CreatedTo)
+	}
+	if afterID != 0 {
+		where("id < $%d", afterID)
+	}
+
+	query := `SELECT ` + transactionColumns + ` FROM transactions`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d;`, len(args))
+
+	transactions := []models.Transaction{}
+	if err := r.db.SelectContext(ctx, &transactions, query, args...); err != nil {
+		log.Printf("Error searching transactions: %v", err)
+		return nil, fmt.Errorf("failed to search transactions: %w", err)
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ITransactionAttemptRepository interface {
+	InsertAttempt(ctx context.Context, attempt *models.TransactionAttempt) error
+	GetAttemptsByReferenceID(ctx context.Context, referenceID string) ([]models.TransactionAttempt, error)
+	GetGatewayTrafficStats(ctx context.Context, since time.Time) ([]models.GatewayTrafficStats, error)
+}
+
+// TransactionAttemptRepository handles database operations for the transaction_attempts table
+type TransactionAttemptRepository struct {
+	db *sqlx.DB
+}
+
+// NewTransactionAttemptRepository creates a new instance of TransactionAttemptRepository
+func NewTransactionAttemptRepository(db *sqlx.DB) *TransactionAttemptRepository {
+	return &TransactionAttemptRepository{db: db}
+}
+
+// InsertAttempt stores an attempt and numbers it after the previous attempts of the same transaction.
+// The ID and attempt number are set on the given attempt.
+func (r *TransactionAttemptRepository) InsertAttempt(ctx context.Context, attempt *models.TransactionAttempt) error {
+	query := `
+		INSERT INTO transaction_attempts (
+			transaction_id, gateway_id, attempt_number, request, response, http_status,
+			latency_ms, status, error_class, error_message, timed_out, started_at, completed_at
+		)
+		SELECT $1, $2, COALESCE(MAX(attempt_number), 0) + 1, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		FROM transaction_attempts
+		WHERE transaction_id = $1
+		RETURNING id, attempt_number;
+	`
+	err := r.db.QueryRowxContext(ctx, query,
+		attempt.TransactionID,
+		attempt.GatewayID,
+		attempt.Request,
+		attempt.Response,
+		attempt.HTTPStatus,
+		attempt.LatencyMs,
+		attempt.Status,
+		attempt.ErrorClass,
+		attempt.ErrorMessage,
+		attempt.TimedOut,
+		attempt.StartedAt,
+		attempt.CompletedAt,
+	).Scan(&attempt.ID, &attempt.AttemptNumber)
+	if err != nil {
+		log.Printf("Error inserting attempt for transaction ID %d: %v", attempt.TransactionID, err)
+		return fmt.Errorf("failed to insert attempt for transaction ID %d: %w", attempt.TransactionID, err)
+	}
+
+	return nil
+}
+
+// GetAttemptsByReferenceID returns the attempts of a transaction in the order they were made
+func (r *TransactionAttemptRepository) GetAttemptsByReferenceID(ctx context.Context, referenceID string) ([]models.TransactionAttempt, error) {
+	query := `
+		SELECT
+			ta.id,
+			ta.transaction_id,
+			ta.gateway_id,
+			g.name AS gateway_name,
+			ta.attempt_number,
+			ta.request,
+			ta.response,
+			ta.http_status,
+			ta.latency_ms,
+			ta.status,
+			ta.error_class,
+			ta.error_message,
+			ta.timed_out,
+			ta.started_at,
+			ta.completed_at,
+			ta.created_at
+		FROM
+			transaction_attempts ta
+		JOIN
+			transactions t ON ta.transaction_id = t.id
+		JOIN
+			gateways g ON ta.gateway_id = g.id
+		WHERE
+			t.reference_id = $1
+		ORDER BY
+			ta.attempt_number;
+	`
+	attempts := []models.TransactionAttempt{}
+	if err := r.db.SelectContext(ctx, &attempts, query, referenceID); err != nil {
+		return nil, fmt.Errorf("failed to fetch attempts for reference ID %s: %w", referenceID, err)
+	}
+
+	return attempts, nil
+}
+
+// GetGatewayTrafficStats sums up the attempts started since the given time per gateway. Gateways
+// without attempts in that time are left out.
+func (r *TransactionAttemptRepository) GetGatewayTrafficStats(ctx context.Context, since time.Time) ([]models.GatewayTrafficStats, error) {
+	query := `
+		SELECT
+			gateway_id,
+			COUNT(*) AS requests,
+			COUNT(*) FILTER (WHERE status IN ($1, $2)) AS successes,
+			COUNT(*) FILTER (WHERE timed_out) AS timeouts,
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY latency_ms) AS p95_latency_ms
+		FROM
+			transaction_attempts
+		WHERE
+			started_at >= $3
+		GROUP BY
+			gateway_id
+		ORDER BY
+			gateway_id;
+	`
+	stats := []models.GatewayTrafficStats{}
+	if err := r.db.SelectContext(ctx, &stats, query, constants.ACCEPTED, constants.DECLINED, since); err != nil {
+		return nil, fmt.Errorf("failed to fetch gateway traffic stats: %w", err)
+	}
+
+	return stats, nil
+}
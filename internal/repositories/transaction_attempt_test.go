@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("TransactionAttemptRepository", func() {
+	var (
+		mockDB  *sqlx.DB
+		sqlMock sqlmock.Sqlmock
+		repo    *TransactionAttemptRepository
+		ctx     context.Context
+		now     time.Time
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewTransactionAttemptRepository(mockDB)
+
+		ctx = context.Background()
+		now = time.Now()
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("InsertAttempt", func() {
+		ginkgo.It("should insert the attempt and set its ID and attempt number", func() {
+			attempt := &models.TransactionAttempt{
+				TransactionID: 10,
+				GatewayID:     1,
+				Request:       `{"encrypted_data":"abc"}`,
+				Response:      `{"status":"accepted"}`,
+				HTTPStatus:    200,
+				LatencyMs:     120,
+				Status:        constants.ACCEPTED,
+				StartedAt:     now,
+				CompletedAt:   now,
+			}
+
+			sqlMock.ExpectQuery(`INSERT INTO transaction_attempts`).
+				WithArgs(10, 1, attempt.Request, attempt.Response, 200, int64(120), constants.ACCEPTED, "", "", false, now, now).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "attempt_number"}).AddRow(7, 3))
+
+			err := repo.InsertAttempt(ctx, attempt)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(attempt.ID).To(gomega.Equal(7))
+			gomega.Expect(attempt.AttemptNumber).To(gomega.Equal(3))
+		})
+
+		ginkgo.It("should return error when the insert fails", func() {
+			dbError := errors.New("database error")
+			sqlMock.ExpectQuery(`INSERT INTO transaction_attempts`).
+				WillReturnError(dbError)
+
+			err := repo.InsertAttempt(ctx, &models.TransactionAttempt{TransactionID: 10})
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
+		})
+	})
+
+	ginkgo.Describe("GetAttemptsByReferenceID", func() {
+		ginkgo.It("should return the attempts in order", func() {
+			referenceID := "123e4567-e89b-12d3-a456-426614174000"
+			rows := sqlmock.NewRows([]string{
+				"id", "transaction_id", "gateway_id", "gateway_name", "attempt_number", "request", "response",
+				"http_status", "latency_ms", "status", "error_class", "error_message", "timed_out", "started_at", "completed_at", "created_at",
+			}).
+				AddRow(1, 10, 1, "A", 1, "req", "", 0, 30000, constants.ERROR, "unknown", "timeout", true, now, now, now).
+				AddRow(2, 10, 2, "B", 2, "req", "<ok/>", 200, 80, constants.ACCEPTED, "", "", false, now, now, now)
+
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+transaction_attempts ta`).
+				WithArgs(referenceID).
+				WillReturnRows(rows)
+
+			attempts, err := repo.GetAttemptsByReferenceID(ctx, referenceID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(attempts).To(gomega.HaveLen(2))
+			gomega.Expect(attempts[0].ErrorClass).To(gomega.Equal("unknown"))
+			gomega.Expect(attempts[0].TimedOut).To(gomega.BeTrue())
+			gomega.Expect(attempts[1].GatewayName).To(gomega.Equal("B"))
+		})
+
+		ginkgo.It("should return an empty list when the transaction has no attempts", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+transaction_attempts ta`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			attempts, err := repo.GetAttemptsByReferenceID(ctx, "unknown")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(attempts).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Describe("GetGatewayTrafficStats", func() {
+		ginkgo.It("should sum up the attempts per gateway since the given time", func() {
+			since := now.Add(-5 * time.Minute)
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+transaction_attempts\s+WHERE\s+started_at >= \$3\s+GROUP BY\s+gateway_id`).
+				WithArgs(constants.ACCEPTED, constants.DECLINED, since).
+				WillReturnRows(sqlmock.NewRows([]string{"gateway_id", "requests", "successes", "timeouts", "p95_latency_ms"}).
+					AddRow(1, 40, 38, 1, 812.5).
+					AddRow(2, 3, 1, 2, 30000.0))
+
+			stats, err := repo.GetGatewayTrafficStats(ctx, since)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(stats).To(gomega.Equal([]models.GatewayTrafficStats{
+				{GatewayID: 1, Requests: 40, Successes: 38, Timeouts: 1, P95LatencyMs: 812.5},
+				{GatewayID: 2, Requests: 3, Successes: 1, Timeouts: 2, P95LatencyMs: 30000},
+			}))
+		})
+
+		ginkgo.It("should return error when the query fails", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM\s+transaction_attempts`).
+				WillReturnError(errors.New("database error"))
+
+			_, err := repo.GetGatewayTrafficStats(ctx, now)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("failed to fetch gateway traffic stats"))
+		})
+	})
+})
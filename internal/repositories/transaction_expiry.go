@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrStatusChanged is returned when a transaction left the status it was selected in before it was expired
+var ErrStatusChanged = errors.New("transaction changed status")
+
+type ITransactionExpiryRepository interface {
+	GetStaleTransactions(ctx context.Context, now time.Time, fallback models.ExpiryPolicy, afterID int, limit int) ([]models.StaleTransaction, error)
+	ExpireTransaction(ctx context.Context, transaction models.StaleTransaction, reason string) error
+}
+
+// TransactionExpiryRepository finds and ends transactions that stayed in a status for too long
+type TransactionExpiryRepository struct {
+	db *sqlx.DB
+}
+
+// NewTransactionExpiryRepository creates a new instance of TransactionExpiryRepository
+func NewTransactionExpiryRepository(db *sqlx.DB) *TransactionExpiryRepository {
+	return &TransactionExpiryRepository{db: db}
+}
+
+// GetStaleTransactions returns up to limit pending, processing, submitted or in-doubt transactions with an ID above
+// afterID whose last status change is older than their expiry policy allows, ordered by ID. A policy of
+// the transaction's gateway wins over one for every gateway, the fallback applies when neither exists.
+func (r *TransactionExpiryRepository) GetStaleTransactions(ctx context.Context, now time.Time, fallback models.ExpiryPolicy, afterID int, limit int) ([]models.StaleTransaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `, ttl_seconds, expire_to
+		FROM (
+			SELECT t.*,
+				COALESCE(p.ttl_seconds, $1) AS ttl_seconds,
+				COALESCE(p.expire_to, $2) AS expire_to
+			FROM transactions t
+			LEFT JOIN LATERAL (
+				SELECT ttl_seconds, expire_to
+				FROM transaction_expiry_policies
+				WHERE transaction_type = t.type
+					AND status = t.status
+					AND (gateway_id = t.gateway_id OR gateway_id IS NULL)
+				ORDER BY gateway_id NULLS LAST
+				LIMIT 1
+			) p ON TRUE
+			WHERE t.status IN ($3, $4, $5, $6) AND t.id > $7
+		) candidates
+		WHERE updated_at + make_interval(secs => ttl_seconds) <= $8
+		ORDER BY id
+		LIMIT $9;
+	`
+
+	transactions := []models.StaleTransaction{}
+	err := r.db.SelectContext(
+		ctx,
+		&transactions,
+		query,
+		int(fallback.TTL.Seconds()),
+		fallback.ExpireTo,
+		constants.PENDING,
+		constants.PROCESSING,
+		constants.SUBMITTED,
+		constants.IN_DOUBT,
+		afterID,
+		now,
+		limit,
+	)
+	if err != nil {
+		log.Printf("Error fetching stale transactions: %v", err)
+		return nil, fmt.Errorf("failed to fetch stale transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// ExpireTransaction moves a stale transaction to the status of its policy and records the transition in
+// transaction_status_history. ErrStatusChanged is returned when the transaction is no longer in the status
+// it was selected in, e.g. because a callback arrived in the meantime.
+func (r *TransactionExpiryRepository) ExpireTransaction(ctx context.Context, transaction models.StaleTransaction, reason string) error {
+	var failureReason *string
+	if transaction.ExpireTo == constants.FAILED {
+		failureReason = new(string)
+		*failureReason = constants.REASON_EXPIRED
+	}
+
+	query := `
+		WITH expired AS (
+			UPDATE transactions
+			SET status = $1, failure_reason = COALESCE($2, failure_reason), updated_at = NOW()
+			WHERE id = $3 AND status = $4
+			RETURNING id
+		)
+		INSERT INTO transaction_status_history (transaction_id, from_status, to_status, reason)
+		SELECT id, $4, $1, $5 FROM expired;
+	`
+	result, err := r.db.ExecContext(ctx, query, transaction.ExpireTo, failureReason, transaction.ID, transaction.Status, reason)
+	if err != nil {
+		log.Printf("Error expiring transaction with Reference ID %s: %v", transaction.ReferenceID, err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Printf("Error getting rows affected for transaction with Reference ID %s: %v", transaction.ReferenceID, err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrStatusChanged
+	}
+
+	return nil
+}
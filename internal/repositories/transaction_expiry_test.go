@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("TransactionExpiryRepository", func() {
+	var (
+		mockDB   *sqlx.DB
+		sqlMock  sqlmock.Sqlmock
+		repo     *TransactionExpiryRepository
+		ctx      context.Context
+		now      time.Time
+		fallback models.ExpiryPolicy
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewTransactionExpiryRepository(mockDB)
+
+		ctx = context.Background()
+		now = time.Now()
+		fallback = models.ExpiryPolicy{TTL: 72 * time.Hour, ExpireTo: constants.EXPIRED}
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("GetStaleTransactions", func() {
+		ginkgo.It("should return the stale transactions with their policy", func() {
+			rows := sqlmock.NewRows([]string{
+				"id", "reference_id", "amount", "currency", "type", "status", "failure_reason",
+				"created_at", "updated_at", "gateway_id", "country_id", "user_id", "ttl_seconds", "expire_to",
+			}).
+				AddRow(3, uuid.New(), 100.0, "USD", constants.DEPOSIT, constants.SUBMITTED, "", now, now, 1, 1, 1, 86400, constants.EXPIRED).
+				AddRow(8, uuid.New(), 50.0, "USD", constants.WITHDRAWAL, constants.PENDING, "", now, now, 0, 1, 1, 3600, constants.FAILED)
+
+			sqlMock.ExpectQuery(`LEFT JOIN LATERAL .* FROM transaction_expiry_policies .* ORDER BY gateway_id NULLS LAST`).
+				WithArgs(259200, constants.EXPIRED, constants.PENDING, constants.PROCESSING, constants.SUBMITTED, constants.IN_DOUBT, 0, now, 100).
+				WillReturnRows(rows)
+
+			transactions, err := repo.GetStaleTransactions(ctx, now, fallback, 0, 100)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(transactions).To(gomega.HaveLen(2))
+			gomega.Expect(transactions[0].ID).To(gomega.Equal(3))
+			gomega.Expect(transactions[0].TTLSeconds).To(gomega.Equal(86400))
+			gomega.Expect(transactions[1].ExpireTo).To(gomega.Equal(constants.FAILED))
+		})
+
+		ginkgo.It("should return error when the stale transactions cannot be fetched", func() {
+			sqlMock.ExpectQuery(`FROM transaction_expiry_policies`).
+				WillReturnError(errors.New("database error"))
+
+			_, err := repo.GetStaleTransactions(ctx, now, fallback, 0, 100)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("ExpireTransaction", func() {
+		var stale models.StaleTransaction
+
+		ginkgo.BeforeEach(func() {
+			stale = models.StaleTransaction{
+				Transaction: models.Transaction{ID: 3, ReferenceID: uuid.New(), Status: constants.SUBMITTED},
+				TTLSeconds:  86400,
+				ExpireTo:    constants.EXPIRED,
+			}
+		})
+
+		ginkgo.It("should expire the transaction and record the transition", func() {
+			sqlMock.ExpectExec(`WITH expired AS .* INSERT INTO transaction_status_history`).
+				WithArgs(constants.EXPIRED, nil, 3, constants.SUBMITTED, "submitted for longer than 24h0m0s").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := repo.ExpireTransaction(ctx, stale, "submitted for longer than 24h0m0s")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should store the reason code when the policy fails the transaction", func() {
+			stale.ExpireTo = constants.FAILED
+			sqlMock.ExpectExec(`WITH expired AS`).
+				WithArgs(constants.FAILED, constants.REASON_EXPIRED, 3, constants.SUBMITTED, "submitted for longer than 24h0m0s").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := repo.ExpireTransaction(ctx, stale, "submitted for longer than 24h0m0s")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should return ErrStatusChanged when the transaction moved on", func() {
+			sqlMock.ExpectExec(`WITH expired AS`).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := repo.ExpireTransaction(ctx, stale, "submitted for longer than 24h0m0s")
+			gomega.Expect(err).To(gomega.Equal(ErrStatusChanged))
+		})
+	})
+})
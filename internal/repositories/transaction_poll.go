@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type ITransactionPollRepository interface {
+	ClaimDuePolls(ctx context.Context, now time.Time, policy models.PollPolicy, gatewayNames []string, limit int) ([]models.Transaction, error)
+}
+
+// TransactionPollRepository schedules status polls of submitted and in-doubt transactions
+type TransactionPollRepository struct {
+	db *sqlx.DB
+}
+
+// NewTransactionPollRepository creates a new instance of TransactionPollRepository
+func NewTransactionPollRepository(db *sqlx.DB) *TransactionPollRepository {
+	return &TransactionPollRepository{db: db}
+}
+
+// ClaimDuePolls returns up to limit submitted or in-doubt transactions of the named gateways that got no
+// callback within the delay of the policy and are due for a poll, oldest first. Claiming counts the poll and
+// moves next_poll_at past the next interval, so pollers on other replicas skip the transactions and every
+// poll waits longer.
+func (r *TransactionPollRepository) ClaimDuePolls(ctx context.Context, now time.Time, policy models.PollPolicy, gatewayNames []string, limit int) ([]models.Transaction, error) {
+	query := `
+		UPDATE transactions
+		SET poll_count = poll_count + 1,
+			next_poll_at = $1::timestamp + make_interval(secs => LEAST($2 * POWER(2, poll_count), $3))
+		WHERE id IN (
+			SELECT id
+			FROM transactions
+			WHERE status IN ($4, $5)
+				AND gateway_id IN (SELECT id FROM gateways WHERE name = ANY($7))
+				AND updated_at <= $6
+				AND (next_poll_at IS NULL OR next_poll_at <= $1)
+			ORDER BY id
+			LIMIT $8
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + transactionColumns + `;`
+
+	transactions := []models.Transaction{}
+	err := r.db.SelectContext(
+		ctx,
+		&transactions,
+		query,
+		now,
+		policy.MinInterval.Seconds(),
+		policy.MaxInterval.Seconds(),
+		constants.SUBMITTED,
+		constants.IN_DOUBT,
+		now.Add(-policy.Delay),
+		pq.Array(gatewayNames),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim transactions to poll: %w", err)
+	}
+
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].ID < transactions[j].ID })
+	return transactions, nil
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("TransactionPollRepository", func() {
+	var (
+		mockDB  *sqlx.DB
+		sqlMock sqlmock.Sqlmock
+		repo    *TransactionPollRepository
+		ctx     context.Context
+		now     time.Time
+		policy  models.PollPolicy
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewTransactionPollRepository(mockDB)
+
+		ctx = context.Background()
+		now = time.Now()
+		policy = models.PollPolicy{
+			Delay:       5 * time.Minute,
+			MinInterval: time.Minute,
+			MaxInterval: time.Hour,
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("ClaimDuePolls", func() {
+		ginkgo.It("should count the poll of the due transactions and return them oldest first", func() {
+			rows := sqlmock.NewRows([]string{
+				"id", "reference_id", "amount", "currency", "type", "status", "failure_reason",
+				"created_at", "updated_at", "gateway_id", "country_id", "user_id",
+			}).
+				AddRow(9, uuid.New(), 100.0, "USD", constants.DEPOSIT, constants.SUBMITTED, "", now, now, 1, 1, 1).
+				AddRow(2, uuid.New(), 50.0, "USD", constants.WITHDRAWAL, constants.SUBMITTED, "", now, now, 3, 2, 1)
+
+			sqlMock.ExpectQuery(`UPDATE transactions\s+SET poll_count = poll_count \+ 1,.*gateway_id IN \(SELECT id FROM gateways WHERE name = ANY\(\$7\)\).* FOR UPDATE SKIP LOCKED`).
+				WithArgs(now, 60.0, 3600.0, constants.SUBMITTED, constants.IN_DOUBT, now.Add(-5*time.Minute), pq.Array([]string{"A", "C"}), 100).
+				WillReturnRows(rows)
+
+			transactions, err := repo.ClaimDuePolls(ctx, now, policy, []string{"A", "C"}, 100)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(transactions).To(gomega.HaveLen(2))
+			gomega.Expect(transactions[0].ID).To(gomega.Equal(2))
+			gomega.Expect(transactions[1].ID).To(gomega.Equal(9))
+		})
+
+		ginkgo.It("should return error when the transactions cannot be claimed", func() {
+			sqlMock.ExpectQuery(`UPDATE transactions`).
+				WillReturnError(errors.New("database error"))
+
+			_, err := repo.ClaimDuePolls(ctx, now, policy, []string{"A", "C"}, 100)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ITransactionRetryRepository interface {
+	ClaimDueRetries(ctx context.Context, now time.Time, policy models.RetryPolicy, limit int) ([]models.Transaction, error)
+	RequeueTransaction(ctx context.Context, transaction *models.Transaction, topic string, now time.Time) error
+	FailExhaustedRetries(ctx context.Context, now time.Time, policy models.RetryPolicy, limit int) (int64, error)
+}
+
+// TransactionRetryRepository handles the retry bookkeeping of transactions parked in retry
+type TransactionRetryRepository struct {
+	db *sqlx.DB
+}
+
+// NewTransactionRetryRepository creates a new instance of TransactionRetryRepository
+func NewTransactionRetryRepository(db *sqlx.DB) *TransactionRetryRepository {
+	return &TransactionRetryRepository{db: db}
+}
+
+// ClaimDueRetries returns up to limit transactions in retry whose backoff has passed, oldest first.
+// Claiming counts the retry and moves next_retry_at past the next backoff, so schedulers on other
+// replicas skip the transactions and a transaction that fails again waits longer.
+func (r *TransactionRetryRepository) ClaimDueRetries(ctx context.Context, now time.Time, policy models.RetryPolicy, limit int) ([]models.Transaction, error) {
+	query := `
+		UPDATE transactions
+		SET retry_count = retry_count + 1,
+			next_retry_at = $1::timestamp + make_interval(secs => LEAST($2 * POWER(2, retry_count + 1), $3))
+		WHERE id IN (
+			SELECT id
+			FROM transactions
+			WHERE status = $4
+				AND retry_count < $5
+				AND created_at > $6
+				AND COALESCE(next_retry_at, updated_at + make_interval(secs => $2)) <= $1
+			ORDER BY id
+			LIMIT $7
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + transactionColumns + `;`
+
+	transactions := []models.Transaction{}
+	err := r.db.SelectContext(
+		ctx,
+		&transactions,
+		query,
+		now,
+		policy.MinBackoff.Seconds(),
+		policy.MaxBackoff.Seconds(),
+		constants.RETRY,
+		policy.MaxRetries,
+		now.Add(-policy.MaxAge),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim transactions to retry: %w", err)
+	}
+
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].ID < transactions[j].ID })
+	return transactions, nil
+}
+
+// RequeueTransaction queues the transaction for publication on topic again. Its processed messages are
+// forgotten in the same database transaction, the consumer would skip the new message as a duplicate otherwise.
+func (r *TransactionRetryRepository) RequeueTransaction(ctx context.Context, transaction *models.Transaction, topic string, now time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting requeue of transaction %s: %v", transaction.ReferenceID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM processed_messages WHERE reference_id = $1;`, transaction.ReferenceID); err != nil {
+		log.Printf("Error deleting processed messages of transaction %s: %v", transaction.ReferenceID, err)
+		return err
+	}
+
+	if err := queueTransaction(ctx, tx, transaction, topic, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FailExhaustedRetries fails up to limit transactions in retry that used up their retries or grew
+// older than the policy allows, and records the transition in transaction_status_history
+func (r *TransactionRetryRepository) FailExhaustedRetries(ctx context.Context, now time.Time, policy models.RetryPolicy, limit int) (int64, error) {
+	query := `
+		WITH exhausted AS (
+			SELECT id
+			FROM transactions
+			WHERE status = $1 AND (retry_count >= $2 OR created_at <= $3)
+			ORDER BY id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		), failed AS (
+			UPDATE transactions
+			SET status = $5, failure_reason = $6, updated_at = NOW()
+			WHERE id IN (SELECT id FROM exhausted)
+			RETURNING id
+		)
+		INSERT INTO transaction_status_history (transaction_id, from_status, to_status, reason)
+		SELECT id, $1, $5, $7 FROM failed;
+	`
+	result, err := r.db.ExecContext(
+		ctx,
+		query,
+		constants.RETRY,
+		policy.MaxRetries,
+		now.Add(-policy.MaxAge),
+		limit,
+		constants.FAILED,
+		constants.REASON_RETRIES_EXHAUSTED,
+		"retry scheduler gave up",
+	)
+	if err != nil {
+		log.Printf("Error failing exhausted retries: %v", err)
+		return 0, fmt.Errorf("failed to fail exhausted retries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("TransactionRetryRepository", func() {
+	var (
+		mockDB  *sqlx.DB
+		sqlMock sqlmock.Sqlmock
+		repo    *TransactionRetryRepository
+		ctx     context.Context
+		now     time.Time
+		policy  models.RetryPolicy
+	)
+
+	ginkgo.BeforeEach(func() {
+		sqlDB, mock, err := sqlmock.New()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockDB = sqlx.NewDb(sqlDB, "sqlmock")
+		sqlMock = mock
+		repo = NewTransactionRetryRepository(mockDB)
+
+		ctx = context.Background()
+		now = time.Now()
+		policy = models.RetryPolicy{
+			MaxRetries: 5,
+			MaxAge:     24 * time.Hour,
+			MinBackoff: time.Minute,
+			MaxBackoff: time.Hour,
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		err := sqlMock.ExpectationsWereMet()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("ClaimDueRetries", func() {
+		ginkgo.It("should count the retry of the due transactions and return them oldest first", func() {
+			rows := sqlmock.NewRows([]string{
+				"id", "reference_id", "amount", "currency", "type", "status", "failure_reason",
+				"created_at", "updated_at", "gateway_id", "country_id", "user_id",
+			}).
+				AddRow(7, uuid.New(), 100.0, "USD", constants.DEPOSIT, constants.RETRY, "", now, now, 1, 1, 1).
+				AddRow(4, uuid.New(), 50.0, "EUR", constants.WITHDRAWAL, constants.RETRY, "", now, now, 2, 1, 1)
+
+			sqlMock.ExpectQuery(`UPDATE transactions\s+SET retry_count = retry_count \+ 1,.* FOR UPDATE SKIP LOCKED`).
+				WithArgs(now, 60.0, 3600.0, constants.RETRY, 5, now.Add(-24*time.Hour), 100).
+				WillReturnRows(rows)
+
+			transactions, err := repo.ClaimDueRetries(ctx, now, policy, 100)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(transactions).To(gomega.HaveLen(2))
+			gomega.Expect(transactions[0].ID).To(gomega.Equal(4))
+			gomega.Expect(transactions[1].ID).To(gomega.Equal(7))
+		})
+
+		ginkgo.It("should return error when the transactions cannot be claimed", func() {
+			sqlMock.ExpectQuery(`UPDATE transactions`).
+				WillReturnError(errors.New("database error"))
+
+			_, err := repo.ClaimDueRetries(ctx, now, policy, 100)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("RequeueTransaction", func() {
+		var transaction *models.Transaction
+
+		ginkgo.BeforeEach(func() {
+			transaction = &models.Transaction{ID: 4, ReferenceID: uuid.New(), Status: constants.RETRY}
+		})
+
+		ginkgo.It("should forget the processed messages and queue the transaction in one database transaction", func() {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(`DELETE FROM processed_messages WHERE reference_id = \$1`).
+				WithArgs(transaction.ReferenceID).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			sqlMock.ExpectExec(`INSERT INTO outbox_messages`).
+				WithArgs("process-transaction", sqlmock.AnyArg(), now).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectCommit()
+
+			err := repo.RequeueTransaction(ctx, transaction, "process-transaction", now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should roll back when the transaction cannot be queued", func() {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(`DELETE FROM processed_messages`).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			sqlMock.ExpectExec(`INSERT INTO outbox_messages`).
+				WillReturnError(errors.New("database error"))
+			sqlMock.ExpectRollback()
+
+			err := repo.RequeueTransaction(ctx, transaction, "process-transaction", now)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("FailExhaustedRetries", func() {
+		ginkgo.It("should fail the exhausted transactions and record the transition", func() {
+			sqlMock.ExpectExec(`WITH exhausted AS .* INSERT INTO transaction_status_history`).
+				WithArgs(constants.RETRY, 5, now.Add(-24*time.Hour), 100, constants.FAILED, constants.REASON_RETRIES_EXHAUSTED, "retry scheduler gave up").
+				WillReturnResult(sqlmock.NewResult(0, 3))
+
+			failed, err := repo.FailExhaustedRetries(ctx, now, policy, 100)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(failed).To(gomega.Equal(int64(3)))
+		})
+
+		ginkgo.It("should return error when the transactions cannot be failed", func() {
+			sqlMock.ExpectExec(`WITH exhausted AS`).
+				WillReturnError(errors.New("database error"))
+
+			_, err := repo.FailExhaustedRetries(ctx, now, policy, 100)
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+})
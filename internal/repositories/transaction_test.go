@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
@@ -51,7 +54,8 @@ var _ = ginkgo.Describe("TransactionRepository", func() {
 	})
 
 	ginkgo.Describe("InsertTransaction", func() {
-		ginkgo.It("should successfully insert a transaction", func() {
+		ginkgo.It("should insert the transaction and queue it in the outbox in one transaction", func() {
+			sqlMock.ExpectBegin()
 			sqlMock.ExpectQuery(`INSERT INTO transactions`).
 				WithArgs(
 					transaction.ReferenceID, transaction.Amount, transaction.Currency,
@@ -59,14 +63,19 @@ var _ = ginkgo.Describe("TransactionRepository", func() {
 					transaction.UpdatedAt, transaction.CountryID, transaction.UserID,
 				).
 				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			sqlMock.ExpectExec(`INSERT INTO outbox_messages`).
+				WithArgs("process-transaction", sqlmock.AnyArg(), transaction.CreatedAt).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectCommit()
 
-			err := repo.InsertTransaction(ctx, transaction)
+			err := repo.InsertTransaction(ctx, transaction, "process-transaction")
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(transaction.ID).Should(gomega.Equal(1))
 		})
 
 		ginkgo.It("should return error when insertion fails", func() {
 			dbError := errors.New("database error")
+			sqlMock.ExpectBegin()
 			sqlMock.ExpectQuery(`INSERT INTO transactions`).
 				WithArgs(
 					transaction.ReferenceID, transaction.Amount, transaction.Currency,
@@ -74,45 +83,157 @@ var _ = ginkgo.Describe("TransactionRepository", func() {
 					transaction.UpdatedAt, transaction.CountryID, transaction.UserID,
 				).
 				WillReturnError(dbError)
+			sqlMock.ExpectRollback()
 
-			err := repo.InsertTransaction(ctx, transaction)
+			err := repo.InsertTransaction(ctx, transaction, "process-transaction")
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
 		})
+
+		ginkgo.It("should not keep the transaction when the outbox message cannot be queued", func() {
+			dbError := errors.New("database error")
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`INSERT INTO transactions`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			sqlMock.ExpectExec(`INSERT INTO outbox_messages`).
+				WillReturnError(dbError)
+			sqlMock.ExpectRollback()
+
+			err := repo.InsertTransaction(ctx, transaction, "process-transaction")
+			gomega.Expect(err).Should(gomega.Equal(dbError))
+		})
 	})
 
 	ginkgo.Describe("UpdateTransactionStatusByReferenceID", func() {
-		ginkgo.It("should successfully update transaction status", func() {
+		expectLock := func(status string) {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT id, status\s+FROM transactions .* FOR UPDATE`).
+				WithArgs("ref123").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, status))
+		}
+
+		ginkgo.It("should update the status and record the transition", func() {
+			expectLock(constants.SUBMITTED)
 			sqlMock.ExpectExec(`UPDATE transactions`).
-				WithArgs("completed", "ref123").
+				WithArgs(constants.COMPLETED, nil, 1).
 				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectExec(`INSERT INTO transaction_status_history`).
+				WithArgs(1, constants.SUBMITTED, constants.COMPLETED, "gateway callback").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectCommit()
 
-			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", "completed")
+			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", constants.COMPLETED, "gateway callback")
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 		})
 
-		ginkgo.It("should return error when no rows are affected", func() {
-			sqlMock.ExpectExec(`UPDATE transactions`).
-				WithArgs("completed", "ref123").
-				WillReturnResult(sqlmock.NewResult(1, 0))
+		ginkgo.It("should reject a transition the lifecycle does not allow", func() {
+			expectLock(constants.COMPLETED)
+			sqlMock.ExpectRollback()
 
-			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", "completed")
-			gomega.Expect(err).Should(gomega.HaveOccurred())
+			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", constants.PENDING, "gateway callback")
+
+			var transitionErr *utils.TransitionError
+			gomega.Expect(errors.As(err, &transitionErr)).To(gomega.BeTrue())
+			gomega.Expect(transitionErr.From).To(gomega.Equal(constants.COMPLETED))
+			gomega.Expect(transitionErr.To).To(gomega.Equal(constants.PENDING))
+		})
+
+		ginkgo.It("should reject an unknown status", func() {
+			expectLock(constants.SUBMITTED)
+			sqlMock.ExpectRollback()
+
+			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", "success", "gateway callback")
+
+			var transitionErr *utils.TransitionError
+			gomega.Expect(errors.As(err, &transitionErr)).To(gomega.BeTrue())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("unknown transaction status"))
+		})
+
+		ginkgo.It("should not write anything when the status does not change", func() {
+			expectLock(constants.COMPLETED)
+			sqlMock.ExpectRollback()
+
+			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", constants.COMPLETED, "gateway callback")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should return error when the transaction does not exist", func() {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT id, status\s+FROM transactions`).
+				WithArgs("ref123").
+				WillReturnError(sql.ErrNoRows)
+			sqlMock.ExpectRollback()
+
+			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", constants.COMPLETED, "gateway callback")
 			gomega.Expect(err).Should(gomega.Equal(sql.ErrNoRows))
 		})
 
 		ginkgo.It("should return error when update query fails", func() {
 			dbError := errors.New("database error")
+			expectLock(constants.SUBMITTED)
 			sqlMock.ExpectExec(`UPDATE transactions`).
-				WithArgs("completed", "ref123").
+				WithArgs(constants.COMPLETED, nil, 1).
 				WillReturnError(dbError)
+			sqlMock.ExpectRollback()
 
-			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", "completed")
+			err := repo.UpdateTransactionStatusByReferenceID(ctx, "ref123", constants.COMPLETED, "gateway callback")
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
 		})
 	})
 
+	ginkgo.Describe("ClaimTransactionByReferenceID", func() {
+		expectLock := func(status string, attempt interface{}) {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT id, status, COALESCE\(processing_attempt, -1\) AS processing_attempt FROM transactions .* FOR UPDATE`).
+				WithArgs("ref123").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "status", "processing_attempt"}).AddRow(1, status, attempt))
+		}
+
+		ginkgo.It("should move a pending transaction to processing and record the transition", func() {
+			expectLock(constants.PENDING, -1)
+			sqlMock.ExpectExec(`UPDATE transactions SET status = \$1, processing_attempt = \$2`).
+				WithArgs(constants.PROCESSING, 0, 1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectExec(`INSERT INTO transaction_status_history`).
+				WithArgs(1, constants.PENDING, constants.PROCESSING, "picked up by consumer").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectCommit()
+
+			err := repo.ClaimTransactionByReferenceID(ctx, "ref123", 0)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should refuse a second claim for the same attempt", func() {
+			expectLock(constants.PROCESSING, 0)
+			sqlMock.ExpectRollback()
+
+			err := repo.ClaimTransactionByReferenceID(ctx, "ref123", 0)
+			gomega.Expect(err).Should(gomega.Equal(ErrTransactionClaimed))
+		})
+
+		ginkgo.It("should let a later attempt claim a transaction back from a retry topic", func() {
+			expectLock(constants.PROCESSING, 0)
+			sqlMock.ExpectExec(`UPDATE transactions SET status = \$1, processing_attempt = \$2`).
+				WithArgs(constants.PROCESSING, 1, 1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectCommit()
+
+			err := repo.ClaimTransactionByReferenceID(ctx, "ref123", 1)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should reject a claim for a transaction that moved past processing", func() {
+			expectLock(constants.COMPLETED, 0)
+			sqlMock.ExpectRollback()
+
+			err := repo.ClaimTransactionByReferenceID(ctx, "ref123", 1)
+
+			var transitionErr *utils.TransitionError
+			gomega.Expect(errors.As(err, &transitionErr)).To(gomega.BeTrue())
+		})
+	})
+
 	ginkgo.Describe("UpdateGatewayIDByTransactionID", func() {
 		ginkgo.It("should successfully update gateway ID", func() {
 			sqlMock.ExpectExec(`UPDATE transactions`).
@@ -144,4 +265,96 @@ var _ = ginkgo.Describe("TransactionRepository", func() {
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
 		})
 	})
+	ginkgo.Describe("FailTransactionByReferenceID", func() {
+		ginkgo.It("should mark the transaction as failed with the reason", func() {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT id, status\s+FROM transactions`).
+				WithArgs("ref-123").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, constants.PROCESSING))
+			sqlMock.ExpectExec(`UPDATE transactions`).
+				WithArgs(constants.FAILED, constants.REASON_INSUFFICIENT_FUNDS, 1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectExec(`INSERT INTO transaction_status_history`).
+				WithArgs(1, constants.PROCESSING, constants.FAILED, constants.REASON_INSUFFICIENT_FUNDS).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			sqlMock.ExpectCommit()
+
+			err := repo.FailTransactionByReferenceID(ctx, "ref-123", constants.REASON_INSUFFICIENT_FUNDS)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should return error when the transaction does not exist", func() {
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(`SELECT id, status\s+FROM transactions`).
+				WithArgs("ref-123").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+			sqlMock.ExpectRollback()
+
+			err := repo.FailTransactionByReferenceID(ctx, "ref-123", constants.REASON_INSUFFICIENT_FUNDS)
+			gomega.Expect(err).Should(gomega.Equal(sql.ErrNoRows))
+		})
+	})
+
+	ginkgo.Describe("GetTransactionByReferenceID", func() {
+		transactionRows := func() *sqlmock.Rows {
+			return sqlmock.NewRows([]string{
+				"id", "reference_id", "amount", "currency", "type", "status", "failure_reason",
+				"created_at", "updated_at", "gateway_id", "country_id", "user_id",
+			})
+		}
+
+		ginkgo.It("should return the transaction", func() {
+			now := time.Now()
+			sqlMock.ExpectQuery(`SELECT .* FROM transactions WHERE reference_id = \$1`).
+				WithArgs(transaction.ReferenceID.String()).
+				WillReturnRows(transactionRows().AddRow(1, transaction.ReferenceID, 100.0, "USD", constants.DEPOSIT, constants.COMPLETED, "", now, now, 2, 1, 1))
+
+			result, err := repo.GetTransactionByReferenceID(ctx, transaction.ReferenceID.String())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result.ReferenceID).To(gomega.Equal(transaction.ReferenceID))
+			gomega.Expect(result.Currency).To(gomega.Equal("USD"))
+			gomega.Expect(result.GatewayID).To(gomega.Equal(2))
+		})
+
+		ginkgo.It("should return sql.ErrNoRows when the transaction does not exist", func() {
+			sqlMock.ExpectQuery(`SELECT .* FROM transactions WHERE reference_id = \$1`).
+				WillReturnRows(transactionRows())
+
+			_, err := repo.GetTransactionByReferenceID(ctx, "unknown")
+			gomega.Expect(err).To(gomega.Equal(sql.ErrNoRows))
+		})
+	})
+
+	ginkgo.Describe("SearchTransactions", func() {
+		ginkgo.It("should filter on every field that is set", func() {
+			minAmount := 10.0
+			createdFrom := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+			filter := models.TransactionFilter{
+				UserID:      1,
+				Status:      constants.COMPLETED,
+				Currency:    "USD",
+				MinAmount:   &minAmount,
+				CreatedFrom: &createdFrom,
+			}
+
+			sqlMock.ExpectQuery(`FROM transactions WHERE user_id = \$1 AND status = \$2 AND currency = \$3 AND amount >= \$4 AND created_at >= \$5 AND id < \$6 ORDER BY id DESC LIMIT \$7`).
+				WithArgs(1, constants.COMPLETED, "USD", minAmount, createdFrom, 40, 11).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "reference_id"}).AddRow(39, transaction.ReferenceID))
+
+			transactions, err := repo.SearchTransactions(ctx, filter, 40, 11)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(transactions).To(gomega.HaveLen(1))
+			gomega.Expect(transactions[0].ID).To(gomega.Equal(39))
+		})
+
+		ginkgo.It("should list every transaction without a filter", func() {
+			sqlMock.ExpectQuery(`FROM transactions ORDER BY id DESC LIMIT \$1`).
+				WithArgs(51).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			transactions, err := repo.SearchTransactions(ctx, models.TransactionFilter{}, 0, 51)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(transactions).To(gomega.BeEmpty())
+		})
+	})
 })
@@ -0,0 +1,263 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"payment-gateway/internal/services"
+	"payment-gateway/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IGatewayService interface {
+	GetGatewayHealthReport(ctx context.Context, gatewayID int) (models.GatewayHealthReport, error)
+	CreateMaintenanceWindow(ctx context.Context, gatewayID int, request models.GatewayMaintenanceWindowRequest) (models.GatewayMaintenanceWindow, error)
+	GetMaintenanceWindows(ctx context.Context, gatewayID int) ([]models.GatewayMaintenanceWindow, error)
+	CancelMaintenanceWindow(ctx context.Context, gatewayID int, windowID int) (models.GatewayMaintenanceWindow, error)
+	SetGatewayMaintenance(ctx context.Context, gatewayID int, inMaintenance bool, reason string) (models.GatewayHealth, error)
+}
+
+type GatewayController struct {
+	service        IGatewayService
+	contextTimeout time.Duration
+}
+
+func InstallGatewayController(e *echo.Echo, s IGatewayService, contextTimeout time.Duration) {
+	controller := &GatewayController{
+		service:        s,
+		contextTimeout: contextTimeout,
+	}
+
+	gatewayGroup := e.Group("/gateways")
+
+	gatewayGroup.GET("/:id/health", controller.GetHealth)
+	gatewayGroup.GET("/:id/maintenance-windows", controller.GetMaintenanceWindows)
+	gatewayGroup.POST("/:id/maintenance-windows", controller.CreateMaintenanceWindow)
+	gatewayGroup.DELETE("/:id/maintenance-windows/:window_id", controller.CancelMaintenanceWindow)
+	gatewayGroup.PUT("/:id/maintenance", controller.StartMaintenance)
+	gatewayGroup.DELETE("/:id/maintenance", controller.EndMaintenance)
+}
+
+// GetHealth reports the current health of a gateway, its recent health history and its uptime
+func (controller *GatewayController) GetHealth(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	gatewayID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || gatewayID <= 0 {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid gateway ID",
+		})
+	}
+
+	report, err := controller.service.GetGatewayHealthReport(ctx, gatewayID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, models.APIResponse{
+				StatusCode: http.StatusNotFound,
+				Message:    "Gateway not found",
+			})
+		}
+		log.Printf("Failed to fetch health of gateway %d: %v", gatewayID, err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to fetch gateway health",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Gateway health fetched",
+		Data:       report,
+	})
+}
+
+// CreateMaintenanceWindow schedules a window in which the gateway is left out of routing
+func (controller *GatewayController) CreateMaintenanceWindow(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	gatewayID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || gatewayID <= 0 {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid gateway ID",
+		})
+	}
+
+	var request models.GatewayMaintenanceWindowRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+		})
+	}
+
+	window, err := controller.service.CreateMaintenanceWindow(ctx, gatewayID, request)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMaintenanceWindow) {
+			return c.JSON(http.StatusBadRequest, models.APIResponse{
+				StatusCode: http.StatusBadRequest,
+				Message:    err.Error(),
+			})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, models.APIResponse{
+				StatusCode: http.StatusNotFound,
+				Message:    "Gateway not found",
+			})
+		}
+		log.Printf("Failed to create maintenance window of gateway %d: %v", gatewayID, err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to create maintenance window",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, models.APIResponse{
+		StatusCode: http.StatusCreated,
+		Message:    "Maintenance window created",
+		Data:       window,
+	})
+}
+
+// GetMaintenanceWindows lists the running and upcoming maintenance windows of a gateway
+func (controller *GatewayController) GetMaintenanceWindows(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	gatewayID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || gatewayID <= 0 {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid gateway ID",
+		})
+	}
+
+	windows, err := controller.service.GetMaintenanceWindows(ctx, gatewayID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, models.APIResponse{
+				StatusCode: http.StatusNotFound,
+				Message:    "Gateway not found",
+			})
+		}
+		log.Printf("Failed to fetch maintenance windows of gateway %d: %v", gatewayID, err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to fetch maintenance windows",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Maintenance windows fetched",
+		Data:       windows,
+	})
+}
+
+// CancelMaintenanceWindow calls off a running or upcoming maintenance window, the gateway is routed to again right away
+func (controller *GatewayController) CancelMaintenanceWindow(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	gatewayID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || gatewayID <= 0 {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid gateway ID",
+		})
+	}
+	windowID, err := strconv.Atoi(c.Param("window_id"))
+	if err != nil || windowID <= 0 {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid maintenance window ID",
+		})
+	}
+
+	window, err := controller.service.CancelMaintenanceWindow(ctx, gatewayID, windowID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, models.APIResponse{
+				StatusCode: http.StatusNotFound,
+				Message:    "Maintenance window not found, cancelled or over",
+			})
+		}
+		log.Printf("Failed to cancel maintenance window %d of gateway %d: %v", windowID, gatewayID, err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to cancel maintenance window",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Maintenance window cancelled",
+		Data:       window,
+	})
+}
+
+// StartMaintenance puts a gateway in maintenance until an operator takes it out again
+func (controller *GatewayController) StartMaintenance(c echo.Context) error {
+	return controller.setMaintenance(c, true)
+}
+
+// EndMaintenance takes a gateway out of maintenance, its health probes and live traffic decide its status again
+func (controller *GatewayController) EndMaintenance(c echo.Context) error {
+	return controller.setMaintenance(c, false)
+}
+
+func (controller *GatewayController) setMaintenance(c echo.Context, inMaintenance bool) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	gatewayID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || gatewayID <= 0 {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid gateway ID",
+		})
+	}
+
+	// the reason is optional, a request without a body gets a default one
+	var request models.GatewayMaintenanceRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+		})
+	}
+
+	health, err := controller.service.SetGatewayMaintenance(ctx, gatewayID, inMaintenance, request.Reason)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, models.APIResponse{
+				StatusCode: http.StatusNotFound,
+				Message:    "Gateway not found",
+			})
+		}
+		log.Printf("Failed to change maintenance of gateway %d: %v", gatewayID, err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to change gateway maintenance",
+		})
+	}
+
+	message := "Gateway taken out of maintenance"
+	if inMaintenance {
+		message = "Gateway put in maintenance"
+	}
+	return c.JSON(http.StatusOK, models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    message,
+		Data:       health,
+	})
+}
@@ -0,0 +1,266 @@
+package rest
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"payment-gateway/internal/services"
+	mocks "payment-gateway/mocks/services"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("GatewayRest", func() {
+	var (
+		mockService *mocks.GatewayService
+		controller  *GatewayController
+		e           *echo.Echo
+	)
+
+	ginkgo.BeforeEach(func() {
+		mockService = new(mocks.GatewayService)
+		e = echo.New()
+		controller = &GatewayController{
+			service:        mockService,
+			contextTimeout: 5 * time.Second,
+		}
+	})
+
+	getHealth := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/gateways/"+id+"/health", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+
+		gomega.Expect(controller.GetHealth(c)).To(gomega.Succeed())
+		return rec
+	}
+
+	ginkgo.Describe("GetHealth Endpoint", func() {
+		ginkgo.It("should return 200 OK with the health report", func() {
+			lastHour := 99.5
+			mockService.On("GetGatewayHealthReport", mock.Anything, 1).Return(models.GatewayHealthReport{
+				GatewayHealth: models.GatewayHealth{GatewayID: 1, HealthStatus: constants.DEGRADED},
+				Name:          "A",
+				Uptime:        models.GatewayUptime{LastHour: &lastHour},
+				Events:        []models.GatewayHealthEvent{{ID: 3, EventType: constants.HEALTH_EVENT_PROBE}},
+			}, nil)
+
+			rec := getHealth("1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+			var response struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data).To(gomega.HaveKeyWithValue("health_status", constants.DEGRADED))
+			gomega.Expect(response.Data).To(gomega.HaveKeyWithValue("uptime", map[string]interface{}{"1h": 99.5, "24h": nil, "30d": nil}))
+			gomega.Expect(response.Data["events"]).To(gomega.HaveLen(1))
+		})
+
+		ginkgo.It("should return 400 Bad Request when the gateway ID is invalid", func() {
+			rec := getHealth("abc")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "GetGatewayHealthReport", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return 404 Not Found when the gateway does not exist", func() {
+			mockService.On("GetGatewayHealthReport", mock.Anything, 9).Return(models.GatewayHealthReport{}, sql.ErrNoRows)
+
+			rec := getHealth("9")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
+		ginkgo.It("should return 500 Internal Server Error when the report cannot be built", func() {
+			mockService.On("GetGatewayHealthReport", mock.Anything, 1).Return(models.GatewayHealthReport{}, errors.New("db error"))
+
+			rec := getHealth("1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+		})
+	})
+
+	ginkgo.Describe("Maintenance window Endpoints", func() {
+		call := func(method, body string, handler echo.HandlerFunc, params ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/gateways/1/maintenance-windows", bytes.NewReader([]byte(body)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "window_id")
+			c.SetParamValues(params...)
+
+			gomega.Expect(handler(c)).To(gomega.Succeed())
+			return rec
+		}
+
+		ginkgo.It("should return 201 Created with the scheduled window", func() {
+			countryID := 2
+			request := models.GatewayMaintenanceWindowRequest{
+				CountryID: &countryID,
+				StartsAt:  time.Date(2024, 12, 23, 1, 0, 0, 0, time.UTC),
+				EndsAt:    time.Date(2024, 12, 23, 3, 0, 0, 0, time.UTC),
+				Reason:    "database upgrade",
+			}
+			mockService.On("CreateMaintenanceWindow", mock.Anything, 1, request).
+				Return(models.GatewayMaintenanceWindow{ID: 5, GatewayID: 1, CountryID: &countryID}, nil)
+
+			rec := call(http.MethodPost, `{"country_id":2,"starts_at":"2024-12-23T01:00:00Z","ends_at":"2024-12-23T03:00:00Z","reason":"database upgrade"}`,
+				controller.CreateMaintenanceWindow, "1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusCreated))
+			var response struct {
+				Data models.GatewayMaintenanceWindow `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data.ID).To(gomega.Equal(5))
+		})
+
+		ginkgo.It("should return 400 Bad Request when the window is invalid", func() {
+			mockService.On("CreateMaintenanceWindow", mock.Anything, 1, mock.Anything).
+				Return(models.GatewayMaintenanceWindow{}, fmt.Errorf("%w: ends_at must be after starts_at", services.ErrInvalidMaintenanceWindow))
+
+			rec := call(http.MethodPost, `{"starts_at":"2024-12-23T03:00:00Z","ends_at":"2024-12-23T01:00:00Z"}`, controller.CreateMaintenanceWindow, "1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("ends_at must be after starts_at"))
+		})
+
+		ginkgo.It("should return 400 Bad Request when the payload is invalid", func() {
+			rec := call(http.MethodPost, `{"starts_at":"tomorrow"}`, controller.CreateMaintenanceWindow, "1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "CreateMaintenanceWindow", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return 404 Not Found when the gateway does not exist", func() {
+			mockService.On("CreateMaintenanceWindow", mock.Anything, 9, mock.Anything).Return(models.GatewayMaintenanceWindow{}, sql.ErrNoRows)
+
+			rec := call(http.MethodPost, `{}`, controller.CreateMaintenanceWindow, "9")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
+		ginkgo.It("should return 200 OK with the running and upcoming windows", func() {
+			mockService.On("GetMaintenanceWindows", mock.Anything, 1).Return([]models.GatewayMaintenanceWindow{{ID: 5}, {ID: 6}}, nil)
+
+			rec := call(http.MethodGet, "", controller.GetMaintenanceWindows, "1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			var response struct {
+				Data []models.GatewayMaintenanceWindow `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data).To(gomega.HaveLen(2))
+		})
+
+		ginkgo.It("should return 200 OK with the cancelled window", func() {
+			cancelledAt := time.Now()
+			mockService.On("CancelMaintenanceWindow", mock.Anything, 1, 5).Return(models.GatewayMaintenanceWindow{ID: 5, CancelledAt: &cancelledAt}, nil)
+
+			rec := call(http.MethodDelete, "", controller.CancelMaintenanceWindow, "1", "5")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+		})
+
+		ginkgo.It("should return 400 Bad Request when the window ID is invalid", func() {
+			rec := call(http.MethodDelete, "", controller.CancelMaintenanceWindow, "1", "abc")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "CancelMaintenanceWindow", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return 404 Not Found when there is no window to cancel", func() {
+			mockService.On("CancelMaintenanceWindow", mock.Anything, 1, 5).Return(models.GatewayMaintenanceWindow{}, sql.ErrNoRows)
+
+			rec := call(http.MethodDelete, "", controller.CancelMaintenanceWindow, "1", "5")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
+		ginkgo.It("should return 500 Internal Server Error when the window cannot be cancelled", func() {
+			mockService.On("CancelMaintenanceWindow", mock.Anything, 1, 5).Return(models.GatewayMaintenanceWindow{}, errors.New("db error"))
+
+			rec := call(http.MethodDelete, "", controller.CancelMaintenanceWindow, "1", "5")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+		})
+	})
+
+	ginkgo.Describe("Maintenance Endpoints", func() {
+		call := func(method, body string, handler echo.HandlerFunc, id string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/gateways/"+id+"/maintenance", bytes.NewReader([]byte(body)))
+			if body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+
+			gomega.Expect(handler(c)).To(gomega.Succeed())
+			return rec
+		}
+
+		ginkgo.It("should return 200 OK with the health of a gateway put in maintenance", func() {
+			mockService.On("SetGatewayMaintenance", mock.Anything, 1, true, "provider outage").
+				Return(models.GatewayHealth{GatewayID: 1, HealthStatus: constants.MAINTENANCE}, nil)
+
+			rec := call(http.MethodPut, `{"reason":"provider outage"}`, controller.StartMaintenance, "1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			var response struct {
+				Data models.GatewayHealth `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data.HealthStatus).To(gomega.Equal(constants.MAINTENANCE))
+		})
+
+		ginkgo.It("should take a gateway out of maintenance without a body", func() {
+			mockService.On("SetGatewayMaintenance", mock.Anything, 1, false, "").
+				Return(models.GatewayHealth{GatewayID: 1, HealthStatus: constants.HEALTHY}, nil)
+
+			rec := call(http.MethodDelete, "", controller.EndMaintenance, "1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			mockService.AssertCalled(ginkgo.GinkgoT(), "SetGatewayMaintenance", mock.Anything, 1, false, "")
+		})
+
+		ginkgo.It("should return 400 Bad Request when the gateway ID is invalid", func() {
+			rec := call(http.MethodPut, "", controller.StartMaintenance, "abc")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "SetGatewayMaintenance", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return 404 Not Found when the gateway does not exist", func() {
+			mockService.On("SetGatewayMaintenance", mock.Anything, 9, true, "").Return(models.GatewayHealth{}, fmt.Errorf("wrapped: %w", sql.ErrNoRows))
+
+			rec := call(http.MethodPut, "", controller.StartMaintenance, "9")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
+		ginkgo.It("should return 500 Internal Server Error when the status cannot be changed", func() {
+			mockService.On("SetGatewayMaintenance", mock.Anything, 1, true, "").Return(models.GatewayHealth{}, errors.New("db error"))
+
+			rec := call(http.MethodPut, "", controller.StartMaintenance, "1")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"payment-gateway/internal/outbox"
+	"payment-gateway/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+type OutboxController struct {
+	relay          outbox.IRelay
+	contextTimeout time.Duration
+}
+
+func InstallOutboxController(e *echo.Echo, relay outbox.IRelay, contextTimeout time.Duration) {
+	controller := &OutboxController{
+		relay:          relay,
+		contextTimeout: contextTimeout,
+	}
+
+	e.GET("/outbox/lag", controller.GetLag)
+}
+
+// GetLag reports how many messages wait to be published to Kafka and how old the oldest one is
+func (controller *OutboxController) GetLag(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	lag, err := controller.relay.Lag(ctx)
+	if err != nil {
+		log.Printf("Failed to fetch outbox lag: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to fetch outbox lag",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Outbox lag fetched",
+		Data:       lag,
+	})
+}
@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	mocks "payment-gateway/mocks/outbox"
+	"payment-gateway/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("OutboxRest", func() {
+	var (
+		mockRelay  *mocks.MockRelay
+		controller *OutboxController
+		e          *echo.Echo
+	)
+
+	ginkgo.BeforeEach(func() {
+		mockRelay = new(mocks.MockRelay)
+		e = echo.New()
+		controller = &OutboxController{
+			relay:          mockRelay,
+			contextTimeout: 5 * time.Second,
+		}
+	})
+
+	ginkgo.Describe("GetLag Endpoint", func() {
+		ginkgo.It("should return 200 OK with the outbox lag", func() {
+			mockRelay.On("Lag", mock.Anything).Return(models.OutboxLag{PendingMessages: 3, OldestPendingAgeSeconds: 42}, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/outbox/lag", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := controller.GetLag(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+			var response struct {
+				Data models.OutboxLag `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data.PendingMessages).To(gomega.Equal(3))
+		})
+
+		ginkgo.It("should return 500 Internal Server Error when the lag cannot be fetched", func() {
+			mockRelay.On("Lag", mock.Anything).Return(models.OutboxLag{}, errors.New("db error"))
+
+			req := httptest.NewRequest(http.MethodGet, "/outbox/lag", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := controller.GetLag(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+		})
+	})
+})
@@ -3,21 +3,38 @@ package rest
 import (
 	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/services"
 	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
 	"payment-gateway/pkg/utils"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	// HeaderIdempotencyKey lets a client retry a deposit or withdraw without creating a second transaction
+	HeaderIdempotencyKey    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255 // size of idempotency_keys.key
+)
+
 type ITransactionService interface {
-	Deposit(ctx context.Context, request models.DepositRequest) (models.Transaction, error)
-	Withdraw(ctx context.Context, request models.WithdrawalRequest) (models.Transaction, error)
+	Deposit(ctx context.Context, request models.DepositRequest, idempotencyKey string) (models.Transaction, error)
+	Withdraw(ctx context.Context, request models.WithdrawalRequest, idempotencyKey string) (models.Transaction, error)
 	TransactionCallback(ctx context.Context, request *models.TransactionCallbackRequest) error
+	GetTransactionAttempts(ctx context.Context, referenceID string) ([]models.TransactionAttempt, error)
+	GetTransaction(ctx context.Context, referenceID string) (models.Transaction, error)
+	SearchTransactions(ctx context.Context, filter models.TransactionFilter) (models.TransactionPage, error)
 }
 
 type TransactionController struct {
@@ -36,12 +53,25 @@ func InstallTransactionController(e *echo.Echo, s ITransactionService, contextTi
 	transactionGroup.POST("/deposit", controller.Deposit)
 	transactionGroup.POST("/withdraw", controller.Withdraw)
 	transactionGroup.POST("/callback", controller.TransactionCallback)
+	transactionGroup.POST("/callback/:gateway", controller.GatewayTransactionCallback)
+	transactionGroup.GET("", controller.SearchTransactions)
+	transactionGroup.GET("/:reference_id", controller.GetTransaction)
+	transactionGroup.GET("/:reference_id/attempts", controller.GetTransactionAttempts)
 }
 
 func (controller *TransactionController) Deposit(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
 	defer cancel()
 
+	idempotencyKey := c.Request().Header.Get(HeaderIdempotencyKey)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid Idempotency-Key",
+			Data:       nil,
+		})
+	}
+
 	var request models.DepositRequest
 	if err := c.Bind(&request); err != nil {
 		return c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -51,8 +81,15 @@ func (controller *TransactionController) Deposit(c echo.Context) error {
 		})
 	}
 
-	result, err := controller.service.Deposit(ctx, request)
+	result, err := controller.service.Deposit(ctx, request, idempotencyKey)
 	if err != nil {
+		if errors.Is(err, services.ErrIdempotencyKeyReused) || errors.Is(err, services.ErrIdempotencyKeyInProgress) {
+			return c.JSON(http.StatusConflict, models.APIResponse{
+				StatusCode: http.StatusConflict,
+				Message:    err.Error(),
+				Data:       nil,
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, models.APIResponse{
 			StatusCode: http.StatusInternalServerError,
 			Message:    "Failed to process deposit",
@@ -73,6 +110,15 @@ func (controller *TransactionController) Withdraw(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
 	defer cancel()
 
+	idempotencyKey := c.Request().Header.Get(HeaderIdempotencyKey)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid Idempotency-Key",
+			Data:       nil,
+		})
+	}
+
 	var request models.WithdrawalRequest
 	if err := c.Bind(&request); err != nil {
 		return c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -82,8 +128,15 @@ func (controller *TransactionController) Withdraw(c echo.Context) error {
 		})
 	}
 
-	result, err := controller.service.Withdraw(ctx, request)
+	result, err := controller.service.Withdraw(ctx, request, idempotencyKey)
 	if err != nil {
+		if errors.Is(err, services.ErrIdempotencyKeyReused) || errors.Is(err, services.ErrIdempotencyKeyInProgress) {
+			return c.JSON(http.StatusConflict, models.APIResponse{
+				StatusCode: http.StatusConflict,
+				Message:    err.Error(),
+				Data:       nil,
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, models.APIResponse{
 			StatusCode: http.StatusInternalServerError,
 			Message:    "Failed to process withdrawal",
@@ -100,8 +153,11 @@ func (controller *TransactionController) Withdraw(c echo.Context) error {
 	return c.JSON(http.StatusAccepted, response)
 }
 
+// TransactionCallback applies a status update sent in the generic callback format
 func (controller *TransactionController) TransactionCallback(c echo.Context) error {
-	// Read and copy the request body
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
 	bodyBytes, err := io.ReadAll(c.Request().Body)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -110,35 +166,264 @@ func (controller *TransactionController) TransactionCallback(c echo.Context) err
 		})
 	}
 
-	// Reset the body so it can be reused
-	c.Request().Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	var request models.TransactionCallbackRequest
 
-	go func(body []byte) {
-		ctx, cancel := context.WithTimeout(context.Background(), controller.contextTimeout)
-		defer cancel()
+	// Decode the request from the copied body
+	req := &http.Request{
+		Body:   io.NopCloser(bytes.NewBuffer(bodyBytes)),
+		Header: c.Request().Header,
+	}
+	if err := utils.DecodeRequest(req, &request); err != nil {
+		log.Printf("Invalid request payload: %v", err)
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+		})
+	}
 
-		var request models.TransactionCallbackRequest
+	return controller.applyCallback(ctx, c, &request)
+}
 
-		// Create a new request object with the copied body
-		req := &http.Request{
-			Body:   io.NopCloser(bytes.NewBuffer(body)),
-			Header: c.Request().Header,
-		}
+// GatewayTransactionCallback handles callbacks sent to /transaction/callback/:gateway,
+// parsing the payload with the adapter registered for that gateway name
+func (controller *TransactionController) GatewayTransactionCallback(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
 
-		// Decode the request using utils
-		err := utils.DecodeRequest(req, &request)
-		if err != nil {
-			log.Printf("Invalid request payload: %v", err)
-			return
+	adapter, err := gateways.Get(c.Param("gateway"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, models.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Message:    "Unknown gateway",
+		})
+	}
+
+	bodyBytes, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+		})
+	}
+
+	request, err := adapter.ParseCallback(c.Request().Header.Get(echo.HeaderContentType), bodyBytes)
+	if err != nil {
+		log.Printf("Invalid callback payload from gateway %s: %v", adapter.Name(), err)
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+		})
+	}
+
+	return controller.applyCallback(ctx, c, request)
+}
+
+// applyCallback hands the callback to the service and reports the outcome, so a gateway
+// knows whether to send the callback again
+func (controller *TransactionController) applyCallback(ctx context.Context, c echo.Context, request *models.TransactionCallbackRequest) error {
+	err := controller.service.TransactionCallback(ctx, request)
+
+	var transitionErr *utils.TransitionError
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, models.APIResponse{
+			StatusCode: http.StatusOK,
+			Message:    "Callback received",
+		})
+	case errors.As(err, &transitionErr):
+		return c.JSON(http.StatusConflict, models.APIResponse{
+			StatusCode: http.StatusConflict,
+			Message:    transitionErr.Error(),
+		})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.JSON(http.StatusNotFound, models.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Message:    "Transaction not found",
+		})
+	default:
+		log.Printf("Failed to process callback: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to process callback",
+		})
+	}
+}
+
+// GetTransactionAttempts returns the audit trail of every request sent to a gateway for the transaction
+func (controller *TransactionController) GetTransactionAttempts(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	referenceID, err := uuid.Parse(c.Param("reference_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid reference ID",
+		})
+	}
+
+	attempts, err := controller.service.GetTransactionAttempts(ctx, referenceID.String())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to fetch transaction attempts",
+		})
+	}
+
+	return c.JSON(http.StatusOK, models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Transaction attempts fetched",
+		Data:       attempts,
+	})
+}
+
+// GetTransaction returns a single transaction by its reference ID
+func (controller *TransactionController) GetTransaction(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	referenceID, err := uuid.Parse(c.Param("reference_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid reference ID",
+		})
+	}
+
+	transaction, err := controller.service.GetTransaction(ctx, referenceID.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, models.APIResponse{
+				StatusCode: http.StatusNotFound,
+				Message:    "Transaction not found",
+			})
 		}
+		log.Printf("Failed to fetch transaction %s: %v", referenceID, err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to fetch transaction",
+		})
+	}
 
-		if err := controller.service.TransactionCallback(ctx, &request); err != nil {
-			log.Printf("Failed to process callback: %v", err)
+	return c.JSON(http.StatusOK, models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Transaction fetched",
+		Data:       transaction,
+	})
+}
+
+// SearchTransactions lists the transactions matching the query parameters, newest first
+func (controller *TransactionController) SearchTransactions(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), controller.contextTimeout)
+	defer cancel()
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, models.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid search filter: " + err.Error(),
+		})
+	}
+
+	page, err := controller.service.SearchTransactions(ctx, filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			return c.JSON(http.StatusBadRequest, models.APIResponse{
+				StatusCode: http.StatusBadRequest,
+				Message:    "Invalid cursor",
+			})
 		}
-	}(bodyBytes)
+		log.Printf("Failed to search transactions: %v", err)
+		return c.JSON(http.StatusInternalServerError, models.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to search transactions",
+		})
+	}
 
 	return c.JSON(http.StatusOK, models.APIResponse{
 		StatusCode: http.StatusOK,
-		Message:    "Callback received",
+		Message:    "Transactions fetched",
+		Data:       page,
 	})
 }
+
+// parseTransactionFilter reads the search filter from the query string. The error names the first invalid parameter.
+func parseTransactionFilter(c echo.Context) (models.TransactionFilter, error) {
+	filter := models.TransactionFilter{
+		Status:   c.QueryParam("status"),
+		Type:     c.QueryParam("type"),
+		Currency: c.QueryParam("currency"),
+		Cursor:   c.QueryParam("cursor"),
+	}
+
+	if filter.Status != "" && !utils.IsTransactionStatus(filter.Status) {
+		return filter, errors.New("invalid status")
+	}
+	if filter.Type != "" && filter.Type != constants.DEPOSIT && filter.Type != constants.WITHDRAWAL {
+		return filter, errors.New("invalid type")
+	}
+
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{"user_id", &filter.UserID},
+		{"gateway_id", &filter.GatewayID},
+		{"country_id", &filter.CountryID},
+		{"limit", &filter.Limit},
+	}
+	for _, param := range ints {
+		raw := c.QueryParam(param.name)
+		if raw == "" {
+			continue
+		}
+		number, err := strconv.Atoi(raw)
+		if err != nil || number <= 0 {
+			return filter, fmt.Errorf("invalid %s", param.name)
+		}
+		*param.value = number
+	}
+	if filter.Limit > services.MaxSearchLimit {
+		return filter, fmt.Errorf("invalid limit, at most %d transactions are returned per page", services.MaxSearchLimit)
+	}
+
+	amounts := []struct {
+		name  string
+		value **float64
+	}{
+		{"min_amount", &filter.MinAmount},
+		{"max_amount", &filter.MaxAmount},
+	}
+	for _, param := range amounts {
+		raw := c.QueryParam(param.name)
+		if raw == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s", param.name)
+		}
+		*param.value = &amount
+	}
+
+	dates := []struct {
+		name  string
+		value **time.Time
+	}{
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	}
+	for _, param := range dates {
+		raw := c.QueryParam(param.name)
+		if raw == "" {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s, expected an RFC 3339 timestamp", param.name)
+		}
+		*param.value = &date
+	}
+
+	return filter, nil
+}
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,9 +10,14 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/gateways/gatewayb"
+	"payment-gateway/internal/services"
 	mocks "payment-gateway/mocks/services"
 	"payment-gateway/models"
 	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -74,7 +80,7 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			}
 
 			// Set up mock service behavior
-			mockService.On("Deposit", mock.Anything, request).Return(expectedTransaction, nil)
+			mockService.On("Deposit", mock.Anything, request, "").Return(expectedTransaction, nil)
 
 			// Prepare HTTP request
 			requestBody, _ := json.Marshal(request)
@@ -108,7 +114,7 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			gomega.Expect(actualTransaction).To(gomega.Equal(expectedTransaction))
 
 			// Verify mock behavior
-			mockService.AssertCalled(ginkgo.GinkgoT(), "Deposit", mock.Anything, request)
+			mockService.AssertCalled(ginkgo.GinkgoT(), "Deposit", mock.Anything, request, "")
 		})
 
 		ginkgo.It("should return 400 Bad Request when request payload is invalid", func() {
@@ -144,7 +150,7 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			}
 
 			// Set up mock service behavior to simulate an error
-			mockService.On("Deposit", mock.Anything, request).Return(models.Transaction{}, errors.New("deposit failed"))
+			mockService.On("Deposit", mock.Anything, request, "").Return(models.Transaction{}, errors.New("deposit failed"))
 
 			// Prepare HTTP request
 			requestBody, _ := json.Marshal(request)
@@ -169,7 +175,79 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			gomega.Expect(response.Message).To(gomega.Equal("Failed to process deposit"))
 
 			// Verify mock behavior
-			mockService.AssertCalled(ginkgo.GinkgoT(), "Deposit", mock.Anything, request)
+			mockService.AssertCalled(ginkgo.GinkgoT(), "Deposit", mock.Anything, request, "")
+		})
+
+		ginkgo.It("should pass the Idempotency-Key header to the service", func() {
+			request := models.DepositRequest{
+				Amount:    1000,
+				Currency:  "USD",
+				CountryID: 1,
+				UserID:    1,
+			}
+
+			mockService.On("Deposit", mock.Anything, request, "key-1").Return(models.Transaction{Amount: request.Amount}, nil)
+
+			requestBody, _ := json.Marshal(request)
+			req := httptest.NewRequest(http.MethodPost, "/transaction/deposit", bytes.NewReader(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(HeaderIdempotencyKey, "key-1")
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/deposit")
+
+			err := controller.Deposit(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusAccepted))
+			mockService.AssertCalled(ginkgo.GinkgoT(), "Deposit", mock.Anything, request, "key-1")
+		})
+
+		ginkgo.It("should return 409 Conflict when the Idempotency-Key was used for a different request", func() {
+			request := models.DepositRequest{
+				Amount:    1000,
+				Currency:  "USD",
+				CountryID: 1,
+				UserID:    1,
+			}
+
+			mockService.On("Deposit", mock.Anything, request, "key-1").Return(models.Transaction{}, services.ErrIdempotencyKeyReused)
+
+			requestBody, _ := json.Marshal(request)
+			req := httptest.NewRequest(http.MethodPost, "/transaction/deposit", bytes.NewReader(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(HeaderIdempotencyKey, "key-1")
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/deposit")
+
+			err := controller.Deposit(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+
+			var response models.APIResponse
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(response.Message).To(gomega.Equal(services.ErrIdempotencyKeyReused.Error()))
+		})
+
+		ginkgo.It("should return 400 Bad Request when the Idempotency-Key is too long", func() {
+			req := httptest.NewRequest(http.MethodPost, "/transaction/deposit", bytes.NewReader([]byte(`{}`)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(HeaderIdempotencyKey, strings.Repeat("k", maxIdempotencyKeyLength+1))
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/deposit")
+
+			err := controller.Deposit(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "Deposit", mock.Anything, mock.Anything, mock.Anything)
 		})
 	})
 
@@ -195,7 +273,7 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			}
 
 			// Set up mock service behavior
-			mockService.On("Withdraw", mock.Anything, request).Return(expectedTransaction, nil)
+			mockService.On("Withdraw", mock.Anything, request, "").Return(expectedTransaction, nil)
 
 			// Prepare HTTP request
 			requestBody, _ := json.Marshal(request)
@@ -229,7 +307,7 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			gomega.Expect(actualTransaction).To(gomega.Equal(expectedTransaction))
 
 			// Verify mock behavior
-			mockService.AssertCalled(ginkgo.GinkgoT(), "Withdraw", mock.Anything, request)
+			mockService.AssertCalled(ginkgo.GinkgoT(), "Withdraw", mock.Anything, request, "")
 		})
 
 		ginkgo.It("should return 400 Bad Request when request payload is invalid", func() {
@@ -265,7 +343,7 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			}
 
 			// Set up mock service behavior to simulate an error
-			mockService.On("Withdraw", mock.Anything, request).Return(models.Transaction{}, errors.New("withdraw failed"))
+			mockService.On("Withdraw", mock.Anything, request, "").Return(models.Transaction{}, errors.New("withdraw failed"))
 
 			// Prepare HTTP request
 			requestBody, _ := json.Marshal(request)
@@ -290,7 +368,7 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			gomega.Expect(response.Message).To(gomega.Equal("Failed to process withdrawal"))
 
 			// Verify mock behavior
-			mockService.AssertCalled(ginkgo.GinkgoT(), "Withdraw", mock.Anything, request)
+			mockService.AssertCalled(ginkgo.GinkgoT(), "Withdraw", mock.Anything, request, "")
 		})
 	})
 
@@ -341,6 +419,28 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 			mockService.AssertCalled(ginkgo.GinkgoT(), "TransactionCallback", mock.Anything, &request)
 		})
 
+		ginkgo.It("should return 404 Not Found when the transaction does not exist", func() {
+			request := models.TransactionCallbackRequest{
+				ReferenceID: "123e4567-e89b-12d3-a456-426614174000",
+				Status:      constants.COMPLETED,
+			}
+
+			mockService.On("TransactionCallback", mock.Anything, &request).Return(sql.ErrNoRows)
+
+			requestBody, _ := json.Marshal(request)
+			req := httptest.NewRequest(http.MethodPost, "/transaction/callback", bytes.NewReader(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/callback")
+
+			err := controller.TransactionCallback(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
 		ginkgo.It("should return 400 Bad Request when io.ReadAll fails", func() {
 			// Create a custom io.Reader that always returns an error
 			errorReader := io.NopCloser(&failingReader{})
@@ -368,4 +468,337 @@ var _ = ginkgo.Describe("TransactionRest", func() {
 		})
 
 	})
+
+	ginkgo.Describe("Gateway Callback Endpoint", func() {
+		ginkgo.BeforeEach(func() {
+			gateways.Register(gatewayb.New(models.GatewayConfig{
+				GatewayUrl:        "B",
+				GatewayApiKey:     "api-key",
+				GatewayPrivateKey: "12345678901234567890123456789012",
+			}))
+		})
+
+		ginkgo.It("should parse the callback with the gateway adapter", func() {
+			expectedRequest := models.TransactionCallbackRequest{
+				ReferenceID: "123e4567-e89b-12d3-a456-426614174000",
+				Amount:      1000,
+				Currency:    "USD",
+				Status:      constants.COMPLETED,
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+
+			mockService.On("TransactionCallback", mock.Anything, &expectedRequest).Run(func(args mock.Arguments) {
+				wg.Done()
+			}).Return(nil)
+
+			requestBody := `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<TransactionCallbackRequest>
+			<id>123e4567-e89b-12d3-a456-426614174000</id>
+			<amount>1000</amount>
+			<currency>USD</currency>
+			<status>SUCCESS</status>
+		</TransactionCallbackRequest>
+	</soap:Body>
+</soap:Envelope>`
+			req := httptest.NewRequest(http.MethodPost, "/transaction/callback/B", bytes.NewReader([]byte(requestBody)))
+			req.Header.Set(echo.HeaderContentType, "text/xml")
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/callback/:gateway")
+			c.SetParamNames("gateway")
+			c.SetParamValues("B")
+
+			err := controller.GatewayTransactionCallback(c)
+
+			wg.Wait()
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			mockService.AssertCalled(ginkgo.GinkgoT(), "TransactionCallback", mock.Anything, &expectedRequest)
+		})
+
+		ginkgo.It("should return 409 Conflict when the transaction cannot move to the reported status", func() {
+			mockService.On("TransactionCallback", mock.Anything, mock.Anything).
+				Return(&utils.TransitionError{ReferenceID: "123e4567-e89b-12d3-a456-426614174000", From: constants.COMPLETED, To: constants.FAILED})
+
+			requestBody := `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<TransactionCallbackRequest>
+			<id>123e4567-e89b-12d3-a456-426614174000</id>
+			<status>FAILED</status>
+		</TransactionCallbackRequest>
+	</soap:Body>
+</soap:Envelope>`
+			req := httptest.NewRequest(http.MethodPost, "/transaction/callback/B", bytes.NewReader([]byte(requestBody)))
+			req.Header.Set(echo.HeaderContentType, "text/xml")
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/callback/:gateway")
+			c.SetParamNames("gateway")
+			c.SetParamValues("B")
+
+			err := controller.GatewayTransactionCallback(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+
+			var response models.APIResponse
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Message).To(gomega.ContainSubstring("cannot move from completed to failed"))
+		})
+
+		ginkgo.It("should return 400 Bad Request when the gateway status is unknown", func() {
+			requestBody := `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<TransactionCallbackRequest>
+			<id>123e4567-e89b-12d3-a456-426614174000</id>
+			<status>PENDING</status>
+		</TransactionCallbackRequest>
+	</soap:Body>
+</soap:Envelope>`
+			req := httptest.NewRequest(http.MethodPost, "/transaction/callback/B", bytes.NewReader([]byte(requestBody)))
+			req.Header.Set(echo.HeaderContentType, "text/xml")
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/callback/:gateway")
+			c.SetParamNames("gateway")
+			c.SetParamValues("B")
+
+			err := controller.GatewayTransactionCallback(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "TransactionCallback", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return 404 Not Found for an unknown gateway", func() {
+			req := httptest.NewRequest(http.MethodPost, "/transaction/callback/unknown", bytes.NewReader([]byte("{}")))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/callback/:gateway")
+			c.SetParamNames("gateway")
+			c.SetParamValues("unknown")
+
+			err := controller.GatewayTransactionCallback(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "TransactionCallback", mock.Anything, mock.Anything)
+		})
+	})
+	ginkgo.Describe("GetTransactionAttempts Endpoint", func() {
+		ginkgo.It("should return 200 OK with the attempts of the transaction", func() {
+			referenceID := "123e4567-e89b-12d3-a456-426614174000"
+			attempts := []models.TransactionAttempt{
+				{ID: 1, AttemptNumber: 1, GatewayID: 1, GatewayName: "A", Status: constants.ACCEPTED, HTTPStatus: http.StatusOK},
+			}
+
+			mockService.On("GetTransactionAttempts", mock.Anything, referenceID).Return(attempts, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/transaction/"+referenceID+"/attempts", nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/:reference_id/attempts")
+			c.SetParamNames("reference_id")
+			c.SetParamValues(referenceID)
+
+			err := controller.GetTransactionAttempts(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+			var response struct {
+				Data []models.TransactionAttempt `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data).To(gomega.HaveLen(1))
+			gomega.Expect(response.Data[0].GatewayName).To(gomega.Equal("A"))
+		})
+
+		ginkgo.It("should return 400 Bad Request for an invalid reference ID", func() {
+			req := httptest.NewRequest(http.MethodGet, "/transaction/not-a-uuid/attempts", nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/:reference_id/attempts")
+			c.SetParamNames("reference_id")
+			c.SetParamValues("not-a-uuid")
+
+			err := controller.GetTransactionAttempts(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "GetTransactionAttempts", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return 500 Internal Server Error when the attempts cannot be fetched", func() {
+			referenceID := "123e4567-e89b-12d3-a456-426614174000"
+
+			mockService.On("GetTransactionAttempts", mock.Anything, referenceID).Return(nil, errors.New("db error"))
+
+			req := httptest.NewRequest(http.MethodGet, "/transaction/"+referenceID+"/attempts", nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/:reference_id/attempts")
+			c.SetParamNames("reference_id")
+			c.SetParamValues(referenceID)
+
+			err := controller.GetTransactionAttempts(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+		})
+	})
+
+	ginkgo.Describe("GetTransaction Endpoint", func() {
+		ginkgo.It("should return 200 OK with the transaction", func() {
+			referenceID := "123e4567-e89b-12d3-a456-426614174000"
+			transaction := models.Transaction{ID: 8, ReferenceID: uuid.MustParse(referenceID), Status: constants.COMPLETED}
+
+			mockService.On("GetTransaction", mock.Anything, referenceID).Return(transaction, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/transaction/"+referenceID, nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/:reference_id")
+			c.SetParamNames("reference_id")
+			c.SetParamValues(referenceID)
+
+			err := controller.GetTransaction(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+			var response struct {
+				Data models.Transaction `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data.ID).To(gomega.Equal(8))
+		})
+
+		ginkgo.It("should return 404 Not Found when the transaction does not exist", func() {
+			referenceID := "123e4567-e89b-12d3-a456-426614174000"
+
+			mockService.On("GetTransaction", mock.Anything, referenceID).Return(models.Transaction{}, fmt.Errorf("wrapped: %w", sql.ErrNoRows))
+
+			req := httptest.NewRequest(http.MethodGet, "/transaction/"+referenceID, nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/:reference_id")
+			c.SetParamNames("reference_id")
+			c.SetParamValues(referenceID)
+
+			err := controller.GetTransaction(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
+		ginkgo.It("should return 400 Bad Request for an invalid reference ID", func() {
+			req := httptest.NewRequest(http.MethodGet, "/transaction/not-a-uuid", nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction/:reference_id")
+			c.SetParamNames("reference_id")
+			c.SetParamValues("not-a-uuid")
+
+			err := controller.GetTransaction(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "GetTransaction", mock.Anything, mock.Anything)
+		})
+	})
+
+	ginkgo.Describe("SearchTransactions Endpoint", func() {
+		ginkgo.It("should pass the query parameters to the service as a filter", func() {
+			minAmount := 10.5
+			createdFrom := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+			expectedFilter := models.TransactionFilter{
+				UserID:      1,
+				Status:      constants.COMPLETED,
+				Type:        constants.DEPOSIT,
+				Currency:    "USD",
+				MinAmount:   &minAmount,
+				CreatedFrom: &createdFrom,
+				Cursor:      "OA",
+				Limit:       20,
+			}
+			page := models.TransactionPage{Transactions: []models.Transaction{{ID: 7}}, NextCursor: "Nw"}
+
+			mockService.On("SearchTransactions", mock.Anything, expectedFilter).Return(page, nil)
+
+			query := "?user_id=1&status=completed&type=deposit&currency=USD&min_amount=10.5&created_from=2024-12-01T00:00:00Z&cursor=OA&limit=20"
+			req := httptest.NewRequest(http.MethodGet, "/transaction"+query, nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction")
+
+			err := controller.SearchTransactions(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+			var response struct {
+				Data models.TransactionPage `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data.Transactions).To(gomega.HaveLen(1))
+			gomega.Expect(response.Data.NextCursor).To(gomega.Equal("Nw"))
+		})
+
+		ginkgo.DescribeTable("should return 400 Bad Request for an invalid query parameter",
+			func(query string) {
+				req := httptest.NewRequest(http.MethodGet, "/transaction?"+query, nil)
+				rec := httptest.NewRecorder()
+
+				c := e.NewContext(req, rec)
+				c.SetPath("/transaction")
+
+				err := controller.SearchTransactions(c)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+				mockService.AssertNotCalled(ginkgo.GinkgoT(), "SearchTransactions", mock.Anything, mock.Anything)
+			},
+			ginkgo.Entry("unknown status", "status=done"),
+			ginkgo.Entry("unknown type", "type=refund"),
+			ginkgo.Entry("non numeric user", "user_id=abc"),
+			ginkgo.Entry("limit above the maximum", "limit=1000"),
+			ginkgo.Entry("non numeric amount", "max_amount=ten"),
+			ginkgo.Entry("date without time", "created_to=2024-12-01"),
+		)
+
+		ginkgo.It("should return 400 Bad Request for an invalid cursor", func() {
+			mockService.On("SearchTransactions", mock.Anything, models.TransactionFilter{Cursor: "bogus"}).Return(models.TransactionPage{}, services.ErrInvalidCursor)
+
+			req := httptest.NewRequest(http.MethodGet, "/transaction?cursor=bogus", nil)
+			rec := httptest.NewRecorder()
+
+			c := e.NewContext(req, rec)
+			c.SetPath("/transaction")
+
+			err := controller.SearchTransactions(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+		})
+	})
 })
@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+)
+
+// StatusQuerier asks the gateway of a transaction for its status. Gateways that cannot be asked
+// return gateways.ErrStatusQueryUnsupported.
+type StatusQuerier interface {
+	QueryTransactionStatus(ctx context.Context, transaction models.Transaction) (string, error)
+}
+
+type ExpirySettings struct {
+	Interval  time.Duration // pause between sweeps
+	BatchSize int           // transactions fetched per query
+	Fallback  models.ExpiryPolicy
+}
+
+// ExpirySettingsFromEnv reads the sweeper settings from EXPIRY_* environment variables
+func ExpirySettingsFromEnv() ExpirySettings {
+	return ExpirySettings{
+		Interval:  utils.GetEnvDuration("EXPIRY_SWEEPER_INTERVAL", 5*time.Minute),
+		BatchSize: utils.GetEnvInt("EXPIRY_SWEEPER_BATCH_SIZE", 100),
+		Fallback: models.ExpiryPolicy{
+			TTL:      utils.GetEnvDuration("EXPIRY_DEFAULT_TTL", 72*time.Hour),
+			ExpireTo: constants.EXPIRED,
+		},
+	}
+}
+
+// ExpirySweeper ends pending, processing, submitted and in-doubt transactions that stayed in their status
+// for longer than their expiry policy allows. Transactions in retry are ended by the RetryScheduler.
+type ExpirySweeper struct {
+	expiryRepo      repositories.ITransactionExpiryRepository
+	transactionRepo repositories.ITransactionRepository
+	querier         StatusQuerier // nil when no gateway can be asked
+	settings        ExpirySettings
+	now             func() time.Time
+}
+
+func NewExpirySweeper(
+	expiryRepo repositories.ITransactionExpiryRepository,
+	transactionRepo repositories.ITransactionRepository,
+	querier StatusQuerier,
+	settings ExpirySettings,
+) *ExpirySweeper {
+	return &ExpirySweeper{
+		expiryRepo:      expiryRepo,
+		transactionRepo: transactionRepo,
+		querier:         querier,
+		settings:        settings,
+		now:             time.Now,
+	}
+}
+
+// Run sweeps until ctx is cancelled
+func (s *ExpirySweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.settings.Interval)
+	defer ticker.Stop()
+
+	log.Printf("Expiry sweeper started (sweeping every %s)", s.settings.Interval)
+	for {
+		if err := s.RunOnce(ctx); err != nil {
+			log.Printf("Expiry sweeper failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Expiry sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce ends every transaction that is stale at the start of the sweep
+func (s *ExpirySweeper) RunOnce(ctx context.Context) error {
+	now := s.now()
+
+	var afterID, ended int
+	for {
+		transactions, err := s.expiryRepo.GetStaleTransactions(ctx, now, s.settings.Fallback, afterID, s.settings.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, transaction := range transactions {
+			done, err := s.sweep(ctx, transaction)
+			if err != nil {
+				log.Printf("Failed to sweep transaction %s: %v", transaction.ReferenceID, err)
+				continue
+			}
+			if done {
+				ended++
+			}
+		}
+
+		if len(transactions) < s.settings.BatchSize {
+			break
+		}
+		afterID = transactions[len(transactions)-1].ID
+	}
+
+	if ended > 0 {
+		log.Printf("Expiry sweeper ended %d stale transaction(s)", ended)
+	}
+	return nil
+}
+
+// sweep applies the final status reported by the gateway of the transaction when it can be asked, and
+// the status of the expiry policy when the gateway cannot be asked or has no record of it. A gateway still
+// working on the transaction, or one that failed to answer, gets until the next sweep. It reports whether
+// the transaction was ended.
+func (s *ExpirySweeper) sweep(ctx context.Context, transaction models.StaleTransaction) (bool, error) {
+	referenceID := transaction.ReferenceID.String()
+
+	if s.querier != nil && transaction.GatewayID != 0 {
+		status, err := s.querier.QueryTransactionStatus(ctx, transaction.Transaction)
+		switch {
+		case err == nil && utils.IsFinalStatus(status):
+			log.Printf("Gateway reported transaction %s as %s", referenceID, status)
+			if err := s.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, referenceID, status, "gateway status query"); err != nil {
+				return false, err
+			}
+			return true, nil
+		case err == nil:
+			log.Printf("Transaction %s is still %s at its gateway, not expiring it", referenceID, status)
+			return false, nil
+		case errors.Is(err, gateways.ErrStatusQueryUnsupported), errors.Is(err, gateways.ErrTransactionNotFound):
+		default:
+			log.Printf("Failed to query the gateway status of transaction %s, retrying next sweep: %v", referenceID, err)
+			return false, nil
+		}
+	}
+
+	ttl := time.Duration(transaction.TTLSeconds) * time.Second
+	reason := fmt.Sprintf("%s for longer than %s", transaction.Status, ttl)
+	if err := s.expiryRepo.ExpireTransaction(ctx, transaction, reason); err != nil {
+		if errors.Is(err, repositories.ErrStatusChanged) {
+			log.Printf("Transaction %s moved on before it could be expired", referenceID)
+			return false, nil
+		}
+		return false, err
+	}
+
+	log.Printf("Moved stale transaction %s to %s, it was %s", referenceID, transaction.ExpireTo, reason)
+	return true, nil
+}
@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/repositories"
+	mocksRepository "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/google/uuid"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+type fakeStatusQuerier struct {
+	status string
+	err    error
+	calls  int
+}
+
+func (q *fakeStatusQuerier) QueryTransactionStatus(ctx context.Context, transaction models.Transaction) (string, error) {
+	q.calls++
+	return q.status, q.err
+}
+
+var _ = ginkgo.Describe("ExpirySweeper", func() {
+	var (
+		mockExpiryRepo      *mocksRepository.MockTransactionExpiryRepository
+		mockTransactionRepo *mocksRepository.TransactionRepository
+		querier             *fakeStatusQuerier
+		settings            ExpirySettings
+		sweeper             *ExpirySweeper
+		ctx                 context.Context
+		now                 time.Time
+		stale               models.StaleTransaction
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		mockExpiryRepo = new(mocksRepository.MockTransactionExpiryRepository)
+		mockTransactionRepo = new(mocksRepository.TransactionRepository)
+		querier = &fakeStatusQuerier{err: gateways.ErrStatusQueryUnsupported}
+		settings = ExpirySettings{
+			Interval:  time.Minute,
+			BatchSize: 2,
+			Fallback:  models.ExpiryPolicy{TTL: 72 * time.Hour, ExpireTo: constants.EXPIRED},
+		}
+		sweeper = NewExpirySweeper(mockExpiryRepo, mockTransactionRepo, querier, settings)
+		sweeper.now = func() time.Time { return now }
+
+		stale = models.StaleTransaction{
+			Transaction: models.Transaction{ID: 1, ReferenceID: uuid.New(), Status: constants.SUBMITTED, GatewayID: 2},
+			TTLSeconds:  3600,
+			ExpireTo:    constants.EXPIRED,
+		}
+	})
+
+	ginkgo.Describe("RunOnce", func() {
+		ginkgo.It("should expire stale transactions whose gateway cannot be asked", func() {
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale}, nil).Once()
+			mockExpiryRepo.On("ExpireTransaction", ctx, stale, "submitted for longer than 1h0m0s").Return(nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(querier.calls).To(gomega.Equal(1))
+			mockExpiryRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should apply the final status reported by the gateway", func() {
+			querier.status, querier.err = constants.COMPLETED, nil
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale}, nil).Once()
+			mockTransactionRepo.On("UpdateTransactionStatusByReferenceID", ctx, stale.ReferenceID.String(), constants.COMPLETED, "gateway status query").Return(nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockTransactionRepo.AssertExpectations(ginkgo.GinkgoT())
+			mockExpiryRepo.AssertNotCalled(ginkgo.GinkgoT(), "ExpireTransaction", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should leave transactions the gateway is still working on", func() {
+			querier.status, querier.err = constants.PROCESSING, nil
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale}, nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockExpiryRepo.AssertNotCalled(ginkgo.GinkgoT(), "ExpireTransaction", mock.Anything, mock.Anything, mock.Anything)
+			mockTransactionRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should leave transactions whose gateway cannot be reached for the next sweep", func() {
+			querier.err = errors.New("connection refused")
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale}, nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(querier.calls).To(gomega.Equal(1))
+			mockExpiryRepo.AssertNotCalled(ginkgo.GinkgoT(), "ExpireTransaction", mock.Anything, mock.Anything, mock.Anything)
+			mockTransactionRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should expire transactions whose gateway wraps that it cannot be asked", func() {
+			querier.err = fmt.Errorf("gateway B: %w", gateways.ErrStatusQueryUnsupported)
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale}, nil).Once()
+			mockExpiryRepo.On("ExpireTransaction", ctx, stale, "submitted for longer than 1h0m0s").Return(nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockExpiryRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should expire in-doubt transactions their gateway has no record of", func() {
+			stale.Status = constants.IN_DOUBT
+			querier.err = fmt.Errorf("gateway A, transaction %s: %w", stale.ReferenceID, gateways.ErrTransactionNotFound)
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale}, nil).Once()
+			mockExpiryRepo.On("ExpireTransaction", ctx, stale, "in_doubt for longer than 1h0m0s").Return(nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockExpiryRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should not ask for transactions without a gateway", func() {
+			stale.Status, stale.GatewayID = constants.PENDING, 0
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale}, nil).Once()
+			mockExpiryRepo.On("ExpireTransaction", ctx, stale, "pending for longer than 1h0m0s").Return(nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(querier.calls).To(gomega.Equal(0))
+			mockExpiryRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should page through the stale transactions and skip those that moved on", func() {
+			second := stale
+			second.ID = 2
+			third := stale
+			third.ID = 3
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return([]models.StaleTransaction{stale, second}, nil).Once()
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 2, 2).Return([]models.StaleTransaction{third}, nil).Once()
+			mockExpiryRepo.On("ExpireTransaction", ctx, stale, mock.Anything).Return(repositories.ErrStatusChanged).Once()
+			mockExpiryRepo.On("ExpireTransaction", ctx, second, mock.Anything).Return(errors.New("database error")).Once()
+			mockExpiryRepo.On("ExpireTransaction", ctx, third, mock.Anything).Return(nil).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockExpiryRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should return error when the stale transactions cannot be fetched", func() {
+			mockExpiryRepo.On("GetStaleTransactions", ctx, now, settings.Fallback, 0, 2).Return(nil, errors.New("database error")).Once()
+
+			err := sweeper.RunOnce(ctx)
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+)
+
+// CallbackHandler applies a status reported by a gateway the way a callback is applied
+type CallbackHandler interface {
+	TransactionCallback(ctx context.Context, request *models.TransactionCallbackRequest) error
+}
+
+type PollSettings struct {
+	Interval  time.Duration // pause between runs
+	BatchSize int           // transactions claimed per query
+	Policy    models.PollPolicy
+}
+
+// PollSettingsFromEnv reads the status poller settings from STATUS_POLL* environment variables
+func PollSettingsFromEnv() PollSettings {
+	return PollSettings{
+		Interval:  utils.GetEnvDuration("STATUS_POLLER_INTERVAL", 30*time.Second),
+		BatchSize: utils.GetEnvInt("STATUS_POLLER_BATCH_SIZE", 100),
+		Policy: models.PollPolicy{
+			Delay:       utils.GetEnvDuration("STATUS_POLL_DELAY", 5*time.Minute),
+			MinInterval: utils.GetEnvDuration("STATUS_POLL_MIN_INTERVAL", time.Minute),
+			MaxInterval: utils.GetEnvDuration("STATUS_POLL_MAX_INTERVAL", time.Hour),
+		},
+	}
+}
+
+// StatusPoller asks gateways for the status of submitted transactions whose callback did not arrive,
+// and applies a final status the way the callback would have. A transaction is polled until it leaves
+// submitted, through a poll, a late callback or the ExpirySweeper. Transactions in doubt are polled the
+// same way, and parked in retry once their gateway confirmed it has no record of them.
+type StatusPoller struct {
+	repo            repositories.ITransactionPollRepository
+	transactionRepo repositories.ITransactionRepository
+	querier         StatusQuerier
+	callbacks       CallbackHandler
+	settings        PollSettings
+	now             func() time.Time
+	gatewayNames    func() []string // gateways that can be asked for the status of a transaction
+}
+
+func NewStatusPoller(
+	repo repositories.ITransactionPollRepository,
+	transactionRepo repositories.ITransactionRepository,
+	querier StatusQuerier,
+	callbacks CallbackHandler,
+	settings PollSettings,
+) *StatusPoller {
+	return &StatusPoller{
+		repo:            repo,
+		transactionRepo: transactionRepo,
+		querier:         querier,
+		callbacks:       callbacks,
+		settings:        settings,
+		now:             time.Now,
+		gatewayNames:    statusQueryGateways,
+	}
+}
+
+// statusQueryGateways returns the names of the registered gateways that can be asked for the status of a
+// transaction. Transactions of the other gateways wait for their callback or the ExpirySweeper.
+func statusQueryGateways() []string {
+	var names []string
+	for _, adapter := range gateways.All() {
+		if adapter.SupportsStatusQuery() {
+			names = append(names, adapter.Name())
+		}
+	}
+	return names
+}
+
+// Run polls until ctx is cancelled
+func (p *StatusPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.settings.Interval)
+	defer ticker.Stop()
+
+	log.Printf("Status poller started (running every %s)", p.settings.Interval)
+	for {
+		if err := p.RunOnce(ctx); err != nil {
+			log.Printf("Status poller failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Status poller stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce polls every submitted or in-doubt transaction that is due and whose gateway can be asked
+func (p *StatusPoller) RunOnce(ctx context.Context) error {
+	gatewayNames := p.gatewayNames()
+	if len(gatewayNames) == 0 {
+		return nil
+	}
+
+	for {
+		transactions, err := p.repo.ClaimDuePolls(ctx, p.now(), p.settings.Policy, gatewayNames, p.settings.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, transaction := range transactions {
+			p.poll(ctx, transaction)
+		}
+
+		if len(transactions) < p.settings.BatchSize {
+			return nil
+		}
+	}
+}
+
+// poll asks the gateway for the status of the transaction. A transaction that could not be
+// polled, or is still in progress at the gateway, is polled again after its next interval.
+// An in-doubt transaction the gateway is working on moves to submitted.
+func (p *StatusPoller) poll(ctx context.Context, transaction models.Transaction) {
+	referenceID := transaction.ReferenceID.String()
+
+	status, err := p.querier.QueryTransactionStatus(ctx, transaction)
+	if errors.Is(err, gateways.ErrTransactionNotFound) && transaction.Status == constants.IN_DOUBT {
+		log.Printf("Gateway has no record of transaction %s, parking it for retry", referenceID)
+		p.updateStatus(ctx, referenceID, constants.RETRY, "gateway confirmed the transaction does not exist")
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, gateways.ErrStatusQueryUnsupported) {
+			log.Printf("Failed to poll the status of transaction %s: %v", referenceID, err)
+		}
+		return
+	}
+
+	if !utils.IsFinalStatus(status) {
+		log.Printf("Transaction %s is still %s at its gateway", referenceID, status)
+		if transaction.Status == constants.IN_DOUBT && status == constants.SUBMITTED {
+			p.updateStatus(ctx, referenceID, constants.SUBMITTED, "gateway status query")
+		}
+		return
+	}
+
+	log.Printf("Gateway reported transaction %s as %s", referenceID, status)
+	err = p.callbacks.TransactionCallback(ctx, &models.TransactionCallbackRequest{
+		ReferenceID: referenceID,
+		Amount:      transaction.Amount,
+		Currency:    transaction.Currency,
+		Status:      status,
+	})
+	if err != nil {
+		log.Printf("Failed to apply the polled status of transaction %s: %v", referenceID, err)
+	}
+}
+
+func (p *StatusPoller) updateStatus(ctx context.Context, referenceID, status, reason string) {
+	if err := p.transactionRepo.UpdateTransactionStatusByReferenceID(ctx, referenceID, status, reason); err != nil {
+		log.Printf("Failed to move transaction %s to %s: %v", referenceID, status, err)
+	}
+}
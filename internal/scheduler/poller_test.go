@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/gateways/gatewaya"
+	"payment-gateway/internal/gateways/gatewayb"
+	mocksRepository "payment-gateway/mocks/repositories"
+	mocksService "payment-gateway/mocks/services"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/google/uuid"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("StatusPoller", func() {
+	var (
+		mockRepo            *mocksRepository.MockTransactionPollRepository
+		mockTransactionRepo *mocksRepository.TransactionRepository
+		mockService         *mocksService.TransactionService
+		querier             *fakeStatusQuerier
+		settings            PollSettings
+		poller              *StatusPoller
+		ctx                 context.Context
+		now                 time.Time
+		transaction         models.Transaction
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		mockRepo = new(mocksRepository.MockTransactionPollRepository)
+		mockTransactionRepo = new(mocksRepository.TransactionRepository)
+		mockService = new(mocksService.TransactionService)
+		querier = &fakeStatusQuerier{status: constants.COMPLETED}
+		settings = PollSettings{
+			Interval:  time.Minute,
+			BatchSize: 2,
+			Policy: models.PollPolicy{
+				Delay:       5 * time.Minute,
+				MinInterval: time.Minute,
+				MaxInterval: time.Hour,
+			},
+		}
+		poller = NewStatusPoller(mockRepo, mockTransactionRepo, querier, mockService, settings)
+		poller.now = func() time.Time { return now }
+		poller.gatewayNames = func() []string { return []string{"A"} }
+
+		transaction = models.Transaction{ID: 1, ReferenceID: uuid.New(), Amount: 100, Currency: "USD", Status: constants.SUBMITTED, GatewayID: 1}
+	})
+
+	ginkgo.Describe("RunOnce", func() {
+		ginkgo.It("should apply a final status through the callback path", func() {
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction}, nil).Once()
+			mockService.On("TransactionCallback", ctx, &models.TransactionCallbackRequest{
+				ReferenceID: transaction.ReferenceID.String(),
+				Amount:      100,
+				Currency:    "USD",
+				Status:      constants.COMPLETED,
+			}).Return(nil).Once()
+
+			err := poller.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockService.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should leave transactions still in progress at the gateway for the next poll", func() {
+			querier.status = constants.SUBMITTED
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction}, nil).Once()
+
+			err := poller.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "TransactionCallback", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should skip transactions whose gateway cannot be asked or fails", func() {
+			querier.err = gateways.ErrStatusQueryUnsupported
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction}, nil).Once()
+
+			gomega.Expect(poller.RunOnce(ctx)).To(gomega.Succeed())
+
+			querier.err = errors.New("connection refused")
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction}, nil).Once()
+
+			gomega.Expect(poller.RunOnce(ctx)).To(gomega.Succeed())
+			gomega.Expect(querier.calls).To(gomega.Equal(2))
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "TransactionCallback", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should park an in-doubt transaction for retry once its gateway has no record of it", func() {
+			transaction.Status = constants.IN_DOUBT
+			querier.err = fmt.Errorf("gateway A: %w", gateways.ErrTransactionNotFound)
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction}, nil).Once()
+			mockTransactionRepo.On("UpdateTransactionStatusByReferenceID", ctx, transaction.ReferenceID.String(), constants.RETRY, "gateway confirmed the transaction does not exist").Return(nil).Once()
+
+			err := poller.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockTransactionRepo.AssertExpectations(ginkgo.GinkgoT())
+			mockService.AssertNotCalled(ginkgo.GinkgoT(), "TransactionCallback", mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should move an in-doubt transaction the gateway is working on to submitted", func() {
+			transaction.Status = constants.IN_DOUBT
+			querier.status = constants.SUBMITTED
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction}, nil).Once()
+			mockTransactionRepo.On("UpdateTransactionStatusByReferenceID", ctx, transaction.ReferenceID.String(), constants.SUBMITTED, "gateway status query").Return(nil).Once()
+
+			err := poller.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockTransactionRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should not retry a submitted transaction the gateway has no record of", func() {
+			querier.err = gateways.ErrTransactionNotFound
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction}, nil).Once()
+
+			gomega.Expect(poller.RunOnce(ctx)).To(gomega.Succeed())
+			mockTransactionRepo.AssertNotCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should keep claiming while full batches come back", func() {
+			second := transaction
+			second.ID = 2
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{transaction, second}, nil).Once()
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return([]models.Transaction{}, nil).Once()
+			mockService.On("TransactionCallback", ctx, mock.Anything).Return(errors.New("transition rejected")).Twice()
+
+			err := poller.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockRepo.AssertExpectations(ginkgo.GinkgoT())
+			mockService.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should return error when the due transactions cannot be claimed", func() {
+			mockRepo.On("ClaimDuePolls", ctx, now, settings.Policy, []string{"A"}, 2).Return(nil, errors.New("database error")).Once()
+
+			err := poller.RunOnce(ctx)
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should not claim anything when no gateway can be asked", func() {
+			poller.gatewayNames = func() []string { return nil }
+
+			err := poller.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "ClaimDuePolls", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	})
+
+	ginkgo.Describe("statusQueryGateways", func() {
+		ginkgo.It("should only name the gateways that can be asked for a status", func() {
+			gateways.Register(gatewaya.New(models.GatewayConfig{GatewayUrl: "http://gateway-a"}))
+			gateways.Register(gatewayb.New(models.GatewayConfig{GatewayUrl: "http://gateway-b"}))
+
+			names := statusQueryGateways()
+
+			gomega.Expect(names).To(gomega.ContainElement("A"))
+			gomega.Expect(names).NotTo(gomega.ContainElement("B"))
+		})
+	})
+})
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"payment-gateway/internal/kafka"
+	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/utils"
+)
+
+type RetrySettings struct {
+	Interval  time.Duration // pause between runs
+	BatchSize int           // transactions claimed per query
+	Policy    models.RetryPolicy
+}
+
+// RetrySettingsFromEnv reads the retry scheduler settings from RETRY_* environment variables
+func RetrySettingsFromEnv() RetrySettings {
+	return RetrySettings{
+		Interval:  utils.GetEnvDuration("RETRY_SCHEDULER_INTERVAL", 30*time.Second),
+		BatchSize: utils.GetEnvInt("RETRY_SCHEDULER_BATCH_SIZE", 100),
+		Policy: models.RetryPolicy{
+			MaxRetries: utils.GetEnvInt("RETRY_MAX_ATTEMPTS", 5),
+			MaxAge:     utils.GetEnvDuration("RETRY_MAX_AGE", 24*time.Hour),
+			MinBackoff: utils.GetEnvDuration("RETRY_MIN_BACKOFF", time.Minute),
+			MaxBackoff: utils.GetEnvDuration("RETRY_MAX_BACKOFF", time.Hour),
+		},
+	}
+}
+
+// RetryScheduler enqueues transactions parked in retry again once their backoff has passed, and
+// fails them once they used up their retries. Claims skip rows locked by other replicas, so every
+// replica can run a scheduler.
+type RetryScheduler struct {
+	repo     repositories.ITransactionRetryRepository
+	settings RetrySettings
+	now      func() time.Time
+}
+
+func NewRetryScheduler(repo repositories.ITransactionRetryRepository, settings RetrySettings) *RetryScheduler {
+	return &RetryScheduler{
+		repo:     repo,
+		settings: settings,
+		now:      time.Now,
+	}
+}
+
+// Run schedules retries until ctx is cancelled
+func (s *RetryScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.settings.Interval)
+	defer ticker.Stop()
+
+	log.Printf("Retry scheduler started (running every %s)", s.settings.Interval)
+	for {
+		if err := s.RunOnce(ctx); err != nil {
+			log.Printf("Retry scheduler failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Retry scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce fails the exhausted transactions, then enqueues every transaction that is due
+func (s *RetryScheduler) RunOnce(ctx context.Context) error {
+	for {
+		failed, err := s.repo.FailExhaustedRetries(ctx, s.now(), s.settings.Policy, s.settings.BatchSize)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			log.Printf("Retry scheduler failed %d transaction(s) that used up their retries", failed)
+		}
+		if failed < int64(s.settings.BatchSize) {
+			break
+		}
+	}
+
+	for {
+		transactions, err := s.repo.ClaimDueRetries(ctx, s.now(), s.settings.Policy, s.settings.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range transactions {
+			transaction := &transactions[i]
+			// a transaction that cannot be queued is claimed again after its next backoff
+			if err := s.repo.RequeueTransaction(ctx, transaction, kafka.SendTransactionKafkaTopic, s.now()); err != nil {
+				log.Printf("Failed to RequeueTransaction %s: %v", transaction.ReferenceID, err)
+				continue
+			}
+			log.Printf("Retry scheduler enqueued transaction %s again", transaction.ReferenceID)
+		}
+
+		if len(transactions) < s.settings.BatchSize {
+			return nil
+		}
+	}
+}
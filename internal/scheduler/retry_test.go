@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payment-gateway/internal/kafka"
+	mocksRepository "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+
+	"github.com/google/uuid"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestScheduler(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Scheduler Suite")
+}
+
+var _ = ginkgo.Describe("RetryScheduler", func() {
+	var (
+		mockRepo  *mocksRepository.MockTransactionRetryRepository
+		scheduler *RetryScheduler
+		ctx       context.Context
+		now       time.Time
+		policy    models.RetryPolicy
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		policy = models.RetryPolicy{
+			MaxRetries: 5,
+			MaxAge:     24 * time.Hour,
+			MinBackoff: time.Minute,
+			MaxBackoff: time.Hour,
+		}
+
+		mockRepo = new(mocksRepository.MockTransactionRetryRepository)
+		scheduler = NewRetryScheduler(mockRepo, RetrySettings{
+			Interval:  time.Minute,
+			BatchSize: 2,
+			Policy:    policy,
+		})
+		scheduler.now = func() time.Time { return now }
+	})
+
+	ginkgo.Describe("RunOnce", func() {
+		ginkgo.It("should fail the exhausted transactions and requeue the due ones", func() {
+			due := []models.Transaction{{ID: 1, ReferenceID: uuid.New()}}
+			mockRepo.On("FailExhaustedRetries", ctx, now, policy, 2).Return(int64(1), nil).Once()
+			mockRepo.On("ClaimDueRetries", ctx, now, policy, 2).Return(due, nil).Once()
+			mockRepo.On("RequeueTransaction", ctx, &due[0], kafka.SendTransactionKafkaTopic, now).Return(nil).Once()
+
+			err := scheduler.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should keep claiming while full batches come back", func() {
+			first := []models.Transaction{{ID: 1, ReferenceID: uuid.New()}, {ID: 2, ReferenceID: uuid.New()}}
+			mockRepo.On("FailExhaustedRetries", ctx, now, policy, 2).Return(int64(2), nil).Once()
+			mockRepo.On("FailExhaustedRetries", ctx, now, policy, 2).Return(int64(0), nil).Once()
+			mockRepo.On("ClaimDueRetries", ctx, now, policy, 2).Return(first, nil).Once()
+			mockRepo.On("ClaimDueRetries", ctx, now, policy, 2).Return([]models.Transaction{}, nil).Once()
+			mockRepo.On("RequeueTransaction", ctx, mock.Anything, kafka.SendTransactionKafkaTopic, now).Return(nil).Twice()
+
+			err := scheduler.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should requeue the other transactions when one cannot be queued", func() {
+			due := []models.Transaction{{ID: 1, ReferenceID: uuid.New()}}
+			mockRepo.On("FailExhaustedRetries", ctx, now, policy, 2).Return(int64(0), nil).Once()
+			mockRepo.On("ClaimDueRetries", ctx, now, policy, 2).Return(due, nil).Once()
+			mockRepo.On("RequeueTransaction", ctx, &due[0], kafka.SendTransactionKafkaTopic, now).Return(errors.New("database error")).Once()
+
+			err := scheduler.RunOnce(ctx)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should return error when the exhausted transactions cannot be failed", func() {
+			mockRepo.On("FailExhaustedRetries", ctx, now, policy, 2).Return(int64(0), errors.New("database error")).Once()
+
+			err := scheduler.RunOnce(ctx)
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "ClaimDueRetries", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should return error when the due transactions cannot be claimed", func() {
+			mockRepo.On("FailExhaustedRetries", ctx, now, policy, 2).Return(int64(0), nil).Once()
+			mockRepo.On("ClaimDueRetries", ctx, now, policy, 2).Return(nil, errors.New("database error")).Once()
+
+			err := scheduler.RunOnce(ctx)
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+})
@@ -2,21 +2,134 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"payment-gateway/internal/client"
+	"payment-gateway/internal/gateways"
 	"payment-gateway/internal/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"time"
+)
+
+const (
+	healthReportEvents = 50 // health events listed in a health report
+	uptimeHistory      = 30 * 24 * time.Hour
 )
 
 type GatewayService struct {
-	gatewayRepository repositories.IGatewayRepository
+	gatewayRepository     repositories.IGatewayRepository
+	maintenanceRepository repositories.IGatewayMaintenanceRepository
+	transactionClient     client.ITransactionClient
+	now                   func() time.Time
 }
 
 func NewGatewayService(
 	gatewayRepository repositories.IGatewayRepository,
+	maintenanceRepository repositories.IGatewayMaintenanceRepository,
+	transactionClient client.ITransactionClient,
 ) *GatewayService {
 	return &GatewayService{
-		gatewayRepository: gatewayRepository,
+		gatewayRepository:     gatewayRepository,
+		maintenanceRepository: maintenanceRepository,
+		transactionClient:     transactionClient,
+		now:                   time.Now,
+	}
+}
+
+// QueryTransactionStatus asks the gateway the transaction was submitted to for its status.
+// gateways.ErrStatusQueryUnsupported is returned when that gateway cannot be asked.
+func (g *GatewayService) QueryTransactionStatus(ctx context.Context, transaction models.Transaction) (string, error) {
+	gateway, err := g.gatewayRepository.GetGatewayByID(ctx, transaction.GatewayID)
+	if err != nil {
+		return "", fmt.Errorf("[service-QueryTransactionStatus] Error while GetGatewayByID = %w", err)
+	}
+
+	adapter, err := gateways.Get(gateway.Name)
+	if err != nil {
+		return "", gateways.NewInternalError(gateway.Name, err)
 	}
+
+	return g.transactionClient.QueryTransactionStatus(ctx, transaction.ReferenceID.String(), adapter)
 }
 
-func (g *GatewayService) UpdateGatewayHealthStatusByID(ctx context.Context, gatewayID int, status string) error {
-	return g.gatewayRepository.UpdateHealthStatus(ctx, gatewayID, status)
+// GetGatewayHealthReport returns the current health of a gateway, its latest health events and its uptime
+// over the last hour, day and 30 days. sql.ErrNoRows is returned when the gateway does not exist.
+func (g *GatewayService) GetGatewayHealthReport(ctx context.Context, gatewayID int) (models.GatewayHealthReport, error) {
+	gateway, err := g.gatewayRepository.GetGatewayByID(ctx, gatewayID)
+	if err != nil {
+		return models.GatewayHealthReport{}, fmt.Errorf("[service-GetGatewayHealthReport] Error while GetGatewayByID = %w", err)
+	}
+
+	health, err := g.gatewayRepository.GetHealth(ctx, gatewayID)
+	if err != nil {
+		return models.GatewayHealthReport{}, fmt.Errorf("[service-GetGatewayHealthReport] Error while GetHealth = %w", err)
+	}
+
+	events, err := g.gatewayRepository.GetHealthEvents(ctx, gatewayID, healthReportEvents)
+	if err != nil {
+		return models.GatewayHealthReport{}, fmt.Errorf("[service-GetGatewayHealthReport] Error while GetHealthEvents = %w", err)
+	}
+
+	now := g.now()
+	changes, err := g.gatewayRepository.GetHealthStatusChanges(ctx, gatewayID, now.Add(-uptimeHistory))
+	if err != nil {
+		return models.GatewayHealthReport{}, fmt.Errorf("[service-GetGatewayHealthReport] Error while GetHealthStatusChanges = %w", err)
+	}
+
+	return models.GatewayHealthReport{
+		GatewayHealth: health,
+		Name:          gateway.Name,
+		Uptime: models.GatewayUptime{
+			LastHour:   uptime(health.HealthStatus, changes, gateway.CreatedAt, now.Add(-time.Hour), now),
+			LastDay:    uptime(health.HealthStatus, changes, gateway.CreatedAt, now.Add(-24*time.Hour), now),
+			Last30Days: uptime(health.HealthStatus, changes, gateway.CreatedAt, now.Add(-uptimeHistory), now),
+		},
+		Events: events,
+	}, nil
+}
+
+// uptime returns the percentage of the time between from and to a gateway spent routable, worked out
+// from its status changes (oldest first) and its current status. Time before the gateway was created and
+// time in maintenance are left out; nil is returned when nothing is left.
+func uptime(currentStatus string, changes []models.GatewayHealthEvent, createdAt, from, to time.Time) *float64 {
+	if from.Before(createdAt) {
+		from = createdAt
+	}
+
+	// The status at from is the one set by the last change before it, or the one the first change left
+	status := currentStatus
+	if len(changes) > 0 && changes[0].PreviousStatus != nil {
+		status = *changes[0].PreviousStatus
+	}
+
+	var up, counted time.Duration
+	since := from
+	add := func(until time.Time) {
+		if !until.After(since) {
+			return
+		}
+		if status != constants.MAINTENANCE {
+			counted += until.Sub(since)
+			if status == constants.HEALTHY || status == constants.DEGRADED {
+				up += until.Sub(since)
+			}
+		}
+		since = until
+	}
+
+	for _, change := range changes {
+		if change.CreatedAt.After(to) {
+			break
+		}
+		add(change.CreatedAt)
+		status = change.HealthStatus
+	}
+	add(to)
+
+	if counted == 0 {
+		return nil
+	}
+	percentage := math.Round(10000*float64(up)/float64(counted)) / 100
+	return &percentage
 }
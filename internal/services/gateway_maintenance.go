@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"payment-gateway/internal/health"
+	"payment-gateway/models"
+)
+
+// ErrInvalidMaintenanceWindow is returned when a maintenance window to create has no sensible time range
+var ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+
+// CreateMaintenanceWindow schedules a window in which the gateway is left out of routing, in every country
+// or in the country of the request. sql.ErrNoRows is returned when the gateway does not exist.
+func (g *GatewayService) CreateMaintenanceWindow(ctx context.Context, gatewayID int, request models.GatewayMaintenanceWindowRequest) (models.GatewayMaintenanceWindow, error) {
+	switch {
+	case request.StartsAt.IsZero() || request.EndsAt.IsZero():
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("%w: starts_at and ends_at are required", ErrInvalidMaintenanceWindow)
+	case !request.EndsAt.After(request.StartsAt):
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidMaintenanceWindow)
+	case !request.EndsAt.After(g.now()):
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("%w: ends_at is in the past", ErrInvalidMaintenanceWindow)
+	case request.CountryID != nil && *request.CountryID <= 0:
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("%w: invalid country_id", ErrInvalidMaintenanceWindow)
+	}
+
+	if _, err := g.gatewayRepository.GetGatewayByID(ctx, gatewayID); err != nil {
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("[service-CreateMaintenanceWindow] Error while GetGatewayByID = %w", err)
+	}
+
+	// gateway_maintenance_windows stores times without a time zone, they are kept in UTC
+	window := models.GatewayMaintenanceWindow{
+		GatewayID: gatewayID,
+		CountryID: request.CountryID,
+		StartsAt:  request.StartsAt.UTC(),
+		EndsAt:    request.EndsAt.UTC(),
+		Reason:    request.Reason,
+	}
+	if err := g.maintenanceRepository.InsertMaintenanceWindow(ctx, &window); err != nil {
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("[service-CreateMaintenanceWindow] Error while InsertMaintenanceWindow = %w", err)
+	}
+
+	return window, nil
+}
+
+// GetMaintenanceWindows returns the running and upcoming maintenance windows of a gateway.
+// sql.ErrNoRows is returned when the gateway does not exist.
+func (g *GatewayService) GetMaintenanceWindows(ctx context.Context, gatewayID int) ([]models.GatewayMaintenanceWindow, error) {
+	if _, err := g.gatewayRepository.GetGatewayByID(ctx, gatewayID); err != nil {
+		return nil, fmt.Errorf("[service-GetMaintenanceWindows] Error while GetGatewayByID = %w", err)
+	}
+
+	windows, err := g.maintenanceRepository.GetMaintenanceWindows(ctx, gatewayID, g.now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("[service-GetMaintenanceWindows] Error while GetMaintenanceWindows = %w", err)
+	}
+
+	return windows, nil
+}
+
+// CancelMaintenanceWindow calls off a running or upcoming maintenance window of a gateway, which is routed
+// to again right away. sql.ErrNoRows is returned when the gateway has no such window.
+func (g *GatewayService) CancelMaintenanceWindow(ctx context.Context, gatewayID int, windowID int) (models.GatewayMaintenanceWindow, error) {
+	window, err := g.maintenanceRepository.CancelMaintenanceWindow(ctx, gatewayID, windowID, g.now().UTC())
+	if err != nil {
+		return models.GatewayMaintenanceWindow{}, fmt.Errorf("[service-CancelMaintenanceWindow] Error while CancelMaintenanceWindow = %w", err)
+	}
+
+	return window, nil
+}
+
+// SetGatewayMaintenance puts a gateway in maintenance or takes it out, leaving it out of routing until an
+// operator takes it out again. The change is recorded in the health history of the gateway. sql.ErrNoRows
+// is returned when the gateway does not exist.
+func (g *GatewayService) SetGatewayMaintenance(ctx context.Context, gatewayID int, inMaintenance bool, reason string) (models.GatewayHealth, error) {
+	if reason == "" {
+		reason = "taken out of maintenance by an operator"
+		if inMaintenance {
+			reason = "put in maintenance by an operator"
+		}
+	}
+
+	var updated models.GatewayHealth
+	err := g.gatewayRepository.UpdateHealth(ctx, gatewayID, func(gatewayHealth *models.GatewayHealth) error {
+		health.SetMaintenance(gatewayHealth, inMaintenance, reason, g.now())
+		updated = *gatewayHealth
+		return nil
+	})
+	if err != nil {
+		return models.GatewayHealth{}, fmt.Errorf("[service-SetGatewayMaintenance] Error while UpdateHealth = %w", err)
+	}
+
+	return updated, nil
+}
@@ -2,62 +2,358 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/gateways/gatewaya"
+	mocksClient "payment-gateway/mocks/client"
 	mocks "payment-gateway/mocks/repositories"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
 )
 
 var _ = ginkgo.Describe("GatewayService", func() {
 	var (
-		mockRepo       *mocks.MockGatewayRepository
-		gatewayService *GatewayService
+		mockRepo            *mocks.MockGatewayRepository
+		mockMaintenanceRepo *mocks.MockGatewayMaintenanceRepository
+		mockClient          *mocksClient.MockTransactionClient
+		gatewayService      *GatewayService
 	)
 
 	ginkgo.BeforeEach(func() {
 		mockRepo = new(mocks.MockGatewayRepository)
-		gatewayService = NewGatewayService(mockRepo)
+		mockMaintenanceRepo = new(mocks.MockGatewayMaintenanceRepository)
+		mockClient = new(mocksClient.MockTransactionClient)
+		gatewayService = NewGatewayService(mockRepo, mockMaintenanceRepo, mockClient)
 	})
 
-	ginkgo.Describe("UpdateGatewayHealthStatusByID", func() {
-		ginkgo.It("should successfully update health status", func() {
-			gatewayID := 1
-			status := "healthy"
+	ginkgo.Describe("QueryTransactionStatus", func() {
+		var (
+			ctx         context.Context
+			transaction models.Transaction
+		)
 
-			mockRepo.On("UpdateHealthStatus", context.Background(), gatewayID, status).Return(nil)
+		ginkgo.BeforeEach(func() {
+			ctx = context.Background()
+			transaction = models.Transaction{ID: 1, ReferenceID: uuid.New(), GatewayID: 1, Status: constants.SUBMITTED}
+			gateways.Register(gatewaya.New(models.GatewayConfig{GatewayUrl: "http://gateway-a"}))
+		})
+
+		ginkgo.It("should ask the gateway the transaction was submitted to", func() {
+			mockRepo.On("GetGatewayByID", ctx, 1).Return(models.GatewayDetail{ID: 1, Name: gatewaya.Name}, nil)
+			mockClient.On("QueryTransactionStatus", ctx, transaction.ReferenceID.String(), mock.Anything).Return(constants.COMPLETED, nil)
 
-			err := gatewayService.UpdateGatewayHealthStatusByID(context.Background(), gatewayID, status)
+			status, err := gatewayService.QueryTransactionStatus(ctx, transaction)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateHealthStatus", context.Background(), gatewayID, status)
+			gomega.Expect(status).To(gomega.Equal(constants.COMPLETED))
 		})
 
-		ginkgo.It("should return error when no rows are affected", func() {
-			gatewayID := 2
-			status := "unhealthy"
+		ginkgo.It("should return error when the gateway does not exist", func() {
+			mockRepo.On("GetGatewayByID", ctx, 1).Return(models.GatewayDetail{}, sql.ErrNoRows)
+
+			_, err := gatewayService.QueryTransactionStatus(ctx, transaction)
 
-			mockRepo.On("UpdateHealthStatus", context.Background(), gatewayID, status).Return(errors.New("no gateway found with id"))
+			gomega.Expect(err).Should(gomega.MatchError(sql.ErrNoRows))
+			mockClient.AssertNotCalled(ginkgo.GinkgoT(), "QueryTransactionStatus", mock.Anything, mock.Anything, mock.Anything)
+		})
 
-			err := gatewayService.UpdateGatewayHealthStatusByID(context.Background(), gatewayID, status)
+		ginkgo.It("should return an internal error when the gateway has no adapter", func() {
+			mockRepo.On("GetGatewayByID", ctx, 1).Return(models.GatewayDetail{ID: 1, Name: "unknown"}, nil)
 
-			gomega.Expect(err).Should(gomega.HaveOccurred())
-			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("no gateway found with id"))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateHealthStatus", context.Background(), gatewayID, status)
+			_, err := gatewayService.QueryTransactionStatus(ctx, transaction)
+
+			gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorInternal))
+		})
+	})
+
+	ginkgo.Describe("GetGatewayHealthReport", func() {
+		var (
+			ctx     context.Context
+			now     time.Time
+			gateway models.GatewayDetail
+			health  models.GatewayHealth
+		)
+
+		statusChange := func(at time.Time, previous, status string) models.GatewayHealthEvent {
+			return models.GatewayHealthEvent{
+				GatewayID:      gateway.ID,
+				EventType:      constants.HEALTH_EVENT_STATUS_CHANGE,
+				HealthStatus:   status,
+				PreviousStatus: &previous,
+				CreatedAt:      at,
+			}
+		}
+
+		ginkgo.BeforeEach(func() {
+			ctx = context.Background()
+			now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			gatewayService.now = func() time.Time { return now }
+
+			gateway = models.GatewayDetail{ID: 1, Name: gatewaya.Name, CreatedAt: now.Add(-365 * 24 * time.Hour)}
+			health = models.GatewayHealth{GatewayID: gateway.ID, HealthStatus: constants.HEALTHY}
 		})
 
-		ginkgo.It("should return error when database query fails", func() {
-			gatewayID := 3
-			status := "healthy"
-			dbError := errors.New("database error")
+		historyIs := func(changes ...models.GatewayHealthEvent) {
+			mockRepo.On("GetGatewayByID", ctx, gateway.ID).Return(gateway, nil)
+			mockRepo.On("GetHealth", ctx, gateway.ID).Return(health, nil)
+			mockRepo.On("GetHealthEvents", ctx, gateway.ID, 50).Return([]models.GatewayHealthEvent{}, nil)
+			mockRepo.On("GetHealthStatusChanges", ctx, gateway.ID, now.Add(-30*24*time.Hour)).Return(changes, nil)
+		}
 
-			mockRepo.On("UpdateHealthStatus", context.Background(), gatewayID, status).Return(dbError)
+		ginkgo.It("should report a gateway that never changed status as fully up", func() {
+			historyIs()
 
-			err := gatewayService.UpdateGatewayHealthStatusByID(context.Background(), gatewayID, status)
+			report, err := gatewayService.GetGatewayHealthReport(ctx, gateway.ID)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(report.Name).To(gomega.Equal(gatewaya.Name))
+			gomega.Expect(report.HealthStatus).To(gomega.Equal(constants.HEALTHY))
+			gomega.Expect(report.Uptime.LastHour).To(gomega.HaveValue(gomega.Equal(100.0)))
+			gomega.Expect(report.Uptime.LastDay).To(gomega.HaveValue(gomega.Equal(100.0)))
+			gomega.Expect(report.Uptime.Last30Days).To(gomega.HaveValue(gomega.Equal(100.0)))
+		})
+
+		ginkgo.It("should work out the uptime from the status changes", func() {
+			health.HealthStatus = constants.DEGRADED
+			historyIs(
+				statusChange(now.Add(-48*time.Hour), constants.HEALTHY, constants.UNHEALTHY),
+				statusChange(now.Add(-36*time.Hour), constants.UNHEALTHY, constants.HEALTHY),
+				statusChange(now.Add(-90*time.Minute), constants.HEALTHY, constants.UNHEALTHY),
+				statusChange(now.Add(-30*time.Minute), constants.UNHEALTHY, constants.DEGRADED),
+			)
+
+			report, err := gatewayService.GetGatewayHealthReport(ctx, gateway.ID)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(report.Uptime.LastHour).To(gomega.HaveValue(gomega.Equal(50.0)))
+			gomega.Expect(report.Uptime.LastDay).To(gomega.HaveValue(gomega.Equal(95.83)))
+			gomega.Expect(report.Uptime.Last30Days).To(gomega.HaveValue(gomega.Equal(98.19)))
+		})
+
+		ginkgo.It("should leave time in maintenance out of the uptime", func() {
+			health.HealthStatus = constants.MAINTENANCE
+			historyIs(statusChange(now.Add(-2*time.Hour), constants.UNHEALTHY, constants.MAINTENANCE))
+
+			report, err := gatewayService.GetGatewayHealthReport(ctx, gateway.ID)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(report.Uptime.LastHour).To(gomega.BeNil())
+			gomega.Expect(report.Uptime.LastDay).To(gomega.HaveValue(gomega.Equal(0.0)))
+		})
+
+		ginkgo.It("should not count the time before the gateway was created", func() {
+			gateway.CreatedAt = now.Add(-2 * time.Hour)
+			historyIs(statusChange(now.Add(-time.Hour), constants.UNHEALTHY, constants.HEALTHY))
+
+			report, err := gatewayService.GetGatewayHealthReport(ctx, gateway.ID)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(report.Uptime.LastDay).To(gomega.HaveValue(gomega.Equal(50.0)))
+			gomega.Expect(report.Uptime.Last30Days).To(gomega.HaveValue(gomega.Equal(50.0)))
+		})
+
+		ginkgo.It("should return sql.ErrNoRows when the gateway does not exist", func() {
+			mockRepo.On("GetGatewayByID", ctx, 9).Return(models.GatewayDetail{}, sql.ErrNoRows)
+
+			_, err := gatewayService.GetGatewayHealthReport(ctx, 9)
+
+			gomega.Expect(err).Should(gomega.MatchError(sql.ErrNoRows))
+		})
+
+		ginkgo.It("should return error when the health history cannot be fetched", func() {
+			mockRepo.On("GetGatewayByID", ctx, gateway.ID).Return(gateway, nil)
+			mockRepo.On("GetHealth", ctx, gateway.ID).Return(health, nil)
+			mockRepo.On("GetHealthEvents", ctx, gateway.ID, 50).Return(nil, errors.New("database error"))
+
+			_, err := gatewayService.GetGatewayHealthReport(ctx, gateway.ID)
 
 			gomega.Expect(err).Should(gomega.HaveOccurred())
-			gomega.Expect(err.Error()).Should(gomega.ContainSubstring(dbError.Error()))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateHealthStatus", context.Background(), gatewayID, status)
+		})
+	})
+
+	ginkgo.Describe("Maintenance windows", func() {
+		var (
+			ctx     context.Context
+			now     time.Time
+			request models.GatewayMaintenanceWindowRequest
+		)
+
+		ginkgo.BeforeEach(func() {
+			ctx = context.Background()
+			now = time.Date(2024, 12, 22, 12, 0, 0, 0, time.UTC)
+			gatewayService.now = func() time.Time { return now }
+
+			jakarta := time.FixedZone("WIB", 7*60*60)
+			request = models.GatewayMaintenanceWindowRequest{
+				StartsAt: time.Date(2024, 12, 23, 1, 0, 0, 0, jakarta),
+				EndsAt:   time.Date(2024, 12, 23, 3, 0, 0, 0, jakarta),
+				Reason:   "database upgrade",
+			}
+		})
+
+		ginkgo.Describe("CreateMaintenanceWindow", func() {
+			ginkgo.It("should store the window in UTC", func() {
+				mockRepo.On("GetGatewayByID", ctx, 1).Return(models.GatewayDetail{ID: 1}, nil)
+				mockMaintenanceRepo.On("InsertMaintenanceWindow", ctx, mock.Anything).Return(nil)
+
+				window, err := gatewayService.CreateMaintenanceWindow(ctx, 1, request)
+
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(window.GatewayID).To(gomega.Equal(1))
+				gomega.Expect(window.CountryID).To(gomega.BeNil())
+				gomega.Expect(window.StartsAt).To(gomega.Equal(time.Date(2024, 12, 22, 18, 0, 0, 0, time.UTC)))
+				gomega.Expect(window.EndsAt).To(gomega.Equal(time.Date(2024, 12, 22, 20, 0, 0, 0, time.UTC)))
+				gomega.Expect(window.Reason).To(gomega.Equal("database upgrade"))
+			})
+
+			ginkgo.It("should scope the window to the country of the request", func() {
+				countryID := 2
+				request.CountryID = &countryID
+				mockRepo.On("GetGatewayByID", ctx, 1).Return(models.GatewayDetail{ID: 1}, nil)
+				mockMaintenanceRepo.On("InsertMaintenanceWindow", ctx, mock.MatchedBy(func(window *models.GatewayMaintenanceWindow) bool {
+					return window.CountryID != nil && *window.CountryID == countryID
+				})).Return(nil)
+
+				_, err := gatewayService.CreateMaintenanceWindow(ctx, 1, request)
+
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			})
+
+			ginkgo.DescribeTable("should reject a window without a sensible time range",
+				func(change func(request *models.GatewayMaintenanceWindowRequest)) {
+					change(&request)
+
+					_, err := gatewayService.CreateMaintenanceWindow(ctx, 1, request)
+
+					gomega.Expect(err).To(gomega.MatchError(ErrInvalidMaintenanceWindow))
+					mockMaintenanceRepo.AssertNotCalled(ginkgo.GinkgoT(), "InsertMaintenanceWindow", mock.Anything, mock.Anything)
+				},
+				ginkgo.Entry("without an end", func(request *models.GatewayMaintenanceWindowRequest) { request.EndsAt = time.Time{} }),
+				ginkgo.Entry("ending before it starts", func(request *models.GatewayMaintenanceWindowRequest) {
+					request.EndsAt = request.StartsAt.Add(-time.Minute)
+				}),
+				ginkgo.Entry("already over", func(request *models.GatewayMaintenanceWindowRequest) {
+					request.StartsAt = now.Add(-2 * time.Hour)
+					request.EndsAt = now.Add(-time.Hour)
+				}),
+				ginkgo.Entry("with an invalid country", func(request *models.GatewayMaintenanceWindowRequest) {
+					countryID := 0
+					request.CountryID = &countryID
+				}),
+			)
+
+			ginkgo.It("should return sql.ErrNoRows when the gateway does not exist", func() {
+				mockRepo.On("GetGatewayByID", ctx, 9).Return(models.GatewayDetail{}, sql.ErrNoRows)
+
+				_, err := gatewayService.CreateMaintenanceWindow(ctx, 9, request)
+
+				gomega.Expect(err).To(gomega.MatchError(sql.ErrNoRows))
+				mockMaintenanceRepo.AssertNotCalled(ginkgo.GinkgoT(), "InsertMaintenanceWindow", mock.Anything, mock.Anything)
+			})
+		})
+
+		ginkgo.Describe("GetMaintenanceWindows", func() {
+			ginkgo.It("should return the running and upcoming windows", func() {
+				windows := []models.GatewayMaintenanceWindow{{ID: 5, GatewayID: 1}}
+				mockRepo.On("GetGatewayByID", ctx, 1).Return(models.GatewayDetail{ID: 1}, nil)
+				mockMaintenanceRepo.On("GetMaintenanceWindows", ctx, 1, now).Return(windows, nil)
+
+				result, err := gatewayService.GetMaintenanceWindows(ctx, 1)
+
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(result).To(gomega.Equal(windows))
+			})
+		})
+
+		ginkgo.Describe("CancelMaintenanceWindow", func() {
+			ginkgo.It("should cancel the window now", func() {
+				mockMaintenanceRepo.On("CancelMaintenanceWindow", ctx, 1, 5, now).Return(models.GatewayMaintenanceWindow{ID: 5, CancelledAt: &now}, nil)
+
+				window, err := gatewayService.CancelMaintenanceWindow(ctx, 1, 5)
+
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(window.CancelledAt).To(gomega.HaveValue(gomega.Equal(now)))
+			})
+
+			ginkgo.It("should return sql.ErrNoRows when there is no window to cancel", func() {
+				mockMaintenanceRepo.On("CancelMaintenanceWindow", ctx, 1, 5, now).Return(models.GatewayMaintenanceWindow{}, sql.ErrNoRows)
+
+				_, err := gatewayService.CancelMaintenanceWindow(ctx, 1, 5)
+
+				gomega.Expect(err).To(gomega.MatchError(sql.ErrNoRows))
+			})
+		})
+	})
+
+	ginkgo.Describe("SetGatewayMaintenance", func() {
+		var (
+			ctx    context.Context
+			now    time.Time
+			health *models.GatewayHealth
+		)
+
+		ginkgo.BeforeEach(func() {
+			ctx = context.Background()
+			now = time.Date(2024, 12, 22, 12, 0, 0, 0, time.UTC)
+			gatewayService.now = func() time.Time { return now }
+
+			health = &models.GatewayHealth{
+				HealthStatus:  constants.HEALTHY,
+				ProbeStatus:   constants.HEALTHY,
+				TrafficStatus: constants.DEGRADED,
+			}
+		})
+
+		ginkgo.It("should put the gateway in maintenance through its health state", func() {
+			health.HealthStatus = constants.DEGRADED
+			mockRepo.On("UpdateHealth", ctx, 1).Return(health, nil).Once()
+
+			updated, err := gatewayService.SetGatewayMaintenance(ctx, 1, true, "provider outage")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(updated.HealthStatus).To(gomega.Equal(constants.MAINTENANCE))
+			gomega.Expect(updated.HealthStatusReason).To(gomega.Equal("provider outage"))
+			gomega.Expect(updated.HealthStatusChangedAt).To(gomega.HaveValue(gomega.Equal(now)))
+			mockRepo.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should give a gateway taken out of maintenance the verdict of its probes and traffic", func() {
+			health.HealthStatus = constants.MAINTENANCE
+			mockRepo.On("UpdateHealth", ctx, 1).Return(health, nil).Once()
+
+			updated, err := gatewayService.SetGatewayMaintenance(ctx, 1, false, "")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(updated.HealthStatus).To(gomega.Equal(constants.DEGRADED))
+			gomega.Expect(updated.HealthStatusReason).To(gomega.Equal("taken out of maintenance by an operator"))
+		})
+
+		ginkgo.It("should leave a gateway already in maintenance as it is", func() {
+			changedAt := now.Add(-time.Hour)
+			health.HealthStatus, health.HealthStatusReason, health.HealthStatusChangedAt = constants.MAINTENANCE, "provider outage", &changedAt
+			mockRepo.On("UpdateHealth", ctx, 1).Return(health, nil).Once()
+
+			updated, err := gatewayService.SetGatewayMaintenance(ctx, 1, true, "")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(updated.HealthStatusReason).To(gomega.Equal("provider outage"))
+			gomega.Expect(updated.HealthStatusChangedAt).To(gomega.HaveValue(gomega.Equal(changedAt)))
+		})
+
+		ginkgo.It("should return sql.ErrNoRows when the gateway does not exist", func() {
+			mockRepo.On("UpdateHealth", ctx, 9).Return(nil, fmt.Errorf("failed to lock health of gatewayID 9: %w", sql.ErrNoRows)).Once()
+
+			_, err := gatewayService.SetGatewayMaintenance(ctx, 9, true, "")
+
+			gomega.Expect(errors.Is(err, sql.ErrNoRows)).To(gomega.BeTrue())
 		})
 	})
 })
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"payment-gateway/models"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrIdempotencyKeyInProgress is returned when the first request sent with the key has not finished yet
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// withIdempotencyKey runs process once per idempotency key. A replay of the same request returns the
+// transaction of the first one, a replay with a different request is rejected with ErrIdempotencyKeyReused.
+// Requests without a key are always processed.
+func (s *TransactionService) withIdempotencyKey(
+	ctx context.Context,
+	idempotencyKey string,
+	operation string,
+	request interface{},
+	process func() (models.Transaction, error),
+) (models.Transaction, error) {
+	if idempotencyKey == "" {
+		return process()
+	}
+
+	requestHash, err := fingerprint(operation, request)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("[service-withIdempotencyKey] Error while fingerprint = %w", err)
+	}
+
+	now := time.Now()
+	reserved, err := s.IdempotencyKeyRepository.ReserveIdempotencyKey(ctx, &models.IdempotencyKey{
+		Key:         idempotencyKey,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.IdempotencyKeyRetention),
+	})
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("[service-withIdempotencyKey] Error while ReserveIdempotencyKey = %w", err)
+	}
+	if !reserved {
+		return s.replay(ctx, idempotencyKey, requestHash)
+	}
+
+	transaction, err := process()
+	if err != nil {
+		// release the key, nothing was created so the client may send the request again
+		if errDelete := s.IdempotencyKeyRepository.DeleteIdempotencyKey(ctx, idempotencyKey); errDelete != nil {
+			log.Printf("Failed to release idempotency key %s: %v", idempotencyKey, errDelete)
+		}
+		return models.Transaction{}, err
+	}
+
+	response, err := json.Marshal(transaction)
+	if err != nil {
+		log.Printf("Failed to marshal response of idempotency key %s: %v", idempotencyKey, err)
+		return transaction, nil
+	}
+	// the transaction exists already, a replay before the response is saved gets ErrIdempotencyKeyInProgress.
+	// A failure to save it is only logged, the client still gets its transaction and the key is kept,
+	// releasing it would let a retry create a second transaction.
+	if err := s.IdempotencyKeyRepository.SaveIdempotencyResponse(ctx, idempotencyKey, string(response)); err != nil {
+		log.Printf("Failed to save response of idempotency key %s for transaction %s: %v", idempotencyKey, transaction.ReferenceID, err)
+	}
+
+	return transaction, nil
+}
+
+// replay returns the transaction stored for a key that was already used
+func (s *TransactionService) replay(ctx context.Context, idempotencyKey, requestHash string) (models.Transaction, error) {
+	stored, err := s.IdempotencyKeyRepository.GetIdempotencyKey(ctx, idempotencyKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the first request failed and released the key in the meantime
+		return models.Transaction{}, ErrIdempotencyKeyInProgress
+	}
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("[service-replay] Error while GetIdempotencyKey = %w", err)
+	}
+
+	if stored.RequestHash != requestHash {
+		return models.Transaction{}, ErrIdempotencyKeyReused
+	}
+	if stored.Response == "" {
+		return models.Transaction{}, ErrIdempotencyKeyInProgress
+	}
+
+	var transaction models.Transaction
+	if err := json.Unmarshal([]byte(stored.Response), &transaction); err != nil {
+		return models.Transaction{}, fmt.Errorf("[service-replay] Error while Unmarshal = %w", err)
+	}
+
+	log.Printf("Replaying transaction %s for idempotency key %s", transaction.ReferenceID, idempotencyKey)
+	return transaction, nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the idempotency keys whose retention period has passed
+func (s *TransactionService) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	deleted, err := s.IdempotencyKeyRepository.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("[service-DeleteExpiredIdempotencyKeys] Error while DeleteExpiredIdempotencyKeys = %v", err)
+	}
+
+	return deleted, nil
+}
+
+// fingerprint hashes the operation together with the request, so the same key cannot be
+// replayed on another endpoint either
+func fingerprint(operation string, request interface{}) (string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(append([]byte(operation+":"), body...))
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -2,9 +2,7 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"payment-gateway/internal/kafka"
 	"payment-gateway/internal/repositories"
 	"payment-gateway/models"
@@ -15,21 +13,35 @@ import (
 )
 
 type TransactionService struct {
-	TransactionRepository repositories.ITransactionRepository
-	KafkaProducer         kafka.KafkaProducer
+	TransactionRepository        repositories.ITransactionRepository
+	TransactionAttemptRepository repositories.ITransactionAttemptRepository
+	IdempotencyKeyRepository     repositories.IIdempotencyKeyRepository
+	IdempotencyKeyRetention      time.Duration // how long a key maps to the transaction it created
 }
 
 func NewTransactionService(
 	transactionRepository repositories.ITransactionRepository,
-	kafkaProducer kafka.KafkaProducer,
+	transactionAttemptRepository repositories.ITransactionAttemptRepository,
+	idempotencyKeyRepository repositories.IIdempotencyKeyRepository,
+	idempotencyKeyRetention time.Duration,
 ) *TransactionService {
 	return &TransactionService{
-		TransactionRepository: transactionRepository,
-		KafkaProducer:         kafkaProducer,
+		TransactionRepository:        transactionRepository,
+		TransactionAttemptRepository: transactionAttemptRepository,
+		IdempotencyKeyRepository:     idempotencyKeyRepository,
+		IdempotencyKeyRetention:      idempotencyKeyRetention,
 	}
 }
 
-func (s *TransactionService) Deposit(ctx context.Context, request models.DepositRequest) (models.Transaction, error) {
+// Deposit creates a deposit transaction and publishes it for processing. A request sent again with
+// the same idempotency key returns the transaction created by the first one.
+func (s *TransactionService) Deposit(ctx context.Context, request models.DepositRequest, idempotencyKey string) (models.Transaction, error) {
+	return s.withIdempotencyKey(ctx, idempotencyKey, constants.DEPOSIT, request, func() (models.Transaction, error) {
+		return s.deposit(ctx, request)
+	})
+}
+
+func (s *TransactionService) deposit(ctx context.Context, request models.DepositRequest) (models.Transaction, error) {
 	transaction := &models.Transaction{
 		ReferenceID: uuid.New(),
 		Amount:      request.Amount,
@@ -42,26 +54,24 @@ func (s *TransactionService) Deposit(ctx context.Context, request models.Deposit
 		UpdatedAt:   time.Now(),
 	}
 
-	err := s.TransactionRepository.InsertTransaction(ctx, transaction)
+	// the outbox relay publishes the transaction once it is stored
+	err := s.TransactionRepository.InsertTransaction(ctx, transaction, kafka.SendTransactionKafkaTopic)
 	if err != nil {
 		return models.Transaction{}, fmt.Errorf("[service-Deposit] Error while InsertTransaction = %v", err)
 	}
 
-	messageBytes, err := json.Marshal(transaction)
-	if err != nil {
-		log.Printf("Failed to marshal Kafka message: %v", err)
-		return models.Transaction{}, fmt.Errorf("[service-Deposit] Error while Marshal = %v", err)
-	}
-
-	go func(messageBytes []byte) {
-
-		s.KafkaProducer.ProduceMessage(messageBytes, kafka.SendTransactionKafkaTopic)
-	}(messageBytes)
-
 	return *transaction, nil
 }
 
-func (s *TransactionService) Withdraw(ctx context.Context, request models.WithdrawalRequest) (models.Transaction, error) {
+// Withdraw creates a withdrawal transaction and publishes it for processing. A request sent again with
+// the same idempotency key returns the transaction created by the first one.
+func (s *TransactionService) Withdraw(ctx context.Context, request models.WithdrawalRequest, idempotencyKey string) (models.Transaction, error) {
+	return s.withIdempotencyKey(ctx, idempotencyKey, constants.WITHDRAWAL, request, func() (models.Transaction, error) {
+		return s.withdraw(ctx, request)
+	})
+}
+
+func (s *TransactionService) withdraw(ctx context.Context, request models.WithdrawalRequest) (models.Transaction, error) {
 	transaction := &models.Transaction{
 		ReferenceID: uuid.New(),
 		Amount:      request.Amount,
@@ -74,25 +84,27 @@ func (s *TransactionService) Withdraw(ctx context.Context, request models.Withdr
 		UpdatedAt:   time.Now(),
 	}
 
-	err := s.TransactionRepository.InsertTransaction(ctx, transaction)
+	// the outbox relay publishes the transaction once it is stored
+	err := s.TransactionRepository.InsertTransaction(ctx, transaction, kafka.SendTransactionKafkaTopic)
 	if err != nil {
 		return models.Transaction{}, fmt.Errorf("[service-Withdraw] Error while InsertTransaction = %v", err)
 	}
 
-	messageBytes, err := json.Marshal(transaction)
-	if err != nil {
-		log.Printf("Failed to marshal Kafka message: %v", err)
-		return models.Transaction{}, fmt.Errorf("[service-Withdraw] Error while Marshal = %v", err)
-	}
-
-	go func(messageBytes []byte) {
-
-		s.KafkaProducer.ProduceMessage(messageBytes, kafka.SendTransactionKafkaTopic)
-	}(messageBytes)
-
 	return *transaction, nil
 }
 
+// TransactionCallback applies the status reported by a gateway. A status the transaction cannot
+// move to is returned as a *utils.TransitionError.
 func (s *TransactionService) TransactionCallback(ctx context.Context, request *models.TransactionCallbackRequest) error {
-	return s.TransactionRepository.UpdateTransactionStatusByReferenceID(ctx, request.ReferenceID, request.Status)
+	return s.TransactionRepository.UpdateTransactionStatusByReferenceID(ctx, request.ReferenceID, request.Status, "gateway callback")
+}
+
+// GetTransactionAttempts returns every request sent to a gateway for the transaction
+func (s *TransactionService) GetTransactionAttempts(ctx context.Context, referenceID string) ([]models.TransactionAttempt, error) {
+	attempts, err := s.TransactionAttemptRepository.GetAttemptsByReferenceID(ctx, referenceID)
+	if err != nil {
+		return nil, fmt.Errorf("[service-GetTransactionAttempts] Error while GetAttemptsByReferenceID = %v", err)
+	}
+
+	return attempts, nil
 }
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"payment-gateway/models"
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 100
+)
+
+// ErrInvalidCursor is returned when the cursor of a transaction search was not issued by SearchTransactions
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// GetTransaction returns the transaction with the given reference ID, sql.ErrNoRows when it does not exist
+func (s *TransactionService) GetTransaction(ctx context.Context, referenceID string) (models.Transaction, error) {
+	transaction, err := s.TransactionRepository.GetTransactionByReferenceID(ctx, referenceID)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("[service-GetTransaction] Error while GetTransactionByReferenceID = %w", err)
+	}
+
+	return transaction, nil
+}
+
+// SearchTransactions returns a page of the transactions matching the filter, newest first.
+// The page's NextCursor is passed back in the filter to fetch the next page.
+func (s *TransactionService) SearchTransactions(ctx context.Context, filter models.TransactionFilter) (models.TransactionPage, error) {
+	afterID, err := decodeCursor(filter.Cursor)
+	if err != nil {
+		return models.TransactionPage{}, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = DefaultSearchLimit
+	}
+
+	// one extra row tells whether there is a next page
+	transactions, err := s.TransactionRepository.SearchTransactions(ctx, filter, afterID, limit+1)
+	if err != nil {
+		return models.TransactionPage{}, fmt.Errorf("[service-SearchTransactions] Error while SearchTransactions = %v", err)
+	}
+
+	page := models.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = encodeCursor(page.Transactions[limit-1].ID)
+	}
+
+	return page, nil
+}
+
+// the cursor is the ID of the last transaction of the previous page
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(string(decoded))
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
@@ -3,13 +3,12 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"sync"
 	"testing"
 	"time"
 
 	"payment-gateway/internal/kafka"
-	mockKafka "payment-gateway/mocks/kafka"
 	mocksRepository "payment-gateway/mocks/repositories"
 	"payment-gateway/pkg/constants"
 
@@ -29,14 +28,16 @@ func TestTransactionService(t *testing.T) {
 var _ = ginkgo.Describe("TransactionService", func() {
 	var (
 		mockRepo           *mocksRepository.TransactionRepository
-		mockKafkaProducer  *mockKafka.MockKafkaProducer
+		mockAttemptRepo    *mocksRepository.MockTransactionAttemptRepository
+		mockIdempotentRepo *mocksRepository.MockIdempotencyKeyRepository
 		transactionService *TransactionService
 	)
 
 	ginkgo.BeforeEach(func() {
 		mockRepo = new(mocksRepository.TransactionRepository)
-		mockKafkaProducer = new(mockKafka.MockKafkaProducer)
-		transactionService = NewTransactionService(mockRepo, mockKafkaProducer)
+		mockAttemptRepo = new(mocksRepository.MockTransactionAttemptRepository)
+		mockIdempotentRepo = new(mocksRepository.MockIdempotencyKeyRepository)
+		transactionService = NewTransactionService(mockRepo, mockAttemptRepo, mockIdempotentRepo, time.Hour)
 	})
 
 	ginkgo.Describe("Deposit", func() {
@@ -59,17 +60,15 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				gomega.Expect(tx.CreatedAt).NotTo(gomega.BeZero())
 				gomega.Expect(tx.UpdatedAt).NotTo(gomega.BeZero())
 				return true
-			})).Return(nil)
+			}), kafka.SendTransactionKafkaTopic).Return(nil)
 
-			mockKafkaProducer.On("ProduceMessage", mock.Anything, kafka.SendTransactionKafkaTopic).Return(nil)
-
-			result, err := transactionService.Deposit(context.Background(), request)
+			result, err := transactionService.Deposit(context.Background(), request, "")
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(result.Amount).Should(gomega.Equal(request.Amount))
 			gomega.Expect(result.Currency).Should(gomega.Equal(request.Currency))
 			gomega.Expect(result.Type).Should(gomega.Equal(constants.DEPOSIT))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"))
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic)
 		})
 
 		ginkgo.It("should return error when InsertTransaction fails", func() {
@@ -84,17 +83,17 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				gomega.Expect(tx.Amount).To(gomega.Equal(request.Amount))
 				gomega.Expect(tx.Currency).To(gomega.Equal(request.Currency))
 				return true
-			})).Return(errors.New("insert error"))
+			}), kafka.SendTransactionKafkaTopic).Return(errors.New("insert error"))
 
-			result, err := transactionService.Deposit(context.Background(), request)
+			result, err := transactionService.Deposit(context.Background(), request, "")
 
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(result).Should(gomega.Equal(models.Transaction{}))
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("insert error"))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"))
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic)
 		})
 
-		ginkgo.It("should invoke Kafka producer even if it fails", func() {
+		ginkgo.It("should queue the transaction for publication instead of publishing it", func() {
 			request := models.DepositRequest{
 				Amount:    1000,
 				Currency:  "USD",
@@ -102,38 +101,13 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				UserID:    123,
 			}
 
-			transaction := models.Transaction{
-				ReferenceID: uuid.New(),
-				Amount:      request.Amount,
-				Currency:    request.Currency,
-				Type:        constants.DEPOSIT,
-				Status:      constants.PENDING,
-				CountryID:   request.CountryID,
-				UserID:      request.UserID,
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			}
+			mockRepo.On("InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic).Return(nil)
 
-			var wg sync.WaitGroup
-			wg.Add(1)
+			result, err := transactionService.Deposit(context.Background(), request, "")
 
-			mockRepo.On("InsertTransaction", mock.Anything, mock.MatchedBy(func(tx *models.Transaction) bool {
-				tx.ReferenceID = transaction.ReferenceID
-				return true
-			})).Return(nil)
-
-			mockKafkaProducer.On("ProduceMessage", mock.Anything, kafka.SendTransactionKafkaTopic).Run(func(args mock.Arguments) {
-				wg.Done()
-			}).Return(errors.New("kafka error"))
-
-			result, err := transactionService.Deposit(context.Background(), request)
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
-
-			wg.Wait()
-
-			gomega.Expect(result.Amount).Should(gomega.Equal(request.Amount))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"))
-			mockKafkaProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessage", mock.Anything, kafka.SendTransactionKafkaTopic)
+			gomega.Expect(result.Type).Should(gomega.Equal(constants.DEPOSIT))
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic)
 		})
 	})
 
@@ -157,17 +131,15 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				gomega.Expect(tx.CreatedAt).NotTo(gomega.BeZero())
 				gomega.Expect(tx.UpdatedAt).NotTo(gomega.BeZero())
 				return true
-			})).Return(nil)
+			}), kafka.SendTransactionKafkaTopic).Return(nil)
 
-			mockKafkaProducer.On("ProduceMessage", mock.Anything, kafka.SendTransactionKafkaTopic).Return(nil)
-
-			result, err := transactionService.Withdraw(context.Background(), request)
+			result, err := transactionService.Withdraw(context.Background(), request, "")
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(result.Amount).Should(gomega.Equal(request.Amount))
 			gomega.Expect(result.Currency).Should(gomega.Equal(request.Currency))
 			gomega.Expect(result.Type).Should(gomega.Equal(constants.WITHDRAWAL))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"))
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic)
 		})
 
 		ginkgo.It("should return error when InsertTransaction fails", func() {
@@ -182,17 +154,17 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				gomega.Expect(tx.Amount).To(gomega.Equal(request.Amount))
 				gomega.Expect(tx.Currency).To(gomega.Equal(request.Currency))
 				return true
-			})).Return(errors.New("insert error"))
+			}), kafka.SendTransactionKafkaTopic).Return(errors.New("insert error"))
 
-			result, err := transactionService.Withdraw(context.Background(), request)
+			result, err := transactionService.Withdraw(context.Background(), request, "")
 
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(result).Should(gomega.Equal(models.Transaction{}))
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("insert error"))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"))
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic)
 		})
 
-		ginkgo.It("should invoke Kafka producer even if it fails", func() {
+		ginkgo.It("should queue the transaction for publication instead of publishing it", func() {
 			request := models.WithdrawalRequest{
 				Amount:    1000,
 				Currency:  "USD",
@@ -200,41 +172,13 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				UserID:    123,
 			}
 
-			transaction := models.Transaction{
-				ReferenceID: uuid.New(),
-				Amount:      request.Amount,
-				Currency:    request.Currency,
-				Type:        constants.WITHDRAWAL,
-				Status:      constants.PENDING,
-				CountryID:   request.CountryID,
-				UserID:      request.UserID,
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			}
-
-			// Use a WaitGroup to wait for the goroutine
-			var wg sync.WaitGroup
-			wg.Add(1)
+			mockRepo.On("InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic).Return(nil)
 
-			// Mock repository behavior
-			mockRepo.On("InsertTransaction", mock.Anything, mock.MatchedBy(func(tx *models.Transaction) bool {
-				// Ensure the transaction contains expected values
-				tx.ReferenceID = transaction.ReferenceID
-				return true
-			})).Return(nil)
-
-			mockKafkaProducer.On("ProduceMessage", mock.Anything, kafka.SendTransactionKafkaTopic).Run(func(args mock.Arguments) {
-				wg.Done()
-			}).Return(errors.New("kafka error"))
-
-			result, err := transactionService.Withdraw(context.Background(), request)
-
-			wg.Wait()
+			result, err := transactionService.Withdraw(context.Background(), request, "")
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
-			gomega.Expect(result.Amount).Should(gomega.Equal(request.Amount))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"))
-			mockKafkaProducer.AssertCalled(ginkgo.GinkgoT(), "ProduceMessage", mock.Anything, kafka.SendTransactionKafkaTopic)
+			gomega.Expect(result.Type).Should(gomega.Equal(constants.WITHDRAWAL))
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic)
 		})
 	})
 
@@ -245,12 +189,12 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				Status:      "success",
 			}
 
-			mockRepo.On("UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status).Return(nil)
+			mockRepo.On("UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status, "gateway callback").Return(nil)
 
 			err := transactionService.TransactionCallback(context.Background(), request)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status)
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status, "gateway callback")
 		})
 
 		ginkgo.It("should return error when UpdateTransactionStatusByReferenceID fails", func() {
@@ -259,13 +203,13 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				Status:      "failed",
 			}
 
-			mockRepo.On("UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status).Return(errors.New("update error"))
+			mockRepo.On("UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status, "gateway callback").Return(errors.New("update error"))
 
 			err := transactionService.TransactionCallback(context.Background(), request)
 
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("update error"))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status)
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status, "gateway callback")
 		})
 
 		ginkgo.It("should return error when no rows are affected", func() {
@@ -274,14 +218,204 @@ var _ = ginkgo.Describe("TransactionService", func() {
 				Status:      "success",
 			}
 
-			mockRepo.On("UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status).Return(sql.ErrNoRows)
+			mockRepo.On("UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status, "gateway callback").Return(sql.ErrNoRows)
 
 			err := transactionService.TransactionCallback(context.Background(), request)
 
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err).Should(gomega.Equal(sql.ErrNoRows))
-			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status)
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "UpdateTransactionStatusByReferenceID", mock.Anything, request.ReferenceID, request.Status, "gateway callback")
+		})
+
+	})
+	ginkgo.Describe("Idempotency-Key", func() {
+		var request models.DepositRequest
+
+		ginkgo.BeforeEach(func() {
+			request = models.DepositRequest{
+				Amount:    1000,
+				Currency:  "USD",
+				CountryID: 1,
+				UserID:    123,
+			}
+		})
+
+		ginkgo.It("should store the response of the first request sent with the key", func() {
+			requestHash, _ := fingerprint(constants.DEPOSIT, request)
+
+			mockIdempotentRepo.On("ReserveIdempotencyKey", mock.Anything, mock.MatchedBy(func(key *models.IdempotencyKey) bool {
+				return key.Key == "key-1" && key.RequestHash == requestHash && key.ExpiresAt.Sub(key.CreatedAt) == time.Hour
+			})).Return(true, nil)
+			mockRepo.On("InsertTransaction", mock.Anything, mock.AnythingOfType("*models.Transaction"), kafka.SendTransactionKafkaTopic).Return(nil)
+			mockIdempotentRepo.On("SaveIdempotencyResponse", mock.Anything, "key-1", mock.AnythingOfType("string")).Return(nil)
+
+			result, err := transactionService.Deposit(context.Background(), request, "key-1")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockIdempotentRepo.AssertCalled(ginkgo.GinkgoT(), "SaveIdempotencyResponse", mock.Anything, "key-1", mock.MatchedBy(func(response string) bool {
+				var stored models.Transaction
+				gomega.Expect(json.Unmarshal([]byte(response), &stored)).To(gomega.Succeed())
+				return stored.ReferenceID == result.ReferenceID
+			}))
+		})
+
+		ginkgo.It("should return the original transaction when the request is replayed", func() {
+			requestHash, _ := fingerprint(constants.DEPOSIT, request)
+			original := models.Transaction{ID: 8, ReferenceID: uuid.New(), Amount: request.Amount, Type: constants.DEPOSIT, Status: constants.PENDING}
+			response, _ := json.Marshal(original)
+
+			mockIdempotentRepo.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(false, nil)
+			mockIdempotentRepo.On("GetIdempotencyKey", mock.Anything, "key-1").Return(models.IdempotencyKey{
+				Key:         "key-1",
+				RequestHash: requestHash,
+				Response:    string(response),
+			}, nil)
+
+			result, err := transactionService.Deposit(context.Background(), request, "key-1")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result.ID).To(gomega.Equal(original.ID))
+			gomega.Expect(result.ReferenceID).To(gomega.Equal(original.ReferenceID))
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should reject a replay with a different request", func() {
+			otherHash, _ := fingerprint(constants.WITHDRAWAL, request)
+
+			mockIdempotentRepo.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(false, nil)
+			mockIdempotentRepo.On("GetIdempotencyKey", mock.Anything, "key-1").Return(models.IdempotencyKey{
+				Key:         "key-1",
+				RequestHash: otherHash,
+				Response:    `{}`,
+			}, nil)
+
+			_, err := transactionService.Deposit(context.Background(), request, "key-1")
+
+			gomega.Expect(errors.Is(err, ErrIdempotencyKeyReused)).To(gomega.BeTrue())
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "InsertTransaction", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		ginkgo.It("should reject a replay while the first request is still being processed", func() {
+			requestHash, _ := fingerprint(constants.DEPOSIT, request)
+
+			mockIdempotentRepo.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(false, nil)
+			mockIdempotentRepo.On("GetIdempotencyKey", mock.Anything, "key-1").Return(models.IdempotencyKey{
+				Key:         "key-1",
+				RequestHash: requestHash,
+			}, nil)
+
+			_, err := transactionService.Deposit(context.Background(), request, "key-1")
+
+			gomega.Expect(errors.Is(err, ErrIdempotencyKeyInProgress)).To(gomega.BeTrue())
 		})
 
+		ginkgo.It("should release the key when the transaction cannot be created", func() {
+			mockIdempotentRepo.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(true, nil)
+			mockRepo.On("InsertTransaction", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("insert error"))
+			mockIdempotentRepo.On("DeleteIdempotencyKey", mock.Anything, "key-1").Return(nil)
+
+			_, err := transactionService.Deposit(context.Background(), request, "key-1")
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			mockIdempotentRepo.AssertCalled(ginkgo.GinkgoT(), "DeleteIdempotencyKey", mock.Anything, "key-1")
+			mockIdempotentRepo.AssertNotCalled(ginkgo.GinkgoT(), "SaveIdempotencyResponse", mock.Anything, mock.Anything, mock.Anything)
+		})
+		ginkgo.It("should return the created transaction and keep the key when the response cannot be saved", func() {
+			mockIdempotentRepo.On("ReserveIdempotencyKey", mock.Anything, mock.Anything).Return(true, nil)
+			mockRepo.On("InsertTransaction", mock.Anything, mock.Anything, kafka.SendTransactionKafkaTopic).Return(nil)
+			mockIdempotentRepo.On("SaveIdempotencyResponse", mock.Anything, "key-1", mock.AnythingOfType("string")).Return(errors.New("db error"))
+
+			transaction, err := transactionService.Deposit(context.Background(), request, "key-1")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(transaction.ReferenceID).ShouldNot(gomega.Equal(uuid.Nil))
+			gomega.Expect(transaction.Amount).To(gomega.Equal(request.Amount))
+			mockIdempotentRepo.AssertNotCalled(ginkgo.GinkgoT(), "DeleteIdempotencyKey", mock.Anything, mock.Anything)
+		})
+	})
+
+	ginkgo.Describe("GetTransactionAttempts", func() {
+		ginkgo.It("should return the attempts of the transaction", func() {
+			referenceID := uuid.New().String()
+			attempts := []models.TransactionAttempt{
+				{ID: 1, AttemptNumber: 1, GatewayID: 1, Status: constants.ERROR, ErrorClass: "unavailable"},
+				{ID: 2, AttemptNumber: 2, GatewayID: 2, Status: constants.ACCEPTED},
+			}
+
+			mockAttemptRepo.On("GetAttemptsByReferenceID", mock.Anything, referenceID).Return(attempts, nil)
+
+			result, err := transactionService.GetTransactionAttempts(context.Background(), referenceID)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(attempts))
+		})
+
+		ginkgo.It("should return error when GetAttemptsByReferenceID fails", func() {
+			referenceID := uuid.New().String()
+
+			mockAttemptRepo.On("GetAttemptsByReferenceID", mock.Anything, referenceID).Return(nil, errors.New("db error"))
+
+			_, err := transactionService.GetTransactionAttempts(context.Background(), referenceID)
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("db error"))
+		})
+	})
+
+	ginkgo.Describe("GetTransaction", func() {
+		ginkgo.It("should return the transaction", func() {
+			transaction := models.Transaction{ID: 8, ReferenceID: uuid.New()}
+			mockRepo.On("GetTransactionByReferenceID", mock.Anything, transaction.ReferenceID.String()).Return(transaction, nil)
+
+			result, err := transactionService.GetTransaction(context.Background(), transaction.ReferenceID.String())
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal(transaction))
+		})
+
+		ginkgo.It("should keep sql.ErrNoRows detectable when the transaction does not exist", func() {
+			mockRepo.On("GetTransactionByReferenceID", mock.Anything, "unknown").Return(models.Transaction{}, sql.ErrNoRows)
+
+			_, err := transactionService.GetTransaction(context.Background(), "unknown")
+
+			gomega.Expect(errors.Is(err, sql.ErrNoRows)).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Describe("SearchTransactions", func() {
+		ginkgo.It("should return a cursor to the next page when there are more transactions", func() {
+			filter := models.TransactionFilter{UserID: 1, Limit: 2}
+			mockRepo.On("SearchTransactions", mock.Anything, filter, 0, 3).Return([]models.Transaction{{ID: 9}, {ID: 8}, {ID: 7}}, nil)
+
+			page, err := transactionService.SearchTransactions(context.Background(), filter)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(page.Transactions).To(gomega.HaveLen(2))
+			gomega.Expect(page.NextCursor).NotTo(gomega.BeEmpty())
+
+			next := models.TransactionFilter{UserID: 1, Limit: 2, Cursor: page.NextCursor}
+			mockRepo.On("SearchTransactions", mock.Anything, next, 8, 3).Return([]models.Transaction{{ID: 7}}, nil)
+
+			page, err = transactionService.SearchTransactions(context.Background(), next)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(page.Transactions).To(gomega.HaveLen(1))
+			gomega.Expect(page.NextCursor).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should use the default limit when none is given", func() {
+			mockRepo.On("SearchTransactions", mock.Anything, models.TransactionFilter{}, 0, DefaultSearchLimit+1).Return([]models.Transaction{}, nil)
+
+			_, err := transactionService.SearchTransactions(context.Background(), models.TransactionFilter{})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should reject a cursor it did not issue", func() {
+			_, err := transactionService.SearchTransactions(context.Background(), models.TransactionFilter{Cursor: "not-a-cursor"})
+
+			gomega.Expect(err).To(gomega.Equal(ErrInvalidCursor))
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "SearchTransactions", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
 	})
 })
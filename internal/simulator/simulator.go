@@ -0,0 +1,415 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"payment-gateway/internal/gateways"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+	"payment-gateway/pkg/utils"
+
+	"github.com/google/uuid"
+)
+
+const (
+	transactionsPath = "/transactions"
+	apiKeyHeader     = "X-API-Key"
+
+	OutcomeApprove = "approve"
+	OutcomeDecline = "decline"
+	OutcomeTimeout = "timeout"
+	OutcomeError   = "error"
+)
+
+// Settings controls how a simulated gateway answers
+type Settings struct {
+	ApproveRate     float64
+	DeclineRate     float64
+	TimeoutRate     float64
+	ErrorRate       float64
+	MinLatency      time.Duration
+	MaxLatency      time.Duration
+	TimeoutDuration time.Duration // how long a timed out request hangs before the gateway gives up on it
+	CallbackDelay   time.Duration
+	CallbackURL     string // base callback URL, the gateway name is appended to it
+}
+
+// GatewaySimulator fakes a payment provider behind a registered gateway adapter
+type GatewaySimulator struct {
+	adapter    gateways.GatewayAdapter
+	settings   Settings
+	httpClient *http.Client
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	statusMu  sync.Mutex
+	statuses  map[string]string          // gateway status of every transaction the gateway took on, by reference ID
+	responses map[string]gatewayResponse // response to every request the gateway executed, by idempotency key
+}
+
+type gatewayResponse struct {
+	statusCode int
+	body       models.GatewayTransactionResponse
+}
+
+func NewGatewaySimulator(adapter gateways.GatewayAdapter, settings Settings) *GatewaySimulator {
+	return &GatewaySimulator{
+		adapter:    adapter,
+		settings:   settings,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		statuses:   map[string]string{},
+		responses:  map[string]gatewayResponse{},
+	}
+}
+
+// Address returns the listen address derived from the port of the gateway URL
+func (s *GatewaySimulator) Address() (string, error) {
+	gatewayUrl, err := url.Parse(s.adapter.Config().GatewayUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid url for gateway %s: %w", s.adapter.Name(), err)
+	}
+
+	port := gatewayUrl.Port()
+	if port == "" {
+		return "", fmt.Errorf("url for gateway %s has no port: %s", s.adapter.Name(), gatewayUrl)
+	}
+
+	return net.JoinHostPort("", port), nil
+}
+
+func (s *GatewaySimulator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(transactionsPath, s.handleTransaction)
+	mux.HandleFunc(s.adapter.HealthPath(), s.handleHealth)
+	if s.adapter.SupportsStatusQuery() {
+		mux.HandleFunc(transactionsPath+"/", s.handleTransactionStatus)
+	}
+	return mux
+}
+
+func (s *GatewaySimulator) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	soap := isSOAP(r.Header.Get("Content-Type"))
+
+	if r.Header.Get(apiKeyHeader) != s.adapter.Config().GatewayApiKey {
+		writeResponse(w, soap, http.StatusUnauthorized, models.GatewayTransactionResponse{
+			Status:  constants.ERROR,
+			Message: "invalid api key",
+		})
+		return
+	}
+
+	transactionRequest, err := s.decodeTransactionRequest(r, soap)
+	if err != nil {
+		log.Printf("[simulator-%s] Invalid transaction request: %v", s.adapter.Name(), err)
+		writeResponse(w, soap, http.StatusBadRequest, models.GatewayTransactionResponse{
+			Status:  constants.ERROR,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	s.sleep(r.Context(), s.latency())
+
+	reference := "sim-" + uuid.NewString()
+	outcome := s.pickOutcome()
+	idempotencyKey := s.idempotencyKey(r, transactionRequest)
+
+	accepted := gatewayResponse{statusCode: http.StatusOK, body: models.GatewayTransactionResponse{
+		Status:    constants.ACCEPTED,
+		Reference: reference,
+		Message:   "transaction accepted",
+	}}
+	declined := gatewayResponse{statusCode: http.StatusPaymentRequired, body: models.GatewayTransactionResponse{
+		Status:     constants.DECLINED,
+		Reference:  reference,
+		Message:    "insufficient funds",
+		ReasonCode: constants.REASON_INSUFFICIENT_FUNDS,
+	}}
+
+	// like a real provider, a request with the key of one it already executed gets the original
+	// response and does not execute the transaction again
+	var executed gatewayResponse
+	switch outcome {
+	case OutcomeApprove, OutcomeTimeout:
+		executed = accepted
+	case OutcomeDecline:
+		executed = declined
+	}
+	if executed.statusCode != 0 {
+		if previous, ok := s.rememberResponse(idempotencyKey, executed); ok {
+			log.Printf("[simulator-%s] Transaction %s replayed for idempotency key %s", s.adapter.Name(), transactionRequest.ReferenceID, idempotencyKey)
+			writeResponse(w, soap, previous.statusCode, previous.body)
+			return
+		}
+	}
+
+	log.Printf("[simulator-%s] Transaction %s -> %s", s.adapter.Name(), transactionRequest.ReferenceID, outcome)
+
+	switch outcome {
+	case OutcomeApprove:
+		s.setStatus(transactionRequest.ReferenceID, constants.PENDING)
+		writeResponse(w, soap, accepted.statusCode, accepted.body)
+		go s.sendCallback(transactionRequest, constants.COMPLETED, soap)
+
+	case OutcomeDecline:
+		s.setStatus(transactionRequest.ReferenceID, constants.FAILED)
+		writeResponse(w, soap, declined.statusCode, declined.body)
+
+	case OutcomeTimeout:
+		// the request hangs, but like a real provider the payment still goes through
+		s.setStatus(transactionRequest.ReferenceID, constants.PENDING)
+		s.sleep(r.Context(), s.settings.TimeoutDuration)
+		go s.sendCallback(transactionRequest, constants.COMPLETED, soap)
+		writeResponse(w, soap, http.StatusGatewayTimeout, models.GatewayTransactionResponse{
+			Status:    constants.ERROR,
+			Reference: reference,
+			Message:   "gateway timeout",
+		})
+
+	default:
+		writeResponse(w, soap, http.StatusServiceUnavailable, models.GatewayTransactionResponse{
+			Status:    constants.ERROR,
+			Reference: reference,
+			Message:   "service unavailable",
+		})
+	}
+}
+
+// handleHealth tells the gateway is up
+func (s *GatewaySimulator) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get(apiKeyHeader) != s.adapter.Config().GatewayApiKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// handleTransactionStatus answers GET /transactions/{reference_id} with the gateway status of the transaction
+func (s *GatewaySimulator) handleTransactionStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	soap := isSOAP(r.Header.Get("Accept"))
+
+	if r.Header.Get(apiKeyHeader) != s.adapter.Config().GatewayApiKey {
+		writeResponse(w, soap, http.StatusUnauthorized, models.GatewayTransactionResponse{
+			Status:  constants.ERROR,
+			Message: "invalid api key",
+		})
+		return
+	}
+
+	referenceID := strings.TrimPrefix(r.URL.Path, transactionsPath+"/")
+	status, ok := s.status(referenceID)
+	if !ok {
+		writeResponse(w, soap, http.StatusNotFound, models.GatewayTransactionResponse{
+			Status:  constants.ERROR,
+			Message: "transaction not found",
+		})
+		return
+	}
+
+	writeResponse(w, soap, http.StatusOK, models.GatewayTransactionResponse{Status: status})
+}
+
+func (s *GatewaySimulator) setStatus(referenceID, status string) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	s.statuses[referenceID] = status
+}
+
+func (s *GatewaySimulator) status(referenceID string) (string, bool) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	status, ok := s.statuses[referenceID]
+	return status, ok
+}
+
+// rememberResponse stores the response of the request with the idempotency key, unless a response is
+// stored for the key already, in which case that one is returned. Requests without a key are never replayed.
+func (s *GatewaySimulator) rememberResponse(idempotencyKey string, response gatewayResponse) (gatewayResponse, bool) {
+	if idempotencyKey == "" {
+		return gatewayResponse{}, false
+	}
+
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	if previous, ok := s.responses[idempotencyKey]; ok {
+		return previous, true
+	}
+	s.responses[idempotencyKey] = response
+	return gatewayResponse{}, false
+}
+
+// idempotencyKey reads the idempotency key from where the adapter puts it
+func (s *GatewaySimulator) idempotencyKey(r *http.Request, transactionRequest *models.SendTransactionRequest) string {
+	if header := s.adapter.IdempotencyHeader(); header != "" {
+		return r.Header.Get(header)
+	}
+	return transactionRequest.IdempotencyKey
+}
+
+func (s *GatewaySimulator) decodeTransactionRequest(r *http.Request, soap bool) (*models.SendTransactionRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	var encryptedData string
+	if soap {
+		var envelope soapTransactionRequest
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			return nil, fmt.Errorf("failed to decode XML: %w", err)
+		}
+		encryptedData = strings.TrimSpace(envelope.Request)
+	} else {
+		var request models.EncryptedTransactionRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON: %w", err)
+		}
+		encryptedData = request.EncryptedData
+	}
+
+	decrypted, err := utils.DecryptAES(encryptedData, s.adapter.Config().GatewayPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactionRequest models.SendTransactionRequest
+	if err := json.Unmarshal([]byte(decrypted), &transactionRequest); err != nil {
+		return nil, fmt.Errorf("failed to decode decrypted payload: %w", err)
+	}
+
+	return &transactionRequest, nil
+}
+
+func (s *GatewaySimulator) sendCallback(transactionRequest *models.SendTransactionRequest, status string, soap bool) {
+	time.Sleep(s.settings.CallbackDelay)
+	s.setStatus(transactionRequest.ReferenceID, status)
+
+	callbackURL := strings.TrimRight(s.settings.CallbackURL, "/") + "/" + s.adapter.Name()
+
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+	if soap {
+		contentType = "text/xml"
+		body, err = marshalSOAP(soapCallbackRequest{
+			ID:       transactionRequest.ReferenceID,
+			Amount:   transactionRequest.Amount,
+			Currency: transactionRequest.Currency,
+			Status:   status,
+		})
+	} else {
+		contentType = "application/json"
+		body, err = json.Marshal(models.TransactionCallbackRequest{
+			ReferenceID: transactionRequest.ReferenceID,
+			Amount:      transactionRequest.Amount,
+			Currency:    transactionRequest.Currency,
+			Status:      status,
+		})
+	}
+	if err != nil {
+		log.Printf("[simulator-%s] Failed to build callback: %v", s.adapter.Name(), err)
+		return
+	}
+
+	resp, err := s.httpClient.Post(callbackURL, contentType, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[simulator-%s] Failed to send callback for %s: %v", s.adapter.Name(), transactionRequest.ReferenceID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	log.Printf("[simulator-%s] Callback for %s sent, status=%s http_status=%d", s.adapter.Name(), transactionRequest.ReferenceID, status, resp.StatusCode)
+}
+
+func (s *GatewaySimulator) pickOutcome() string {
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+
+	total := s.settings.ApproveRate + s.settings.DeclineRate + s.settings.TimeoutRate + s.settings.ErrorRate
+	if total <= 0 {
+		return OutcomeApprove
+	}
+
+	roll := s.rand.Float64() * total
+	switch {
+	case roll < s.settings.ApproveRate:
+		return OutcomeApprove
+	case roll < s.settings.ApproveRate+s.settings.DeclineRate:
+		return OutcomeDecline
+	case roll < s.settings.ApproveRate+s.settings.DeclineRate+s.settings.TimeoutRate:
+		return OutcomeTimeout
+	default:
+		return OutcomeError
+	}
+}
+
+func (s *GatewaySimulator) latency() time.Duration {
+	if s.settings.MaxLatency <= s.settings.MinLatency {
+		return s.settings.MinLatency
+	}
+
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+
+	return s.settings.MinLatency + time.Duration(s.rand.Int63n(int64(s.settings.MaxLatency-s.settings.MinLatency)))
+}
+
+// sleep waits for the given duration or until the caller goes away
+func (s *GatewaySimulator) sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func isSOAP(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/xml" || mediaType == "application/xml" || mediaType == "application/soap+xml"
+}
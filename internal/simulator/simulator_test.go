@@ -0,0 +1,223 @@
+package simulator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"payment-gateway/internal/client"
+	"payment-gateway/internal/gateways"
+	"payment-gateway/internal/gateways/gatewaya"
+	"payment-gateway/internal/gateways/gatewayb"
+	"payment-gateway/models"
+	"payment-gateway/pkg/constants"
+
+	"github.com/google/uuid"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestSimulator(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Simulator Suite")
+}
+
+type receivedCallback struct {
+	path        string
+	contentType string
+	body        []byte
+}
+
+var _ = ginkgo.Describe("GatewaySimulator", func() {
+	var (
+		callbackServer *httptest.Server
+		callbacks      chan receivedCallback
+		settings       Settings
+		gatewayConfig  models.GatewayConfig
+		transaction    *models.Transaction
+	)
+
+	post := func(server *httptest.Server, adapter gateways.GatewayAdapter, apiKey string, attempt int) models.GatewayTransactionResult {
+		request, err := adapter.BuildRequest(transaction, gateways.IdempotencyKey(transaction.ReferenceID.String(), attempt))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+transactionsPath, strings.NewReader(request.Request))
+		req.Header.Set("Content-Type", request.ContentType)
+		req.Header.Set(apiKeyHeader, apiKey)
+		for header, value := range request.Headers {
+			req.Header.Set(header, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return adapter.ParseResponse(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	send := func(adapter gateways.GatewayAdapter, apiKey string) models.GatewayTransactionResult {
+		server := httptest.NewServer(NewGatewaySimulator(adapter, settings).Handler())
+		defer server.Close()
+
+		return post(server, adapter, apiKey, 0)
+	}
+
+	ginkgo.BeforeEach(func() {
+		callbacks = make(chan receivedCallback, 1)
+		callbackServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			callbacks <- receivedCallback{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), body: body}
+		}))
+
+		settings = Settings{
+			ApproveRate: 1,
+			CallbackURL: callbackServer.URL + "/transaction/callback",
+		}
+		gatewayConfig = models.GatewayConfig{
+			GatewayUrl:        "http://localhost:8081",
+			GatewayApiKey:     "api-key",
+			GatewayPrivateKey: "12345678901234567890123456789012",
+		}
+		transaction = &models.Transaction{
+			ReferenceID: uuid.MustParse("123e4567-e89b-12d3-a456-426614174000"),
+			Amount:      1000,
+			Currency:    "USD",
+			UserID:      1,
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		callbackServer.Close()
+	})
+
+	ginkgo.It("should approve a JSON transaction and send a JSON callback", func() {
+		adapter := gatewaya.New(gatewayConfig)
+
+		result := send(adapter, "api-key")
+		gomega.Expect(result.Status).To(gomega.Equal(constants.ACCEPTED))
+		gomega.Expect(result.GatewayReference).NotTo(gomega.BeEmpty())
+
+		var callback receivedCallback
+		gomega.Eventually(callbacks, time.Second).Should(gomega.Receive(&callback))
+		gomega.Expect(callback.path).To(gomega.Equal("/transaction/callback/A"))
+
+		request, err := adapter.ParseCallback(callback.contentType, callback.body)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(request.ReferenceID).To(gomega.Equal(transaction.ReferenceID.String()))
+		gomega.Expect(request.Status).To(gomega.Equal(constants.COMPLETED))
+	})
+
+	ginkgo.It("should approve a SOAP transaction and send a SOAP callback", func() {
+		adapter := gatewayb.New(gatewayConfig)
+
+		result := send(adapter, "api-key")
+		gomega.Expect(result.Status).To(gomega.Equal(constants.ACCEPTED))
+
+		var callback receivedCallback
+		gomega.Eventually(callbacks, time.Second).Should(gomega.Receive(&callback))
+		gomega.Expect(callback.contentType).To(gomega.Equal("text/xml"))
+
+		request, err := adapter.ParseCallback(callback.contentType, callback.body)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(request.Amount).To(gomega.Equal(transaction.Amount))
+		gomega.Expect(request.Status).To(gomega.Equal(constants.COMPLETED))
+	})
+
+	ginkgo.It("should decline without sending a callback", func() {
+		settings.ApproveRate = 0
+		settings.DeclineRate = 1
+
+		result := send(gatewaya.New(gatewayConfig), "api-key")
+		gomega.Expect(result.Status).To(gomega.Equal(constants.DECLINED))
+		gomega.Expect(result.HTTPStatus).To(gomega.Equal(http.StatusPaymentRequired))
+		gomega.Consistently(callbacks, 100*time.Millisecond).ShouldNot(gomega.Receive())
+	})
+
+	ginkgo.It("should answer with a 5xx", func() {
+		settings.ApproveRate = 0
+		settings.ErrorRate = 1
+
+		result := send(gatewayb.New(gatewayConfig), "api-key")
+		gomega.Expect(result.Status).To(gomega.Equal(constants.ERROR))
+		gomega.Expect(result.HTTPStatus).To(gomega.Equal(http.StatusServiceUnavailable))
+	})
+
+	ginkgo.It("should replay the response to a request with the idempotency key of an executed one", func() {
+		for _, adapter := range []gateways.GatewayAdapter{gatewaya.New(gatewayConfig), gatewayb.New(gatewayConfig)} {
+			server := httptest.NewServer(NewGatewaySimulator(adapter, settings).Handler())
+
+			first := post(server, adapter, "api-key", 0)
+			replayed := post(server, adapter, "api-key", 0)
+			gomega.Expect(replayed.Status).To(gomega.Equal(constants.ACCEPTED))
+			gomega.Expect(replayed.GatewayReference).To(gomega.Equal(first.GatewayReference))
+
+			next := post(server, adapter, "api-key", 1)
+			gomega.Expect(next.GatewayReference).NotTo(gomega.Equal(first.GatewayReference))
+
+			gomega.Eventually(callbacks, time.Second).Should(gomega.Receive())
+			gomega.Eventually(callbacks, time.Second).Should(gomega.Receive())
+			gomega.Consistently(callbacks, 100*time.Millisecond).ShouldNot(gomega.Receive())
+			server.Close()
+		}
+	})
+
+	ginkgo.It("should reject an invalid api key", func() {
+		result := send(gatewaya.New(gatewayConfig), "wrong-key")
+		gomega.Expect(result.HTTPStatus).To(gomega.Equal(http.StatusUnauthorized))
+	})
+
+	ginkgo.It("should answer health checks", func() {
+		server := httptest.NewServer(nil)
+		defer server.Close()
+		gatewayConfig.GatewayUrl = server.URL
+		server.Config.Handler = NewGatewaySimulator(gatewaya.New(gatewayConfig), settings).Handler()
+
+		err := client.NewTransactionClient().CheckHealth(context.Background(), gatewaya.New(gatewayConfig))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		gatewayConfig.GatewayApiKey = "wrong-key"
+		err = client.NewTransactionClient().CheckHealth(context.Background(), gatewaya.New(gatewayConfig))
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should report the status of the transactions it took on", func() {
+		settings.CallbackDelay = 200 * time.Millisecond
+		server := httptest.NewServer(nil)
+		defer server.Close()
+
+		gatewayConfig.GatewayUrl = server.URL
+		adapter := gatewaya.New(gatewayConfig)
+		server.Config.Handler = NewGatewaySimulator(adapter, settings).Handler()
+
+		transactionClient := client.NewTransactionClient()
+		referenceID := transaction.ReferenceID.String()
+
+		_, err := transactionClient.QueryTransactionStatus(context.Background(), referenceID, adapter)
+		gomega.Expect(gateways.Classify(err)).To(gomega.Equal(gateways.ErrorInternal))
+
+		request, err := adapter.BuildRequest(transaction, gateways.IdempotencyKey(transaction.ReferenceID.String(), 0))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		_, err = transactionClient.SendTransaction(context.Background(), request, adapter)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		status, err := transactionClient.QueryTransactionStatus(context.Background(), referenceID, adapter)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(status).To(gomega.Equal(constants.SUBMITTED))
+
+		gomega.Eventually(callbacks, time.Second).Should(gomega.Receive())
+		status, err = transactionClient.QueryTransactionStatus(context.Background(), referenceID, adapter)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(status).To(gomega.Equal(constants.COMPLETED))
+	})
+
+	ginkgo.It("should derive the listen address from the gateway url", func() {
+		address, err := NewGatewaySimulator(gatewaya.New(gatewayConfig), settings).Address()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(address).To(gomega.Equal(":8081"))
+	})
+})
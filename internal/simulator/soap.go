@@ -0,0 +1,79 @@
+package simulator
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+
+	"payment-gateway/models"
+)
+
+const soapNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+type soapTransactionRequest struct {
+	Request string `xml:"Body>Request"`
+}
+
+type soapEnvelope struct {
+	XMLName xml.Name `xml:"soap:Envelope"`
+	Soap    string   `xml:"xmlns:soap,attr"`
+	Body    soapBody `xml:"soap:Body"`
+}
+
+type soapBody struct {
+	Content interface{}
+}
+
+type soapTransactionResponse struct {
+	XMLName    xml.Name `xml:"TransactionResponse"`
+	Status     string   `xml:"status"`
+	Reference  string   `xml:"reference"`
+	Message    string   `xml:"message"`
+	ReasonCode string   `xml:"reason_code,omitempty"`
+}
+
+type soapCallbackRequest struct {
+	XMLName  xml.Name `xml:"TransactionCallbackRequest"`
+	ID       string   `xml:"id"`
+	Amount   float64  `xml:"amount"`
+	Currency string   `xml:"currency"`
+	Status   string   `xml:"status"`
+}
+
+func marshalSOAP(content interface{}) ([]byte, error) {
+	body, err := xml.Marshal(soapEnvelope{
+		Soap: soapNamespace,
+		Body: soapBody{Content: content},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func writeResponse(w http.ResponseWriter, soap bool, statusCode int, response models.GatewayTransactionResponse) {
+	var (
+		body []byte
+		err  error
+	)
+
+	if soap {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		body, err = marshalSOAP(soapTransactionResponse{
+			Status:     response.Status,
+			Reference:  response.Reference,
+			Message:    response.Message,
+			ReasonCode: response.ReasonCode,
+		})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		body, err = json.Marshal(response)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
@@ -0,0 +1,36 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockCircuitBreaker is a mock implementation of the CircuitBreaker
+type MockCircuitBreaker struct {
+	mock.Mock
+}
+
+// Allow provides a mock function for checking whether a gateway may receive a request
+func (m *MockCircuitBreaker) Allow(ctx context.Context, gatewayID int) error {
+	args := m.Called(ctx, gatewayID)
+	return args.Error(0)
+}
+
+// RecordSuccess provides a mock function for recording a successful request
+func (m *MockCircuitBreaker) RecordSuccess(ctx context.Context, gatewayID int) error {
+	args := m.Called(ctx, gatewayID)
+	return args.Error(0)
+}
+
+// RecordFailure provides a mock function for recording a failed request
+func (m *MockCircuitBreaker) RecordFailure(ctx context.Context, gatewayID int) error {
+	args := m.Called(ctx, gatewayID)
+	return args.Error(0)
+}
+
+// Release provides a mock function for giving back a request that was never sent
+func (m *MockCircuitBreaker) Release(ctx context.Context, gatewayID int) error {
+	args := m.Called(ctx, gatewayID)
+	return args.Error(0)
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"payment-gateway/internal/gateways"
 	"payment-gateway/models"
 
 	"github.com/stretchr/testify/mock"
@@ -16,9 +17,20 @@ type MockTransactionClient struct {
 func (m *MockTransactionClient) SendTransaction(
 	ctx context.Context,
 	transactionRequest models.BuildExternalTransaction,
-	gatewayName string,
-	gatewayConfig models.GatewayConfig,
-) error {
-	args := m.Called(ctx, transactionRequest, gatewayName, gatewayConfig)
+	adapter gateways.GatewayAdapter,
+) (models.GatewayTransactionResult, error) {
+	args := m.Called(ctx, transactionRequest, adapter)
+	return args.Get(0).(models.GatewayTransactionResult), args.Error(1)
+}
+
+// QueryTransactionStatus provides a mock function for querying the status of a transaction
+func (m *MockTransactionClient) QueryTransactionStatus(ctx context.Context, referenceID string, adapter gateways.GatewayAdapter) (string, error) {
+	args := m.Called(ctx, referenceID, adapter)
+	return args.String(0), args.Error(1)
+}
+
+// CheckHealth provides a mock function for calling the health endpoint of a gateway
+func (m *MockTransactionClient) CheckHealth(ctx context.Context, adapter gateways.GatewayAdapter) error {
+	args := m.Called(ctx, adapter)
 	return args.Error(0)
 }
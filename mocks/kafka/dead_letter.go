@@ -0,0 +1,33 @@
+package mocks
+
+import (
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockDeadLetterReader is a mock implementation of the DeadLetterReader interface
+type MockDeadLetterReader struct {
+	mock.Mock
+}
+
+// ReadDeadLetters provides a mock function for reading the dead-letter topic
+func (m *MockDeadLetterReader) ReadDeadLetters(limit int) ([]models.DeadLetterMessage, error) {
+	args := m.Called(limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.DeadLetterMessage), args.Error(1)
+}
+
+// ReadDeadLetter provides a mock function for reading one dead-letter message
+func (m *MockDeadLetterReader) ReadDeadLetter(partition int32, offset int64) (models.DeadLetterMessage, error) {
+	args := m.Called(partition, offset)
+	return args.Get(0).(models.DeadLetterMessage), args.Error(1)
+}
+
+// Close provides a mock function for closing the reader
+func (m *MockDeadLetterReader) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
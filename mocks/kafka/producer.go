@@ -14,3 +14,15 @@ func (m *MockKafkaProducer) ProduceMessage(data []byte, topic string) error {
 	args := m.Called(data, topic)
 	return args.Error(0)
 }
+
+// ProduceMessageWithHeaders provides a mock function for sending messages with headers to Kafka
+func (m *MockKafkaProducer) ProduceMessageWithHeaders(data []byte, topic string, headers map[string]string) error {
+	args := m.Called(data, topic, headers)
+	return args.Error(0)
+}
+
+// Close provides a mock function for closing the producer
+func (m *MockKafkaProducer) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
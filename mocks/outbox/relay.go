@@ -0,0 +1,19 @@
+package mocks
+
+import (
+	"context"
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockRelay is a mock implementation of the outbox IRelay interface
+type MockRelay struct {
+	mock.Mock
+}
+
+// Lag provides a mock function for fetching the outbox lag
+func (m *MockRelay) Lag(ctx context.Context) (models.OutboxLag, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(models.OutboxLag), args.Error(1)
+}
@@ -0,0 +1,27 @@
+package mocks
+
+import (
+	"context"
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockCircuitBreakerRepository is a mock implementation of the CircuitBreakerRepository.
+// UpdateState applies the update to the state passed to Return.
+type MockCircuitBreakerRepository struct {
+	mock.Mock
+}
+
+// UpdateState provides a mock function for updating the circuit breaker state of a gateway
+func (m *MockCircuitBreakerRepository) UpdateState(ctx context.Context, gatewayID int, update func(state *models.CircuitBreakerState) error) error {
+	args := m.Called(ctx, gatewayID)
+
+	if state, ok := args.Get(0).(*models.CircuitBreakerState); ok {
+		if err := update(state); err != nil {
+			return err
+		}
+	}
+
+	return args.Error(1)
+}
@@ -2,6 +2,9 @@ package mocks
 
 import (
 	"context"
+	"time"
+
+	"payment-gateway/models"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -11,8 +14,67 @@ type MockGatewayRepository struct {
 	mock.Mock
 }
 
-// UpdateHealthStatus provides a mock function for updating the health status of a gateway
-func (m *MockGatewayRepository) UpdateHealthStatus(ctx context.Context, gatewayID int, healthStatus string) error {
-	args := m.Called(ctx, gatewayID, healthStatus)
+// GetGatewayByID provides a mock function for fetching a gateway by its ID
+func (m *MockGatewayRepository) GetGatewayByID(ctx context.Context, gatewayID int) (models.GatewayDetail, error) {
+	args := m.Called(ctx, gatewayID)
+	return args.Get(0).(models.GatewayDetail), args.Error(1)
+}
+
+// GetGateways provides a mock function for fetching every gateway
+func (m *MockGatewayRepository) GetGateways(ctx context.Context) ([]models.GatewayDetail, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.GatewayDetail), args.Error(1)
+}
+
+// UpdateHealth provides a mock function for updating the health check state of a gateway.
+// It applies the update to the state passed to Return.
+func (m *MockGatewayRepository) UpdateHealth(ctx context.Context, gatewayID int, update func(health *models.GatewayHealth) error) error {
+	args := m.Called(ctx, gatewayID)
+
+	if health, ok := args.Get(0).(*models.GatewayHealth); ok {
+		if err := update(health); err != nil {
+			return err
+		}
+	}
+
+	return args.Error(1)
+}
+
+// GetHealth provides a mock function for fetching the health state of a gateway
+func (m *MockGatewayRepository) GetHealth(ctx context.Context, gatewayID int) (models.GatewayHealth, error) {
+	args := m.Called(ctx, gatewayID)
+	return args.Get(0).(models.GatewayHealth), args.Error(1)
+}
+
+// InsertHealthEvent provides a mock function for storing a health event of a gateway
+func (m *MockGatewayRepository) InsertHealthEvent(ctx context.Context, event *models.GatewayHealthEvent) error {
+	args := m.Called(ctx, event)
 	return args.Error(0)
 }
+
+// GetHealthEvents provides a mock function for fetching the latest health events of a gateway
+func (m *MockGatewayRepository) GetHealthEvents(ctx context.Context, gatewayID int, limit int) ([]models.GatewayHealthEvent, error) {
+	args := m.Called(ctx, gatewayID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.GatewayHealthEvent), args.Error(1)
+}
+
+// GetHealthStatusChanges provides a mock function for fetching the health status changes of a gateway
+func (m *MockGatewayRepository) GetHealthStatusChanges(ctx context.Context, gatewayID int, since time.Time) ([]models.GatewayHealthEvent, error) {
+	args := m.Called(ctx, gatewayID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.GatewayHealthEvent), args.Error(1)
+}
+
+// DeleteProbeEvents provides a mock function for removing old probe events
+func (m *MockGatewayRepository) DeleteProbeEvents(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
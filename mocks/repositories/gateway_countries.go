@@ -12,13 +12,13 @@ type MockGatewayCountryRepository struct {
 	mock.Mock
 }
 
-// GetHealthyGatewayByCountryID provides a mock function for fetching a healthy gateway by country ID
-func (m *MockGatewayCountryRepository) GetHealthyGatewayByCountryID(ctx context.Context, countryID int) (*models.GatewayDetail, error) {
+// GetRoutableGatewaysByCountryID provides a mock function for fetching the routable gateways of a country
+func (m *MockGatewayCountryRepository) GetRoutableGatewaysByCountryID(ctx context.Context, countryID int) ([]models.GatewayDetail, error) {
 	args := m.Called(ctx, countryID)
 
-	var r0 *models.GatewayDetail
+	var r0 []models.GatewayDetail
 	if args.Get(0) != nil {
-		r0 = args.Get(0).(*models.GatewayDetail)
+		r0 = args.Get(0).([]models.GatewayDetail)
 	}
 	r1 := args.Error(1)
 
@@ -0,0 +1,36 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockGatewayMaintenanceRepository is a mock implementation of the GatewayMaintenanceRepository
+type MockGatewayMaintenanceRepository struct {
+	mock.Mock
+}
+
+// InsertMaintenanceWindow provides a mock function for storing a maintenance window
+func (m *MockGatewayMaintenanceRepository) InsertMaintenanceWindow(ctx context.Context, window *models.GatewayMaintenanceWindow) error {
+	args := m.Called(ctx, window)
+	return args.Error(0)
+}
+
+// GetMaintenanceWindows provides a mock function for fetching the maintenance windows of a gateway
+func (m *MockGatewayMaintenanceRepository) GetMaintenanceWindows(ctx context.Context, gatewayID int, endsAfter time.Time) ([]models.GatewayMaintenanceWindow, error) {
+	args := m.Called(ctx, gatewayID, endsAfter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.GatewayMaintenanceWindow), args.Error(1)
+}
+
+// CancelMaintenanceWindow provides a mock function for calling off a maintenance window
+func (m *MockGatewayMaintenanceRepository) CancelMaintenanceWindow(ctx context.Context, gatewayID int, windowID int, cancelledAt time.Time) (models.GatewayMaintenanceWindow, error) {
+	args := m.Called(ctx, gatewayID, windowID, cancelledAt)
+	return args.Get(0).(models.GatewayMaintenanceWindow), args.Error(1)
+}
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"context"
+	"payment-gateway/models"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockIdempotencyKeyRepository is a mock implementation of the IdempotencyKeyRepository
+type MockIdempotencyKeyRepository struct {
+	mock.Mock
+}
+
+// ReserveIdempotencyKey provides a mock function for reserving an idempotency key
+func (m *MockIdempotencyKeyRepository) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) (bool, error) {
+	args := m.Called(ctx, key)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetIdempotencyKey provides a mock function for fetching an idempotency key
+func (m *MockIdempotencyKeyRepository) GetIdempotencyKey(ctx context.Context, key string) (models.IdempotencyKey, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(models.IdempotencyKey), args.Error(1)
+}
+
+// SaveIdempotencyResponse provides a mock function for storing the response of an idempotency key
+func (m *MockIdempotencyKeyRepository) SaveIdempotencyResponse(ctx context.Context, key string, response string) error {
+	args := m.Called(ctx, key, response)
+	return args.Error(0)
+}
+
+// DeleteIdempotencyKey provides a mock function for releasing an idempotency key
+func (m *MockIdempotencyKeyRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+// DeleteExpiredIdempotencyKeys provides a mock function for removing expired idempotency keys
+func (m *MockIdempotencyKeyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,49 @@
+package mocks
+
+import (
+	"context"
+	"payment-gateway/models"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockOutboxRepository is a mock implementation of the OutboxRepository
+type MockOutboxRepository struct {
+	mock.Mock
+}
+
+// ClaimPendingMessages provides a mock function for claiming due outbox messages
+func (m *MockOutboxRepository) ClaimPendingMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxMessage, error) {
+	args := m.Called(ctx, now, lease, limit)
+
+	var r0 []models.OutboxMessage
+	if args.Get(0) != nil {
+		r0 = args.Get(0).([]models.OutboxMessage)
+	}
+	return r0, args.Error(1)
+}
+
+// MarkMessageSent provides a mock function for marking an outbox message as sent
+func (m *MockOutboxRepository) MarkMessageSent(ctx context.Context, id int, sentAt time.Time) error {
+	args := m.Called(ctx, id, sentAt)
+	return args.Error(0)
+}
+
+// MarkMessageFailed provides a mock function for recording a failed publish attempt
+func (m *MockOutboxRepository) MarkMessageFailed(ctx context.Context, id int, errorMessage string, nextAttemptAt time.Time) error {
+	args := m.Called(ctx, id, errorMessage, nextAttemptAt)
+	return args.Error(0)
+}
+
+// GetLag provides a mock function for fetching the outbox lag
+func (m *MockOutboxRepository) GetLag(ctx context.Context, now time.Time) (models.OutboxLag, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(models.OutboxLag), args.Error(1)
+}
+
+// DeleteSentMessages provides a mock function for removing sent outbox messages
+func (m *MockOutboxRepository) DeleteSentMessages(ctx context.Context, sentBefore time.Time) (int64, error) {
+	args := m.Called(ctx, sentBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockProcessedMessageRepository is a mock implementation of the ProcessedMessageRepository
+type MockProcessedMessageRepository struct {
+	mock.Mock
+}
+
+// IsMessageProcessed provides a mock function for checking whether a message was handled
+func (m *MockProcessedMessageRepository) IsMessageProcessed(ctx context.Context, referenceID string, attempt int) (bool, error) {
+	args := m.Called(ctx, referenceID, attempt)
+	return args.Bool(0), args.Error(1)
+}
+
+// MarkMessageProcessed provides a mock function for recording a handled message
+func (m *MockProcessedMessageRepository) MarkMessageProcessed(ctx context.Context, referenceID string, attempt int) error {
+	args := m.Called(ctx, referenceID, attempt)
+	return args.Error(0)
+}
+
+// DeleteProcessedMessages provides a mock function for forgetting the handled messages of a transaction
+func (m *MockProcessedMessageRepository) DeleteProcessedMessages(ctx context.Context, referenceID string) (int64, error) {
+	args := m.Called(ctx, referenceID)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -11,13 +11,18 @@ type TransactionRepository struct {
 	mock.Mock
 }
 
-func (m *TransactionRepository) InsertTransaction(ctx context.Context, transaction *models.Transaction) error {
-	args := m.Called(ctx, transaction)
+func (m *TransactionRepository) InsertTransaction(ctx context.Context, transaction *models.Transaction, topic string) error {
+	args := m.Called(ctx, transaction, topic)
 	return args.Error(0)
 }
 
-func (m *TransactionRepository) UpdateTransactionStatusByReferenceID(ctx context.Context, referenceID string, status string) error {
-	args := m.Called(ctx, referenceID, status)
+func (m *TransactionRepository) UpdateTransactionStatusByReferenceID(ctx context.Context, referenceID string, status string, reason string) error {
+	args := m.Called(ctx, referenceID, status, reason)
+	return args.Error(0)
+}
+
+func (m *TransactionRepository) ClaimTransactionByReferenceID(ctx context.Context, referenceID string, attempt int) error {
+	args := m.Called(ctx, referenceID, attempt)
 	return args.Error(0)
 }
 
@@ -25,3 +30,23 @@ func (m *TransactionRepository) UpdateGatewayIDByTransactionID(ctx context.Conte
 	args := m.Called(ctx, transactionID, gatewayID)
 	return args.Error(0)
 }
+
+func (m *TransactionRepository) FailTransactionByReferenceID(ctx context.Context, referenceID string, reason string) error {
+	args := m.Called(ctx, referenceID, reason)
+	return args.Error(0)
+}
+
+func (m *TransactionRepository) GetTransactionByReferenceID(ctx context.Context, referenceID string) (models.Transaction, error) {
+	args := m.Called(ctx, referenceID)
+	return args.Get(0).(models.Transaction), args.Error(1)
+}
+
+func (m *TransactionRepository) SearchTransactions(ctx context.Context, filter models.TransactionFilter, afterID int, limit int) ([]models.Transaction, error) {
+	args := m.Called(ctx, filter, afterID, limit)
+
+	var r0 []models.Transaction
+	if args.Get(0) != nil {
+		r0 = args.Get(0).([]models.Transaction)
+	}
+	return r0, args.Error(1)
+}
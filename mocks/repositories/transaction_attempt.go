@@ -0,0 +1,46 @@
+package mocks
+
+import (
+	"context"
+	"payment-gateway/models"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTransactionAttemptRepository is a mock implementation of the TransactionAttemptRepository
+type MockTransactionAttemptRepository struct {
+	mock.Mock
+}
+
+// InsertAttempt provides a mock function for storing a transaction attempt
+func (m *MockTransactionAttemptRepository) InsertAttempt(ctx context.Context, attempt *models.TransactionAttempt) error {
+	args := m.Called(ctx, attempt)
+	return args.Error(0)
+}
+
+// GetAttemptsByReferenceID provides a mock function for fetching the attempts of a transaction
+func (m *MockTransactionAttemptRepository) GetAttemptsByReferenceID(ctx context.Context, referenceID string) ([]models.TransactionAttempt, error) {
+	args := m.Called(ctx, referenceID)
+
+	var r0 []models.TransactionAttempt
+	if args.Get(0) != nil {
+		r0 = args.Get(0).([]models.TransactionAttempt)
+	}
+	r1 := args.Error(1)
+
+	return r0, r1
+}
+
+// GetGatewayTrafficStats provides a mock function for summing up the attempts per gateway
+func (m *MockTransactionAttemptRepository) GetGatewayTrafficStats(ctx context.Context, since time.Time) ([]models.GatewayTrafficStats, error) {
+	args := m.Called(ctx, since)
+
+	var r0 []models.GatewayTrafficStats
+	if args.Get(0) != nil {
+		r0 = args.Get(0).([]models.GatewayTrafficStats)
+	}
+	r1 := args.Error(1)
+
+	return r0, r1
+}
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTransactionExpiryRepository is a mock implementation of the TransactionExpiryRepository
+type MockTransactionExpiryRepository struct {
+	mock.Mock
+}
+
+// GetStaleTransactions provides a mock function for fetching stale transactions
+func (m *MockTransactionExpiryRepository) GetStaleTransactions(ctx context.Context, now time.Time, fallback models.ExpiryPolicy, afterID int, limit int) ([]models.StaleTransaction, error) {
+	args := m.Called(ctx, now, fallback, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.StaleTransaction), args.Error(1)
+}
+
+// ExpireTransaction provides a mock function for expiring a stale transaction
+func (m *MockTransactionExpiryRepository) ExpireTransaction(ctx context.Context, transaction models.StaleTransaction, reason string) error {
+	args := m.Called(ctx, transaction, reason)
+	return args.Error(0)
+}
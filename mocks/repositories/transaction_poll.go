@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTransactionPollRepository is a mock implementation of the TransactionPollRepository
+type MockTransactionPollRepository struct {
+	mock.Mock
+}
+
+// ClaimDuePolls provides a mock function for claiming transactions to poll
+func (m *MockTransactionPollRepository) ClaimDuePolls(ctx context.Context, now time.Time, policy models.PollPolicy, gatewayNames []string, limit int) ([]models.Transaction, error) {
+	args := m.Called(ctx, now, policy, gatewayNames, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Transaction), args.Error(1)
+}
@@ -0,0 +1,36 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTransactionRetryRepository is a mock implementation of the TransactionRetryRepository
+type MockTransactionRetryRepository struct {
+	mock.Mock
+}
+
+// ClaimDueRetries provides a mock function for claiming transactions to retry
+func (m *MockTransactionRetryRepository) ClaimDueRetries(ctx context.Context, now time.Time, policy models.RetryPolicy, limit int) ([]models.Transaction, error) {
+	args := m.Called(ctx, now, policy, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Transaction), args.Error(1)
+}
+
+// RequeueTransaction provides a mock function for queuing a transaction again
+func (m *MockTransactionRetryRepository) RequeueTransaction(ctx context.Context, transaction *models.Transaction, topic string, now time.Time) error {
+	args := m.Called(ctx, transaction, topic, now)
+	return args.Error(0)
+}
+
+// FailExhaustedRetries provides a mock function for failing transactions that used up their retries
+func (m *MockTransactionRetryRepository) FailExhaustedRetries(ctx context.Context, now time.Time, policy models.RetryPolicy, limit int) (int64, error) {
+	args := m.Called(ctx, now, policy, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,42 @@
+package mocks
+
+import (
+	"context"
+	"payment-gateway/models"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type GatewayService struct {
+	mock.Mock
+}
+
+func (m *GatewayService) GetGatewayHealthReport(ctx context.Context, gatewayID int) (models.GatewayHealthReport, error) {
+	args := m.Called(ctx, gatewayID)
+	return args.Get(0).(models.GatewayHealthReport), args.Error(1)
+}
+
+func (m *GatewayService) CreateMaintenanceWindow(ctx context.Context, gatewayID int, request models.GatewayMaintenanceWindowRequest) (models.GatewayMaintenanceWindow, error) {
+	args := m.Called(ctx, gatewayID, request)
+	return args.Get(0).(models.GatewayMaintenanceWindow), args.Error(1)
+}
+
+func (m *GatewayService) GetMaintenanceWindows(ctx context.Context, gatewayID int) ([]models.GatewayMaintenanceWindow, error) {
+	args := m.Called(ctx, gatewayID)
+
+	var r0 []models.GatewayMaintenanceWindow
+	if args.Get(0) != nil {
+		r0 = args.Get(0).([]models.GatewayMaintenanceWindow)
+	}
+	return r0, args.Error(1)
+}
+
+func (m *GatewayService) CancelMaintenanceWindow(ctx context.Context, gatewayID int, windowID int) (models.GatewayMaintenanceWindow, error) {
+	args := m.Called(ctx, gatewayID, windowID)
+	return args.Get(0).(models.GatewayMaintenanceWindow), args.Error(1)
+}
+
+func (m *GatewayService) SetGatewayMaintenance(ctx context.Context, gatewayID int, inMaintenance bool, reason string) (models.GatewayHealth, error) {
+	args := m.Called(ctx, gatewayID, inMaintenance, reason)
+	return args.Get(0).(models.GatewayHealth), args.Error(1)
+}
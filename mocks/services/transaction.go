@@ -11,13 +11,13 @@ type TransactionService struct {
 	mock.Mock
 }
 
-func (m *TransactionService) Deposit(ctx context.Context, request models.DepositRequest) (models.Transaction, error) {
-	args := m.Called(ctx, request)
+func (m *TransactionService) Deposit(ctx context.Context, request models.DepositRequest, idempotencyKey string) (models.Transaction, error) {
+	args := m.Called(ctx, request, idempotencyKey)
 	return args.Get(0).(models.Transaction), args.Error(1)
 }
 
-func (m *TransactionService) Withdraw(ctx context.Context, request models.WithdrawalRequest) (models.Transaction, error) {
-	args := m.Called(ctx, request)
+func (m *TransactionService) Withdraw(ctx context.Context, request models.WithdrawalRequest, idempotencyKey string) (models.Transaction, error) {
+	args := m.Called(ctx, request, idempotencyKey)
 	return args.Get(0).(models.Transaction), args.Error(1)
 }
 
@@ -25,3 +25,23 @@ func (m *TransactionService) TransactionCallback(ctx context.Context, request *m
 	args := m.Called(ctx, request)
 	return args.Error(0)
 }
+
+func (m *TransactionService) GetTransactionAttempts(ctx context.Context, referenceID string) ([]models.TransactionAttempt, error) {
+	args := m.Called(ctx, referenceID)
+
+	var r0 []models.TransactionAttempt
+	if args.Get(0) != nil {
+		r0 = args.Get(0).([]models.TransactionAttempt)
+	}
+	return r0, args.Error(1)
+}
+
+func (m *TransactionService) GetTransaction(ctx context.Context, referenceID string) (models.Transaction, error) {
+	args := m.Called(ctx, referenceID)
+	return args.Get(0).(models.Transaction), args.Error(1)
+}
+
+func (m *TransactionService) SearchTransactions(ctx context.Context, filter models.TransactionFilter) (models.TransactionPage, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(models.TransactionPage), args.Error(1)
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type CircuitBreakerState struct {
+	GatewayID         int        `db:"gateway_id"`
+	State             string     `db:"state"` // closed, open, half_open
+	WindowStartedAt   time.Time  `db:"window_started_at"`
+	RequestCount      int        `db:"request_count"`
+	FailureCount      int        `db:"failure_count"`
+	OpenedAt          *time.Time `db:"opened_at"`
+	HalfOpenProbes    int        `db:"half_open_probes"`
+	HalfOpenSuccesses int        `db:"half_open_successes"`
+	ProbeAdmittedAt   *time.Time `db:"probe_admitted_at"` // when the last half-open probe was admitted
+	UpdatedAt         time.Time  `db:"updated_at"`
+}
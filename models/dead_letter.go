@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// DeadLetterMessage is a message read back from the dead-letter topic. Headers holds the headers
+// of the failed message together with the error and where the message came from.
+type DeadLetterMessage struct {
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Timestamp time.Time         `json:"timestamp"` // when the message was dead-lettered
+	Headers   map[string]string `json:"headers"`
+	Payload   string            `json:"payload"`
+}
+
+// ReplayResult counts what a replay did with the messages or transactions it selected
+type ReplayResult struct {
+	Selected int `json:"selected"`
+	Replayed int `json:"replayed"` // in a dry run, the ones that would have been replayed
+	Skipped  int `json:"skipped"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ExpiryPolicy applies to transactions without a matching row in transaction_expiry_policies
+type ExpiryPolicy struct {
+	TTL      time.Duration // time in the same status after which the transaction is stale
+	ExpireTo string        // expired or failed
+}
+
+// StaleTransaction is a transaction that stayed in its status for longer than its expiry policy allows
+type StaleTransaction struct {
+	Transaction
+	TTLSeconds int    `json:"ttl_seconds" db:"ttl_seconds"`
+	ExpireTo   string `json:"expire_to" db:"expire_to"`
+}
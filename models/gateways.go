@@ -15,12 +15,114 @@ type GatewayDetail struct {
 	Currency            string    `db:"currency"`
 }
 
+// GatewayHealth is the health state of a gateway. HealthStatus is the worse of the verdict of its
+// health probes and the verdict of its live traffic.
+type GatewayHealth struct {
+	GatewayID             int        `json:"gateway_id" db:"id"`
+	HealthStatus          string     `json:"health_status" db:"health_status"`
+	HealthStatusReason    string     `json:"health_status_reason" db:"health_status_reason"`
+	HealthStatusChangedAt *time.Time `json:"health_status_changed_at" db:"health_status_changed_at"`
+	ProbeStatus           string     `json:"probe_status" db:"probe_status"`
+	ConsecutiveFailures   int        `json:"consecutive_failures" db:"consecutive_failures"`
+	ConsecutiveSuccesses  int        `json:"consecutive_successes" db:"consecutive_successes"`
+	LastCheckedAt         time.Time  `json:"last_checked_at" db:"last_checked_at"`
+	LastCheckLatencyMs    int64      `json:"last_check_latency_ms" db:"last_check_latency_ms"`
+	LastCheckError        string     `json:"last_check_error" db:"last_check_error"`
+	TrafficStatus         string     `json:"traffic_status" db:"traffic_status"` // healthy, degraded, unhealthy
+	TrafficStatusReason   string     `json:"traffic_status_reason" db:"traffic_status_reason"`
+	TrafficRequests       int        `json:"traffic_requests" db:"traffic_requests"`
+	TrafficSuccessRate    float64    `json:"traffic_success_rate" db:"traffic_success_rate"`
+	TrafficTimeoutRate    float64    `json:"traffic_timeout_rate" db:"traffic_timeout_rate"`
+	TrafficP95LatencyMs   int64      `json:"traffic_p95_latency_ms" db:"traffic_p95_latency_ms"`
+	TrafficScoredAt       *time.Time `json:"traffic_scored_at" db:"traffic_scored_at"`
+}
+
+// GatewayHealthEvent is a health probe result or a change of the health status of a gateway
+type GatewayHealthEvent struct {
+	ID             int       `json:"id" db:"id"`
+	GatewayID      int       `json:"gateway_id" db:"gateway_id"`
+	EventType      string    `json:"event_type" db:"event_type"`                     // probe, status_change
+	HealthStatus   string    `json:"health_status" db:"health_status"`               // health status of the gateway after the event
+	PreviousStatus *string   `json:"previous_status,omitempty" db:"previous_status"` // health status before a status change
+	ProbePassed    *bool     `json:"probe_passed,omitempty" db:"probe_passed"`       // outcome of a probe
+	LatencyMs      *int64    `json:"latency_ms,omitempty" db:"latency_ms"`           // latency of a probe
+	Reason         string    `json:"reason" db:"reason"`                             // why the probe failed or the status changed
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// GatewayHealthReport is the health of a gateway as shown to operators
+type GatewayHealthReport struct {
+	GatewayHealth
+	Name   string               `json:"name"`
+	Uptime GatewayUptime        `json:"uptime"`
+	Events []GatewayHealthEvent `json:"events"` // most recent first
+}
+
+// GatewayUptime is the percentage of time a gateway was healthy or degraded. Time in maintenance is
+// left out, a period spent in maintenance as a whole has no uptime.
+type GatewayUptime struct {
+	LastHour   *float64 `json:"1h"`
+	LastDay    *float64 `json:"24h"`
+	Last30Days *float64 `json:"30d"`
+}
+
+// GatewayMaintenanceWindow is a period announced by a provider in which its gateway is left out of routing
+type GatewayMaintenanceWindow struct {
+	ID          int        `json:"id" db:"id"`
+	GatewayID   int        `json:"gateway_id" db:"gateway_id"`
+	CountryID   *int       `json:"country_id" db:"country_id"` // nil applies to every country of the gateway
+	StartsAt    time.Time  `json:"starts_at" db:"starts_at"`
+	EndsAt      time.Time  `json:"ends_at" db:"ends_at"`
+	Reason      string     `json:"reason" db:"reason"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+type GatewayMaintenanceWindowRequest struct {
+	CountryID *int      `json:"country_id"` // leave out to take the gateway out of routing in every country
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Reason    string    `json:"reason"`
+}
+
+// GatewayMaintenanceRequest puts a gateway in maintenance or takes it out
+type GatewayMaintenanceRequest struct {
+	Reason string `json:"reason"`
+}
+
+// GatewayTrafficStats sums up the requests sent to a gateway since a point in time
+type GatewayTrafficStats struct {
+	GatewayID    int     `db:"gateway_id"`
+	Requests     int     `db:"requests"`
+	Successes    int     `db:"successes"` // requests the gateway answered, accepted or declined
+	Timeouts     int     `db:"timeouts"`
+	P95LatencyMs float64 `db:"p95_latency_ms"`
+}
+
 type GatewayConfig struct {
 	GatewayUrl        string
 	GatewayApiKey     string
 	GatewayPrivateKey string
 }
 
+// GatewayTransactionResponse is the body a gateway returns when a transaction is submitted or its status is queried
+type GatewayTransactionResponse struct {
+	Status     string `json:"status" xml:"Body>TransactionResponse>status"`
+	Reference  string `json:"reference" xml:"Body>TransactionResponse>reference"`
+	Message    string `json:"message" xml:"Body>TransactionResponse>message"`
+	ReasonCode string `json:"reason_code,omitempty" xml:"Body>TransactionResponse>reason_code,omitempty"`
+}
+
+// GatewayTransactionResult is the parsed outcome of sending a transaction to a gateway
+type GatewayTransactionResult struct {
+	Status           string // accepted, declined or error
+	GatewayReference string // Reference assigned by the gateway, if any
+	Message          string // Response message from the gateway
+	HTTPStatus       int    // HTTP status code returned by the gateway
+	ReasonCode       string // Why the gateway declined the transaction
+	RawResponse      string // Response body as received from the gateway
+}
+
 type GatewayCallback struct {
 	ReferenceID     string    `json:"reference_id"`     // Transaction reference ID
 	Status          string    `json:"status"`           // Transaction status
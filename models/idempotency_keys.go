@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// IdempotencyKey is the Idempotency-Key of a deposit or withdraw request together with the
+// response returned for it, so a replay of the request gets the same response
+type IdempotencyKey struct {
+	Key         string    `json:"key" db:"key"`
+	RequestHash string    `json:"request_hash" db:"request_hash"` // sha256 of the operation and request body
+	Response    string    `json:"response" db:"response"`         // empty while the request is being processed
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OutboxMessage is a Kafka message written in the same database transaction as the row it
+// announces. The outbox relay publishes it and marks it as sent.
+type OutboxMessage struct {
+	ID            int        `json:"id" db:"id"`
+	Topic         string     `json:"topic" db:"topic"`
+	Payload       string     `json:"payload" db:"payload"`
+	Attempts      int        `json:"attempts" db:"attempts"`               // failed publish attempts
+	LastError     string     `json:"last_error" db:"last_error"`           // error of the last failed attempt
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"` // not published again before this
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty" db:"sent_at"` // nil until the broker acknowledged it
+}
+
+// OutboxLag tells how far the outbox relay is behind
+type OutboxLag struct {
+	PendingMessages         int     `json:"pending_messages" db:"pending_messages"`
+	OldestPendingAgeSeconds float64 `json:"oldest_pending_age_seconds" db:"oldest_pending_age_seconds"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// PollPolicy decides when the gateway of a submitted transaction is asked for its status
+type PollPolicy struct {
+	Delay       time.Duration // time without a callback before the first poll
+	MinInterval time.Duration // pause after the first poll
+	MaxInterval time.Duration // upper bound of the doubling pause between polls
+}
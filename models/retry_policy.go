@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RetryPolicy decides when a transaction parked in retry is enqueued again and when it is given up on
+type RetryPolicy struct {
+	MaxRetries int           // enqueues before the transaction is failed
+	MaxAge     time.Duration // age of the transaction after which it is failed
+	MinBackoff time.Duration // delay before the first enqueue
+	MaxBackoff time.Duration // upper bound of the doubling delay between enqueues
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// TransactionAttempt is one request sent to a gateway for a transaction
+type TransactionAttempt struct {
+	ID            int       `json:"id" db:"id"`
+	TransactionID int       `json:"transaction_id" db:"transaction_id"`
+	GatewayID     int       `json:"gateway_id" db:"gateway_id"`
+	GatewayName   string    `json:"gateway_name" db:"gateway_name"`
+	AttemptNumber int       `json:"attempt_number" db:"attempt_number"`
+	Request       string    `json:"request" db:"request"`             // encrypted request body
+	Response      string    `json:"response" db:"response"`           // raw response body
+	HTTPStatus    int       `json:"http_status" db:"http_status"`     // 0 when no response was received
+	LatencyMs     int64     `json:"latency_ms" db:"latency_ms"`       // time between sending the request and reading the response
+	Status        string    `json:"status" db:"status"`               // accepted, declined, error
+	ErrorClass    string    `json:"error_class" db:"error_class"`     // retryable, unavailable, declined, internal
+	ErrorMessage  string    `json:"error_message" db:"error_message"` // error returned while sending, if any
+	TimedOut      bool      `json:"timed_out" db:"timed_out"`         // no answer in time, or a 504 from the gateway
+	StartedAt     time.Time `json:"started_at" db:"started_at"`
+	CompletedAt   time.Time `json:"completed_at" db:"completed_at"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
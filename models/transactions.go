@@ -7,17 +7,25 @@ import (
 )
 
 type Transaction struct {
-	ID          int       `json:"id" db:"id"`
-	ReferenceID uuid.UUID `json:"reference_id" db:"reference_id"`
-	Amount      float64   `json:"amount" db:"amount"`
-	Currency    string    `json:"currency"`
-	Type        string    `json:"type" db:"type"`     // deposit/withdrawal
-	Status      string    `json:"status" db:"status"` // pending, completed, failed
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
-	GatewayID   int       `json:"gateway_id" db:"gateway_id"`
-	CountryID   int       `json:"country_id" db:"country_id"`
-	UserID      int       `json:"user_id" db:"user_id"`
+	ID            int       `json:"id" db:"id"`
+	ReferenceID   uuid.UUID `json:"reference_id" db:"reference_id"`
+	Amount        float64   `json:"amount" db:"amount"`
+	Currency      string    `json:"currency"`
+	Type          string    `json:"type" db:"type"`     // deposit/withdrawal
+	Status        string    `json:"status" db:"status"` // see utils.ValidateTransition for the lifecycle
+	FailureReason string    `json:"failure_reason,omitempty" db:"failure_reason"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+	GatewayID     int       `json:"gateway_id" db:"gateway_id"`
+	CountryID     int       `json:"country_id" db:"country_id"`
+	UserID        int       `json:"user_id" db:"user_id"`
+}
+
+// TransactionMessage is the message sent to SendTransactionKafkaTopic. TriedGatewayIDs holds the
+// gateways that already failed to process the transaction, so a fallback does not pick them again.
+type TransactionMessage struct {
+	Transaction
+	TriedGatewayIDs []int `json:"tried_gateway_ids,omitempty"`
 }
 
 type SendTransactionRequest struct {
@@ -25,6 +33,8 @@ type SendTransactionRequest struct {
 	Amount      float64 `json:"amount"`
 	UserID      int     `json:"user_id"`
 	Currency    string  `json:"currency"`
+	// IdempotencyKey is only set for gateways that read the key from the payload instead of a header
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 type EncryptedTransactionRequest struct {
@@ -57,6 +67,7 @@ type DepositResponse struct {
 type BuildExternalTransaction struct {
 	Request     string
 	ContentType string
+	Headers     map[string]string // gateway specific headers, e.g. the idempotency key
 }
 
 type TransactionCallbackRequest struct {
@@ -65,3 +76,25 @@ type TransactionCallbackRequest struct {
 	Currency    string  `json:"currency" xml:"Body>TransactionCallbackRequest>currency"`
 	Status      string  `json:"status" xml:"Body>TransactionCallbackRequest>status"`
 }
+
+// TransactionFilter narrows down a transaction search. Zero values are not filtered on.
+type TransactionFilter struct {
+	UserID      int
+	Status      string
+	Type        string
+	GatewayID   int
+	CountryID   int
+	Currency    string
+	MinAmount   *float64
+	MaxAmount   *float64
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Cursor      string     // next_cursor of the previous page
+	Limit       int
+}
+
+// TransactionPage is one page of a transaction search, newest first
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"` // empty on the last page
+}
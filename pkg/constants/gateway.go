@@ -1,13 +1,22 @@
 package constants
 
 const (
-	GATEWAY_A = "A"
-	GATEWAY_B = "B"
-	GATEWAY_C = "C"
-
 	JSON = "json"
 	SOAP = "soap"
 
-	HEALTHY   = "healthy"
-	UNHEALTHY = "unhealthy"
+	HEALTHY     = "healthy"
+	DEGRADED    = "degraded"
+	UNHEALTHY   = "unhealthy"
+	MAINTENANCE = "maintenance"
+
+	HEALTH_EVENT_PROBE         = "probe"
+	HEALTH_EVENT_STATUS_CHANGE = "status_change"
+
+	ACCEPTED = "accepted"
+	DECLINED = "declined"
+	ERROR    = "error"
+
+	CIRCUIT_CLOSED    = "closed"
+	CIRCUIT_OPEN      = "open"
+	CIRCUIT_HALF_OPEN = "half_open"
 )
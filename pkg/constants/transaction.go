@@ -4,8 +4,21 @@ const (
 	DEPOSIT    = "deposit"
 	WITHDRAWAL = "withdrawal"
 
-	PENDING   = "pending"
-	COMPLETED = "completed"
-	FAILED    = "failed"
-	RETRY     = "retry"
+	PENDING    = "pending"
+	PROCESSING = "processing"
+	SUBMITTED  = "submitted"
+	IN_DOUBT   = "in_doubt"
+	COMPLETED  = "completed"
+	FAILED     = "failed"
+	REVERSED   = "reversed"
+	RETRY      = "retry"
+	EXPIRED    = "expired"
+
+	// reason codes stored with a failed transaction
+	REASON_DECLINED           = "declined"
+	REASON_INSUFFICIENT_FUNDS = "insufficient_funds"
+	REASON_INVALID_ACCOUNT    = "invalid_account"
+	REASON_GATEWAYS_EXHAUSTED = "gateways_exhausted"
+	REASON_RETRIES_EXHAUSTED  = "retries_exhausted"
+	REASON_EXPIRED            = "expired"
 )
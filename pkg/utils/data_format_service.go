@@ -5,6 +5,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"payment-gateway/models"
 	"payment-gateway/pkg/constants"
@@ -34,22 +35,49 @@ func DecodeRequest(r *http.Request, request interface{}) error {
 	return nil
 }
 
+// DecodeResponse decodes a gateway response body based on its content type
+func DecodeResponse(contentType string, body []byte, response interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %v", contentType, err)
+	}
+
+	switch mediaType {
+	case "application/json":
+		if err := json.Unmarshal(body, response); err != nil {
+			return fmt.Errorf("failed to decode JSON: %v", err)
+		}
+	case "text/xml", "application/xml", "application/soap+xml":
+		if err := xml.Unmarshal(body, response); err != nil {
+			return fmt.Errorf("failed to decode XML: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported content type: %s", contentType)
+	}
+
+	return nil
+}
+
 func BuildExternalTransactionRequest(dataFormatSupported, encryptedRequest string) (models.BuildExternalTransaction, error) {
 	switch dataFormatSupported {
 	case constants.JSON:
+		jsonData, err := json.Marshal(models.EncryptedTransactionRequest{EncryptedData: encryptedRequest})
+		if err != nil {
+			return models.BuildExternalTransaction{}, fmt.Errorf("failed to serialize request to JSON: %v", err)
+		}
+
 		return models.BuildExternalTransaction{
-			Request:     dataFormatSupported,
+			Request:     string(jsonData),
 			ContentType: "application/json",
 		}, nil
 
 	case constants.SOAP:
-		soapEnvelope := `
-			<?xml version="1.0" encoding="UTF-8"?>
-				<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
-					<soap:Body>
-						<Request>%s</Request>
-					</soap:Body>
-				</soap:Envelope>`
+		soapEnvelope := `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<Request>%s</Request>
+	</soap:Body>
+</soap:Envelope>`
 		formattedSOAP := fmt.Sprintf(soapEnvelope, encryptedRequest)
 
 		return models.BuildExternalTransaction{
@@ -1,20 +1,104 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"time"
 )
 
-// Retry operation with exponential backoff
-func RetryOperation(operation func() error, maxRetries int) error {
-	for i := 0; i < maxRetries; i++ {
-		if err := operation(); err == nil {
+type Backoff string
+
+const (
+	// BackoffExponential waits a random delay of up to InitialDelay doubled for every failed attempt (full jitter)
+	BackoffExponential Backoff = "exponential"
+	// BackoffDecorrelated waits a random delay between InitialDelay and three times the previous delay
+	BackoffDecorrelated Backoff = "decorrelated"
+)
+
+// ErrRetriesExhausted is wrapped in the error returned once a RetryPolicy gives up on an operation
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryPolicy retries a failing operation with a jittered backoff. A zero MaxAttempts or MaxElapsedTime
+// does not limit the retries, a zero MaxDelay does not cap the backoff.
+type RetryPolicy struct {
+	Name           string        // names the operation in logs and errors
+	MaxAttempts    int           // attempts including the first one
+	MaxElapsedTime time.Duration // no attempt starts later than this after the first one
+	InitialDelay   time.Duration
+	MaxDelay       time.Duration
+	Backoff        Backoff              // BackoffExponential when empty
+	Retryable      func(err error) bool // nil retries every error
+}
+
+// Do runs operation until it succeeds, fails with an error that is not retryable, or the policy gives up.
+// An error that is not retryable is returned as is. Otherwise the last error of the operation is returned
+// wrapped together with ErrRetriesExhausted, or with the context error when ctx is done while waiting.
+// The policy never waits after the last attempt.
+func (p RetryPolicy) Do(ctx context.Context, operation func() error) error {
+	startedAt := time.Now()
+	var delay time.Duration
+
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil {
 			return nil
-		} else {
-			log.Printf("Retry %d/%d failed: %v", i+1, maxRetries, err)
 		}
-		time.Sleep(time.Duration(1<<i) * time.Second) // Exponential backoff
+		if p.Retryable != nil && !p.Retryable(err) {
+			return err
+		}
+
+		delay = p.nextDelay(attempt, delay)
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return fmt.Errorf("%s: %w after %d attempt(s): %w", p.Name, ErrRetriesExhausted, attempt, err)
+		}
+		if p.MaxElapsedTime > 0 && time.Since(startedAt)+delay > p.MaxElapsedTime {
+			return fmt.Errorf("%s: %w after %d attempt(s) in %s: %w", p.Name, ErrRetriesExhausted, attempt, time.Since(startedAt), err)
+		}
+
+		log.Printf("%s attempt %d failed, retrying in %s: %v", p.Name, attempt, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s: %w after %d attempt(s): %w", p.Name, ctx.Err(), attempt, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// nextDelay returns the delay before the attempt after the given one
+func (p RetryPolicy) nextDelay(attempt int, previous time.Duration) time.Duration {
+	if p.InitialDelay <= 0 {
+		return 0
+	}
+
+	var delay time.Duration
+	switch p.Backoff {
+	case BackoffDecorrelated:
+		upper := max(3*previous, p.InitialDelay)
+		delay = p.InitialDelay + jitter(upper-p.InitialDelay)
+	default:
+		ceiling := p.InitialDelay << min(attempt-1, 30)
+		if ceiling <= 0 || (p.MaxDelay > 0 && ceiling > p.MaxDelay) {
+			ceiling = p.MaxDelay
+		}
+		delay = jitter(ceiling)
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// jitter returns a random duration in [0, d]
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
 	}
-	return fmt.Errorf("operation failed after %d attempts", maxRetries)
+	return time.Duration(rand.Int64N(int64(d) + 1))
 }
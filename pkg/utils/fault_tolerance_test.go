@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestUtils(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Utils Suite")
+}
+
+var _ = ginkgo.Describe("RetryPolicy", func() {
+	var (
+		ctx   context.Context
+		calls int
+	)
+
+	// failing returns an operation that fails with a different error on every call
+	failing := func() func() error {
+		return func() error {
+			calls++
+			return fmt.Errorf("attempt %d failed", calls)
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		ctx = context.Background()
+		calls = 0
+	})
+
+	ginkgo.Describe("nextDelay", func() {
+		ginkgo.It("should keep exponential delays within the backoff ceiling and MaxDelay", func() {
+			policy := RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+			var delay time.Duration
+			for attempt := 1; attempt <= 40; attempt++ {
+				delay = policy.nextDelay(attempt, delay)
+				gomega.Expect(delay).To(gomega.BeNumerically(">=", 0))
+				gomega.Expect(delay).To(gomega.BeNumerically("<=", policy.MaxDelay))
+				if attempt <= 3 {
+					gomega.Expect(delay).To(gomega.BeNumerically("<=", policy.InitialDelay<<(attempt-1)))
+				}
+			}
+		})
+
+		ginkgo.It("should keep decorrelated delays between InitialDelay and MaxDelay", func() {
+			policy := RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Backoff: BackoffDecorrelated}
+
+			var delay time.Duration
+			for attempt := 1; attempt <= 40; attempt++ {
+				delay = policy.nextDelay(attempt, delay)
+				gomega.Expect(delay).To(gomega.BeNumerically(">=", policy.InitialDelay))
+				gomega.Expect(delay).To(gomega.BeNumerically("<=", policy.MaxDelay))
+			}
+		})
+
+		ginkgo.It("should not wait without an InitialDelay", func() {
+			policy := RetryPolicy{MaxDelay: time.Second}
+
+			gomega.Expect(policy.nextDelay(5, time.Second)).To(gomega.BeZero())
+		})
+	})
+
+	ginkgo.Describe("Do", func() {
+		ginkgo.It("should return nil once the operation succeeds", func() {
+			policy := RetryPolicy{Name: "test", MaxAttempts: 3}
+
+			err := policy.Do(ctx, func() error {
+				calls++
+				if calls < 2 {
+					return errors.New("not yet")
+				}
+				return nil
+			})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(calls).To(gomega.Equal(2))
+		})
+
+		ginkgo.It("should wrap ErrRetriesExhausted and the last error once MaxAttempts is reached", func() {
+			policy := RetryPolicy{Name: "test", MaxAttempts: 3}
+
+			err := policy.Do(ctx, failing())
+
+			gomega.Expect(calls).To(gomega.Equal(3))
+			gomega.Expect(errors.Is(err, ErrRetriesExhausted)).To(gomega.BeTrue())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("attempt 3 failed"))
+			gomega.Expect(err.Error()).ShouldNot(gomega.ContainSubstring("attempt 2 failed"))
+		})
+
+		ginkgo.It("should keep the last error reachable with errors.Is", func() {
+			cause := errors.New("gateway down")
+			policy := RetryPolicy{Name: "test", MaxAttempts: 2}
+
+			err := policy.Do(ctx, func() error { return cause })
+
+			gomega.Expect(errors.Is(err, ErrRetriesExhausted)).To(gomega.BeTrue())
+			gomega.Expect(errors.Is(err, cause)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should stop at once on an error that is not retryable", func() {
+			permanent := errors.New("declined")
+			policy := RetryPolicy{
+				Name:        "test",
+				MaxAttempts: 5,
+				Retryable:   func(err error) bool { return !errors.Is(err, permanent) },
+			}
+
+			err := policy.Do(ctx, func() error {
+				calls++
+				return permanent
+			})
+
+			gomega.Expect(calls).To(gomega.Equal(1))
+			gomega.Expect(err).To(gomega.Equal(permanent))
+			gomega.Expect(errors.Is(err, ErrRetriesExhausted)).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("should stop retrying once the next attempt would start after MaxElapsedTime", func() {
+			policy := RetryPolicy{
+				Name:           "test",
+				MaxElapsedTime: 15 * time.Millisecond,
+				InitialDelay:   10 * time.Millisecond,
+				MaxDelay:       10 * time.Millisecond,
+				Backoff:        BackoffDecorrelated,
+			}
+
+			err := policy.Do(ctx, failing())
+
+			gomega.Expect(calls).To(gomega.Equal(2))
+			gomega.Expect(errors.Is(err, ErrRetriesExhausted)).To(gomega.BeTrue())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("attempt 2 failed"))
+		})
+
+		ginkgo.It("should return the context error when ctx is cancelled while waiting", func() {
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			policy := RetryPolicy{Name: "test", MaxAttempts: 5, InitialDelay: time.Hour, Backoff: BackoffDecorrelated}
+
+			err := policy.Do(cancelled, failing())
+
+			gomega.Expect(calls).To(gomega.Equal(1))
+			gomega.Expect(errors.Is(err, context.Canceled)).To(gomega.BeTrue())
+			gomega.Expect(errors.Is(err, ErrRetriesExhausted)).To(gomega.BeFalse())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("attempt 1 failed"))
+		})
+
+		ginkgo.It("should not wait after the last attempt", func() {
+			policy := RetryPolicy{Name: "test", MaxAttempts: 1, InitialDelay: time.Hour, Backoff: BackoffDecorrelated}
+
+			startedAt := time.Now()
+			err := policy.Do(ctx, failing())
+
+			gomega.Expect(calls).To(gomega.Equal(1))
+			gomega.Expect(errors.Is(err, ErrRetriesExhausted)).To(gomega.BeTrue())
+			gomega.Expect(time.Since(startedAt)).To(gomega.BeNumerically("<", time.Second))
+		})
+	})
+})
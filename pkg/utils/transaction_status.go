@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+
+	"payment-gateway/pkg/constants"
+)
+
+// transactionTransitions lists the statuses a transaction may move to from each status.
+// A callback may overtake the write of submitted, so processing and retry may complete directly.
+// An in-doubt transaction may have been executed by its gateway, so it is never processed again
+// directly: it moves to retry only once the gateway confirmed it has no record of it.
+var transactionTransitions = map[string][]string{
+	constants.PENDING:    {constants.PROCESSING, constants.RETRY, constants.FAILED, constants.EXPIRED},
+	constants.PROCESSING: {constants.SUBMITTED, constants.IN_DOUBT, constants.COMPLETED, constants.FAILED, constants.RETRY, constants.EXPIRED},
+	constants.SUBMITTED:  {constants.COMPLETED, constants.FAILED, constants.EXPIRED},
+	constants.IN_DOUBT:   {constants.SUBMITTED, constants.COMPLETED, constants.FAILED, constants.RETRY, constants.EXPIRED},
+	constants.RETRY:      {constants.PROCESSING, constants.COMPLETED, constants.FAILED, constants.EXPIRED},
+	constants.COMPLETED:  {constants.REVERSED},
+	constants.FAILED:     {},
+	constants.REVERSED:   {},
+	constants.EXPIRED:    {},
+}
+
+// TransitionError is returned when a transaction cannot move from its current status to the requested one
+type TransitionError struct {
+	ReferenceID string
+	From        string
+	To          string
+}
+
+func (e *TransitionError) Error() string {
+	if !IsTransactionStatus(e.To) {
+		return fmt.Sprintf("unknown transaction status %q for transaction %s", e.To, e.ReferenceID)
+	}
+	return fmt.Sprintf("transaction %s cannot move from %s to %s", e.ReferenceID, e.From, e.To)
+}
+
+// IsTransactionStatus reports whether status is part of the transaction lifecycle
+func IsTransactionStatus(status string) bool {
+	_, ok := transactionTransitions[status]
+	return ok
+}
+
+// ValidateTransition returns a *TransitionError unless the transaction may move from one status to the other.
+// Staying in the same status is always allowed.
+func ValidateTransition(referenceID, from, to string) error {
+	if IsTransactionStatus(to) && from == to {
+		return nil
+	}
+
+	for _, allowed := range transactionTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+
+	return &TransitionError{ReferenceID: referenceID, From: from, To: to}
+}
+
+// IsFinalStatus reports whether the outcome of a transaction in status is decided. A completed
+// transaction may still be reversed, but it is never processed again.
+func IsFinalStatus(status string) bool {
+	if status == constants.COMPLETED {
+		return true
+	}
+	next, ok := transactionTransitions[status]
+	return ok && len(next) == 0
+}